@@ -2,10 +2,8 @@ module github.com/GustavBW/bsc-multiplayer-backend
 
 go 1.23
 
-godebug (
-    gotypesalias=1
-)
+godebug gotypesalias=1
 
 require github.com/gorilla/websocket v1.5.3
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/middleware"
+)
+
+// Handles an admin request. Any params relevant to the audit log are to be added to params.
+//
+// Returns the status code and either the response (marshalled as JSON) or an error
+type adminAction func(r *http.Request, params map[string]string) (int, any, error)
+
+type adminReasonRequestDTO struct {
+	Reason string `json:"reason"`
+}
+
+type adminAnnouncementRequestDTO struct {
+	Message string `json:"message"`
+}
+
+type adminAcceptsNewLobbiesRequestDTO struct {
+	Accepts bool `json:"accepts"`
+}
+
+// Every route requires the admin token as "Authorization: Bearer <token>", and every request is written to the audit log
+func applyAdminAPI(mux *http.ServeMux, lobbyManager *internal.LobbyManager, adminToken string, auditLog *middleware.AuditLog) {
+	adminAPIRoot := "/admin"
+	route := func(pattern string, action string, handle adminAction) {
+		mux.HandleFunc(pattern, adminHandler(adminToken, auditLog, action, handle))
+	}
+
+	route("GET "+adminAPIRoot+"/lobbies", "ListLobbies", func(r *http.Request, params map[string]string) (int, any, error) {
+		lobbies := make([]LobbyStateResponseDTO, 0)
+		lobbyManager.Lobbies.Range(func(key internal.LobbyID, lobby *internal.Lobby) bool {
+			lobbies = append(lobbies, lobbyStateOf(lobby))
+			return true
+		})
+		return http.StatusOK, lobbies, nil
+	})
+
+	route("POST "+adminAPIRoot+"/lobbies/{lobbyID}/close", "ForceCloseLobby", func(r *http.Request, params map[string]string) (int, any, error) {
+		lobbyID, err := lobbyIDPathValue(r, params)
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		var body adminReasonRequestDTO
+		if err := decodeAdminBody(r, &body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		params["reason"] = body.Reason
+		return statusOfAdminError(lobbyManager.ForceCloseLobby(lobbyID, body.Reason))
+	})
+
+	route("POST "+adminAPIRoot+"/lobbies/{lobbyID}/clients/{clientID}/kick", "KickClient", func(r *http.Request, params map[string]string) (int, any, error) {
+		lobbyID, err := lobbyIDPathValue(r, params)
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		params["clientID"] = r.PathValue("clientID")
+		clientID, err := strconv.ParseUint(r.PathValue("clientID"), 10, 32)
+		if err != nil {
+			return http.StatusBadRequest, nil, errors.New("invalid clientID")
+		}
+		var body adminReasonRequestDTO
+		if err := decodeAdminBody(r, &body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		params["reason"] = body.Reason
+		return statusOfAdminError(lobbyManager.KickClient(lobbyID, uint32(clientID), body.Reason))
+	})
+
+	route("POST "+adminAPIRoot+"/announcements", "AnnounceToAll", func(r *http.Request, params map[string]string) (int, any, error) {
+		var body adminAnnouncementRequestDTO
+		if err := decodeAdminBody(r, &body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		if body.Message == "" {
+			return http.StatusBadRequest, nil, errors.New("message missing")
+		}
+		params["message"] = body.Message
+		reached, err := lobbyManager.AnnounceToAll(body.Message)
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		return http.StatusOK, map[string]int{"lobbiesReached": reached}, nil
+	})
+
+	route("POST "+adminAPIRoot+"/lobbies/{lobbyID}/announcements", "AnnounceToLobby", func(r *http.Request, params map[string]string) (int, any, error) {
+		lobbyID, err := lobbyIDPathValue(r, params)
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		var body adminAnnouncementRequestDTO
+		if err := decodeAdminBody(r, &body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		if body.Message == "" {
+			return http.StatusBadRequest, nil, errors.New("message missing")
+		}
+		params["message"] = body.Message
+		return statusOfAdminError(lobbyManager.AnnounceToLobby(lobbyID, body.Message))
+	})
+
+	route("POST "+adminAPIRoot+"/lobbies/{lobbyID}/release-activity-lock", "ReleaseActivityLock", func(r *http.Request, params map[string]string) (int, any, error) {
+		lobbyID, err := lobbyIDPathValue(r, params)
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		return statusOfAdminError(lobbyManager.ForceReleaseActivityLock(lobbyID))
+	})
+
+	route("PUT "+adminAPIRoot+"/accepts-new-lobbies", "SetAcceptsNewLobbies", func(r *http.Request, params map[string]string) (int, any, error) {
+		var body adminAcceptsNewLobbiesRequestDTO
+		if err := decodeAdminBody(r, &body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		params["accepts"] = strconv.FormatBool(body.Accepts)
+		if err := lobbyManager.SetAcceptsNewLobbies(body.Accepts); err != nil {
+			return statusOfAdminError(err)
+		}
+		return http.StatusOK, body, nil
+	})
+}
+
+func adminHandler(adminToken string, auditLog *middleware.AuditLog, action string, handle adminAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := middleware.AuditEntry{
+			RemoteAddr: r.RemoteAddr,
+			Action:     action,
+			Params:     map[string]string{},
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			entry.Status = http.StatusUnauthorized
+			entry.Error = "invalid admin token"
+			auditLog.Record(entry)
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			middleware.LogResultOfRequest(w, r, http.StatusUnauthorized)
+			return
+		}
+
+		status, response, err := handle(r, entry.Params)
+		entry.Status = status
+		if err != nil {
+			entry.Error = err.Error()
+			auditLog.Record(entry)
+			http.Error(w, err.Error(), status)
+			middleware.LogResultOfRequest(w, r, status)
+			return
+		}
+		auditLog.Record(entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		bytes, marshalErr := json.Marshal(response)
+		if marshalErr != nil {
+			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+			middleware.LogResultOfRequest(w, r, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(bytes)
+		middleware.LogResultOfRequest(w, r, status)
+	}
+}
+
+func lobbyIDPathValue(r *http.Request, params map[string]string) (internal.LobbyID, error) {
+	params["lobbyID"] = r.PathValue("lobbyID")
+	lobbyID, err := strconv.ParseUint(r.PathValue("lobbyID"), 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid lobbyID")
+	}
+	return internal.LobbyID(lobbyID), nil
+}
+
+// An empty body is allowed and leaves target untouched
+func decodeAdminBody(r *http.Request, target any) error {
+	if r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		return errors.New("invalid request body: " + err.Error())
+	}
+	return nil
+}
+
+func statusOfAdminError(err error) (int, any, error) {
+	switch {
+	case err == nil:
+		return http.StatusOK, map[string]bool{"ok": true}, nil
+	case errors.Is(err, internal.ErrLobbyNotFound), errors.Is(err, internal.ErrClientNotFound):
+		return http.StatusNotFound, nil, err
+	default:
+		return http.StatusConflict, nil, err
+	}
+}
+
+// Opens (or creates) the audit log file for appending
+func openAuditLog(path string) (*middleware.AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[admin] Writing audit log to %s", path)
+	return middleware.NewAuditLog(file), nil
+}
@@ -6,23 +6,26 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/GustavBW/bsc-multiplayer-backend/src/auth"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/metrics"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/middleware"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
 	"github.com/gorilla/websocket"
 )
 
-func applyPublicApi(mux *http.ServeMux, lobbyManager *internal.LobbyManager) error {
+func applyPublicApi(mux *http.ServeMux, lobbyManager *internal.LobbyManager, tokenSigner *auth.JoinTokenSigner) error {
 	//This one is the one that is upgraded to a websocket connection
 	mux.HandleFunc("/connect", func(w http.ResponseWriter, r *http.Request) {
-		webSocketConnectionRequestHandler(lobbyManager, w, r)
+		webSocketConnectionRequestHandler(lobbyManager, tokenSigner, w, r)
 	})
 
 	mux.HandleFunc("POST /create-lobby", func(w http.ResponseWriter, r *http.Request) {
-		createLobbyHandler(lobbyManager, w, r)
+		createLobbyHandler(lobbyManager, tokenSigner, w, r)
 	})
 
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
@@ -33,6 +36,9 @@ func applyPublicApi(mux *http.ServeMux, lobbyManager *internal.LobbyManager) err
 		gatherLobbyStateHandler(w, r, lobbyManager)
 	})
 
+	// Prometheus text format
+	mux.Handle("GET /metrics", metrics.Default.Handler(lobbyManager.UpdateMetrics))
+
 	return nil
 }
 
@@ -52,12 +58,27 @@ func gatherLobbyStateHandler(w http.ResponseWriter, r *http.Request, lobbyManage
 		return
 	}
 
+	var response = lobbyStateOf(lobby)
+
+	w.Header().Set("Content-Type", "application/json")
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		middleware.LogResultOfRequest(w, r, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+	middleware.LogResultOfRequest(w, r, http.StatusOK)
+}
+
+func lobbyStateOf(lobby *internal.Lobby) LobbyStateResponseDTO {
 	var clients = make([]ClientResponseDTO, 0, lobby.ClientCount())
 	lobby.Clients.Range(func(key internal.ClientID, value *internal.Client) bool {
 		clients = append(clients, ClientResponseDTO{
 			ID:   key,
 			IGN:  value.IGN,
-			Type: value.Type,
+			Type: value.Type(),
 			State: ClientStateResponseDTO{
 				LastKnownPosition: value.State.LastKnownPosition.Load(),
 				MSOfLastMessage:   value.State.MSOfLastMessage.Load(),
@@ -66,31 +87,25 @@ func gatherLobbyStateHandler(w http.ResponseWriter, r *http.Request, lobbyManage
 		return true
 	})
 
-	var response = LobbyStateResponseDTO{
+	return LobbyStateResponseDTO{
+		ID:       lobby.ID,
 		ColonyID: lobby.ColonyID,
+		OwnerID:  lobby.GetOwnerID(),
 		Closing:  lobby.Closing.Load(),
 		Phase:    internal.LobbyPhase(lobby.GetPhase()),
 		Encoding: lobby.Encoding,
 		Clients:  clients,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	bytes, err := json.Marshal(response)
-	if err != nil {
-		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-		middleware.LogResultOfRequest(w, r, http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes)
-	middleware.LogResultOfRequest(w, r, http.StatusOK)
 }
 
 func performHealthCheckHandler(w http.ResponseWriter, r *http.Request, lobbyManager *internal.LobbyManager) {
 	lobbyCount := lobbyManager.GetLobbyCount()
 	response := HealthCheckResponseDTO{
-		Status:     true,
-		LobbyCount: uint32(lobbyCount),
+		Status:          true,
+		LobbyCount:      uint32(lobbyCount),
+		ProtocolVersion: internal.PROTOCOL_VERSION,
+		SpecFingerprint: internal.ProtocolFingerprint(),
+		MainBackend:     lobbyManager.MainBackend().Status(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	bytes, err := json.Marshal(response)
@@ -104,25 +119,24 @@ func performHealthCheckHandler(w http.ResponseWriter, r *http.Request, lobbyMana
 	middleware.LogResultOfRequest(w, r, http.StatusOK)
 }
 
-func createLobbyHandler(lobbyManager *internal.LobbyManager, w http.ResponseWriter, r *http.Request) {
-	ownerID, ownerIDErr := getAsUint32(r, "ownerID")
-	colonyID, colonyIDErr := getAsUint32(r, "colonyID")
-	userSetEncodingStr := r.URL.Query().Get("encoding")
-	if ownerIDErr != nil {
-		//log.Println("[] Error parsing ownerID: ", ownerIDErr)
-		w.Header().Set("Default-Debug-Header", "Error in ownerID query param: "+ownerIDErr.Error())
-		http.Error(w, "Error in ownerID", http.StatusBadRequest)
-		middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
+func createLobbyHandler(lobbyManager *internal.LobbyManager, tokenSigner *auth.JoinTokenSigner, w http.ResponseWriter, r *http.Request) {
+	claims, tokenErr := verifyJoinToken(tokenSigner, r)
+	if tokenErr != nil {
+		w.Header().Set("Default-Debug-Header", "Error in join token: "+tokenErr.Error())
+		http.Error(w, "Invalid join token", http.StatusUnauthorized)
+		middleware.LogResultOfRequest(w, r, http.StatusUnauthorized)
 		return
 	}
-
-	if colonyIDErr != nil {
-		//log.Println("[] Error parsing colonyID: ", colonyIDErr)
-		w.Header().Set("Default-Debug-Header", "Error in colonyID query param: "+colonyIDErr.Error())
-		http.Error(w, "Error in colonyID", http.StatusBadRequest)
-		middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
+	// Only the owner of a colony may open a lobby for it
+	if claims.OwnerID != claims.PlayerID {
+		w.Header().Set("Default-Debug-Header", "Join token does not belong to the colony owner")
+		http.Error(w, "Only the colony owner may create a lobby", http.StatusForbidden)
+		middleware.LogResultOfRequest(w, r, http.StatusForbidden)
 		return
 	}
+	ownerID := claims.PlayerID
+	colonyID := claims.ColonyID
+	userSetEncodingStr := r.URL.Query().Get("encoding")
 
 	var userSetEncoding meta.MessageEncoding
 	switch userSetEncodingStr {
@@ -134,7 +148,19 @@ func createLobbyHandler(lobbyManager *internal.LobbyManager, w http.ResponseWrit
 		userSetEncoding = meta.MESSAGE_ENCODING_BINARY
 	}
 
-	lobby, err := lobbyManager.CreateLobby(uint32(ownerID), uint32(colonyID), userSetEncoding)
+	// Optional, falls back to OWNER_LEAVE_POLICY
+	var ownerLeavePolicy meta.OwnerLeavePolicy
+	if policyStr := r.URL.Query().Get("ownerLeavePolicy"); policyStr != "" {
+		var policyErr error
+		if ownerLeavePolicy, policyErr = meta.ParseOwnerLeavePolicy(policyStr); policyErr != nil {
+			w.Header().Set("Default-Debug-Header", "Error in ownerLeavePolicy query param: "+policyErr.Error())
+			http.Error(w, policyErr.Error(), http.StatusBadRequest)
+			middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+
+	lobby, err := lobbyManager.CreateLobby(ownerID, colonyID, userSetEncoding, ownerLeavePolicy)
 	if err != nil {
 		//log.Println("Error creating lobby: ", err)
 		w.Header().Set("Default-Debug-Header", "Error creating lobby: "+err.Error())
@@ -171,20 +197,35 @@ func getAsUint32(r *http.Request, key string) (uint32, error) {
 	return uint32(parsed), err
 }
 
-func webSocketConnectionRequestHandler(lobbyManager *internal.LobbyManager, w http.ResponseWriter, r *http.Request) {
+// Reads the join token from either the "token" query param (browsers cannot set headers on websocket upgrades)
+// or the Authorization header, and verifies it.
+func verifyJoinToken(tokenSigner *auth.JoinTokenSigner, r *http.Request) (*auth.JoinTokenClaims, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("join token missing")
+	}
+	return tokenSigner.Verify(token)
+}
+
+func webSocketConnectionRequestHandler(lobbyManager *internal.LobbyManager, tokenSigner *auth.JoinTokenSigner, w http.ResponseWriter, r *http.Request) {
 	lobbyID, lobbyIDErr := getAsInt(r, "lobbyID")
-	userID, userIDErr := getAsInt(r, "clientID")
-	IGN := r.URL.Query().Get("IGN")
-	colonyID, colonyIDErr := getAsUint32(r, "colonyID")
-	ownerID, ownerIDErr := getAsUint32(r, "ownerID")
-
-	if IGN == "" {
-		w.Header().Set("Default-Debug-Header", "IGN query param missing")
-		log.Println("IGN not provided")
-		http.Error(w, "IGN not provided", http.StatusBadRequest)
-		middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
+
+	claims, tokenErr := verifyJoinToken(tokenSigner, r)
+	if tokenErr != nil {
+		log.Printf("Error in join token: %s", tokenErr)
+		w.Header().Set("Default-Debug-Header", fmt.Sprintf("Error in join token: %s", tokenErr))
+		http.Error(w, "Invalid join token", http.StatusUnauthorized)
+		middleware.LogResultOfRequest(w, r, http.StatusUnauthorized)
 		return
 	}
+	// The verified claims replace what used to be given as query params
+	userID := claims.PlayerID
+	IGN := claims.IGN
+	colonyID := claims.ColonyID
+	ownerID := claims.OwnerID
 
 	if lobbyIDErr != nil {
 		log.Printf("Error in lobbyID: %s", lobbyIDErr)
@@ -194,47 +235,43 @@ func webSocketConnectionRequestHandler(lobbyManager *internal.LobbyManager, w ht
 		return
 	}
 
-	if userIDErr != nil {
-		log.Printf("Error in userID: %s", userIDErr.Error())
-		w.Header().Set("Default-Debug-Header", fmt.Sprintf("Error in clientID: %s", userIDErr))
-		http.Error(w, fmt.Sprintf("Error in clientID: %s", userIDErr.Error()), http.StatusBadRequest)
-		middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
-		return
+	// Optional, falls back to the encoding of the lobby. A resumed session keeps its encoding
+	var clientEncoding meta.MessageEncoding
+	if encodingStr := r.URL.Query().Get("encoding"); encodingStr != "" {
+		var encodingErr error
+		if clientEncoding, encodingErr = meta.ParseMessageEncoding(encodingStr); encodingErr != nil {
+			w.Header().Set("Default-Debug-Header", "Error in encoding query param: "+encodingErr.Error())
+			http.Error(w, encodingErr.Error(), http.StatusBadRequest)
+			middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
+			return
+		}
 	}
 
-	if colonyIDErr != nil {
-		log.Printf("Error in colonyID: %s", colonyIDErr)
-		w.Header().Set("Default-Debug-Header", fmt.Sprintf("Error in colonyID: %s", colonyIDErr))
-		http.Error(w, fmt.Sprintf("Error in colonyID: %s", colonyIDErr.Error()), http.StatusBadRequest)
-		middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
-		return
+	// Optional, as declared by the generated EventSpecifications of the client
+	handshake := internal.ProtocolHandshake{Fingerprint: r.URL.Query().Get("specFingerprint")}
+	if r.URL.Query().Get("protocolVersion") != "" {
+		version, versionErr := getAsUint32(r, "protocolVersion")
+		if versionErr != nil {
+			w.Header().Set("Default-Debug-Header", "Error in protocolVersion query param: "+versionErr.Error())
+			http.Error(w, versionErr.Error(), http.StatusBadRequest)
+			middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
+			return
+		}
+		handshake.Version = version
 	}
 
-	if ownerIDErr != nil {
-		log.Printf("Error in ownerID: %s", ownerIDErr)
-		w.Header().Set("Default-Debug-Header", fmt.Sprintf("Error in ownerID: %s", ownerIDErr))
-		http.Error(w, fmt.Sprintf("Error in ownerID: %s", ownerIDErr.Error()), http.StatusBadRequest)
-		middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
-		return
+	// Given when the client attempts to resume its session after a dropped connection
+	resumeToken := r.URL.Query().Get("resumeToken")
+	// The protocol is checked first, as an incompatible client may misunderstand whatever comes after
+	preflightErr := lobbyManager.CheckProtocol(uint32(lobbyID), handshake)
+	if preflightErr == nil && resumeToken != "" {
+		preflightErr = lobbyManager.IsResumePossible(uint32(lobbyID), userID, resumeToken)
+	} else if preflightErr == nil {
+		preflightErr = lobbyManager.IsJoinPossible(uint32(lobbyID), userID, colonyID, ownerID)
 	}
-
-	if err := lobbyManager.IsJoinPossible(uint32(lobbyID), uint32(userID), colonyID, ownerID); err != nil {
-		log.Printf("Failed to join lobby: %v", err)
-		w.Header().Set("Default-Debug-Header", err.Error())
-		switch err.Type {
-		case internal.JoinErrorNotFound:
-			http.Error(w, "Lobby not found", http.StatusNotFound)
-			middleware.LogResultOfRequest(w, r, http.StatusNotFound)
-			return
-		case internal.JoinErrorAlreadyInLobby:
-			http.Error(w, "User already in lobby", http.StatusConflict)
-			middleware.LogResultOfRequest(w, r, http.StatusConflict)
-			return
-		case internal.JoinErrorClosing:
-			http.Error(w, "Lobby is closing", http.StatusGone)
-			middleware.LogResultOfRequest(w, r, http.StatusGone)
-			return
-		}
+	if preflightErr != nil {
+		respondWithJoinError(w, r, preflightErr)
+		return
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -245,12 +282,22 @@ func webSocketConnectionRequestHandler(lobbyManager *internal.LobbyManager, w ht
 		return
 	}
 
-	if joinError := lobbyManager.JoinLobby(uint32(lobbyID), uint32(userID), IGN, conn); joinError != nil {
-		//Send as debug message over WS instead
-		msg := internal.DEBUG_EVENT.CopyIDBytes()
-		msg = append(msg, util.BytesOfUint32(500)...)
-		msg = append(msg, []byte(joinError.Error())...)
-		conn.WriteMessage(websocket.TextMessage, util.EncodeBase16(msg))
+	var joinError *internal.LobbyJoinError
+	if resumeToken != "" {
+		joinError = lobbyManager.ResumeSession(uint32(lobbyID), userID, resumeToken, conn)
+	} else {
+		joinError = lobbyManager.JoinLobby(uint32(lobbyID), userID, IGN, clientEncoding, handshake, conn)
+	}
+	if joinError != nil {
+		// Send as debug message over WS instead. A failed join never creates a client, so nothing else writes to the connection.
+		// A failed resume may have attached it to the client, whose writer may then be using it, so nothing is written
+		if resumeToken == "" {
+			msg := append([]byte{}, internal.SERVER_ID_BYTES...)
+			msg = append(msg, internal.DEBUG_EVENT.CopyIDBytes()...)
+			msg = append(msg, util.BytesOfUint32(500)...)
+			msg = append(msg, []byte(joinError.Error())...)
+			conn.WriteMessage(websocket.TextMessage, util.EncodeBase16(msg))
+		}
 		if err := conn.Close(); err != nil {
 			log.Printf("Failed to close connection: %v", err)
 		}
@@ -262,3 +309,31 @@ func webSocketConnectionRequestHandler(lobbyManager *internal.LobbyManager, w ht
 	}
 	middleware.LogResultOfRequest(w, r, http.StatusOK)
 }
+
+func respondWithJoinError(w http.ResponseWriter, r *http.Request, err *internal.LobbyJoinError) {
+	log.Printf("Failed to join lobby: %v", err)
+	w.Header().Set("Default-Debug-Header", err.Error())
+	switch err.Type {
+	case internal.JoinErrorNotFound:
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		middleware.LogResultOfRequest(w, r, http.StatusNotFound)
+	case internal.JoinErrorAlreadyInLobby:
+		http.Error(w, "User already in lobby", http.StatusConflict)
+		middleware.LogResultOfRequest(w, r, http.StatusConflict)
+	case internal.JoinErrorClosing:
+		http.Error(w, "Lobby is closing", http.StatusGone)
+		middleware.LogResultOfRequest(w, r, http.StatusGone)
+	case internal.JoinErrorColonyMismatch:
+		http.Error(w, "Join token is not valid for this lobby", http.StatusForbidden)
+		middleware.LogResultOfRequest(w, r, http.StatusForbidden)
+	case internal.JoinErrorSessionNotResumable:
+		http.Error(w, "No resumable session found", http.StatusGone)
+		middleware.LogResultOfRequest(w, r, http.StatusGone)
+	case internal.JoinErrorProtocolMismatch:
+		http.Error(w, err.Reason+". Regenerate the event specifications of the client", http.StatusUpgradeRequired)
+		middleware.LogResultOfRequest(w, r, http.StatusUpgradeRequired)
+	default:
+		http.Error(w, "Unable to join lobby", http.StatusBadRequest)
+		middleware.LogResultOfRequest(w, r, http.StatusBadRequest)
+	}
+}
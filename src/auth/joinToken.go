@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims carried by a join token. Minted by the main backend (or the dev signing tool)
+// and verified before any lobby is created or joined.
+//
+// Follows the JWT claim conventions, so "exp" and "iat" are seconds since epoch.
+type JoinTokenClaims struct {
+	PlayerID uint32 `json:"playerID"`
+	ColonyID uint32 `json:"colonyID"`
+	// ID of the owner of the colony. The player itself if it is the owner
+	OwnerID   uint32 `json:"ownerID"`
+	IGN       string `json:"ign"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+type joinTokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+var (
+	ErrTokenMalformed        = errors.New("join token is malformed")
+	ErrTokenInvalidSignature = errors.New("join token signature is invalid")
+	ErrTokenExpired          = errors.New("join token has expired")
+	ErrTokenNotYetValid      = errors.New("join token is not valid yet")
+	ErrTokenUnsupported      = errors.New("join token uses an unsupported algorithm")
+	ErrTokenMissingClaims    = errors.New("join token is missing required claims")
+)
+
+// Allowed difference between the clock of the issuer and this service
+const CLOCK_SKEW_LEEWAY = 5 * time.Second
+
+var tokenEncoding = base64.RawURLEncoding
+var encodedHeader = mustEncodeSegment(joinTokenHeader{Algorithm: "HS256", Type: "JWT"})
+
+// Signs and verifies HS256 (HMAC-SHA256) JWT's carrying JoinTokenClaims
+type JoinTokenSigner struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func NewJoinTokenSigner(secret []byte) (*JoinTokenSigner, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("join token secret must not be empty")
+	}
+	return &JoinTokenSigner{
+		secret: secret,
+		now:    time.Now,
+	}, nil
+}
+
+// Mints a new token valid for the duration given
+func (s *JoinTokenSigner) Sign(claims JoinTokenClaims, validFor time.Duration) (string, error) {
+	issuedAt := s.now()
+	claims.IssuedAt = issuedAt.Unix()
+	claims.ExpiresAt = issuedAt.Add(validFor).Unix()
+
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling claims: %s", err.Error())
+	}
+	signingInput := encodedHeader + "." + tokenEncoding.EncodeToString(claimsBytes)
+	return signingInput + "." + s.signature(signingInput), nil
+}
+
+// Verifies signature, algorithm and expiry of the token and returns the claims if all is well
+func (s *JoinTokenSigner) Verify(token string) (*JoinTokenClaims, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	headerBytes, err := tokenEncoding.DecodeString(segments[0])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var header joinTokenHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if header.Algorithm != "HS256" {
+		return nil, ErrTokenUnsupported
+	}
+
+	expectedSignature := s.signature(segments[0] + "." + segments[1])
+	if !hmac.Equal([]byte(expectedSignature), []byte(segments[2])) {
+		return nil, ErrTokenInvalidSignature
+	}
+
+	claims, err := decodeClaims(segments[1])
+	if err != nil {
+		return nil, err
+	}
+	if claims.PlayerID == 0 || claims.ColonyID == 0 || claims.IGN == "" || claims.ExpiresAt == 0 {
+		return nil, ErrTokenMissingClaims
+	}
+
+	now := s.now()
+	if now.Add(-CLOCK_SKEW_LEEWAY).Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	if claims.IssuedAt != 0 && now.Add(CLOCK_SKEW_LEEWAY).Unix() < claims.IssuedAt {
+		return nil, ErrTokenNotYetValid
+	}
+
+	return claims, nil
+}
+
+// Reads the claims of a token without verifying it, for clients holding a token but not the secret it is signed with.
+// Never authorize anything based on the result
+func ReadClaimsUnverified(token string) (*JoinTokenClaims, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	return decodeClaims(segments[1])
+}
+
+func decodeClaims(segment string) (*JoinTokenClaims, error) {
+	claimsBytes, err := tokenEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var claims JoinTokenClaims
+	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	return &claims, nil
+}
+
+func (s *JoinTokenSigner) signature(signingInput string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(signingInput))
+	return tokenEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func mustEncodeSegment(v any) string {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return tokenEncoding.EncodeToString(bytes)
+}
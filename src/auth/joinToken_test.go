@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testClaims = JoinTokenClaims{
+	PlayerID: 42,
+	ColonyID: 7,
+	OwnerID:  42,
+	IGN:      "Hello",
+}
+
+func newTestSigner(t *testing.T, secret string, now time.Time) *JoinTokenSigner {
+	signer, err := NewJoinTokenSigner([]byte(secret))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	signer.now = func() time.Time { return now }
+	return signer
+}
+
+func TestJoinTokenRoundTrip(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := newTestSigner(t, "secret", now)
+
+	token, err := signer.Sign(testClaims, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if claims.PlayerID != 42 || claims.ColonyID != 7 || claims.OwnerID != 42 || claims.IGN != "Hello" {
+		t.Errorf("Claims do not match. Got: %+v", claims)
+	}
+	if claims.ExpiresAt != now.Add(time.Minute).Unix() {
+		t.Errorf("Expected exp %d, got %d", now.Add(time.Minute).Unix(), claims.ExpiresAt)
+	}
+}
+
+func TestJoinTokenRejections(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := newTestSigner(t, "secret", now)
+	validToken, _ := signer.Sign(testClaims, time.Minute)
+	expiredToken, _ := signer.Sign(testClaims, -time.Minute)
+	otherSignerToken, _ := newTestSigner(t, "other secret", now).Sign(testClaims, time.Minute)
+	missingIGNToken, _ := signer.Sign(JoinTokenClaims{PlayerID: 1, ColonyID: 1}, time.Minute)
+
+	segments := strings.Split(validToken, ".")
+	noneAlgHeader := mustEncodeSegment(joinTokenHeader{Algorithm: "none", Type: "JWT"})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"empty", "", ErrTokenMalformed},
+		{"two segments", segments[0] + "." + segments[1], ErrTokenMalformed},
+		{"tampered claims", segments[0] + "." + mustEncodeSegment(JoinTokenClaims{PlayerID: 1, ColonyID: 7, IGN: "x", ExpiresAt: now.Unix() + 60}) + "." + segments[2], ErrTokenInvalidSignature},
+		{"wrong secret", otherSignerToken, ErrTokenInvalidSignature},
+		{"alg none", noneAlgHeader + "." + segments[1] + ".", ErrTokenUnsupported},
+		{"expired", expiredToken, ErrTokenExpired},
+		{"missing claims", missingIGNToken, ErrTokenMissingClaims},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := signer.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestJoinTokenClockSkew(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	issuer := newTestSigner(t, "secret", now.Add(3*time.Second))
+	token, _ := issuer.Sign(testClaims, time.Minute)
+
+	verifier := newTestSigner(t, "secret", now)
+	if _, err := verifier.Verify(token); err != nil {
+		t.Errorf("Expected token issued within leeway to be accepted, got %v", err)
+	}
+
+	farFutureIssuer := newTestSigner(t, "secret", now.Add(time.Hour))
+	futureToken, _ := farFutureIssuer.Sign(testClaims, time.Minute)
+	if _, err := verifier.Verify(futureToken); !errors.Is(err, ErrTokenNotYetValid) {
+		t.Errorf("Expected ErrTokenNotYetValid, got %v", err)
+	}
+}
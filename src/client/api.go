@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+// Returned when the service refuses a request, fx. a join rejected before the websocket upgrade
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Value of the Default-Debug-Header, if any
+	Debug string
+}
+
+func (e *APIError) Error() string {
+	if e.Debug != "" {
+		return fmt.Sprintf("status %d: %s (%s)", e.StatusCode, e.Message, e.Debug)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+func apiErrorOf(response *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	return &APIError{
+		StatusCode: response.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		Debug:      response.Header.Get("Default-Debug-Header"),
+	}
+}
+
+type CreateLobbyOptions struct {
+	// Defaults to binary
+	Encoding meta.MessageEncoding
+	// Defaults to the OWNER_LEAVE_POLICY of the service
+	OwnerLeavePolicy meta.OwnerLeavePolicy
+	// Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type createLobbyResponse struct {
+	ID uint32 `json:"id"`
+}
+
+// Opens a lobby for the colony of the token, which must be held by the colony owner. Returns the id of the lobby
+func CreateLobby(ctx context.Context, baseURL string, token string, options CreateLobbyOptions) (uint32, error) {
+	endpoint, err := endpointURL(baseURL, "/create-lobby")
+	if err != nil {
+		return 0, err
+	}
+	query := url.Values{"token": {token}}
+	if options.Encoding != "" {
+		query.Set("encoding", string(options.Encoding))
+	}
+	if options.OwnerLeavePolicy != "" {
+		query.Set("ownerLeavePolicy", string(options.OwnerLeavePolicy))
+	}
+	endpoint.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("error creating lobby: %s", err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, apiErrorOf(response)
+	}
+	var created createLobbyResponse
+	if err := json.NewDecoder(response.Body).Decode(&created); err != nil {
+		return 0, fmt.Errorf("error parsing create lobby response: %s", err.Error())
+	}
+	return created.ID, nil
+}
+
+// Resolves the path against the base url of the service, fx. http://localhost:9062
+func endpointURL(baseURL string, path string) (*url.URL, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url %s: %s", baseURL, err.Error())
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base url %s: expected scheme and host", baseURL)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + path
+	return parsed, nil
+}
+
+// The websocket counterpart of the base url
+func websocketURL(baseURL string, path string, query url.Values) (string, error) {
+	endpoint, err := endpointURL(baseURL, path)
+	if err != nil {
+		return "", err
+	}
+	switch endpoint.Scheme {
+	case "http", "ws":
+		endpoint.Scheme = "ws"
+	case "https", "wss":
+		endpoint.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported scheme %s, expected http(s) or ws(s)", endpoint.Scheme)
+	}
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+func formatUint32(value uint32) string {
+	return strconv.FormatUint(uint64(value), 10)
+}
@@ -0,0 +1,318 @@
+// Package client connects to the multiplayer backend as a player would, for bots, load tests and integration tests.
+//
+// Messages are (de)serialized by the same event specifications the service uses:
+//
+//	c := client.New(client.Options{})
+//	client.On(c, internal.PLAYER_JOINED_EVENT, func(dto *internal.PlayerJoinedMessageDTO) { ... })
+//	err := c.Connect(ctx, "http://localhost:9062", lobbyID, token)
+//	err = client.Send(c, internal.PLAYER_MOVE_EVENT, internal.PlayerMoveMessageDTO{...})
+//
+// The API is typed on the specifications and DTOs of src/internal, which Go won't let code outside this module import.
+// So the client is for use within this repository only, fx. by --tools and the tests.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/auth"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+	"github.com/gorilla/websocket"
+)
+
+// A DEBUG_EVENT received from the service, fx. when a message sent was rejected
+type DebugError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *DebugError) Error() string {
+	return fmt.Sprintf("debug event %d: %s", e.Code, e.Message)
+}
+
+// A message as received, header split off
+type Message struct {
+	SenderID internal.ClientID
+	EventID  internal.MessageID
+	// The message without the header
+	Body []byte
+}
+
+type Options struct {
+	// Encoding of the messages in both directions. Defaults to binary
+	Encoding meta.MessageEncoding
+	// Defaults to websocket.DefaultDialer
+	Dialer *websocket.Dialer
+	// Called with every debug event received as a *DebugError, and messages that couldn't be decoded.
+	// Logged if not set
+	OnError func(err error)
+}
+
+// A connection to a lobby. Handlers are called one at a time, in the order the messages arrive
+type Client struct {
+	ID       internal.ClientID
+	LobbyID  uint32
+	Encoding meta.MessageEncoding
+	// Set on connecting, and whenever ownership moves to or from the client
+	isOwner atomic.Bool
+
+	dialer    *websocket.Dialer
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	onError   func(err error)
+
+	handlersLock sync.RWMutex
+	handlers     map[internal.MessageID][]func(message Message) error
+	anyHandlers  []func(message Message)
+
+	done    chan struct{}
+	readErr error
+}
+
+// Handlers are to be registered before connecting, so no message is missed
+func New(options Options) *Client {
+	client := &Client{
+		Encoding: options.Encoding,
+		dialer:   options.Dialer,
+		onError:  options.OnError,
+		handlers: make(map[internal.MessageID][]func(message Message) error),
+		done:     make(chan struct{}),
+	}
+	if client.Encoding == "" {
+		client.Encoding = meta.MESSAGE_ENCODING_BINARY
+	}
+	if client.dialer == nil {
+		client.dialer = websocket.DefaultDialer
+	}
+	if client.onError == nil {
+		client.onError = func(err error) {
+			log.Printf("[client] %d in lobby %d: %s", client.ID, client.LobbyID, err.Error())
+		}
+	}
+	// Registered first, so the handlers of the user see the origin as it is after the change
+	On(client, internal.OWNER_CHANGED_EVENT, func(dto *internal.OwnerChangedMessageDTO) {
+		switch client.ID {
+		case dto.PlayerID:
+			client.isOwner.Store(true)
+		case dto.PreviousOwnerID:
+			client.isOwner.Store(false)
+		}
+	})
+	return client
+}
+
+// Owner or guest, as the service sees the client. Follows OWNER_CHANGED_EVENT
+func (c *Client) Origin() internal.OriginType {
+	if c.isOwner.Load() {
+		return internal.ORIGIN_TYPE_OWNER
+	}
+	return internal.ORIGIN_TYPE_GUEST
+}
+
+// Joins the lobby with the join token given. The client id and origin are read from the token.
+// Rejections before the websocket upgrade are returned as *APIError
+func (c *Client) Connect(ctx context.Context, baseURL string, lobbyID uint32, token string) error {
+	if c.conn != nil {
+		return fmt.Errorf("client already connected to lobby %d", c.LobbyID)
+	}
+	if err := internal.InitEventSpecifications(); err != nil {
+		return err
+	}
+	claims, err := auth.ReadClaimsUnverified(token)
+	if err != nil {
+		return err
+	}
+	query := url.Values{
+		"lobbyID":         {formatUint32(lobbyID)},
+		"token":           {token},
+		"encoding":        {string(c.Encoding)},
+		"protocolVersion": {formatUint32(internal.PROTOCOL_VERSION)},
+		"specFingerprint": {internal.ProtocolFingerprint()},
+	}
+	endpoint, err := websocketURL(baseURL, "/connect", query)
+	if err != nil {
+		return err
+	}
+
+	conn, response, err := c.dialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		if response != nil && response.StatusCode != 0 {
+			defer response.Body.Close()
+			return apiErrorOf(response)
+		}
+		return fmt.Errorf("error connecting to lobby %d: %s", lobbyID, err.Error())
+	}
+
+	c.ID = claims.PlayerID
+	c.LobbyID = lobbyID
+	c.isOwner.Store(claims.OwnerID == claims.PlayerID)
+	c.conn = conn
+	go c.readLoop()
+	return nil
+}
+
+// Shorthand for New and Connect, for when no message before the first handler is registered matters
+func Connect(ctx context.Context, baseURL string, lobbyID uint32, token string, options Options) (*Client, error) {
+	client := New(options)
+	if err := client.Connect(ctx, baseURL, lobbyID, token); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Calls the handler with every message of the event received.
+// Called on the goroutine reading messages, so it should not block for long
+func On[T any](c *Client, spec *internal.EventSpecification[T], handler func(dto *T)) {
+	c.addHandler(spec.ID, func(message Message) error {
+		dto, err := internal.Deserialize(spec, message.Body, true)
+		if err != nil {
+			return fmt.Errorf("error deserializing %s from %d: %s", spec.Name, message.SenderID, err.Error())
+		}
+		handler(dto)
+		return nil
+	})
+}
+
+// Like On, but with the sender of the message
+func OnFrom[T any](c *Client, spec *internal.EventSpecification[T], handler func(senderID internal.ClientID, dto *T)) {
+	c.addHandler(spec.ID, func(message Message) error {
+		dto, err := internal.Deserialize(spec, message.Body, true)
+		if err != nil {
+			return fmt.Errorf("error deserializing %s from %d: %s", spec.Name, message.SenderID, err.Error())
+		}
+		handler(message.SenderID, dto)
+		return nil
+	})
+}
+
+// Calls the handler with every message received, before any handler of the event
+func (c *Client) OnAny(handler func(message Message)) {
+	c.handlersLock.Lock()
+	defer c.handlersLock.Unlock()
+	c.anyHandlers = append(c.anyHandlers, handler)
+}
+
+func (c *Client) addHandler(id internal.MessageID, handler func(message Message) error) {
+	c.handlersLock.Lock()
+	defer c.handlersLock.Unlock()
+	c.handlers[id] = append(c.handlers[id], handler)
+}
+
+// Serializes the DTO and sends it with the id of the client as sender.
+// Fails without sending if the spec doesn't permit the client to send it
+func Send[T any](c *Client, spec *internal.EventSpecification[T], dto T) error {
+	origin := c.Origin()
+	if !spec.SendPermissions[origin] {
+		return fmt.Errorf("%s may not send %s", origin, spec.Name)
+	}
+	serialized, err := internal.Serialize(spec, dto)
+	if err != nil {
+		return fmt.Errorf("error serializing %s: %s", spec.Name, err.Error())
+	}
+	return c.SendRaw(serialized)
+}
+
+// Sends a message already serialized (event id included), prepending the id of the client
+func (c *Client) SendRaw(message []byte) error {
+	if c.conn == nil {
+		return fmt.Errorf("client not connected")
+	}
+	withSender := append(util.BytesOfUint32(c.ID), message...)
+	messageType, encoded := internal.EncodeOutbound(c.Encoding, withSender)
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.conn.WriteMessage(messageType, encoded)
+}
+
+// Closed once the connection is, by either side. Never before connecting
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Why the connection closed, nil if it closed normally. Only set once Done is closed
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.readErr
+	default:
+		return nil
+	}
+}
+
+// Leaves the lobby and waits for the connection to close
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	c.writeLock.Lock()
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	writeErr := c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
+	c.writeLock.Unlock()
+
+	closeErr := c.conn.Close()
+	<-c.done
+	if writeErr != nil && !errors.Is(writeErr, websocket.ErrCloseSent) {
+		return writeErr
+	}
+	return closeErr
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, net.ErrClosed) {
+				c.readErr = err
+			}
+			return
+		}
+		if err := c.dispatch(messageType, data); err != nil {
+			c.onError(err)
+		}
+	}
+}
+
+func (c *Client) dispatch(messageType int, data []byte) error {
+	decoded, err := internal.DecodeInbound(c.Encoding, messageType, data)
+	if err != nil {
+		return fmt.Errorf("error decoding message: %s", err.Error())
+	}
+	senderID, eventID, body, err := internal.SplitMessageHeader(decoded)
+	if err != nil {
+		return err
+	}
+	message := Message{SenderID: senderID, EventID: eventID, Body: body}
+
+	c.handlersLock.RLock()
+	anyHandlers := c.anyHandlers
+	handlers := c.handlers[eventID]
+	c.handlersLock.RUnlock()
+
+	for _, handler := range anyHandlers {
+		handler(message)
+	}
+	if eventID == internal.DEBUG_EVENT.ID {
+		debug, err := internal.Deserialize(internal.DEBUG_EVENT, body, true)
+		if err != nil {
+			return fmt.Errorf("error deserializing debug event: %s", err.Error())
+		}
+		c.onError(&DebugError{Code: debug.Code, Message: debug.Message})
+	}
+	var handlerErrs []error
+	for _, handler := range handlers {
+		if err := handler(message); err != nil {
+			handlerErrs = append(handlerErrs, err)
+		}
+	}
+	return errors.Join(handlerErrs...)
+}
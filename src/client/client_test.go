@@ -0,0 +1,197 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/auth"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+	"github.com/gorilla/websocket"
+)
+
+const testServerID internal.ClientID = 4041587326
+
+func newTestToken(t *testing.T, playerID uint32, ownerID uint32) string {
+	signer, err := auth.NewJoinTokenSigner([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	token, err := signer.Sign(auth.JoinTokenClaims{PlayerID: playerID, ColonyID: 7, OwnerID: ownerID, IGN: "Bot"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return token
+}
+
+// Stands in for /connect, sending the messages given as the server would and passing on what the client sends
+func newTestServer(t *testing.T, send [][]byte, received chan<- []byte) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/connect" {
+			http.Error(w, "Lobby not found", http.StatusNotFound)
+			return
+		}
+		for _, param := range []string{"lobbyID", "token", "protocolVersion", "specFingerprint"} {
+			if r.URL.Query().Get(param) == "" {
+				t.Errorf("Expected query param %s to be set", param)
+			}
+		}
+		encoding := meta.MessageEncoding(r.URL.Query().Get("encoding"))
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Unexpected error upgrading: %v", err)
+			return
+		}
+		defer conn.Close()
+		for _, message := range send {
+			withSender := append(util.BytesOfUint32(testServerID), message...)
+			if err := conn.WriteMessage(internal.EncodeOutbound(encoding, withSender)); err != nil {
+				t.Errorf("Unexpected error writing: %v", err)
+				return
+			}
+		}
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			decoded, err := internal.DecodeInbound(encoding, messageType, data)
+			if err != nil {
+				t.Errorf("Unexpected error decoding: %v", err)
+				return
+			}
+			received <- decoded
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func mustSerialize[T any](t *testing.T, spec *internal.EventSpecification[T], dto T) []byte {
+	serialized, err := internal.Serialize(spec, dto)
+	if err != nil {
+		t.Fatalf("Unexpected error serializing %s: %v", spec.Name, err)
+	}
+	return serialized
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	for _, encoding := range []meta.MessageEncoding{meta.MESSAGE_ENCODING_BINARY, meta.MESSAGE_ENCODING_BASE16, meta.MESSAGE_ENCODING_BASE64} {
+		t.Run(string(encoding), func(t *testing.T) {
+			received := make(chan []byte, 1)
+			server := newTestServer(t, [][]byte{
+				mustSerialize(t, internal.DEBUG_EVENT, internal.DebugEventMessageDTO{Code: 400, Message: "Bad message"}),
+				mustSerialize(t, internal.PLAYER_JOINED_EVENT, internal.PlayerJoinedMessageDTO{PlayerID: 2, IGN: "Other"}),
+			}, received)
+
+			errs := make(chan error, 1)
+			c := New(Options{
+				Encoding: encoding,
+				OnError:  func(err error) { errs <- err },
+			})
+			joined := make(chan *internal.PlayerJoinedMessageDTO, 1)
+			On(c, internal.PLAYER_JOINED_EVENT, func(dto *internal.PlayerJoinedMessageDTO) {
+				joined <- dto
+			})
+			if err := c.Connect(context.Background(), server.URL, 1, newTestToken(t, 1, 1)); err != nil {
+				t.Fatalf("Unexpected error connecting: %v", err)
+			}
+
+			var debugErr *DebugError
+			if err := <-errs; !errors.As(err, &debugErr) || debugErr.Code != 400 || debugErr.Message != "Bad message" {
+				t.Errorf("Expected debug event as DebugError, got %v", err)
+			}
+			select {
+			case dto := <-joined:
+				if dto.PlayerID != 2 || dto.IGN != "Other" {
+					t.Errorf("Expected player 2 'Other' to join, got %+v", dto)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected PlayerJoined handler to be called")
+			}
+
+			if err := Send(c, internal.ENTER_LOCATION_EVENT, internal.EnterLocationMessageDTO{ID: 3}); err != nil {
+				t.Fatalf("Unexpected error sending: %v", err)
+			}
+			message := <-received
+			senderID, spec, body, err := internal.ExtractMessageHeader(message)
+			if err != nil {
+				t.Fatalf("Unexpected error reading header: %v", err)
+			}
+			if senderID != 1 || spec.ID != internal.ENTER_LOCATION_EVENT.ID {
+				t.Errorf("Expected EnterLocation from 1, got %s from %d", spec.Name, senderID)
+			}
+			if dto, err := internal.Deserialize(internal.ENTER_LOCATION_EVENT, body, true); err != nil || dto.ID != 3 {
+				t.Errorf("Expected location 3, got %+v (%v)", dto, err)
+			}
+
+			if err := c.Close(); err != nil {
+				t.Errorf("Unexpected error closing: %v", err)
+			}
+		})
+	}
+}
+
+func TestSendChecksPermissions(t *testing.T) {
+	server := newTestServer(t, nil, make(chan []byte, 1))
+	guest, err := Connect(context.Background(), server.URL, 1, newTestToken(t, 2, 1), Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error connecting: %v", err)
+	}
+	defer guest.Close()
+
+	if origin := guest.Origin(); origin != internal.ORIGIN_TYPE_GUEST {
+		t.Errorf("Expected origin guest, got %s", origin)
+	}
+	if err := Send(guest, internal.ENTER_LOCATION_EVENT, internal.EnterLocationMessageDTO{ID: 3}); err == nil {
+		t.Error("Expected guest to be refused sending EnterLocation")
+	}
+	if err := Send(guest, internal.PLAYER_JOINED_EVENT, internal.PlayerJoinedMessageDTO{}); err == nil {
+		t.Error("Expected guest to be refused sending the server only PlayerJoined")
+	}
+}
+
+func TestConnectReturnsAPIError(t *testing.T) {
+	server := newTestServer(t, nil, nil)
+	_, err := Connect(context.Background(), server.URL+"/not-the-service", 1, newTestToken(t, 1, 1), Options{})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Lobby not found" {
+		t.Errorf("Expected APIError with status 404, got %v", err)
+	}
+}
+
+func TestOwnerChangedUpdatesOrigin(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := newTestServer(t, [][]byte{
+		mustSerialize(t, internal.OWNER_CHANGED_EVENT, internal.OwnerChangedMessageDTO{PlayerID: 2, PreviousOwnerID: 1, IGN: "Bot"}),
+	}, received)
+
+	guest := New(Options{})
+	promoted := make(chan internal.OriginType, 1)
+	On(guest, internal.OWNER_CHANGED_EVENT, func(dto *internal.OwnerChangedMessageDTO) {
+		promoted <- guest.Origin()
+	})
+	if err := guest.Connect(context.Background(), server.URL, 1, newTestToken(t, 2, 1)); err != nil {
+		t.Fatalf("Unexpected error connecting: %v", err)
+	}
+	defer guest.Close()
+
+	select {
+	case origin := <-promoted:
+		if origin != internal.ORIGIN_TYPE_OWNER {
+			t.Errorf("Expected origin owner once promoted, got %s", origin)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected OwnerChanged handler to be called")
+	}
+	if err := Send(guest, internal.ENTER_LOCATION_EVENT, internal.EnterLocationMessageDTO{ID: 3}); err != nil {
+		t.Errorf("Expected the new owner to be permitted sending EnterLocation, got %v", err)
+	}
+}
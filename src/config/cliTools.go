@@ -1,13 +1,31 @@
 package config
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/auth"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/client"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
 )
 
+// Returned by tools whose outcome is to be reported through the exit code, such as --diff-specs finding breaking changes
+type ToolExitError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ToolExitError) Error() string {
+	return fmt.Sprintf("%s (exit code %d)", e.Reason, e.Code)
+}
+
 func HandleToolRequest(args []string) error {
 	// Print the event specs
 	if len(args) == 0 {
@@ -19,6 +37,30 @@ func HandleToolRequest(args []string) error {
 			log.Println("[config] --print-event-specs flag found, printing event specs")
 			return handleEventSpecRequest(args[1:])
 		}
+		if arg == "--generate-go-codecs" {
+			log.Println("[config] --generate-go-codecs flag found, generating go codecs")
+			return handleGenerateGoCodecsRequest(args[1:])
+		}
+		if arg == "--generate-test-vectors" {
+			log.Println("[config] --generate-test-vectors flag found, generating test vectors")
+			return handleGenerateTestVectorsRequest(args[1:])
+		}
+		if arg == "--diff-specs" {
+			log.Println("[config] --diff-specs flag found, diffing event specs")
+			return handleDiffSpecsRequest(args[1:])
+		}
+		if arg == "--loadtest" {
+			log.Println("[config] --loadtest flag found, running load test")
+			return handleLoadTestRequest(args[1:])
+		}
+		if arg == "--client" {
+			log.Println("[config] --client flag found, starting terminal client")
+			return handleTerminalClientRequest(args[1:])
+		}
+		if arg == "--sign-join-token" {
+			log.Println("[config] --sign-join-token flag found, signing join token")
+			return handleSignJoinTokenRequest(args[1:])
+		}
 	}
 
 	return nil
@@ -62,3 +104,303 @@ func handleEventSpecRequest(args []string) error {
 
 	return nil
 }
+
+// The output path is relative to the root of the repository
+func handleGenerateGoCodecsRequest(args []string) error {
+	var outputPath = "./src/internal/codecs_generated.go"
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--output=") {
+			var err error
+			if outputPath, err = retrieveValueOfKVArg(arg); err != nil {
+				return err
+			}
+		}
+	}
+
+	var generated bytes.Buffer
+	if err := WriteGoCodecs(&generated, getOrderedEventSpecs()); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, generated.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing go codecs to %s: %s", outputPath, err.Error())
+	}
+	log.Printf("[config] Go codecs written to %s", outputPath)
+	return nil
+}
+
+func handleGenerateTestVectorsRequest(args []string) error {
+	var programVersion = GetOr("PROGRAM_VERSION", "UNKOWN")
+	var outputPath = "./TestVectors-v" + programVersion + ".json"
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--output=") {
+			var err error
+			if outputPath, err = retrieveValueOfKVArg(arg); err != nil {
+				return err
+			}
+		}
+	}
+
+	vectors, err := BuildTestVectors(getOrderedEventSpecs())
+	if err != nil {
+		return err
+	}
+	if mkDirErr := os.MkdirAll(filepath.Dir(outputPath), os.ModePerm); mkDirErr != nil {
+		return fmt.Errorf("error creating directory for output file: %s", mkDirErr.Error())
+	}
+	var encoded bytes.Buffer
+	if err := WriteTestVectors(&encoded, vectors); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, encoded.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing test vectors to %s: %s", outputPath, err.Error())
+	}
+	log.Printf("[config] %d test vectors written to %s", len(vectors.Vectors), outputPath)
+	return nil
+}
+
+// Compares --old=<json> with --new=<json>, or the current specs if not given. Exits with 1 on breaking changes
+func handleDiffSpecsRequest(args []string) error {
+	var oldPath, newPath string
+	var format = "text"
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") || !strings.Contains(arg, "=") {
+			continue
+		}
+		value, err := retrieveValueOfKVArg(arg)
+		if err != nil {
+			return err
+		}
+		switch arg[:strings.Index(arg, "=")] {
+		case "--old":
+			oldPath = value
+		case "--new":
+			newPath = value
+		case "--format":
+			format = value
+		}
+	}
+	if oldPath == "" {
+		return fmt.Errorf("--old=<path to previously exported json spec> is required")
+	}
+
+	oldSpecs, err := readJSONEventSpecs(oldPath)
+	if err != nil {
+		return err
+	}
+	newSpecs := toJSONEventSpecifications(getOrderedEventSpecs()).Events
+	if newPath != "" {
+		if newSpecs, err = readJSONEventSpecs(newPath); err != nil {
+			return err
+		}
+	}
+
+	diff := diffEventSpecs(oldSpecs, newSpecs)
+	switch format {
+	case "text":
+		err = WriteSpecDiffAsText(os.Stdout, diff)
+	case "json":
+		err = WriteSpecDiffAsJSON(os.Stdout, diff)
+	default:
+		return fmt.Errorf("invalid --format \"%s\", expected \"text|json\"", format)
+	}
+	if err != nil {
+		return err
+	}
+	if diff.Breaking {
+		return &ToolExitError{Code: 1, Reason: "breaking changes found"}
+	}
+	return nil
+}
+
+// Runs bots against --target=<url>, or the local service, and reports on stdout
+func handleLoadTestRequest(args []string) error {
+	var options = LoadTestOptions{
+		Target:          "http://localhost:" + GetOr("SERVICE_PORT", "9062"),
+		Lobbies:         10,
+		ClientsPerLobby: 4,
+		Duration:        30 * time.Second,
+		MoveInterval:    250 * time.Millisecond,
+		MinigamePause:   time.Second,
+		DifficultyID:    1,
+		Secret:          []byte(GetOr("JOIN_TOKEN_SECRET", "")),
+	}
+	var format = "text"
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") || !strings.Contains(arg, "=") {
+			continue
+		}
+		value, err := retrieveValueOfKVArg(arg)
+		if err != nil {
+			return err
+		}
+		switch arg[:strings.Index(arg, "=")] {
+		case "--target":
+			options.Target = value
+		case "--lobbies":
+			options.Lobbies, err = strconv.Atoi(value)
+		case "--clients":
+			options.ClientsPerLobby, err = strconv.Atoi(value)
+		case "--duration":
+			options.Duration, err = time.ParseDuration(value)
+		case "--ramp-up":
+			options.RampUp, err = time.ParseDuration(value)
+		case "--move-interval":
+			options.MoveInterval, err = time.ParseDuration(value)
+		case "--minigame-pause":
+			options.MinigamePause, err = time.ParseDuration(value)
+		case "--encoding":
+			options.Encoding, err = meta.ParseMessageEncoding(value)
+		case "--difficulty":
+			options.DifficultyID, err = parseUint32Arg(value)
+		case "--secret":
+			options.Secret = []byte(value)
+		case "--format":
+			format = value
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value in argument %s: %s", arg, err.Error())
+		}
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid --format \"%s\", expected \"text|json\"", format)
+	}
+
+	log.Printf("[config] Load testing %s with %d lobbies of %d clients for %s", options.Target, options.Lobbies, options.ClientsPerLobby, options.Duration)
+	report, err := RunLoadTest(context.Background(), options)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return WriteLoadTestReportAsJSON(os.Stdout, report)
+	}
+	return WriteLoadTestReportAsText(os.Stdout, report)
+}
+
+// Joins --lobby=<id> (or creates a lobby if not given) as --id=<player id>, with --token=<join token> or one signed like --sign-join-token does
+func handleTerminalClientRequest(args []string) error {
+	var options = TerminalClientOptions{URL: "http://localhost:" + GetOr("SERVICE_PORT", "9062")}
+	var claims auth.JoinTokenClaims
+	var secret = GetOr("JOIN_TOKEN_SECRET", "")
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") || !strings.Contains(arg, "=") {
+			continue
+		}
+		value, err := retrieveValueOfKVArg(arg)
+		if err != nil {
+			return err
+		}
+		switch arg[:strings.Index(arg, "=")] {
+		case "--url":
+			options.URL = value
+		case "--lobby":
+			options.LobbyID, err = parseUint32Arg(value)
+		case "--token":
+			options.Token = value
+		case "--encoding":
+			options.Encoding, err = meta.ParseMessageEncoding(value)
+		case "--id":
+			claims.PlayerID, err = parseUint32Arg(value)
+		case "--colonyID":
+			claims.ColonyID, err = parseUint32Arg(value)
+		case "--ownerID":
+			claims.OwnerID, err = parseUint32Arg(value)
+		case "--IGN":
+			claims.IGN = value
+		case "--secret":
+			secret = value
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value in argument %s: %s", arg, err.Error())
+		}
+	}
+
+	if options.Token == "" {
+		if claims.PlayerID == 0 {
+			return fmt.Errorf("--id=<player id> or --token=<join token> is required")
+		}
+		if claims.ColonyID == 0 {
+			claims.ColonyID = 1
+		}
+		if claims.OwnerID == 0 {
+			claims.OwnerID = claims.PlayerID
+		}
+		if claims.IGN == "" {
+			claims.IGN = fmt.Sprintf("client-%d", claims.PlayerID)
+		}
+		signer, err := auth.NewJoinTokenSigner([]byte(secret))
+		if err != nil {
+			return fmt.Errorf("no secret provided, use --secret=\"...\" or set JOIN_TOKEN_SECRET: %s", err.Error())
+		}
+		if options.Token, err = signer.Sign(claims, time.Hour); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	if options.LobbyID == 0 {
+		lobbyID, err := client.CreateLobby(ctx, options.URL, options.Token, client.CreateLobbyOptions{Encoding: options.Encoding})
+		if err != nil {
+			return fmt.Errorf("no --lobby given, and creating one failed: %s", err.Error())
+		}
+		options.LobbyID = lobbyID
+	}
+	return RunTerminalClient(ctx, os.Stdin, os.Stdout, options)
+}
+
+// Mints a join token for local development, so the service can be used without the main backend
+func handleSignJoinTokenRequest(args []string) error {
+	var claims auth.JoinTokenClaims
+	var validFor = 5 * time.Minute
+	var secret = GetOr("JOIN_TOKEN_SECRET", "")
+
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") || !strings.Contains(arg, "=") {
+			continue
+		}
+		value, err := retrieveValueOfKVArg(arg)
+		if err != nil {
+			return err
+		}
+		switch arg[:strings.Index(arg, "=")] {
+		case "--playerID":
+			claims.PlayerID, err = parseUint32Arg(value)
+		case "--colonyID":
+			claims.ColonyID, err = parseUint32Arg(value)
+		case "--ownerID":
+			claims.OwnerID, err = parseUint32Arg(value)
+		case "--IGN":
+			claims.IGN = value
+		case "--ttl":
+			validFor, err = time.ParseDuration(value)
+		case "--secret":
+			secret = value
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value in argument %s: %s", arg, err.Error())
+		}
+	}
+
+	if claims.PlayerID == 0 || claims.ColonyID == 0 || claims.IGN == "" {
+		return fmt.Errorf("--playerID, --colonyID and --IGN are required")
+	}
+	if claims.OwnerID == 0 {
+		// Default to the player owning the colony
+		claims.OwnerID = claims.PlayerID
+	}
+
+	signer, err := auth.NewJoinTokenSigner([]byte(secret))
+	if err != nil {
+		return fmt.Errorf("no secret provided, use --secret=\"...\" or set JOIN_TOKEN_SECRET: %s", err.Error())
+	}
+	token, err := signer.Sign(claims, validFor)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+func parseUint32Arg(value string) (uint32, error) {
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	return uint32(parsed), err
+}
@@ -3,13 +3,16 @@ package config
 //From BSC-Main-Backend repo
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
 	"github.com/joho/godotenv"
 )
@@ -46,6 +49,11 @@ func ParseArgsAndApplyENV() (*meta.RuntimeConfiguration, error) {
 			log.Println("[config] --tools flag found, executing tools on args: ", args[1:])
 			configuration.Mode = meta.RUNTIME_MODE_TOOL
 			if toolErr := HandleToolRequest(args[1:]); toolErr != nil {
+				var exitErr *ToolExitError
+				if errors.As(toolErr, &exitErr) {
+					log.Printf("[config] %s", exitErr.Reason)
+					os.Exit(exitErr.Code)
+				}
 				return nil, toolErr
 			}
 			log.Println("[config] --tools flag found and executed, closing process")
@@ -76,9 +84,98 @@ func ParseArgsAndApplyENV() (*meta.RuntimeConfiguration, error) {
 		}
 	}
 
+	if tuningErr := applyTuningFromENV(configuration); tuningErr != nil {
+		return nil, tuningErr
+	}
+
 	return configuration, nil
 }
 
+// Overwrites the defaults of the configuration with any values set in the environment
+func applyTuningFromENV(configuration *meta.RuntimeConfiguration) error {
+	var err error
+	if configuration.SessionResumeGracePeriod, err = GetDurationMSOr("SESSION_RESUME_GRACE_PERIOD_MS", configuration.SessionResumeGracePeriod); err != nil {
+		return err
+	}
+	if configuration.SessionResumeBufferSize, err = GetUint32Or("SESSION_RESUME_BUFFER_SIZE", configuration.SessionResumeBufferSize); err != nil {
+		return err
+	}
+	if configuration.ClientSendQueueSize, err = GetUint32Or("CLIENT_SEND_QUEUE_SIZE", configuration.ClientSendQueueSize); err != nil {
+		return err
+	}
+	if configuration.ClientWriteTimeout, err = GetDurationMSOr("CLIENT_WRITE_TIMEOUT_MS", configuration.ClientWriteTimeout); err != nil {
+		return err
+	}
+	switch policy := meta.SlowConsumerPolicy(GetOr("SLOW_CONSUMER_POLICY", string(configuration.SlowConsumerPolicy))); policy {
+	case meta.SLOW_CONSUMER_POLICY_DISCONNECT, meta.SLOW_CONSUMER_POLICY_DROP:
+		configuration.SlowConsumerPolicy = policy
+	default:
+		return fmt.Errorf("[config] Invalid SLOW_CONSUMER_POLICY \"%s\", expected \"disconnect|drop\"", policy)
+	}
+	if configuration.ClientPingInterval, err = GetDurationMSOr("CLIENT_PING_INTERVAL_MS", configuration.ClientPingInterval); err != nil {
+		return err
+	}
+	if configuration.ClientPongTimeout, err = GetDurationMSOr("CLIENT_PONG_TIMEOUT_MS", configuration.ClientPongTimeout); err != nil {
+		return err
+	}
+	if configuration.ClientIdleTimeout, err = GetDurationMSOr("CLIENT_IDLE_TIMEOUT_MS", configuration.ClientIdleTimeout); err != nil {
+		return err
+	}
+	if configuration.ClientPingInterval <= 0 || configuration.ClientPongTimeout <= configuration.ClientPingInterval {
+		return fmt.Errorf("[config] CLIENT_PONG_TIMEOUT_MS (%s) must be greater than CLIENT_PING_INTERVAL_MS (%s), which must be positive", configuration.ClientPongTimeout, configuration.ClientPingInterval)
+	}
+	if configuration.OwnerLeavePolicy, err = meta.ParseOwnerLeavePolicy(GetOr("OWNER_LEAVE_POLICY", string(configuration.OwnerLeavePolicy))); err != nil {
+		return fmt.Errorf("[config] OWNER_LEAVE_POLICY: %s", err.Error())
+	}
+	if configuration.AwaitingParticipantsTimeout, err = GetDurationMSOr("PHASE_AWAITING_PARTICIPANTS_TIMEOUT_MS", configuration.AwaitingParticipantsTimeout); err != nil {
+		return err
+	}
+	if configuration.PlayersDeclareIntentTimeout, err = GetDurationMSOr("PHASE_PLAYERS_DECLARE_INTENT_TIMEOUT_MS", configuration.PlayersDeclareIntentTimeout); err != nil {
+		return err
+	}
+	if configuration.LoadingMinigameTimeout, err = GetDurationMSOr("PHASE_LOADING_MINIGAME_TIMEOUT_MS", configuration.LoadingMinigameTimeout); err != nil {
+		return err
+	}
+	if configuration.LaggardPolicy, err = meta.ParseLaggardPolicy(GetOr("PHASE_LAGGARD_POLICY", string(configuration.LaggardPolicy))); err != nil {
+		return fmt.Errorf("[config] PHASE_LAGGARD_POLICY: %s", err.Error())
+	}
+	if configuration.ProtocolMismatchPolicy, err = meta.ParseProtocolMismatchPolicy(GetOr("PROTOCOL_MISMATCH_POLICY", string(configuration.ProtocolMismatchPolicy))); err != nil {
+		return fmt.Errorf("[config] PROTOCOL_MISMATCH_POLICY: %s", err.Error())
+	}
+	if configuration.MainBackendCallTimeout, err = GetDurationMSOr("MAIN_BACKEND_CALL_TIMEOUT_MS", configuration.MainBackendCallTimeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// The defaults overwritten by any values set in the environment
+func GetMainBackendOptions() (integrations.MainBackendOptions, error) {
+	options := integrations.DefaultMainBackendOptions()
+	var err error
+	if options.RequestTimeout, err = GetDurationMSOr("MAIN_BACKEND_REQUEST_TIMEOUT_MS", options.RequestTimeout); err != nil {
+		return options, err
+	}
+	if options.RequestTimeout <= 0 {
+		return options, fmt.Errorf("[config] MAIN_BACKEND_REQUEST_TIMEOUT_MS must be positive")
+	}
+	if options.MaxAttempts, err = GetUint32Or("MAIN_BACKEND_MAX_ATTEMPTS", options.MaxAttempts); err != nil {
+		return options, err
+	}
+	if options.InitialBackoff, err = GetDurationMSOr("MAIN_BACKEND_INITIAL_BACKOFF_MS", options.InitialBackoff); err != nil {
+		return options, err
+	}
+	if options.MaxBackoff, err = GetDurationMSOr("MAIN_BACKEND_MAX_BACKOFF_MS", options.MaxBackoff); err != nil {
+		return options, err
+	}
+	if options.BreakerFailureThreshold, err = GetUint32Or("MAIN_BACKEND_BREAKER_FAILURE_THRESHOLD", options.BreakerFailureThreshold); err != nil {
+		return options, err
+	}
+	if options.BreakerOpenDuration, err = GetDurationMSOr("MAIN_BACKEND_BREAKER_OPEN_MS", options.BreakerOpenDuration); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
 // Overwrites any env variables currently set in environment
 func LoadDevConfig() error {
 	return LoadCustomConfig("dev.env")
@@ -125,6 +222,32 @@ func GetInt(key string) (int, error) {
 	return strconv.Atoi(val)
 }
 
+// Returns the default value if the key isn't set, errors if it is set but isn't a whole number of milliseconds
+func GetDurationMSOr(key string, defaultValue time.Duration) (time.Duration, error) {
+	val, err := LoudGet(key)
+	if err != nil {
+		return defaultValue, nil
+	}
+	ms, parseErr := strconv.ParseUint(val, 10, 63)
+	if parseErr != nil {
+		return 0, fmt.Errorf("[config] Invalid value for %s, expected milliseconds: %s", key, parseErr.Error())
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Returns the default value if the key isn't set, errors if it is set but isn't a valid uint32
+func GetUint32Or(key string, defaultValue uint32) (uint32, error) {
+	val, err := LoudGet(key)
+	if err != nil {
+		return defaultValue, nil
+	}
+	parsed, parseErr := strconv.ParseUint(val, 10, 32)
+	if parseErr != nil {
+		return 0, fmt.Errorf("[config] Invalid value for %s: %s", key, parseErr.Error())
+	}
+	return uint32(parsed), nil
+}
+
 // Get func to get env value, will log on error but return the empty value
 // The value of the key will be trimmed/stripped/whitespace removed
 func Get(key string) string {
@@ -0,0 +1,474 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+const CSHARP_NAMESPACE = "MultiplayerBackend.Events"
+
+// Writes a C# file with the event ids, send permissions and DTOs of every spec given,
+// along with Serialize and Deserialize methods for the DTOs. Targets .NET Standard 2.0, so it works in Unity as well
+func WriteCSharpClient(writer io.Writer, specs []internal.EventSpecification[any]) error {
+	var source strings.Builder
+	source.WriteString("// <auto-generated>\n// !!! This content is generated by the multiplayer backend tool. Do not modify manually !!!\n// </auto-generated>\n")
+	source.WriteString("using System;\nusing System.Collections.Generic;\nusing System.Text;\n\n")
+	source.WriteString(fmt.Sprintf("namespace %s\n{\n", CSHARP_NAMESPACE))
+
+	source.WriteString("\tpublic static class Protocol\n\t{\n")
+	source.WriteString(fmt.Sprintf("\t\tpublic const uint Version = %d;\n", internal.PROTOCOL_VERSION))
+	source.WriteString(fmt.Sprintf("\t\tpublic const string SpecFingerprint = \"%s\";\n", internal.ProtocolFingerprint()))
+	source.WriteString("\t\t/// <summary>Every message starts with the sender ID and the event ID, both big endian uint32's</summary>\n")
+	source.WriteString(fmt.Sprintf("\t\tpublic const int HeaderSize = %d;\n", internal.MESSAGE_HEADER_SIZE))
+	source.WriteString("\t}\n\n")
+
+	source.WriteString("\tpublic static class EventIDs\n\t{\n")
+	for _, spec := range specs {
+		source.WriteString(formatCSharpSummary(spec.Comment, "\t\t"))
+		source.WriteString(fmt.Sprintf("\t\tpublic const uint %s = %d;\n", spec.Name, spec.ID))
+	}
+	source.WriteString("\t}\n\n")
+
+	source.WriteString("\tpublic readonly struct SendPermissions\n\t{\n")
+	source.WriteString("\t\tpublic readonly bool Server;\n\t\tpublic readonly bool Owner;\n\t\tpublic readonly bool Guest;\n\n")
+	source.WriteString("\t\tpublic SendPermissions(bool server, bool owner, bool guest)\n\t\t{\n")
+	source.WriteString("\t\t\tServer = server;\n\t\t\tOwner = owner;\n\t\t\tGuest = guest;\n\t\t}\n\t}\n\n")
+
+	source.WriteString("\tpublic static class EventSpecifications\n\t{\n")
+	source.WriteString("\t\tpublic static readonly IReadOnlyDictionary<uint, string> Names = new Dictionary<uint, string>\n\t\t{\n")
+	for _, spec := range specs {
+		source.WriteString(fmt.Sprintf("\t\t\t{ EventIDs.%s, \"%s\" },\n", spec.Name, spec.Name))
+	}
+	source.WriteString("\t\t};\n\n")
+	source.WriteString("\t\tpublic static readonly IReadOnlyDictionary<uint, SendPermissions> Permissions = new Dictionary<uint, SendPermissions>\n\t\t{\n")
+	for _, spec := range specs {
+		source.WriteString(fmt.Sprintf("\t\t\t{ EventIDs.%s, new SendPermissions(%t, %t, %t) },\n", spec.Name,
+			spec.SendPermissions[internal.ORIGIN_TYPE_SERVER], spec.SendPermissions[internal.ORIGIN_TYPE_OWNER], spec.SendPermissions[internal.ORIGIN_TYPE_GUEST]))
+	}
+	source.WriteString("\t\t};\n\n")
+	source.WriteString("\t\t/// <summary>Min size of the body of each event, header excluded</summary>\n")
+	source.WriteString("\t\tpublic static readonly IReadOnlyDictionary<uint, int> ExpectedMinSizes = new Dictionary<uint, int>\n\t\t{\n")
+	for _, spec := range specs {
+		source.WriteString(fmt.Sprintf("\t\t\t{ EventIDs.%s, %d },\n", spec.Name, spec.ExpectedMinSize))
+	}
+	source.WriteString("\t\t};\n\t}\n\n")
+
+	dtos, err := formatCSharpDTOs(specs)
+	if err != nil {
+		return err
+	}
+	source.WriteString(dtos)
+	source.WriteString(CSHARP_CLIENT_RUNTIME)
+	source.WriteString("}\n")
+
+	_, err = io.WriteString(writer, source.String())
+	return err
+}
+
+// Once per DTO type, as several events may share one
+func formatCSharpDTOs(specs []internal.EventSpecification[any]) (string, error) {
+	var namesByType = make(map[reflect.Type][]string)
+	var specByType = make(map[reflect.Type]internal.EventSpecification[any])
+	for _, spec := range specs {
+		if spec.DTOType == nil {
+			return "", fmt.Errorf("spec %s has no DTO type", spec.Name)
+		}
+		if _, seen := specByType[spec.DTOType]; !seen {
+			specByType[spec.DTOType] = spec
+		}
+		namesByType[spec.DTOType] = append(namesByType[spec.DTOType], spec.Name)
+	}
+	types := make([]reflect.Type, 0, len(specByType))
+	for t := range specByType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return goClientTypeName(types[i]) < goClientTypeName(types[j])
+	})
+
+	var result string
+	var nestedWritten = make(map[string]bool)
+	for _, t := range types {
+		spec := specByType[t]
+		class, err := formatCSharpClass(t, spec.Structure, "Body of "+strings.Join(namesByType[t], ", "), spec.ExpectedMinSize, true, nestedWritten)
+		if err != nil {
+			return "", fmt.Errorf("generating C# DTO for %s: %s", t.Name(), err.Error())
+		}
+		result += class
+	}
+	return result, nil
+}
+
+// Top level DTOs get Serialize and Deserialize methods, the elements of slices of structs are handled by their DTO.
+// Classes for such elements are written after the class using them
+func formatCSharpClass(t reflect.Type, structure internal.ComputedStructure, comment string, minSize uint32, topLevel bool, nestedWritten map[string]bool) (string, error) {
+	className := goClientTypeName(t)
+	var result = formatCSharpSummary(comment, "\t")
+	result += fmt.Sprintf("\tpublic sealed class %s\n\t{\n", className)
+	var nested string
+	for _, element := range structure {
+		field, err := goFieldOf(t, element.FieldName)
+		if err != nil {
+			return "", err
+		}
+		csType, err := csharpTypeOf(field.Type)
+		if err != nil {
+			return "", err
+		}
+		result += formatCSharpSummary(element.Description, "\t\t")
+		result += fmt.Sprintf("\t\tpublic %s %s%s;\n", csType, field.Name, csharpInitializerOf(csType))
+
+		if element.Kind == reflect.Slice && element.ElementKind == reflect.Struct && !nestedWritten[goClientTypeName(field.Type.Elem())] {
+			nestedWritten[goClientTypeName(field.Type.Elem())] = true
+			definition, err := formatCSharpClass(field.Type.Elem(), element.Elements, "Element of "+className+"."+field.Name, 0, false, nestedWritten)
+			if err != nil {
+				return "", err
+			}
+			nested += definition
+		}
+	}
+
+	if topLevel {
+		writes, err := formatCSharpWrites(t, structure, "this", "\t\t\t")
+		if err != nil {
+			return "", err
+		}
+		result += fmt.Sprintf("\n\t\tpublic byte[] Serialize()\n\t\t{\n\t\t\tvar w = new MessageWriter(%d);\n", minSize)
+		result += writes
+		result += "\t\t\treturn w.ToArray();\n\t\t}\n"
+
+		reads, err := formatCSharpReads(t, structure, "dto", "\t\t\t")
+		if err != nil {
+			return "", err
+		}
+		result += "\n\t\t/// <summary>Throws a FormatException if the body doesn't match the structure of the DTO</summary>\n"
+		result += fmt.Sprintf("\t\tpublic static %s Deserialize(byte[] body)\n\t\t{\n\t\t\tvar r = new MessageReader(body);\n", className)
+		result += fmt.Sprintf("\t\t\tvar dto = new %s();\n", className)
+		result += reads
+		result += "\t\t\treturn dto;\n\t\t}\n"
+	}
+	result += "\t}\n\n"
+	return result + nested, nil
+}
+
+func formatCSharpWrites(t reflect.Type, structure internal.ComputedStructure, receiver string, indent string) (string, error) {
+	var result string
+	for _, element := range structure {
+		field, err := goFieldOf(t, element.FieldName)
+		if err != nil {
+			return "", err
+		}
+		access := fmt.Sprintf("%s.%s", receiver, field.Name)
+
+		switch element.Kind {
+		case reflect.String:
+			result += fmt.Sprintf("%sw.String(%s, %s);\n", indent, access, csharpLengthPrefixOf(element.LengthPrefix))
+		case reflect.Slice:
+			result += fmt.Sprintf("%sw.Length(%s.Length, %s);\n", indent, access, csharpLengthPrefixOf(element.LengthPrefix))
+			result += fmt.Sprintf("%sforeach (var v in %s)\n%s{\n", indent, access, indent)
+			if element.ElementKind == reflect.Struct {
+				nested, err := formatCSharpWrites(field.Type.Elem(), element.Elements, "v", indent+"\t")
+				if err != nil {
+					return "", err
+				}
+				result += nested
+			} else {
+				method, err := csharpCodecMethodOf(element.ElementKind)
+				if err != nil {
+					return "", err
+				}
+				result += fmt.Sprintf("%s\tw.%s(v);\n", indent, method)
+			}
+			result += fmt.Sprintf("%s}\n", indent)
+		default:
+			method, err := csharpCodecMethodOf(element.Kind)
+			if err != nil {
+				return "", err
+			}
+			result += fmt.Sprintf("%sw.%s(%s);\n", indent, method, access)
+		}
+	}
+	return result, nil
+}
+
+func formatCSharpReads(t reflect.Type, structure internal.ComputedStructure, receiver string, indent string) (string, error) {
+	var result string
+	for _, element := range structure {
+		field, err := goFieldOf(t, element.FieldName)
+		if err != nil {
+			return "", err
+		}
+		access := fmt.Sprintf("%s.%s", receiver, field.Name)
+
+		switch element.Kind {
+		case reflect.String:
+			result += fmt.Sprintf("%s%s = r.String(%s);\n", indent, access, csharpLengthPrefixOf(element.LengthPrefix))
+		case reflect.Slice:
+			elementType, err := csharpTypeOf(field.Type.Elem())
+			if err != nil {
+				return "", err
+			}
+			elementSize := internal.MinimumSizeOf(element.Elements)
+			if element.ElementKind != reflect.Struct {
+				elementSize = util.SizeOfSerializedKind(element.ElementKind)
+			}
+			// Scoped, so that several slices can be read by the same method
+			result += fmt.Sprintf("%s{\n", indent)
+			result += fmt.Sprintf("%s\tvar length = r.Length(%s, %d);\n", indent, csharpLengthPrefixOf(element.LengthPrefix), elementSize)
+			result += fmt.Sprintf("%s\t%s = new %s[length];\n", indent, access, elementType)
+			result += fmt.Sprintf("%s\tfor (var i = 0; i < length; i++)\n%s\t{\n", indent, indent)
+			if element.ElementKind == reflect.Struct {
+				nested, err := formatCSharpReads(field.Type.Elem(), element.Elements, "element", indent+"\t\t")
+				if err != nil {
+					return "", err
+				}
+				result += fmt.Sprintf("%s\t\tvar element = new %s();\n", indent, elementType)
+				result += nested
+				result += fmt.Sprintf("%s\t\t%s[i] = element;\n", indent, access)
+			} else {
+				method, err := csharpCodecMethodOf(element.ElementKind)
+				if err != nil {
+					return "", err
+				}
+				result += fmt.Sprintf("%s\t\t%s[i] = r.%s();\n", indent, access, method)
+			}
+			result += fmt.Sprintf("%s\t}\n%s}\n", indent, indent)
+		default:
+			method, err := csharpCodecMethodOf(element.Kind)
+			if err != nil {
+				return "", err
+			}
+			result += fmt.Sprintf("%s%s = r.%s();\n", indent, access, method)
+		}
+	}
+	return result, nil
+}
+
+func csharpTypeOf(t reflect.Type) (string, error) {
+	switch t.Kind() {
+	case reflect.Uint8:
+		return "byte", nil
+	case reflect.Int8:
+		return "sbyte", nil
+	case reflect.Uint16:
+		return "ushort", nil
+	case reflect.Int16:
+		return "short", nil
+	case reflect.Uint32:
+		return "uint", nil
+	case reflect.Int32:
+		return "int", nil
+	case reflect.Uint64:
+		return "ulong", nil
+	case reflect.Int64:
+		return "long", nil
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Float64:
+		return "double", nil
+	case reflect.String:
+		return "string", nil
+	case reflect.Struct:
+		return goClientTypeName(t), nil
+	case reflect.Slice:
+		elementType, err := csharpTypeOf(t.Elem())
+		return elementType + "[]", err
+	default:
+		return "", fmt.Errorf("kind %s has no C# type", t.Kind())
+	}
+}
+
+// Strings and arrays are never null, so that a fresh DTO can be serialized as is
+func csharpInitializerOf(csType string) string {
+	switch {
+	case csType == "string":
+		return " = \"\""
+	case strings.HasSuffix(csType, "[]"):
+		return fmt.Sprintf(" = Array.Empty<%s>()", strings.TrimSuffix(csType, "[]"))
+	default:
+		return ""
+	}
+}
+
+func csharpLengthPrefixOf(prefix internal.LengthPrefix) string {
+	switch prefix {
+	case internal.LENGTH_PREFIX_U16:
+		return "LengthPrefix.U16"
+	case internal.LENGTH_PREFIX_U32:
+		return "LengthPrefix.U32"
+	default:
+		return "LengthPrefix.None"
+	}
+}
+
+// Fx. "U32", named after the codecWriter and codecReader methods of the server
+func csharpCodecMethodOf(kind reflect.Kind) (string, error) {
+	method, err := goCodecMethodOf(kind)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(method[:1]) + method[1:], nil
+}
+
+func formatCSharpSummary(comment string, indent string) string {
+	if comment == "" {
+		return ""
+	}
+	escaped := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\n", " ").Replace(comment)
+	return fmt.Sprintf("%s/// <summary>%s</summary>\n", indent, escaped)
+}
+
+// Framing and codec building blocks of the generated C# client, mirroring src/internal/codecs.go
+const CSHARP_CLIENT_RUNTIME = `	public static class Messages
+	{
+		/// <summary>Prepends the header to the body of a DTO</summary>
+		public static byte[] Encode(uint senderID, uint eventID, byte[] body)
+		{
+			var message = new byte[Protocol.HeaderSize + body.Length];
+			WriteU32(message, 0, senderID);
+			WriteU32(message, 4, eventID);
+			Buffer.BlockCopy(body, 0, message, Protocol.HeaderSize, body.Length);
+			return message;
+		}
+
+		/// <summary>Splits a message into sender ID, event ID and body. Throws a FormatException if shorter than the header</summary>
+		public static void DecodeHeader(byte[] message, out uint senderID, out uint eventID, out byte[] body)
+		{
+			var r = new MessageReader(message);
+			senderID = r.U32();
+			eventID = r.U32();
+			body = new byte[message.Length - Protocol.HeaderSize];
+			Buffer.BlockCopy(message, Protocol.HeaderSize, body, 0, body.Length);
+		}
+
+		private static void WriteU32(byte[] target, int offset, uint v)
+		{
+			target[offset] = (byte)(v >> 24);
+			target[offset + 1] = (byte)(v >> 16);
+			target[offset + 2] = (byte)(v >> 8);
+			target[offset + 3] = (byte)v;
+		}
+	}
+
+	public enum LengthPrefix
+	{
+		None = 0,
+		U16 = 2,
+		U32 = 4
+	}
+
+	internal sealed class MessageWriter
+	{
+		private readonly List<byte> message;
+
+		public MessageWriter(int capacity)
+		{
+			message = new List<byte>(capacity);
+		}
+
+		public byte[] ToArray() => message.ToArray();
+
+		public void U8(byte v) => message.Add(v);
+		public void U16(ushort v) { message.Add((byte)(v >> 8)); message.Add((byte)v); }
+		public void U32(uint v) { U16((ushort)(v >> 16)); U16((ushort)v); }
+		public void U64(ulong v) { U32((uint)(v >> 32)); U32((uint)v); }
+		public void I8(sbyte v) => U8((byte)v);
+		public void I16(short v) => U16((ushort)v);
+		public void I32(int v) => U32((uint)v);
+		public void I64(long v) => U64((ulong)v);
+		public void F32(float v) => I32(BitConverter.ToInt32(BitConverter.GetBytes(v), 0));
+		public void F64(double v) => I64(BitConverter.DoubleToInt64Bits(v));
+
+		public void Length(int length, LengthPrefix prefix)
+		{
+			switch (prefix)
+			{
+				case LengthPrefix.U16:
+					if (length > ushort.MaxValue)
+					{
+						throw new ArgumentException($"length {length} exceeds the max of {ushort.MaxValue} of a u16 prefix");
+					}
+					U16((ushort)length);
+					break;
+				case LengthPrefix.U32:
+					U32((uint)length);
+					break;
+			}
+		}
+
+		public void String(string v, LengthPrefix prefix)
+		{
+			var bytes = Encoding.UTF8.GetBytes(v);
+			Length(bytes.Length, prefix);
+			message.AddRange(bytes);
+		}
+	}
+
+	internal sealed class MessageReader
+	{
+		private static readonly Encoding StrictUTF8 = new UTF8Encoding(false, true);
+		private readonly byte[] data;
+		private int offset;
+
+		public MessageReader(byte[] data)
+		{
+			this.data = data;
+		}
+
+		private int Remaining => data.Length - offset;
+
+		private int Take(int n)
+		{
+			if (n > Remaining)
+			{
+				throw new FormatException($"expected {n} more bytes at offset {offset}, got {Remaining}");
+			}
+			var start = offset;
+			offset += n;
+			return start;
+		}
+
+		public byte U8() => data[Take(1)];
+		public ushort U16() { var at = Take(2); return (ushort)(data[at] << 8 | data[at + 1]); }
+		public uint U32() => (uint)U16() << 16 | U16();
+		public ulong U64() => (ulong)U32() << 32 | U32();
+		public sbyte I8() => (sbyte)U8();
+		public short I16() => (short)U16();
+		public int I32() => (int)U32();
+		public long I64() => (long)U64();
+		public float F32() => BitConverter.ToSingle(BitConverter.GetBytes(I32()), 0);
+		public double F64() => BitConverter.Int64BitsToDouble(I64());
+
+		/// <summary>Number of elements to follow, each of at least elementSize bytes</summary>
+		public int Length(LengthPrefix prefix, int elementSize)
+		{
+			ulong length = prefix == LengthPrefix.U16 ? U16() : prefix == LengthPrefix.U32 ? U32() : 0UL;
+			// Checked before allocating, so a bogus length can't make us allocate more than the message could hold
+			if (length * (ulong)elementSize > (ulong)Remaining)
+			{
+				throw new FormatException($"length {length} exceeds the {Remaining} bytes remaining");
+			}
+			return (int)length;
+		}
+
+		public string String(LengthPrefix prefix)
+		{
+			var length = prefix == LengthPrefix.None ? Remaining : Length(prefix, 1);
+			var start = Take(length);
+			try
+			{
+				return StrictUTF8.GetString(data, start, length);
+			}
+			catch (DecoderFallbackException)
+			{
+				throw new FormatException("invalid UTF-8 string");
+			}
+		}
+	}
+`
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+)
+
+type SpecChangeKind string
+
+const (
+	SPEC_CHANGE_EVENT_ADDED      SpecChangeKind = "event added"
+	SPEC_CHANGE_EVENT_REMOVED    SpecChangeKind = "event removed"
+	SPEC_CHANGE_EVENT_RENUMBERED SpecChangeKind = "event renumbered"
+	SPEC_CHANGE_EVENT_RENAMED    SpecChangeKind = "event renamed"
+	SPEC_CHANGE_PERMISSIONS      SpecChangeKind = "permissions changed"
+	SPEC_CHANGE_FIELD_ADDED      SpecChangeKind = "field added"
+	SPEC_CHANGE_FIELD_REMOVED    SpecChangeKind = "field removed"
+	SPEC_CHANGE_FIELD_CHANGED    SpecChangeKind = "field changed"
+)
+
+type SpecChange struct {
+	EventID     uint32         `json:"eventID"`
+	EventName   string         `json:"eventName"`
+	Kind        SpecChangeKind `json:"kind"`
+	Breaking    bool           `json:"breaking"`
+	Description string         `json:"description"`
+}
+
+type SpecDiff struct {
+	Breaking bool         `json:"breaking"`
+	Changes  []SpecChange `json:"changes"`
+}
+
+// Compares the events of a previously exported spec with those of another, usually the current one.
+// Comments and descriptions are ignored, as they don't affect what goes over the wire
+func diffEventSpecs(oldSpecs []jsonEventSpecification, newSpecs []jsonEventSpecification) SpecDiff {
+	oldByID := make(map[uint32]jsonEventSpecification, len(oldSpecs))
+	for _, spec := range oldSpecs {
+		oldByID[spec.ID] = spec
+	}
+	newByID := make(map[uint32]jsonEventSpecification, len(newSpecs))
+	newIDByName := make(map[string]uint32, len(newSpecs))
+	for _, spec := range newSpecs {
+		newByID[spec.ID] = spec
+		newIDByName[spec.Name] = spec.ID
+	}
+	renumberedTo := make(map[uint32]bool)
+
+	diff := SpecDiff{Changes: make([]SpecChange, 0)}
+	add := func(spec jsonEventSpecification, kind SpecChangeKind, breaking bool, description string) {
+		diff.Changes = append(diff.Changes, SpecChange{EventID: spec.ID, EventName: spec.Name, Kind: kind, Breaking: breaking, Description: description})
+		diff.Breaking = diff.Breaking || breaking
+	}
+
+	for _, oldSpec := range oldSpecs {
+		newSpec, exists := newByID[oldSpec.ID]
+		if !exists || newSpec.Name != oldSpec.Name {
+			if newID, renumbered := newIDByName[oldSpec.Name]; renumbered {
+				renumberedTo[newID] = true
+				add(oldSpec, SPEC_CHANGE_EVENT_RENUMBERED, true, fmt.Sprintf("now has id %d", newID))
+				diffPermissions(oldSpec, newByID[newID], add)
+				diffStructure(oldSpec, newByID[newID], add)
+				continue
+			}
+		}
+		if !exists {
+			add(oldSpec, SPEC_CHANGE_EVENT_REMOVED, true, "no longer exists")
+			continue
+		}
+		if newSpec.Name != oldSpec.Name {
+			add(oldSpec, SPEC_CHANGE_EVENT_RENAMED, true, fmt.Sprintf("now named %s", newSpec.Name))
+		}
+		diffPermissions(oldSpec, newSpec, add)
+		diffStructure(oldSpec, newSpec, add)
+	}
+	for _, newSpec := range newSpecs {
+		if _, exists := oldByID[newSpec.ID]; !exists && !renumberedTo[newSpec.ID] {
+			add(newSpec, SPEC_CHANGE_EVENT_ADDED, false, "new event")
+		}
+	}
+
+	sort.SliceStable(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].EventID < diff.Changes[j].EventID
+	})
+	return diff
+}
+
+// Revoking a permission breaks clients relying on it, granting one does not
+func diffPermissions(oldSpec jsonEventSpecification, newSpec jsonEventSpecification, add func(jsonEventSpecification, SpecChangeKind, bool, string)) {
+	for _, origin := range []internal.OriginType{internal.ORIGIN_TYPE_SERVER, internal.ORIGIN_TYPE_OWNER, internal.ORIGIN_TYPE_GUEST} {
+		before, after := oldSpec.Permissions[origin], newSpec.Permissions[origin]
+		if before && !after {
+			add(newSpec, SPEC_CHANGE_PERMISSIONS, true, fmt.Sprintf("%s may no longer send it", origin))
+		} else if !before && after {
+			add(newSpec, SPEC_CHANGE_PERMISSIONS, false, fmt.Sprintf("%s may now send it", origin))
+		}
+	}
+}
+
+func diffStructure(oldSpec jsonEventSpecification, newSpec jsonEventSpecification, add func(jsonEventSpecification, SpecChangeKind, bool, string)) {
+	shared := min(len(oldSpec.Structure), len(newSpec.Structure))
+	for i := 0; i < shared; i++ {
+		if difference := describeElementDifference(oldSpec.Structure[i], newSpec.Structure[i]); difference != "" {
+			add(newSpec, SPEC_CHANGE_FIELD_CHANGED, true, fmt.Sprintf("field %d: %s", i, difference))
+		}
+	}
+	for _, removed := range oldSpec.Structure[shared:] {
+		add(newSpec, SPEC_CHANGE_FIELD_REMOVED, true, fmt.Sprintf("%s (%s) removed", removed.FieldName, removed.Type))
+	}
+	if len(newSpec.Structure) <= shared {
+		return
+	}
+
+	// Trailing fields are ignored by old readers, but raise the min size the server expects of anything clients send,
+	// and can't follow an unprefixed string, as old readers would read them as part of it
+	breaking, reason := false, ""
+	if shared > 0 && oldSpec.Structure[shared-1].Type == "string" && oldSpec.Structure[shared-1].LengthPrefix == 0 {
+		breaking, reason = true, ", after a string spanning the rest of the message"
+	} else if newSpec.Permissions[internal.ORIGIN_TYPE_OWNER] || newSpec.Permissions[internal.ORIGIN_TYPE_GUEST] {
+		breaking, reason = true, ", which clients sending the event must include"
+	}
+	for _, added := range newSpec.Structure[shared:] {
+		add(newSpec, SPEC_CHANGE_FIELD_ADDED, breaking, fmt.Sprintf("%s (%s) added at offset %d%s", added.FieldName, added.Type, added.Offset, reason))
+	}
+}
+
+// Empty if the elements are the same on the wire
+func describeElementDifference(before jsonElementDescriptor, after jsonElementDescriptor) string {
+	var differences []string
+	if before.FieldName != after.FieldName {
+		differences = append(differences, fmt.Sprintf("name %s -> %s", before.FieldName, after.FieldName))
+	}
+	if before.Type != after.Type || before.ElementType != after.ElementType {
+		differences = append(differences, fmt.Sprintf("type %s -> %s", formatJSONElementType(before), formatJSONElementType(after)))
+	}
+	if before.Offset != after.Offset {
+		differences = append(differences, fmt.Sprintf("offset %d -> %d", before.Offset, after.Offset))
+	}
+	if before.ByteSize != after.ByteSize {
+		differences = append(differences, fmt.Sprintf("size %d -> %d", before.ByteSize, after.ByteSize))
+	}
+	if before.LengthPrefix != after.LengthPrefix {
+		differences = append(differences, fmt.Sprintf("length prefix %d -> %d bytes", before.LengthPrefix, after.LengthPrefix))
+	}
+	if len(before.Elements) != len(after.Elements) {
+		differences = append(differences, fmt.Sprintf("element fields %d -> %d", len(before.Elements), len(after.Elements)))
+	} else {
+		for i := range before.Elements {
+			if difference := describeElementDifference(before.Elements[i], after.Elements[i]); difference != "" {
+				differences = append(differences, fmt.Sprintf("element field %d: %s", i, difference))
+			}
+		}
+	}
+	if len(differences) == 0 {
+		return ""
+	}
+	return after.FieldName + " " + strings.Join(differences, ", ")
+}
+
+func formatJSONElementType(element jsonElementDescriptor) string {
+	if element.ElementType != "" {
+		return element.Type + " of " + element.ElementType
+	}
+	return element.Type
+}
+
+// Accepts both the current format and the plain array of events exported before the protocol fingerprint was added
+func readJSONEventSpecs(path string) ([]jsonEventSpecification, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", path, err.Error())
+	}
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		var events []jsonEventSpecification
+		if err := json.Unmarshal(trimmed, &events); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %s", path, err.Error())
+		}
+		return events, nil
+	}
+	var specs jsonEventSpecifications
+	if err := json.Unmarshal(content, &specs); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err.Error())
+	}
+	return specs.Events, nil
+}
+
+func WriteSpecDiffAsText(writer io.Writer, diff SpecDiff) error {
+	if len(diff.Changes) == 0 {
+		_, err := fmt.Fprintln(writer, "No changes")
+		return err
+	}
+	for _, change := range diff.Changes {
+		classification := "compatible"
+		if change.Breaking {
+			classification = "BREAKING"
+		}
+		if _, err := fmt.Fprintf(writer, "[%s] %d %s - %s: %s\n", classification, change.EventID, change.EventName, change.Kind, change.Description); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(writer, "%d changes, breaking: %t\n", len(diff.Changes), diff.Breaking)
+	return err
+}
+
+func WriteSpecDiffAsJSON(writer io.Writer, diff SpecDiff) error {
+	encoded, err := json.MarshalIndent(diff, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding spec diff as json: %s", err.Error())
+	}
+	_, err = writer.Write(append(encoded, '\n'))
+	return err
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+)
+
+func testSpec(id uint32, name string, permissions map[string]bool, structure ...jsonElementDescriptor) jsonEventSpecification {
+	return jsonEventSpecification{ID: id, Name: name, Permissions: permissions, Structure: structure}
+}
+
+var testServerOnly = map[string]bool{"server": true, "owner": false, "guest": false}
+var testAnyone = map[string]bool{"server": true, "owner": true, "guest": true}
+
+func TestDiffEventSpecs(t *testing.T) {
+	id := jsonElementDescriptor{FieldName: "id", Type: "uint32", ByteSize: 4, Offset: 0}
+	ign := jsonElementDescriptor{FieldName: "ign", Type: "string", Offset: 4}
+	prefixedIGN := jsonElementDescriptor{FieldName: "ign", Type: "string", Offset: 4, LengthPrefix: 2}
+	position := jsonElementDescriptor{FieldName: "position", Type: "uint32", ByteSize: 4, Offset: 4}
+	wideID := jsonElementDescriptor{FieldName: "id", Type: "uint64", ByteSize: 8, Offset: 0}
+
+	tests := []struct {
+		name         string
+		old          []jsonEventSpecification
+		new          []jsonEventSpecification
+		wantKinds    []SpecChangeKind
+		wantBreaking bool
+	}{
+		{"no changes", []jsonEventSpecification{testSpec(1, "A", testServerOnly, id)}, []jsonEventSpecification{testSpec(1, "A", testServerOnly, id)}, nil, false},
+		{"comment only", []jsonEventSpecification{{ID: 1, Name: "A", Comment: "before", Permissions: testServerOnly}}, []jsonEventSpecification{{ID: 1, Name: "A", Comment: "after", Permissions: testServerOnly}}, nil, false},
+		{"event added", nil, []jsonEventSpecification{testSpec(1, "A", testServerOnly)}, []SpecChangeKind{SPEC_CHANGE_EVENT_ADDED}, false},
+		{"event removed", []jsonEventSpecification{testSpec(1, "A", testServerOnly)}, nil, []SpecChangeKind{SPEC_CHANGE_EVENT_REMOVED}, true},
+		{"event renumbered", []jsonEventSpecification{testSpec(1, "A", testServerOnly)}, []jsonEventSpecification{testSpec(2, "A", testServerOnly)}, []SpecChangeKind{SPEC_CHANGE_EVENT_RENUMBERED}, true},
+		{"event renumbered and changed", []jsonEventSpecification{testSpec(1, "A", testAnyone, id)}, []jsonEventSpecification{testSpec(2, "A", testServerOnly, wideID)}, []SpecChangeKind{SPEC_CHANGE_EVENT_RENUMBERED, SPEC_CHANGE_PERMISSIONS, SPEC_CHANGE_PERMISSIONS, SPEC_CHANGE_FIELD_CHANGED}, true},
+		{"event renamed", []jsonEventSpecification{testSpec(1, "A", testServerOnly)}, []jsonEventSpecification{testSpec(1, "B", testServerOnly)}, []SpecChangeKind{SPEC_CHANGE_EVENT_RENAMED}, true},
+		{"permission revoked", []jsonEventSpecification{testSpec(1, "A", testAnyone)}, []jsonEventSpecification{testSpec(1, "A", testServerOnly)}, []SpecChangeKind{SPEC_CHANGE_PERMISSIONS, SPEC_CHANGE_PERMISSIONS}, true},
+		{"permission granted", []jsonEventSpecification{testSpec(1, "A", testServerOnly)}, []jsonEventSpecification{testSpec(1, "A", testAnyone)}, []SpecChangeKind{SPEC_CHANGE_PERMISSIONS, SPEC_CHANGE_PERMISSIONS}, false},
+		{"field kind changed", []jsonEventSpecification{testSpec(1, "A", testServerOnly, id)}, []jsonEventSpecification{testSpec(1, "A", testServerOnly, wideID)}, []SpecChangeKind{SPEC_CHANGE_FIELD_CHANGED}, true},
+		{"string prefixed", []jsonEventSpecification{testSpec(1, "A", testServerOnly, id, ign)}, []jsonEventSpecification{testSpec(1, "A", testServerOnly, id, prefixedIGN)}, []SpecChangeKind{SPEC_CHANGE_FIELD_CHANGED}, true},
+		{"field removed", []jsonEventSpecification{testSpec(1, "A", testServerOnly, id, position)}, []jsonEventSpecification{testSpec(1, "A", testServerOnly, id)}, []SpecChangeKind{SPEC_CHANGE_FIELD_REMOVED}, true},
+		{"trailing field from server", []jsonEventSpecification{testSpec(1, "A", testServerOnly, id)}, []jsonEventSpecification{testSpec(1, "A", testServerOnly, id, position)}, []SpecChangeKind{SPEC_CHANGE_FIELD_ADDED}, false},
+		{"trailing field from clients", []jsonEventSpecification{testSpec(1, "A", testAnyone, id)}, []jsonEventSpecification{testSpec(1, "A", testAnyone, id, position)}, []SpecChangeKind{SPEC_CHANGE_FIELD_ADDED}, true},
+		{"trailing field after string", []jsonEventSpecification{testSpec(1, "A", testServerOnly, id, ign)}, []jsonEventSpecification{testSpec(1, "A", testServerOnly, id, ign, position)}, []SpecChangeKind{SPEC_CHANGE_FIELD_ADDED}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffEventSpecs(tt.old, tt.new)
+			if diff.Breaking != tt.wantBreaking {
+				t.Errorf("Expected breaking: %v, got %v (%+v)", tt.wantBreaking, diff.Breaking, diff.Changes)
+			}
+			if len(diff.Changes) != len(tt.wantKinds) {
+				t.Fatalf("Expected %d changes, got %+v", len(tt.wantKinds), diff.Changes)
+			}
+			for i, kind := range tt.wantKinds {
+				if diff.Changes[i].Kind != kind {
+					t.Errorf("Expected change %d to be %s, got %s", i, kind, diff.Changes[i].Kind)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+)
+
+const GO_CLIENT_HEADER = "// Code generated by the multiplayer backend tool (--tools --print-event-specs). DO NOT EDIT.\n\n"
+
+// Package name used when none can be derived from the output path
+const DEFAULT_GO_CLIENT_PACKAGE = "events"
+
+// Writes a standalone Go package with the event ids, send permissions and DTOs of every spec given,
+// along with codecs for the DTOs. The package depends on nothing but the standard library
+func WriteGoClient(writer io.Writer, packageName string, specs []internal.EventSpecification[any]) error {
+	var source strings.Builder
+	source.WriteString(GO_CLIENT_HEADER)
+	source.WriteString(fmt.Sprintf("package %s\n\n", packageName))
+	source.WriteString("import (\n\t\"encoding\"\n\t\"encoding/binary\"\n\t\"fmt\"\n\t\"math\"\n\t\"unicode/utf8\"\n)\n\n")
+
+	source.WriteString(fmt.Sprintf("const PROTOCOL_VERSION uint32 = %d\n", internal.PROTOCOL_VERSION))
+	source.WriteString(fmt.Sprintf("const SPEC_FINGERPRINT = \"%s\"\n\n", internal.ProtocolFingerprint()))
+
+	source.WriteString("type EventID = uint32\n\nconst (\n")
+	for _, spec := range specs {
+		source.WriteString(formatGoComment(spec.Comment, "\t"))
+		source.WriteString(fmt.Sprintf("\t%s EventID = %d\n", formatTSConstantName(spec.Name, "EVENT"), spec.ID))
+	}
+	source.WriteString(")\n\n")
+
+	source.WriteString("var EVENT_NAMES = map[EventID]string{\n")
+	for _, spec := range specs {
+		source.WriteString(fmt.Sprintf("\t%s: \"%s\",\n", formatTSConstantName(spec.Name, "EVENT"), spec.Name))
+	}
+	source.WriteString("}\n\n")
+
+	source.WriteString("// Who may send an event\ntype SendPermissions struct {\n\tServer bool\n\tOwner  bool\n\tGuest  bool\n}\n\n")
+	source.WriteString("var SEND_PERMISSIONS = map[EventID]SendPermissions{\n")
+	for _, spec := range specs {
+		source.WriteString(fmt.Sprintf("\t%s: {Server: %t, Owner: %t, Guest: %t},\n", formatTSConstantName(spec.Name, "EVENT"),
+			spec.SendPermissions[internal.ORIGIN_TYPE_SERVER], spec.SendPermissions[internal.ORIGIN_TYPE_OWNER], spec.SendPermissions[internal.ORIGIN_TYPE_GUEST]))
+	}
+	source.WriteString("}\n\n")
+
+	source.WriteString("// Min size of the body of each event, header excluded\nvar EXPECTED_MIN_SIZES = map[EventID]uint32{\n")
+	for _, spec := range specs {
+		source.WriteString(fmt.Sprintf("\t%s: %d,\n", formatTSConstantName(spec.Name, "EVENT"), spec.ExpectedMinSize))
+	}
+	source.WriteString("}\n\n")
+
+	dtos, err := formatGoClientDTOs(specs)
+	if err != nil {
+		return err
+	}
+	source.WriteString(dtos)
+	source.WriteString(GO_CLIENT_RUNTIME)
+
+	formatted, err := format.Source([]byte(source.String()))
+	if err != nil {
+		return fmt.Errorf("error formatting generated go client: %s", err.Error())
+	}
+	_, err = writer.Write(formatted)
+	return err
+}
+
+// Once per DTO type, as several events may share one
+func formatGoClientDTOs(specs []internal.EventSpecification[any]) (string, error) {
+	var commentsByType = make(map[reflect.Type][]string)
+	var specByType = make(map[reflect.Type]internal.EventSpecification[any])
+	for _, spec := range specs {
+		if spec.DTOType == nil {
+			return "", fmt.Errorf("spec %s has no DTO type", spec.Name)
+		}
+		if _, seen := specByType[spec.DTOType]; !seen {
+			specByType[spec.DTOType] = spec
+		}
+		commentsByType[spec.DTOType] = append(commentsByType[spec.DTOType], spec.Name)
+	}
+	types := make([]reflect.Type, 0, len(specByType))
+	for t := range specByType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return goClientTypeName(types[i]) < goClientTypeName(types[j])
+	})
+
+	var result string
+	var nestedWritten = make(map[string]bool)
+	for _, t := range types {
+		spec := specByType[t]
+		result += fmt.Sprintf("// Body of %s\n", strings.Join(commentsByType[t], ", "))
+		definitions, err := formatGoClientStruct(t, spec.Structure, nestedWritten)
+		if err != nil {
+			return "", fmt.Errorf("generating client DTO for %s: %s", t.Name(), err.Error())
+		}
+		result += definitions
+		marshal, err := formatGoMarshal(t, spec.Structure, spec.ExpectedMinSize, goClientTypeName)
+		if err != nil {
+			return "", fmt.Errorf("generating client codec for %s: %s", t.Name(), err.Error())
+		}
+		unmarshal, err := formatGoUnmarshal(t, spec.Structure, goClientTypeName)
+		if err != nil {
+			return "", fmt.Errorf("generating client codec for %s: %s", t.Name(), err.Error())
+		}
+		result += "\n" + marshal + "\n" + unmarshal + "\n"
+	}
+	return result, nil
+}
+
+// The struct, followed by the structs of any slices of structs in it
+func formatGoClientStruct(t reflect.Type, structure internal.ComputedStructure, nestedWritten map[string]bool) (string, error) {
+	var result = fmt.Sprintf("type %s struct {\n", goClientTypeName(t))
+	var nested string
+	for _, element := range structure {
+		field, err := goFieldOf(t, element.FieldName)
+		if err != nil {
+			return "", err
+		}
+		result += formatGoComment(element.Description, "\t")
+		result += fmt.Sprintf("\t%s %s `json:\"%s\"`\n", field.Name, goClientTypeName(field.Type), element.FieldName)
+
+		if element.Kind == reflect.Slice && element.ElementKind == reflect.Struct && !nestedWritten[goClientTypeName(field.Type.Elem())] {
+			nestedWritten[goClientTypeName(field.Type.Elem())] = true
+			definition, err := formatGoClientStruct(field.Type.Elem(), element.Elements, nestedWritten)
+			if err != nil {
+				return "", err
+			}
+			nested += "\n" + definition
+		}
+	}
+	return result + "}\n" + nested, nil
+}
+
+// Named types of the server are reduced to their kind, so the client needs none of them
+func goClientTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice:
+		return "[]" + goClientTypeName(t.Elem())
+	case reflect.Struct:
+		name := []rune(t.Name())
+		name[0] = unicode.ToUpper(name[0])
+		return string(name)
+	default:
+		return t.Kind().String()
+	}
+}
+
+func formatGoComment(comment string, indent string) string {
+	if comment == "" {
+		return ""
+	}
+	var result string
+	for _, line := range strings.Split(comment, "\n") {
+		result += fmt.Sprintf("%s// %s\n", indent, strings.TrimSpace(line))
+	}
+	return result
+}
+
+// The name of the directory the file is in, if it is a valid package name
+func goPackageNameFromPath(path string) string {
+	name := strings.ToLower(filepath.Base(filepath.Dir(path)))
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		return DEFAULT_GO_CLIENT_PACKAGE
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return DEFAULT_GO_CLIENT_PACKAGE
+		}
+	}
+	return name
+}
+
+// Header, framing and codec building blocks of the generated go client, mirroring src/internal/codecs.go
+const GO_CLIENT_RUNTIME = `
+type LengthPrefix uint32
+
+const (
+	LENGTH_PREFIX_NONE LengthPrefix = 0
+	LENGTH_PREFIX_U16  LengthPrefix = 2
+	LENGTH_PREFIX_U32  LengthPrefix = 4
+)
+
+// Every message starts with the sender ID and the event ID, both big endian uint32's
+const MESSAGE_HEADER_SIZE = 8
+
+// Prepends the header to the body of the DTO
+func Encode(senderID uint32, eventID EventID, dto encoding.BinaryMarshaler) ([]byte, error) {
+	body, err := dto.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, 0, MESSAGE_HEADER_SIZE+len(body))
+	message = binary.BigEndian.AppendUint32(message, senderID)
+	message = binary.BigEndian.AppendUint32(message, eventID)
+	return append(message, body...), nil
+}
+
+// Splits a message into sender ID, event ID and body
+func DecodeHeader(message []byte) (uint32, EventID, []byte, error) {
+	if len(message) < MESSAGE_HEADER_SIZE {
+		return 0, 0, nil, fmt.Errorf("expected at least %d bytes, got %d", MESSAGE_HEADER_SIZE, len(message))
+	}
+	return binary.BigEndian.Uint32(message[0:4]), binary.BigEndian.Uint32(message[4:8]), message[MESSAGE_HEADER_SIZE:], nil
+}
+
+// Checks the body against the min size of the event before decoding it into the DTO
+func Decode(eventID EventID, body []byte, dto encoding.BinaryUnmarshaler) error {
+	minSize, known := EXPECTED_MIN_SIZES[eventID]
+	if !known {
+		return fmt.Errorf("unknown event id %d", eventID)
+	}
+	if len(body) < int(minSize) {
+		return fmt.Errorf("expected at least %d bytes for %s, got %d", minSize, EVENT_NAMES[eventID], len(body))
+	}
+	return dto.UnmarshalBinary(body)
+}
+
+type codecWriter struct {
+	message []byte
+	err     error
+}
+
+func newCodecWriter(capacity uint32) *codecWriter {
+	return &codecWriter{message: make([]byte, 0, capacity)}
+}
+
+func (w *codecWriter) bytes() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.message, nil
+}
+
+func (w *codecWriter) u8(v uint8)    { w.message = append(w.message, v) }
+func (w *codecWriter) u16(v uint16)  { w.message = binary.BigEndian.AppendUint16(w.message, v) }
+func (w *codecWriter) u32(v uint32)  { w.message = binary.BigEndian.AppendUint32(w.message, v) }
+func (w *codecWriter) u64(v uint64)  { w.message = binary.BigEndian.AppendUint64(w.message, v) }
+func (w *codecWriter) i8(v int8)     { w.u8(uint8(v)) }
+func (w *codecWriter) i16(v int16)   { w.u16(uint16(v)) }
+func (w *codecWriter) i32(v int32)   { w.u32(uint32(v)) }
+func (w *codecWriter) i64(v int64)   { w.u64(uint64(v)) }
+func (w *codecWriter) f32(v float32) { w.u32(math.Float32bits(v)) }
+func (w *codecWriter) f64(v float64) { w.u64(math.Float64bits(v)) }
+
+func (w *codecWriter) length(length int, prefix LengthPrefix) {
+	if w.err != nil {
+		return
+	}
+	switch prefix {
+	case LENGTH_PREFIX_U16:
+		if length > math.MaxUint16 {
+			w.err = fmt.Errorf("length %d exceeds the max of %d of a u16 prefix", length, math.MaxUint16)
+			return
+		}
+		w.u16(uint16(length))
+	case LENGTH_PREFIX_U32:
+		if uint64(length) > math.MaxUint32 {
+			w.err = fmt.Errorf("length %d exceeds the max of %d of a u32 prefix", length, uint64(math.MaxUint32))
+			return
+		}
+		w.u32(uint32(length))
+	}
+}
+
+func (w *codecWriter) string(v string, prefix LengthPrefix) {
+	w.length(len(v), prefix)
+	w.message = append(w.message, v...)
+}
+
+type codecReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func newCodecReader(data []byte) *codecReader {
+	return &codecReader{data: data}
+}
+
+func (r *codecReader) remaining() int {
+	return len(r.data) - r.offset
+}
+
+// Zeroes on failure, so that the generated code can go on reading
+func (r *codecReader) take(n int) []byte {
+	if r.err == nil && n > r.remaining() {
+		r.err = fmt.Errorf("expected %d more bytes at offset %d, got %d", n, r.offset, r.remaining())
+	}
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	taken := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return taken
+}
+
+func (r *codecReader) u8() uint8     { return r.take(1)[0] }
+func (r *codecReader) u16() uint16   { return binary.BigEndian.Uint16(r.take(2)) }
+func (r *codecReader) u32() uint32   { return binary.BigEndian.Uint32(r.take(4)) }
+func (r *codecReader) u64() uint64   { return binary.BigEndian.Uint64(r.take(8)) }
+func (r *codecReader) i8() int8      { return int8(r.u8()) }
+func (r *codecReader) i16() int16    { return int16(r.u16()) }
+func (r *codecReader) i32() int32    { return int32(r.u32()) }
+func (r *codecReader) i64() int64    { return int64(r.u64()) }
+func (r *codecReader) f32() float32  { return math.Float32frombits(r.u32()) }
+func (r *codecReader) f64() float64  { return math.Float64frombits(r.u64()) }
+
+// Number of elements to follow, each of at least elementSize bytes
+func (r *codecReader) length(prefix LengthPrefix, elementSize uint32) int {
+	var length uint64
+	switch prefix {
+	case LENGTH_PREFIX_U16:
+		length = uint64(r.u16())
+	case LENGTH_PREFIX_U32:
+		length = uint64(r.u32())
+	}
+	if r.err != nil {
+		return 0
+	}
+	// Checked before allocating, so a bogus length can't make us allocate more than the message could hold
+	if length*uint64(elementSize) > uint64(r.remaining()) {
+		r.err = fmt.Errorf("length %d exceeds the %d bytes remaining", length, r.remaining())
+		return 0
+	}
+	return int(length)
+}
+
+func (r *codecReader) string(prefix LengthPrefix) string {
+	length := r.remaining()
+	if prefix != LENGTH_PREFIX_NONE {
+		length = r.length(prefix, 1)
+	}
+	bytes := r.take(length)
+	if r.err != nil {
+		return ""
+	}
+	if !utf8.Valid(bytes) {
+		r.err = fmt.Errorf("invalid UTF-8 string")
+		return ""
+	}
+	return string(bytes)
+}
+`
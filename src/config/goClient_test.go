@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoPackageNameFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"../bots/eventspecs/events.go", "eventspecs"},
+		{"./Events/events.go", "events"},
+		{"events.go", DEFAULT_GO_CLIENT_PACKAGE},
+		{"./multiplayer-events/events.go", DEFAULT_GO_CLIENT_PACKAGE},
+		{"./2024/events.go", DEFAULT_GO_CLIENT_PACKAGE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := goPackageNameFromPath(tt.path); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteClientsCoverAllEvents(t *testing.T) {
+	if err := initEventSpecifications(); err != nil {
+		t.Fatalf("Expected no error initializing event specifications, got %v", err)
+	}
+	specs := getOrderedEventSpecs()
+
+	var goClient, csharpClient bytes.Buffer
+	if err := WriteGoClient(&goClient, "events", specs); err != nil {
+		t.Fatalf("Expected no error writing go client, got %v", err)
+	}
+	if err := WriteCSharpClient(&csharpClient, specs); err != nil {
+		t.Fatalf("Expected no error writing C# client, got %v", err)
+	}
+
+	for _, spec := range specs {
+		wantGo := fmt.Sprintf("%s EventID = %d", formatTSConstantName(spec.Name, "EVENT"), spec.ID)
+		if !strings.Contains(goClient.String(), wantGo) {
+			t.Errorf("Expected go client to contain %q", wantGo)
+		}
+		wantCSharp := fmt.Sprintf("public const uint %s = %d;", spec.Name, spec.ID)
+		if !strings.Contains(csharpClient.String(), wantCSharp) {
+			t.Errorf("Expected C# client to contain %q", wantCSharp)
+		}
+		wantDTO := fmt.Sprintf("class %s\n", goClientTypeName(spec.DTOType))
+		if !strings.Contains(csharpClient.String(), wantDTO) {
+			t.Errorf("Expected C# client to contain %q", wantDTO)
+		}
+	}
+}
+
+// Decodes every test vector with the generated client, and encodes the result back into the same message
+const goClientVectorCheck = `package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"generatedclient/events"
+)
+
+type dto interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+var newDTO = map[events.EventID]func() dto{
+%s}
+
+func main() {
+	content, err := os.ReadFile("vectors.json")
+	if err != nil {
+		panic(err)
+	}
+	var vectors struct {
+		Vectors []struct {
+			EventID uint32          ` + "`json:\"eventID\"`" + `
+			Case    string          ` + "`json:\"case\"`" + `
+			DTO     json.RawMessage ` + "`json:\"dto\"`" + `
+			Hex     string          ` + "`json:\"hex\"`" + `
+		} ` + "`json:\"vectors\"`" + `
+	}
+	if err := json.Unmarshal(content, &vectors); err != nil {
+		panic(err)
+	}
+	failed := false
+	for _, vector := range vectors.Vectors {
+		name := fmt.Sprintf("%%s/%%s", events.EVENT_NAMES[vector.EventID], vector.Case)
+		message, _ := hex.DecodeString(vector.Hex)
+		senderID, eventID, body, err := events.DecodeHeader(message)
+		if err != nil || eventID != vector.EventID {
+			fmt.Printf("%%s: expected event %%d, got %%d (%%v)\n", name, vector.EventID, eventID, err)
+			failed = true
+			continue
+		}
+		decoded := newDTO[eventID]()
+		if err := events.Decode(eventID, body, decoded); err != nil {
+			fmt.Printf("%%s: error decoding: %%v\n", name, err)
+			failed = true
+			continue
+		}
+		var expected bytes.Buffer
+		json.Compact(&expected, vector.DTO)
+		if asJSON, _ := json.Marshal(decoded); !bytes.Equal(asJSON, expected.Bytes()) {
+			fmt.Printf("%%s: expected %%s, got %%s\n", name, expected.Bytes(), asJSON)
+			failed = true
+		}
+		if encoded, err := events.Encode(senderID, eventID, decoded); err != nil || !bytes.Equal(encoded, message) {
+			fmt.Printf("%%s: expected to encode back into %%x, got %%x (%%v)\n", name, message, encoded, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+`
+
+// Builds the generated client as a module of its own, with nothing but the standard library, and runs it against the test vectors
+func TestGoClientDecodesTestVectors(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated client")
+	}
+	goBinary, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go toolchain found")
+	}
+	if err := initEventSpecifications(); err != nil {
+		t.Fatalf("Expected no error initializing event specifications, got %v", err)
+	}
+	specs := getOrderedEventSpecs()
+
+	dir := t.TempDir()
+	write := func(name string, content []byte) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	write("go.mod", []byte("module generatedclient\n\ngo 1.23\n"))
+
+	var client bytes.Buffer
+	if err := WriteGoClient(&client, "events", specs); err != nil {
+		t.Fatalf("Expected no error writing go client, got %v", err)
+	}
+	write("events/events.go", client.Bytes())
+
+	vectors, err := BuildTestVectors(specs)
+	if err != nil {
+		t.Fatalf("Expected no error building test vectors, got %v", err)
+	}
+	var vectorsJSON bytes.Buffer
+	if err := WriteTestVectors(&vectorsJSON, vectors); err != nil {
+		t.Fatalf("Expected no error writing test vectors, got %v", err)
+	}
+	write("vectors.json", vectorsJSON.Bytes())
+
+	var factories strings.Builder
+	for _, spec := range specs {
+		factories.WriteString(fmt.Sprintf("\tevents.%s: func() dto { return &events.%s{} },\n", formatTSConstantName(spec.Name, "EVENT"), goClientTypeName(spec.DTOType)))
+	}
+	write("main.go", []byte(fmt.Sprintf(goClientVectorCheck, factories.String())))
+
+	for _, args := range [][]string{{"vet", "./..."}, {"run", "."}} {
+		cmd := exec.Command(goBinary, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Expected go %s of the generated client to succeed, got %v:\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+const GO_CODECS_HEADER = "// Code generated by the multiplayer backend tool (--tools --generate-go-codecs). DO NOT EDIT.\n\npackage internal\n"
+
+// Where the generated codecs must live, as they are methods on the DTOs
+var internalPackagePath = reflect.TypeOf(internal.EmptyDTO{}).PkgPath()
+
+// Writes MarshalBinary and UnmarshalBinary methods for the DTO of every spec given, once per DTO type.
+// The output is gofmt'ed and deterministic, such that regenerating without changes to the specs gives the same file
+func WriteGoCodecs(writer io.Writer, specs []internal.EventSpecification[any]) error {
+	var minSizeByType = make(map[reflect.Type]uint32)
+	var structureByType = make(map[reflect.Type]internal.ComputedStructure)
+	for _, spec := range specs {
+		if spec.DTOType == nil {
+			return fmt.Errorf("spec %s has no DTO type", spec.Name)
+		}
+		structureByType[spec.DTOType] = spec.Structure
+		minSizeByType[spec.DTOType] = spec.ExpectedMinSize
+	}
+	types := make([]reflect.Type, 0, len(structureByType))
+	for t := range structureByType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name() < types[j].Name()
+	})
+
+	var source strings.Builder
+	source.WriteString(GO_CODECS_HEADER)
+	for _, t := range types {
+		if t.PkgPath() != internalPackagePath {
+			return fmt.Errorf("%s is not declared in package internal, so no codec can be generated for it", t.String())
+		}
+		marshal, err := formatGoMarshal(t, structureByType[t], minSizeByType[t], goTypeName)
+		if err != nil {
+			return fmt.Errorf("generating codec for %s: %s", t.Name(), err.Error())
+		}
+		unmarshal, err := formatGoUnmarshal(t, structureByType[t], goTypeName)
+		if err != nil {
+			return fmt.Errorf("generating codec for %s: %s", t.Name(), err.Error())
+		}
+		source.WriteString("\n" + marshal + "\n" + unmarshal)
+	}
+
+	formatted, err := format.Source([]byte(source.String()))
+	if err != nil {
+		return fmt.Errorf("error formatting generated codecs: %s", err.Error())
+	}
+	_, err = io.Copy(writer, bytes.NewReader(formatted))
+	return err
+}
+
+// Names the Go type a DTO, or a field of it, has in the generated code
+type goTypeNamer func(t reflect.Type) string
+
+func formatGoMarshal(t reflect.Type, structure internal.ComputedStructure, minSize uint32, typeName goTypeNamer) (string, error) {
+	body, err := formatGoWrites(t, structure, "dto", "\t", typeName)
+	if err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("func (dto %s) MarshalBinary() ([]byte, error) {\n", typeName(t))
+	result += fmt.Sprintf("\tw := newCodecWriter(%d)\n", minSize)
+	result += body
+	result += "\treturn w.bytes()\n}\n"
+	return result, nil
+}
+
+func formatGoUnmarshal(t reflect.Type, structure internal.ComputedStructure, typeName goTypeNamer) (string, error) {
+	body, err := formatGoReads(t, structure, "dto", "\t", typeName)
+	if err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("func (dto *%s) UnmarshalBinary(data []byte) error {\n", typeName(t))
+	result += "\tr := newCodecReader(data)\n"
+	result += body
+	result += "\treturn r.err\n}\n"
+	return result, nil
+}
+
+func formatGoWrites(t reflect.Type, structure internal.ComputedStructure, receiver string, indent string, typeName goTypeNamer) (string, error) {
+	var result string
+	for _, element := range structure {
+		field, err := goFieldOf(t, element.FieldName)
+		if err != nil {
+			return "", err
+		}
+		access := fmt.Sprintf("%s.%s", receiver, field.Name)
+
+		switch element.Kind {
+		case reflect.String:
+			result += fmt.Sprintf("%sw.string(%s, %s)\n", indent, goConversion("string", typeName(field.Type), access), goLengthPrefixConstant(element.LengthPrefix))
+		case reflect.Slice:
+			result += fmt.Sprintf("%sw.length(len(%s), %s)\n", indent, access, goLengthPrefixConstant(element.LengthPrefix))
+			result += fmt.Sprintf("%sfor _, v := range %s {\n", indent, access)
+			if element.ElementKind == reflect.Struct {
+				nested, err := formatGoWrites(field.Type.Elem(), element.Elements, "v", indent+"\t", typeName)
+				if err != nil {
+					return "", err
+				}
+				result += nested
+			} else {
+				method, err := goCodecMethodOf(element.ElementKind)
+				if err != nil {
+					return "", err
+				}
+				result += fmt.Sprintf("%s\tw.%s(%s)\n", indent, method, goConversion(element.ElementKind.String(), typeName(field.Type.Elem()), "v"))
+			}
+			result += fmt.Sprintf("%s}\n", indent)
+		default:
+			method, err := goCodecMethodOf(element.Kind)
+			if err != nil {
+				return "", err
+			}
+			result += fmt.Sprintf("%sw.%s(%s)\n", indent, method, goConversion(element.Kind.String(), typeName(field.Type), access))
+		}
+	}
+	return result, nil
+}
+
+func formatGoReads(t reflect.Type, structure internal.ComputedStructure, receiver string, indent string, typeName goTypeNamer) (string, error) {
+	var result string
+	for _, element := range structure {
+		field, err := goFieldOf(t, element.FieldName)
+		if err != nil {
+			return "", err
+		}
+		access := fmt.Sprintf("%s.%s", receiver, field.Name)
+
+		switch element.Kind {
+		case reflect.String:
+			read := fmt.Sprintf("r.string(%s)", goLengthPrefixConstant(element.LengthPrefix))
+			result += fmt.Sprintf("%s%s = %s\n", indent, access, goConversion(typeName(field.Type), "string", read))
+		case reflect.Slice:
+			elementType := field.Type.Elem()
+			elementSize := internal.MinimumSizeOf(element.Elements)
+			if element.ElementKind != reflect.Struct {
+				elementSize = util.SizeOfSerializedKind(element.ElementKind)
+			}
+			result += fmt.Sprintf("%s%s = make(%s, r.length(%s, %d))\n", indent, access, typeName(field.Type), goLengthPrefixConstant(element.LengthPrefix), elementSize)
+			result += fmt.Sprintf("%sfor i := range %s {\n", indent, access)
+			if element.ElementKind == reflect.Struct {
+				nested, err := formatGoReads(elementType, element.Elements, access+"[i]", indent+"\t", typeName)
+				if err != nil {
+					return "", err
+				}
+				result += nested
+			} else {
+				method, err := goCodecMethodOf(element.ElementKind)
+				if err != nil {
+					return "", err
+				}
+				read := fmt.Sprintf("r.%s()", method)
+				result += fmt.Sprintf("%s\t%s[i] = %s\n", indent, access, goConversion(typeName(elementType), element.ElementKind.String(), read))
+			}
+			result += fmt.Sprintf("%s}\n", indent)
+		default:
+			method, err := goCodecMethodOf(element.Kind)
+			if err != nil {
+				return "", err
+			}
+			read := fmt.Sprintf("r.%s()", method)
+			result += fmt.Sprintf("%s%s = %s\n", indent, access, goConversion(typeName(field.Type), element.Kind.String(), read))
+		}
+	}
+	return result, nil
+}
+
+func goFieldOf(t reflect.Type, jsonName string) (reflect.StructField, error) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if strings.Split(field.Tag.Get("json"), ",")[0] == jsonName {
+			return field, nil
+		}
+	}
+	return reflect.StructField{}, fmt.Errorf("field with JSON tag '%s' not found in %s", jsonName, t.Name())
+}
+
+// Converts the expression from the type named to the other type named, if they differ
+func goConversion(to string, from string, expression string) string {
+	if from == to {
+		return expression
+	}
+	return fmt.Sprintf("%s(%s)", to, expression)
+}
+
+// Unqualified, as the codecs live in the package of the DTOs
+func goTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Slice {
+		return "[]" + goTypeName(t.Elem())
+	}
+	return t.Name()
+}
+
+func goLengthPrefixConstant(prefix internal.LengthPrefix) string {
+	switch prefix {
+	case internal.LENGTH_PREFIX_U16:
+		return "LENGTH_PREFIX_U16"
+	case internal.LENGTH_PREFIX_U32:
+		return "LENGTH_PREFIX_U32"
+	default:
+		return "LENGTH_PREFIX_NONE"
+	}
+}
+
+// Name of the codecWriter and codecReader methods handling the kind
+func goCodecMethodOf(kind reflect.Kind) (string, error) {
+	switch kind {
+	case reflect.Uint8:
+		return "u8", nil
+	case reflect.Uint16:
+		return "u16", nil
+	case reflect.Uint32:
+		return "u32", nil
+	case reflect.Uint64:
+		return "u64", nil
+	case reflect.Int8:
+		return "i8", nil
+	case reflect.Int16:
+		return "i16", nil
+	case reflect.Int32:
+		return "i32", nil
+	case reflect.Int64:
+		return "i64", nil
+	case reflect.Float32:
+		return "f32", nil
+	case reflect.Float64:
+		return "f64", nil
+	default:
+		return "", fmt.Errorf("kind %s has no binary codec", kind)
+	}
+}
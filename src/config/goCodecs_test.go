@@ -0,0 +1,29 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+)
+
+var initEventSpecifications = sync.OnceValue(internal.InitEventSpecifications)
+
+func TestGeneratedGoCodecsAreUpToDate(t *testing.T) {
+	if err := initEventSpecifications(); err != nil {
+		t.Fatalf("Expected no error initializing event specifications, got %v", err)
+	}
+	var generated bytes.Buffer
+	if err := WriteGoCodecs(&generated, getOrderedEventSpecs()); err != nil {
+		t.Fatalf("Expected no error generating codecs, got %v", err)
+	}
+	onDisk, err := os.ReadFile("../internal/codecs_generated.go")
+	if err != nil {
+		t.Fatalf("Expected to read the generated codecs, got %v", err)
+	}
+	if !bytes.Equal(generated.Bytes(), onDisk) {
+		t.Error("codecs_generated.go is out of date, run --tools --generate-go-codecs")
+	}
+}
@@ -0,0 +1,496 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/auth"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/client"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+// Colony and player ids of the bots are counted from these, to stay clear of real ones
+const LOAD_TEST_FIRST_COLONY_ID uint32 = 1_000_000_000
+const LOAD_TEST_FIRST_PLAYER_ID uint32 = 1_000_000_000
+
+// How many moves back latency can be measured. Moves delivered later than that are not measured
+const LOAD_TEST_LATENCY_PROBE_SLOTS = 1 << 16
+
+type LoadTestOptions struct {
+	// Base url of the service, fx. http://localhost:9062
+	Target          string
+	Lobbies         int
+	ClientsPerLobby int
+	Duration        time.Duration
+	// Lobbies are started evenly spread over this duration
+	RampUp       time.Duration
+	MoveInterval time.Duration
+	// Pause between the end of one minigame and the owner confirming the next
+	MinigamePause time.Duration
+	Encoding      meta.MessageEncoding
+	DifficultyID  uint32
+	// Join tokens of the bots are signed with this, so it must be the JOIN_TOKEN_SECRET of the target
+	Secret []byte
+}
+
+type LoadTestLatency struct {
+	Samples uint64  `json:"samples"`
+	P50MS   float64 `json:"p50MS"`
+	P90MS   float64 `json:"p90MS"`
+	P99MS   float64 `json:"p99MS"`
+	MaxMS   float64 `json:"maxMS"`
+}
+
+type LoadTestReport struct {
+	DurationS          float64 `json:"durationS"`
+	LobbiesAttempted   uint64  `json:"lobbiesAttempted"`
+	LobbiesCreated     uint64  `json:"lobbiesCreated"`
+	ConnectsAttempted  uint64  `json:"connectsAttempted"`
+	ConnectsSucceeded  uint64  `json:"connectsSucceeded"`
+	ConnectSuccessRate float64 `json:"connectSuccessRate"`
+	// Connections closed by the service before the end of the test
+	Disconnects      uint64 `json:"disconnects"`
+	MessagesSent     uint64 `json:"messagesSent"`
+	MessagesReceived uint64 `json:"messagesReceived"`
+	// Messages received by all bots per second, i.e. the broadcast fan-out throughput
+	ReceivedPerS float64 `json:"receivedPerS"`
+	SentPerS     float64 `json:"sentPerS"`
+	// Average number of bots each move was delivered to
+	MoveFanOut float64 `json:"moveFanOut"`
+	// From sending a move to another bot receiving it
+	MoveLatency    LoadTestLatency `json:"moveLatency"`
+	MinigamesBegun uint64          `json:"minigamesBegun"`
+	MinigamesWon   uint64          `json:"minigamesWon"`
+	MinigamesLost  uint64          `json:"minigamesLost"`
+	// Untimely aborts and sequence resets
+	MinigamesAborted uint64 `json:"minigamesAborted"`
+	// Debug events by code, and errors of the bots themselves
+	ErrorEvents map[string]uint64 `json:"errorEvents"`
+}
+
+// Spins up the lobbies, each with an owner and guests walking through the minigame sequence for as long as the duration.
+// Fails only if the test couldn't be run at all, everything else is reported
+func RunLoadTest(ctx context.Context, options LoadTestOptions) (LoadTestReport, error) {
+	if options.Lobbies <= 0 || options.ClientsPerLobby <= 0 {
+		return LoadTestReport{}, fmt.Errorf("lobbies and clients per lobby must be at least 1")
+	}
+	if options.Duration <= 0 || options.MoveInterval <= 0 {
+		return LoadTestReport{}, fmt.Errorf("duration and move interval must be positive")
+	}
+	signer, err := auth.NewJoinTokenSigner(options.Secret)
+	if err != nil {
+		return LoadTestReport{}, err
+	}
+	if err := internal.InitEventSpecifications(); err != nil {
+		return LoadTestReport{}, err
+	}
+
+	run := &loadTestRun{
+		options:     options,
+		signer:      signer,
+		probe:       &latencyProbe{},
+		errorEvents: make(map[string]uint64),
+	}
+	ctx, cancel := context.WithTimeout(ctx, options.Duration)
+	defer cancel()
+
+	started := time.Now()
+	var lobbies sync.WaitGroup
+	for i := 0; i < options.Lobbies; i++ {
+		lobbies.Add(1)
+		go func(index int) {
+			defer lobbies.Done()
+			delay := options.RampUp * time.Duration(index) / time.Duration(options.Lobbies)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			run.runLobby(ctx, index)
+		}(i)
+	}
+	lobbies.Wait()
+	return run.report(time.Since(started)), nil
+}
+
+type loadTestRun struct {
+	options LoadTestOptions
+	signer  *auth.JoinTokenSigner
+	probe   *latencyProbe
+
+	lobbiesAttempted, lobbiesCreated   atomic.Uint64
+	connectsAttempted, connectsSucceed atomic.Uint64
+	disconnects                        atomic.Uint64
+	sent, received                     atomic.Uint64
+	movesSent, movesReceived           atomic.Uint64
+	minigamesBegun, minigamesWon       atomic.Uint64
+	minigamesLost, minigamesAborted    atomic.Uint64
+
+	errorsLock  sync.Mutex
+	errorEvents map[string]uint64
+}
+
+func (run *loadTestRun) recordError(kind string) {
+	run.errorsLock.Lock()
+	defer run.errorsLock.Unlock()
+	run.errorEvents[kind]++
+}
+
+func (run *loadTestRun) recordClientError(err error) {
+	var debugErr *client.DebugError
+	if errors.As(err, &debugErr) {
+		run.recordError(fmt.Sprintf("debug %d", debugErr.Code))
+		return
+	}
+	run.recordError("client")
+}
+
+// The first bot of a lobby owns it
+func (run *loadTestRun) runLobby(ctx context.Context, index int) {
+	colonyID := LOAD_TEST_FIRST_COLONY_ID + uint32(index)
+	ownerID := LOAD_TEST_FIRST_PLAYER_ID + uint32(index*run.options.ClientsPerLobby)
+
+	run.lobbiesAttempted.Add(1)
+	ownerToken, err := run.tokenFor(ownerID, colonyID, ownerID)
+	if err != nil {
+		run.recordError("sign token")
+		return
+	}
+	lobbyID, err := client.CreateLobby(ctx, run.options.Target, ownerToken, client.CreateLobbyOptions{Encoding: run.options.Encoding})
+	if err != nil {
+		run.recordError(describeLoadTestAPIError("create lobby", err))
+		return
+	}
+	run.lobbiesCreated.Add(1)
+
+	bots := make([]*loadTestBot, 0, run.options.ClientsPerLobby)
+	defer func() {
+		// Guests first, as the lobby closes along with its owner
+		for i := len(bots) - 1; i >= 0; i-- {
+			bots[i].client.Close()
+		}
+	}()
+	for i := 0; i < run.options.ClientsPerLobby; i++ {
+		playerID := ownerID + uint32(i)
+		token, err := run.tokenFor(playerID, colonyID, ownerID)
+		if err != nil {
+			run.recordError("sign token")
+			return
+		}
+		bot := newLoadTestBot(run, i, playerID)
+		run.connectsAttempted.Add(1)
+		if err := bot.client.Connect(ctx, run.options.Target, lobbyID, token); err != nil {
+			run.recordError(describeLoadTestAPIError("connect", err))
+			if i == 0 {
+				return
+			}
+			continue
+		}
+		run.connectsSucceed.Add(1)
+		bots = append(bots, bot)
+	}
+
+	var loops sync.WaitGroup
+	for _, bot := range bots {
+		loops.Add(1)
+		go func(bot *loadTestBot) {
+			defer loops.Done()
+			bot.moveUntilDone(ctx)
+		}(bot)
+	}
+	bots[0].driveMinigames(ctx)
+	loops.Wait()
+}
+
+func (run *loadTestRun) tokenFor(playerID uint32, colonyID uint32, ownerID uint32) (string, error) {
+	claims := auth.JoinTokenClaims{PlayerID: playerID, ColonyID: colonyID, OwnerID: ownerID, IGN: fmt.Sprintf("bot-%d", playerID)}
+	return run.signer.Sign(claims, run.options.Duration+time.Minute)
+}
+
+func describeLoadTestAPIError(action string, err error) string {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("%s %d", action, apiErr.StatusCode)
+	}
+	return action
+}
+
+func (run *loadTestRun) report(elapsed time.Duration) LoadTestReport {
+	seconds := elapsed.Seconds()
+	report := LoadTestReport{
+		DurationS:         seconds,
+		LobbiesAttempted:  run.lobbiesAttempted.Load(),
+		LobbiesCreated:    run.lobbiesCreated.Load(),
+		ConnectsAttempted: run.connectsAttempted.Load(),
+		ConnectsSucceeded: run.connectsSucceed.Load(),
+		Disconnects:       run.disconnects.Load(),
+		MessagesSent:      run.sent.Load(),
+		MessagesReceived:  run.received.Load(),
+		MoveLatency:       run.probe.latency(),
+		MinigamesBegun:    run.minigamesBegun.Load(),
+		MinigamesWon:      run.minigamesWon.Load(),
+		MinigamesLost:     run.minigamesLost.Load(),
+		MinigamesAborted:  run.minigamesAborted.Load(),
+		ErrorEvents:       run.errorEvents,
+	}
+	// Lobbies failing to be created had no bots attempt to connect, yet still count as failed connections
+	if attempted := report.ConnectsAttempted + (report.LobbiesAttempted-report.LobbiesCreated)*uint64(run.options.ClientsPerLobby); attempted > 0 {
+		report.ConnectSuccessRate = float64(report.ConnectsSucceeded) / float64(attempted)
+	}
+	if seconds > 0 {
+		report.SentPerS = float64(report.MessagesSent) / seconds
+		report.ReceivedPerS = float64(report.MessagesReceived) / seconds
+	}
+	if movesSent := run.movesSent.Load(); movesSent > 0 {
+		report.MoveFanOut = float64(run.movesReceived.Load()) / float64(movesSent)
+	}
+	return report
+}
+
+// A synthetic player, speaking the protocol as the frontend would
+type loadTestBot struct {
+	run     *loadTestRun
+	client  *client.Client
+	index   int
+	isOwner bool
+	ign     string
+	// Signalled when a minigame sequence has ended, one way or the other. Only read by the owner
+	sequenceEnded chan struct{}
+}
+
+func newLoadTestBot(run *loadTestRun, index int, playerID uint32) *loadTestBot {
+	bot := &loadTestBot{
+		run:           run,
+		index:         index,
+		isOwner:       index == 0,
+		ign:           fmt.Sprintf("bot-%d", playerID),
+		sequenceEnded: make(chan struct{}, 1),
+	}
+	bot.client = client.New(client.Options{Encoding: run.options.Encoding, OnError: run.recordClientError})
+	bot.client.OnAny(func(client.Message) {
+		run.received.Add(1)
+	})
+	client.On(bot.client, internal.PLAYER_MOVE_EVENT, func(dto *internal.PlayerMoveMessageDTO) {
+		run.movesReceived.Add(1)
+		run.probe.observe(dto.ColonyLocationID, time.Now())
+	})
+	// Guests learn of the activity from the owner confirming it, the owner joins as it confirms
+	client.On(bot.client, internal.DIFFICULTY_CONFIRMED_FOR_MINIGAME_EVENT, func(*internal.DifficultyConfirmedForMinigameMessageDTO) {
+		sendAs(bot, internal.PLAYER_JOIN_ACTIVITY_EVENT, internal.PlayerJoinActivityMessageDTO{PlayerID: bot.client.ID, IGN: bot.ign})
+	})
+	client.On(bot.client, internal.PLAYERS_DECLARE_INTENT_EVENT, func(*internal.EmptyDTO) {
+		sendAs(bot, internal.PLAYER_READY_EVENT, internal.PlayerReadyMessageDTO{PlayerID: bot.client.ID, IGN: bot.ign})
+	})
+	client.On(bot.client, internal.LOAD_MINIGAME_EVENT, func(*internal.EmptyDTO) {
+		sendAs(bot, internal.PLAYER_LOAD_COMPLETE_EVENT, internal.EmptyDTO{})
+	})
+	// Every asteroid is shot at by one bot only, so the others aren't penalized for missing
+	client.On(bot.client, internal.ASTEROID_SPAWN_EVENT, func(dto *internal.AsteroidSpawnMessageDTO) {
+		if int(dto.ID)%run.options.ClientsPerLobby == bot.index {
+			sendAs(bot, internal.PLAYER_SHOOT_EVENT, internal.PlayerShootAtCodeMessageDTO{PlayerID: bot.client.ID, CharCode: dto.CharCode})
+		}
+	})
+	if !bot.isOwner {
+		return bot
+	}
+	client.On(bot.client, internal.MINIGAME_BEGINS_EVENT, func(*internal.EmptyDTO) {
+		run.minigamesBegun.Add(1)
+	})
+	client.On(bot.client, internal.MINIGAME_WON_EVENT, func(*internal.MinigameWonMessageDTO) {
+		run.minigamesWon.Add(1)
+		bot.endSequence()
+	})
+	client.On(bot.client, internal.MINIGAME_LOST_EVENT, func(*internal.MinigameLostMessageDTO) {
+		run.minigamesLost.Add(1)
+		bot.endSequence()
+	})
+	client.On(bot.client, internal.GENERIC_MINIGAME_UNTIMELY_ABORT, func(*internal.GenericUntimelyAbortMessageDTO) {
+		run.minigamesAborted.Add(1)
+		bot.endSequence()
+	})
+	client.On(bot.client, internal.GENERIC_MINIGAME_SEQUENCE_RESET, func(*internal.EmptyDTO) {
+		run.minigamesAborted.Add(1)
+		bot.endSequence()
+	})
+	return bot
+}
+
+func sendAs[T any](bot *loadTestBot, spec *internal.EventSpecification[T], dto T) {
+	if err := client.Send(bot.client, spec, dto); err != nil {
+		bot.run.recordError("send " + spec.Name)
+		return
+	}
+	bot.run.sent.Add(1)
+}
+
+func (bot *loadTestBot) endSequence() {
+	select {
+	case bot.sequenceEnded <- struct{}{}:
+	default:
+	}
+}
+
+// Moves to a new location every move interval, carrying a latency probe as the location id
+func (bot *loadTestBot) moveUntilDone(ctx context.Context) {
+	// Staggered, so the bots don't all move at once
+	select {
+	case <-ctx.Done():
+		return
+	case <-bot.client.Done():
+		bot.run.disconnects.Add(1)
+		return
+	case <-time.After(time.Duration(rand.Int63n(int64(bot.run.options.MoveInterval)))):
+	}
+	ticker := time.NewTicker(bot.run.options.MoveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-bot.client.Done():
+			bot.run.disconnects.Add(1)
+			return
+		case <-ticker.C:
+			sendAs(bot, internal.PLAYER_MOVE_EVENT, internal.PlayerMoveMessageDTO{
+				PlayerID:         bot.client.ID,
+				ColonyLocationID: bot.run.probe.stamp(time.Now()),
+			})
+			bot.run.movesSent.Add(1)
+		}
+	}
+}
+
+// Confirms a minigame, and the next once it has ended, until done
+func (bot *loadTestBot) driveMinigames(ctx context.Context) {
+	for {
+		sendAs(bot, internal.DIFFICULTY_CONFIRMED_FOR_MINIGAME_EVENT, internal.DifficultyConfirmedForMinigameMessageDTO{
+			ColonyLocationID: 1,
+			MinigameID:       internal.ASTEROIDS_MINIGAME_ID,
+			DifficultyID:     bot.run.options.DifficultyID,
+			DifficultyName:   "loadtest",
+		})
+		sendAs(bot, internal.PLAYER_JOIN_ACTIVITY_EVENT, internal.PlayerJoinActivityMessageDTO{PlayerID: bot.client.ID, IGN: bot.ign})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-bot.client.Done():
+			return
+		case <-bot.sequenceEnded:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bot.run.options.MinigamePause):
+		}
+	}
+}
+
+// Remembers when each probe was sent, for whoever receives it to compute the latency
+type latencyProbe struct {
+	lock  sync.Mutex
+	next  uint32
+	slots [LOAD_TEST_LATENCY_PROBE_SLOTS]struct {
+		probe  uint32
+		sentAt int64
+	}
+	samples []time.Duration
+}
+
+func (p *latencyProbe) stamp(now time.Time) uint32 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.next++
+	slot := &p.slots[p.next%LOAD_TEST_LATENCY_PROBE_SLOTS]
+	slot.probe, slot.sentAt = p.next, now.UnixNano()
+	return p.next
+}
+
+func (p *latencyProbe) observe(probe uint32, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	slot := p.slots[probe%LOAD_TEST_LATENCY_PROBE_SLOTS]
+	// Overwritten by a later probe, or never sent by this run
+	if slot.probe != probe || slot.sentAt == 0 {
+		return
+	}
+	p.samples = append(p.samples, time.Duration(now.UnixNano()-slot.sentAt))
+}
+
+func (p *latencyProbe) latency() LoadTestLatency {
+	p.lock.Lock()
+	samples := append([]time.Duration(nil), p.samples...)
+	p.lock.Unlock()
+	if len(samples) == 0 {
+		return LoadTestLatency{}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return LoadTestLatency{
+		Samples: uint64(len(samples)),
+		P50MS:   durationAsMS(percentileOf(samples, 0.50)),
+		P90MS:   durationAsMS(percentileOf(samples, 0.90)),
+		P99MS:   durationAsMS(percentileOf(samples, 0.99)),
+		MaxMS:   durationAsMS(samples[len(samples)-1]),
+	}
+}
+
+// Nearest rank percentile of samples sorted in ascending order
+func percentileOf(sorted []time.Duration, percentile float64) time.Duration {
+	rank := int(math.Ceil(percentile*float64(len(sorted)))) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
+
+func durationAsMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func WriteLoadTestReportAsText(writer io.Writer, report LoadTestReport) error {
+	kinds := make([]string, 0, len(report.ErrorEvents))
+	for kind := range report.ErrorEvents {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	lines := []string{
+		fmt.Sprintf("Duration:            %.1fs", report.DurationS),
+		fmt.Sprintf("Lobbies:             %d of %d created", report.LobbiesCreated, report.LobbiesAttempted),
+		fmt.Sprintf("Connections:         %d of %d succeeded (%.1f%%), %d dropped", report.ConnectsSucceeded, report.ConnectsAttempted, report.ConnectSuccessRate*100, report.Disconnects),
+		fmt.Sprintf("Messages sent:       %d (%.1f/s)", report.MessagesSent, report.SentPerS),
+		fmt.Sprintf("Messages received:   %d (%.1f/s)", report.MessagesReceived, report.ReceivedPerS),
+		fmt.Sprintf("Move fan-out:        %.2f receivers per move", report.MoveFanOut),
+		fmt.Sprintf("Move latency:        p50 %.2fms, p90 %.2fms, p99 %.2fms, max %.2fms (%d samples)",
+			report.MoveLatency.P50MS, report.MoveLatency.P90MS, report.MoveLatency.P99MS, report.MoveLatency.MaxMS, report.MoveLatency.Samples),
+		fmt.Sprintf("Minigames:           %d begun, %d won, %d lost, %d aborted", report.MinigamesBegun, report.MinigamesWon, report.MinigamesLost, report.MinigamesAborted),
+		fmt.Sprintf("Error events:        %d kinds", len(kinds)),
+	}
+	for _, kind := range kinds {
+		lines = append(lines, fmt.Sprintf("  %-18s %d", kind+":", report.ErrorEvents[kind]))
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(writer, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WriteLoadTestReportAsJSON(writer io.Writer, report LoadTestReport) error {
+	encoded, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding load test report as json: %s", err.Error())
+	}
+	_, err = writer.Write(append(encoded, '\n'))
+	return err
+}
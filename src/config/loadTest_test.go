@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentileOf(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tests := []struct {
+		percentile float64
+		want       time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{0.50, 50 * time.Millisecond},
+		{0.90, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := percentileOf(sorted, tt.percentile); got != tt.want {
+			t.Errorf("Expected p%.0f to be %s, got %s", tt.percentile*100, tt.want, got)
+		}
+	}
+	if got := percentileOf(sorted[:1], 0.99); got != time.Millisecond {
+		t.Errorf("Expected the only sample for any percentile, got %s", got)
+	}
+}
+
+func TestLatencyProbe(t *testing.T) {
+	probe := &latencyProbe{}
+	sentAt := time.Unix(1_700_000_000, 0)
+
+	first := probe.stamp(sentAt)
+	probe.observe(first, sentAt.Add(2*time.Millisecond))
+	probe.observe(first, sentAt.Add(4*time.Millisecond))
+	// Never stamped
+	probe.observe(first+1, sentAt.Add(time.Millisecond))
+	// Overwritten once the probes have wrapped around
+	for i := 0; i < LOAD_TEST_LATENCY_PROBE_SLOTS; i++ {
+		probe.stamp(sentAt)
+	}
+	probe.observe(first, sentAt.Add(time.Millisecond))
+
+	latency := probe.latency()
+	if latency.Samples != 2 {
+		t.Fatalf("Expected 2 samples, got %d", latency.Samples)
+	}
+	if latency.P50MS != 2 || latency.MaxMS != 4 {
+		t.Errorf("Expected p50 2ms and max 4ms, got %+v", latency)
+	}
+}
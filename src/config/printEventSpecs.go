@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,13 +11,16 @@ import (
 	"unicode"
 
 	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
 )
 
 type OutputFormat string
 
 const (
-	TS   OutputFormat = "ts"
-	JSON OutputFormat = "json"
+	TS     OutputFormat = "ts"
+	JSON   OutputFormat = "json"
+	GO     OutputFormat = "go"
+	CSHARP OutputFormat = "cs"
 )
 
 func WriteEventSpecsToFile(file *os.File, outputFormat OutputFormat) error {
@@ -25,6 +29,10 @@ func WriteEventSpecsToFile(file *os.File, outputFormat OutputFormat) error {
 		return writeEventSpecsToTSFile(file)
 	case JSON:
 		return writeEventSpecsToJSONFile(file)
+	case GO:
+		return WriteGoClient(file, goPackageNameFromPath(file.Name()), getOrderedEventSpecs())
+	case CSHARP:
+		return WriteCSharpClient(file, getOrderedEventSpecs())
 	default:
 		return fmt.Errorf("unsupported output format: %s", outputFormat)
 	}
@@ -42,6 +50,9 @@ func writeEventSpecsToTSFile(file *os.File) error {
 		return writeErr
 	}
 	file.WriteString(fmt.Sprintf("// !!! Last Updated (DD/MM/YYYY HH:MM:SS CET): %s !!!\n\n", time.Now().Format("02/01/2006 15:04:05 MST")))
+	//Protocol handshake, to be given as query params on /connect
+	file.WriteString(fmt.Sprintf("export const PROTOCOL_VERSION = %d;\n", internal.PROTOCOL_VERSION))
+	file.WriteString(fmt.Sprintf("export const SPEC_FINGERPRINT = \"%s\";\n\n", internal.ProtocolFingerprint()))
 	//TS Types - OriginType enum
 	file.WriteString("export enum OriginType {\n")
 	file.WriteString("\tServer = \"server\",\n")
@@ -65,7 +76,13 @@ func writeEventSpecsToTSFile(file *os.File) error {
 	file.WriteString("\toffset: number,\n")
 	file.WriteString("\tdescription: string,\n")
 	file.WriteString("\tfieldName: string,\n")
-	file.WriteString(fmt.Sprintf("\ttype: %s\n", nameOfTypeEnum))
+	file.WriteString(fmt.Sprintf("\ttype: %s,\n", nameOfTypeEnum))
+	file.WriteString("\t/** Byte size of the length prefix of a string or slice. 0 means none: A string spanning the rest of the message */\n")
+	file.WriteString("\tlengthPrefix: number,\n")
+	file.WriteString("\t/** Slices only */\n")
+	file.WriteString(fmt.Sprintf("\telementType?: %s,\n", nameOfTypeEnum))
+	file.WriteString("\t/** Slices of structs only. Offsets are relative to the start of each element */\n")
+	file.WriteString("\telements?: MessageElementDescriptor[]\n")
 	file.WriteString("};\n\n")
 
 	//TS Types - EventSpecification
@@ -85,6 +102,12 @@ func writeEventSpecsToTSFile(file *os.File) error {
 	})
 	file.WriteString(eventEnum)
 
+	//Minigame ID Enum, as registered by each minigame
+	minigameEnum := FormatTSEnum("MinigameID", internal.RegisteredMinigames(), func(minigame *internal.MinigameRegistration) (string, string) {
+		return formatTSConstantName(minigame.Name, ""), fmt.Sprint(minigame.ID)
+	})
+	file.WriteString(minigameEnum)
+
 	//Player penalty types for Asteroids Minigame
 	file.WriteString("\nexport enum PlayerPenaltyType {\n")
 	file.WriteString(fmt.Sprintf("\tMiss = \"%s\",\n", internal.PLAYER_PENALTY_TYPE_MISS))
@@ -115,22 +138,7 @@ func writeEventSpecsToTSFile(file *os.File) error {
 		file.WriteString(fmt.Sprintf("\tname: \"%s\",\n", spec.Name))
 		file.WriteString(fmt.Sprintf("\tpermissions: %s,\n", formatTSSendPermissions(spec.SendPermissions)))
 		file.WriteString(fmt.Sprintf("\texpectedMinSize: %d,\n", spec.ExpectedMinSize))
-		file.WriteString("\tstructure: [\n")
-		// Message Structure
-		for i, element := range spec.Structure {
-			file.WriteString("\t\t{\n")
-			file.WriteString(fmt.Sprintf("\t\t\tbyteSize: %d,\n", element.ByteSize))
-			file.WriteString(fmt.Sprintf("\t\t\toffset: %d,\n", element.Offset))
-			file.WriteString(fmt.Sprintf("\t\t\tdescription: \"%s\",\n", element.Description))
-			file.WriteString(fmt.Sprintf("\t\t\tfieldName: \"%s\",\n", element.FieldName))
-			file.WriteString(fmt.Sprintf("\t\t\ttype: %s\n", fmt.Sprintf("%s.%s", nameOfTypeEnum, formatTSConstantName(element.Kind.String(), ""))))
-			if i == len(spec.Structure)-1 {
-				file.WriteString("\t\t}\n")
-			} else {
-				file.WriteString("\t\t},\n")
-			}
-		}
-		file.WriteString("\t]\n")
+		file.WriteString(fmt.Sprintf("\tstructure: %s\n", formatTSStructure(spec.Structure, nameOfTypeEnum, "\t")))
 		file.WriteString("}\n")
 	}
 	file.WriteString("\n")
@@ -144,7 +152,43 @@ func writeEventSpecsToTSFile(file *os.File) error {
 		}
 	}
 	file.WriteString("};\n")
-	return nil
+
+	codec, err := formatTSCodec(specs, nameOfEventEnum)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(codec)
+	return err
+}
+
+// Writes the structure as a TS array of MessageElementDescriptor, nested elements included
+func formatTSStructure(structure internal.ComputedStructure, nameOfTypeEnum string, indent string) string {
+	if len(structure) == 0 {
+		return "[]"
+	}
+	result := "[\n"
+	for i, element := range structure {
+		result += fmt.Sprintf("%s\t{\n", indent)
+		result += fmt.Sprintf("%s\t\tbyteSize: %d,\n", indent, element.ByteSize)
+		result += fmt.Sprintf("%s\t\toffset: %d,\n", indent, element.Offset)
+		result += fmt.Sprintf("%s\t\tdescription: \"%s\",\n", indent, element.Description)
+		result += fmt.Sprintf("%s\t\tfieldName: \"%s\",\n", indent, element.FieldName)
+		result += fmt.Sprintf("%s\t\ttype: %s.%s,\n", indent, nameOfTypeEnum, formatTSConstantName(element.Kind.String(), ""))
+		if element.Kind == reflect.Slice {
+			result += fmt.Sprintf("%s\t\telementType: %s.%s,\n", indent, nameOfTypeEnum, formatTSConstantName(element.ElementKind.String(), ""))
+		}
+		if len(element.Elements) > 0 {
+			result += fmt.Sprintf("%s\t\telements: %s,\n", indent, formatTSStructure(element.Elements, nameOfTypeEnum, indent+"\t\t"))
+		}
+		result += fmt.Sprintf("%s\t\tlengthPrefix: %d\n", indent, element.LengthPrefix)
+		if i == len(structure)-1 {
+			result += fmt.Sprintf("%s\t}\n", indent)
+		} else {
+			result += fmt.Sprintf("%s\t},\n", indent)
+		}
+	}
+	result += fmt.Sprintf("%s]", indent)
+	return result
 }
 
 // Writes a TS type for the message structure of the event
@@ -166,9 +210,9 @@ func formatTSTypeForEvent(spec internal.EventSpecification[any], parents []strin
 	var toReturn = fmt.Sprintf("export interface %s %s {\n", typeName, formattedParentExtendsString)
 
 	for _, element := range spec.Structure {
-		tsType := TSTypeOf(element.Kind)
+		tsType := TSTypeOfElement(element)
 		toReturn += fmt.Sprintf("\t/** %s\n\t*\n", element.Description)
-		toReturn += fmt.Sprintf("\t* go type: %s\n", element.Kind.String())
+		toReturn += fmt.Sprintf("\t* go type: %s\n", formatGoTypeOfElement(element))
 		toReturn += "\t*/\n"
 		toReturn += fmt.Sprintf("\t%s: %s;\n", element.FieldName, tsType)
 	}
@@ -179,35 +223,114 @@ func formatTSTypeForEvent(spec internal.EventSpecification[any], parents []strin
 
 func insertJSDOCCommentDescribingStructure(file *os.File, spec internal.EventSpecification[any]) {
 	file.WriteString(fmt.Sprintf("/** %s Message Structure\n *\n", spec.Name))
+	// Once past a variable size element, offsets are only minimums
+	var offsetIsExact = true
 	for _, element := range spec.Structure {
-		isVariable := element.ByteSize == 0
-		if isVariable {
-			file.WriteString(fmt.Sprintf(" * *\t%db --> +%sb:\t%-10s:\t%s\n", element.Offset, "N", element.Kind, element.Description))
+		minimum := util.Ternary(offsetIsExact, "", ">=")
+		offset := fmt.Sprintf("%s%db", minimum, element.Offset)
+		typeName := formatGoTypeOfElement(element)
+		if element.IsVariableSize() {
+			size := "N"
+			if element.LengthPrefix != internal.LENGTH_PREFIX_NONE {
+				size = fmt.Sprintf("%d+N", element.LengthPrefix)
+			}
+			file.WriteString(fmt.Sprintf(" * *\t%s --> +%sb:\t%-10s:\t%s\n", offset, size, typeName, element.Description))
+			offsetIsExact = false
 		} else {
-			file.WriteString(fmt.Sprintf(" * *\t%db --> %db:\t%-10s:\t%s\n", element.Offset, element.Offset+element.ByteSize, element.Kind, element.Description))
+			file.WriteString(fmt.Sprintf(" * *\t%s --> %s%db:\t%-10s:\t%s\n", offset, minimum, element.Offset+element.ByteSize, typeName, element.Description))
 		}
 	}
 	file.WriteString(" */\n")
 }
 
-func writeEventSpecsToJSONFile(file *os.File) error {
-	file.WriteString("[\n")
-	specs := getOrderedEventSpecs()
-	for index, spec := range specs {
-		file.WriteString("{\n")
-		file.WriteString(fmt.Sprintf("\t\"id\": %d,\n", spec.ID))
-		file.WriteString(fmt.Sprintf("\t\"name\": \"%s\",\n", spec.Name))
-		file.WriteString(fmt.Sprintf("\t\"permissions\": %s,\n", formatJSONSendPermissions(spec.SendPermissions)))
-		file.WriteString(fmt.Sprintf("\t\"expectedMinSize\": %d\n", spec.ExpectedMinSize))
-		if index == len(specs)-1 {
-			file.WriteString("}\n")
-		} else {
-			file.WriteString("},\n")
+// Fx. "[]uint32 (u16 prefixed)"
+func formatGoTypeOfElement(element internal.MessageElementDescriptor) string {
+	typeName := element.Kind.String()
+	if element.Kind == reflect.Slice {
+		typeName = "[]" + element.ElementKind.String()
+	}
+	if element.LengthPrefix != internal.LENGTH_PREFIX_NONE {
+		typeName += fmt.Sprintf(" (%s prefixed)", element.LengthPrefix)
+	}
+	return typeName
+}
+
+type jsonEventSpecification struct {
+	ID              uint32                       `json:"id"`
+	Name            string                       `json:"name"`
+	Comment         string                       `json:"comment"`
+	Permissions     map[internal.OriginType]bool `json:"permissions"`
+	ExpectedMinSize uint32                       `json:"expectedMinSize"`
+	Structure       []jsonElementDescriptor      `json:"structure"`
+}
+
+type jsonElementDescriptor struct {
+	ByteSize     uint32                  `json:"byteSize"`
+	Offset       uint32                  `json:"offset"`
+	Description  string                  `json:"description"`
+	FieldName    string                  `json:"fieldName"`
+	Type         string                  `json:"type"`
+	LengthPrefix uint32                  `json:"lengthPrefix"`
+	ElementType  string                  `json:"elementType,omitempty"`
+	Elements     []jsonElementDescriptor `json:"elements,omitempty"`
+}
+
+func toJSONStructure(structure internal.ComputedStructure) []jsonElementDescriptor {
+	result := make([]jsonElementDescriptor, 0, len(structure))
+	for _, element := range structure {
+		descriptor := jsonElementDescriptor{
+			ByteSize:     element.ByteSize,
+			Offset:       element.Offset,
+			Description:  element.Description,
+			FieldName:    element.FieldName,
+			Type:         element.Kind.String(),
+			LengthPrefix: uint32(element.LengthPrefix),
 		}
+		if element.Kind == reflect.Slice {
+			descriptor.ElementType = element.ElementKind.String()
+		}
+		if len(element.Elements) > 0 {
+			descriptor.Elements = toJSONStructure(element.Elements)
+		}
+		result = append(result, descriptor)
 	}
-	file.WriteString("]\n")
+	return result
+}
 
-	return fmt.Errorf("not implemented")
+type jsonEventSpecifications struct {
+	ProtocolVersion uint32                   `json:"protocolVersion"`
+	SpecFingerprint string                   `json:"specFingerprint"`
+	Events          []jsonEventSpecification `json:"events"`
+}
+
+func writeEventSpecsToJSONFile(file *os.File) error {
+	encoded, err := json.MarshalIndent(toJSONEventSpecifications(getOrderedEventSpecs()), "", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding event specs as json: %s", err.Error())
+	}
+	if _, err := file.Write(append(encoded, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+func toJSONEventSpecifications(specs []internal.EventSpecification[any]) jsonEventSpecifications {
+	asJSON := jsonEventSpecifications{
+		ProtocolVersion: internal.PROTOCOL_VERSION,
+		SpecFingerprint: internal.ProtocolFingerprint(),
+		Events:          make([]jsonEventSpecification, 0, len(specs)),
+	}
+	for _, spec := range specs {
+		asJSON.Events = append(asJSON.Events, jsonEventSpecification{
+			ID:              spec.ID,
+			Name:            spec.Name,
+			Comment:         spec.Comment,
+			Permissions:     spec.SendPermissions,
+			ExpectedMinSize: spec.ExpectedMinSize,
+			Structure:       toJSONStructure(spec.Structure),
+		})
+	}
+	return asJSON
 }
 
 func getOrderedEventSpecs() []internal.EventSpecification[any] {
@@ -261,6 +384,10 @@ func GetOutputFormatFromPath(path string) (OutputFormat, error) {
 		return TS, nil
 	case ".json":
 		return JSON, nil
+	case ".go":
+		return GO, nil
+	case ".cs":
+		return CSHARP, nil
 	}
 
 	return "", fmt.Errorf("unsupported file extension: %s", filepath.Ext(path))
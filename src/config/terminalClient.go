@@ -0,0 +1,235 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/client"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+const TERMINAL_CLIENT_PROMPT = "> "
+
+const TERMINAL_CLIENT_HELP = `Commands:
+  send <event name> <dto as json>   Serializes and sends the event, fx. send PlayerMove {"playerID":5,"colonyLocationID":3}
+  events [filter]                   Lists the events, optionally only those whose name contains the filter
+  describe <event name>             Shows the fields of the event, and its DTO as json
+  help                              Shows this
+  quit                              Leaves the lobby
+Event names are case insensitive. Incoming messages are printed as: <- <sender id> <event name> <dto as json>`
+
+type TerminalClientOptions struct {
+	// Base url of the service, fx. http://localhost:9062
+	URL     string
+	LobbyID uint32
+	Token   string
+	// Defaults to binary
+	Encoding meta.MessageEncoding
+}
+
+// Reads commands from in until it ends or quit is given, printing incoming messages to out as they arrive
+func RunTerminalClient(ctx context.Context, in io.Reader, out io.Writer, options TerminalClientOptions) error {
+	if err := internal.InitEventSpecifications(); err != nil {
+		return err
+	}
+	terminal := &terminalClient{out: out, specsByName: terminalClientSpecsByName(internal.ALL_EVENTS)}
+	c := client.New(client.Options{
+		Encoding: options.Encoding,
+		OnError: func(err error) {
+			// Debug events are printed as any other message
+			if _, isDebug := err.(*client.DebugError); !isDebug {
+				terminal.printf("! %s\n", err.Error())
+			}
+		},
+	})
+	c.OnAny(func(message client.Message) {
+		terminal.printf("<- %s\n", formatTerminalClientMessage(message))
+	})
+	if err := c.Connect(ctx, options.URL, options.LobbyID, options.Token); err != nil {
+		return err
+	}
+	defer c.Close()
+	terminal.printf("Connected to lobby %d as %d (%s). Type help for commands\n", c.LobbyID, c.ID, c.Origin())
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	for {
+		terminal.printf(TERMINAL_CLIENT_PROMPT)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.Done():
+			terminal.printf("Connection closed\n")
+			return c.Err()
+		case line, open := <-lines:
+			if !open {
+				return nil
+			}
+			if quit := terminal.execute(c, strings.TrimSpace(line)); quit {
+				return nil
+			}
+		}
+	}
+}
+
+type terminalClient struct {
+	outLock     sync.Mutex
+	out         io.Writer
+	specsByName map[string]*internal.EventSpecification[any]
+}
+
+// Incoming messages are printed from another goroutine than the commands, so all output goes through here
+func (t *terminalClient) printf(format string, args ...any) {
+	t.outLock.Lock()
+	defer t.outLock.Unlock()
+	fmt.Fprintf(t.out, format, args...)
+}
+
+// Returns true if the client is to quit
+func (t *terminalClient) execute(c *client.Client, line string) bool {
+	command, argument, _ := strings.Cut(line, " ")
+	argument = strings.TrimSpace(argument)
+	switch strings.ToLower(command) {
+	case "":
+	case "quit", "exit":
+		return true
+	case "help":
+		t.printf("%s\n", TERMINAL_CLIENT_HELP)
+	case "events":
+		t.printf("%s", formatTerminalClientEvents(t.specsByName, argument))
+	case "describe":
+		spec, err := t.specNamed(argument)
+		if err != nil {
+			t.printf("! %s\n", err.Error())
+			return false
+		}
+		t.printf("%s", describeTerminalClientEvent(spec))
+	case "send":
+		name, dto, _ := strings.Cut(argument, " ")
+		spec, err := t.specNamed(name)
+		if err != nil {
+			t.printf("! %s\n", err.Error())
+			return false
+		}
+		message, err := serializeTerminalClientDTO(spec, dto)
+		if err != nil {
+			t.printf("! %s\n", err.Error())
+			return false
+		}
+		// Not checked against the permissions of the spec, so the service can be tested with what it ought to refuse
+		if origin := c.Origin(); !spec.SendPermissions[origin] {
+			t.printf("Note: %s may not send %s, expect the service to refuse it\n", origin, spec.Name)
+		}
+		if err := c.SendRaw(message); err != nil {
+			t.printf("! error sending: %s\n", err.Error())
+			return false
+		}
+		t.printf("-> %s (%d bytes)\n", spec.Name, len(message))
+	default:
+		t.printf("! unknown command %s, type help for commands\n", command)
+	}
+	return false
+}
+
+func (t *terminalClient) specNamed(name string) (*internal.EventSpecification[any], error) {
+	if name == "" {
+		return nil, fmt.Errorf("no event name given")
+	}
+	spec, exists := t.specsByName[strings.ToLower(name)]
+	if !exists {
+		return nil, fmt.Errorf("no event named %s, see events", name)
+	}
+	return spec, nil
+}
+
+func terminalClientSpecsByName(specs map[internal.MessageID]*internal.EventSpecification[any]) map[string]*internal.EventSpecification[any] {
+	byName := make(map[string]*internal.EventSpecification[any], len(specs))
+	for _, spec := range specs {
+		byName[strings.ToLower(spec.Name)] = spec
+	}
+	return byName
+}
+
+// Decodes the json into the DTO of the spec and serializes it, event id included. Unknown fields are refused, to catch typos
+func serializeTerminalClientDTO(spec *internal.EventSpecification[any], dtoJSON string) ([]byte, error) {
+	dto := reflect.New(spec.DTOType)
+	if strings.TrimSpace(dtoJSON) != "" {
+		decoder := json.NewDecoder(strings.NewReader(dtoJSON))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(dto.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", spec.Name, err.Error())
+		}
+	}
+	return internal.Serialize(spec, dto.Elem().Interface())
+}
+
+// <sender id> <event name> <dto as json>, or the body as hex if it can't be decoded
+func formatTerminalClientMessage(message client.Message) string {
+	spec, exists := internal.ALL_EVENTS[message.EventID]
+	if !exists {
+		return fmt.Sprintf("%d unknown event %d %x", message.SenderID, message.EventID, message.Body)
+	}
+	dto, err := internal.DeserializeDTO(spec, message.Body, true)
+	if err != nil {
+		return fmt.Sprintf("%d %s %x (%s)", message.SenderID, spec.Name, message.Body, err.Error())
+	}
+	asJSON, err := json.Marshal(dto)
+	if err != nil {
+		return fmt.Sprintf("%d %s %x (%s)", message.SenderID, spec.Name, message.Body, err.Error())
+	}
+	return fmt.Sprintf("%d %s %s", message.SenderID, spec.Name, asJSON)
+}
+
+func formatTerminalClientEvents(specsByName map[string]*internal.EventSpecification[any], filter string) string {
+	var specs []*internal.EventSpecification[any]
+	for name, spec := range specsByName {
+		if strings.Contains(name, strings.ToLower(filter)) {
+			specs = append(specs, spec)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].ID < specs[j].ID
+	})
+	var result bytes.Buffer
+	for _, spec := range specs {
+		var senders []string
+		for _, origin := range []internal.OriginType{internal.ORIGIN_TYPE_OWNER, internal.ORIGIN_TYPE_GUEST, internal.ORIGIN_TYPE_SERVER} {
+			if spec.SendPermissions[origin] {
+				senders = append(senders, origin)
+			}
+		}
+		fmt.Fprintf(&result, "%6d %-40s %s\n", spec.ID, spec.Name, strings.Join(senders, ", "))
+	}
+	return result.String()
+}
+
+func describeTerminalClientEvent(spec *internal.EventSpecification[any]) string {
+	var result bytes.Buffer
+	fmt.Fprintf(&result, "%d %s: %s\n", spec.ID, spec.Name, spec.Comment)
+	for _, element := range spec.Structure {
+		elementType := element.Kind.String()
+		if element.Kind == reflect.Slice {
+			elementType = "[]" + element.ElementKind.String()
+		}
+		fmt.Fprintf(&result, "  %-20s %-10s %s\n", element.FieldName, elementType, element.Description)
+	}
+	if template, err := json.Marshal(reflect.New(spec.DTOType).Interface()); err == nil {
+		fmt.Fprintf(&result, "  send %s %s\n", spec.Name, template)
+	}
+	return result.String()
+}
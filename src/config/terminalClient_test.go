@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/client"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+)
+
+func TestSerializeTerminalClientDTO(t *testing.T) {
+	if err := initEventSpecifications(); err != nil {
+		t.Fatalf("Unexpected error initializing event specifications: %v", err)
+	}
+	terminal := &terminalClient{specsByName: terminalClientSpecsByName(internal.ALL_EVENTS)}
+
+	spec, err := terminal.specNamed("playermove")
+	if err != nil {
+		t.Fatalf("Expected PlayerMove to be found case insensitively, got %v", err)
+	}
+	got, err := serializeTerminalClientDTO(spec, `{"playerID":5,"colonyLocationID":3}`)
+	if err != nil {
+		t.Fatalf("Unexpected error serializing: %v", err)
+	}
+	want, err := internal.Serialize(internal.PLAYER_MOVE_EVENT, internal.PlayerMoveMessageDTO{PlayerID: 5, ColonyLocationID: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error serializing: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+
+	if _, err := serializeTerminalClientDTO(spec, `{"playerId":5,"colonyLocation":3}`); err == nil {
+		t.Error("Expected unknown fields to be refused")
+	}
+	if _, err := terminal.specNamed("NoSuchEvent"); err == nil {
+		t.Error("Expected unknown event name to be refused")
+	}
+}
+
+func TestFormatTerminalClientMessage(t *testing.T) {
+	if err := initEventSpecifications(); err != nil {
+		t.Fatalf("Unexpected error initializing event specifications: %v", err)
+	}
+	serialized, err := internal.Serialize(internal.PLAYER_MOVE_EVENT, internal.PlayerMoveMessageDTO{PlayerID: 5, ColonyLocationID: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error serializing: %v", err)
+	}
+	message := client.Message{SenderID: 5, EventID: internal.PLAYER_MOVE_EVENT.ID, Body: serialized[internal.MESSAGE_HEADER_SIZE/2:]}
+
+	got := formatTerminalClientMessage(message)
+	if !strings.HasPrefix(got, "5 PlayerMove {") || !strings.Contains(got, `"colonyLocationID":3`) {
+		t.Errorf("Expected PlayerMove from 5 as json, got %s", got)
+	}
+	unknown := formatTerminalClientMessage(client.Message{SenderID: 5, EventID: 999_999, Body: []byte{1, 2}})
+	if unknown != "5 unknown event 999999 0102" {
+		t.Errorf("Expected unknown event as hex, got %s", unknown)
+	}
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+// Sender id in the header of every vector. Its bytes differ, so decoders reading it in the wrong byte order are caught
+const TEST_VECTOR_SENDER_ID uint32 = 0x01020304
+
+// Longer than 255 bytes, so decoders reading a length prefix as a single byte are caught
+const TEST_VECTOR_LONG_STRING_LENGTH = 300
+
+const TEST_VECTOR_UNICODE_STRING = "Ünïcødé ✓ 日本語 🚀 é"
+
+type TestVectorCase string
+
+const (
+	// All numbers 0, all strings and arrays empty
+	TEST_VECTOR_CASE_ZERO TestVectorCase = "zero"
+	// The smallest value of every number, a single element in every array
+	TEST_VECTOR_CASE_MIN TestVectorCase = "min"
+	// The largest value of every number, long strings and multiple elements in every array
+	TEST_VECTOR_CASE_MAX TestVectorCase = "max"
+	// Multi-byte characters in every string
+	TEST_VECTOR_CASE_UNICODE TestVectorCase = "unicode"
+)
+
+var TEST_VECTOR_CASES = []TestVectorCase{TEST_VECTOR_CASE_ZERO, TEST_VECTOR_CASE_MIN, TEST_VECTOR_CASE_MAX, TEST_VECTOR_CASE_UNICODE}
+
+// A message as it is sent to clients, header included, along with the DTO it must decode to
+type TestVector struct {
+	EventID   uint32         `json:"eventID"`
+	EventName string         `json:"event"`
+	Case      TestVectorCase `json:"case"`
+	// The DTO as json, using the same field names as the event specifications
+	DTO    json.RawMessage `json:"dto"`
+	Hex    string          `json:"hex"`
+	Base64 string          `json:"base64"`
+}
+
+type TestVectors struct {
+	ProtocolVersion uint32       `json:"protocolVersion"`
+	SpecFingerprint string       `json:"specFingerprint"`
+	SenderID        uint32       `json:"senderID"`
+	Vectors         []TestVector `json:"vectors"`
+}
+
+// Serializes a sample DTO of every case for each spec given
+func BuildTestVectors(specs []internal.EventSpecification[any]) (TestVectors, error) {
+	vectors := TestVectors{
+		ProtocolVersion: internal.PROTOCOL_VERSION,
+		SpecFingerprint: internal.ProtocolFingerprint(),
+		SenderID:        TEST_VECTOR_SENDER_ID,
+		Vectors:         make([]TestVector, 0, len(specs)*len(TEST_VECTOR_CASES)),
+	}
+	for i := range specs {
+		spec := &specs[i]
+		if spec.DTOType == nil {
+			return vectors, fmt.Errorf("spec %s has no DTO type", spec.Name)
+		}
+		for _, sampleCase := range TEST_VECTOR_CASES {
+			sample := reflect.New(spec.DTOType).Elem()
+			if err := fillTestVectorSample(sample, sampleCase); err != nil {
+				return vectors, fmt.Errorf("building %s sample of %s: %s", sampleCase, spec.Name, err.Error())
+			}
+			vector, err := buildTestVector(spec, sampleCase, sample.Interface())
+			if err != nil {
+				return vectors, fmt.Errorf("serializing %s sample of %s: %s", sampleCase, spec.Name, err.Error())
+			}
+			vectors.Vectors = append(vectors.Vectors, vector)
+		}
+	}
+	return vectors, nil
+}
+
+func buildTestVector(spec *internal.EventSpecification[any], sampleCase TestVectorCase, dto any) (TestVector, error) {
+	serialized, err := internal.Serialize(spec, dto)
+	if err != nil {
+		return TestVector{}, err
+	}
+	message := append(util.BytesOfUint32(TEST_VECTOR_SENDER_ID), serialized...)
+	asJSON, err := json.Marshal(dto)
+	if err != nil {
+		return TestVector{}, err
+	}
+	return TestVector{
+		EventID:   spec.ID,
+		EventName: spec.Name,
+		Case:      sampleCase,
+		DTO:       asJSON,
+		Hex:       string(util.EncodeBase16(message)),
+		Base64:    string(util.EncodeBase64(message)),
+	}, nil
+}
+
+// Sets every field of the struct value to the sample value of the case
+func fillTestVectorSample(v reflect.Value, sampleCase TestVectorCase) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := fillTestVectorSample(v.Field(i), sampleCase); err != nil {
+				return fmt.Errorf("field %s: %s", v.Type().Field(i).Name, err.Error())
+			}
+		}
+	case reflect.Slice:
+		// Never nil, as a nil slice is "null" in json but decodes as empty
+		length := map[TestVectorCase]int{TEST_VECTOR_CASE_ZERO: 0, TEST_VECTOR_CASE_MIN: 1, TEST_VECTOR_CASE_MAX: 3, TEST_VECTOR_CASE_UNICODE: 2}[sampleCase]
+		slice := reflect.MakeSlice(v.Type(), length, length)
+		for i := 0; i < length; i++ {
+			if err := fillTestVectorSample(slice.Index(i), sampleCase); err != nil {
+				return fmt.Errorf("element %d: %s", i, err.Error())
+			}
+		}
+		v.Set(slice)
+	case reflect.String:
+		switch sampleCase {
+		case TEST_VECTOR_CASE_MAX:
+			v.SetString(strings.Repeat("x", TEST_VECTOR_LONG_STRING_LENGTH))
+		case TEST_VECTOR_CASE_UNICODE:
+			v.SetString(TEST_VECTOR_UNICODE_STRING)
+		}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch sampleCase {
+		case TEST_VECTOR_CASE_MAX:
+			v.SetUint(math.MaxUint64 >> (64 - v.Type().Bits()))
+		case TEST_VECTOR_CASE_UNICODE:
+			v.SetUint(1)
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch sampleCase {
+		case TEST_VECTOR_CASE_MIN:
+			v.SetInt(math.MinInt64 >> (64 - v.Type().Bits()))
+		case TEST_VECTOR_CASE_MAX:
+			v.SetInt(math.MaxInt64 >> (64 - v.Type().Bits()))
+		case TEST_VECTOR_CASE_UNICODE:
+			v.SetInt(-1)
+		}
+	case reflect.Float32, reflect.Float64:
+		largest := util.Ternary(v.Kind() == reflect.Float32, math.MaxFloat32, math.MaxFloat64)
+		switch sampleCase {
+		case TEST_VECTOR_CASE_MIN:
+			v.SetFloat(-largest)
+		case TEST_VECTOR_CASE_MAX:
+			v.SetFloat(largest)
+		case TEST_VECTOR_CASE_UNICODE:
+			v.SetFloat(0.5)
+		}
+	default:
+		return fmt.Errorf("kind %s has no sample value", v.Kind())
+	}
+	return nil
+}
+
+func WriteTestVectors(writer io.Writer, vectors TestVectors) error {
+	encoded, err := json.MarshalIndent(vectors, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding test vectors as json: %s", err.Error())
+	}
+	_, err = writer.Write(append(encoded, '\n'))
+	return err
+}
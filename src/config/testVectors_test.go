@@ -0,0 +1,71 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+)
+
+func TestTestVectorsRoundTrip(t *testing.T) {
+	if err := initEventSpecifications(); err != nil {
+		t.Fatalf("Expected no error initializing event specifications, got %v", err)
+	}
+	built, err := BuildTestVectors(getOrderedEventSpecs())
+	if err != nil {
+		t.Fatalf("Expected no error building test vectors, got %v", err)
+	}
+
+	// Read back from the written file, as a client would
+	var written bytes.Buffer
+	if err := WriteTestVectors(&written, built); err != nil {
+		t.Fatalf("Expected no error writing test vectors, got %v", err)
+	}
+	var vectors TestVectors
+	if err := json.Unmarshal(written.Bytes(), &vectors); err != nil {
+		t.Fatalf("Expected written test vectors to be valid json, got %v", err)
+	}
+	if expected := len(internal.ALL_EVENTS) * len(TEST_VECTOR_CASES); len(vectors.Vectors) != expected {
+		t.Fatalf("Expected %d vectors, got %d", expected, len(vectors.Vectors))
+	}
+
+	for _, vector := range vectors.Vectors {
+		t.Run(fmt.Sprintf("%s/%s", vector.EventName, vector.Case), func(t *testing.T) {
+			message, err := hex.DecodeString(vector.Hex)
+			if err != nil {
+				t.Fatalf("Expected valid hex, got %v", err)
+			}
+			if fromBase64, err := base64.StdEncoding.DecodeString(vector.Base64); err != nil || !bytes.Equal(fromBase64, message) {
+				t.Fatalf("Expected base64 to hold the same message as hex, got %x (%v)", fromBase64, err)
+			}
+			if senderID := binary.BigEndian.Uint32(message[0:4]); senderID != TEST_VECTOR_SENDER_ID {
+				t.Errorf("Expected sender id %d, got %d", TEST_VECTOR_SENDER_ID, senderID)
+			}
+			if eventID := binary.BigEndian.Uint32(message[4:8]); eventID != vector.EventID {
+				t.Errorf("Expected event id %d, got %d", vector.EventID, eventID)
+			}
+
+			spec := internal.ALL_EVENTS[internal.MessageID(vector.EventID)]
+			dto, err := internal.DeserializeDTO(spec, message, false)
+			if err != nil {
+				t.Fatalf("Expected no error deserializing, got %v", err)
+			}
+			asJSON, err := json.Marshal(dto)
+			if err != nil {
+				t.Fatalf("Expected no error encoding deserialized DTO, got %v", err)
+			}
+			var expected bytes.Buffer
+			if err := json.Compact(&expected, vector.DTO); err != nil {
+				t.Fatalf("Expected the DTO of the vector to be valid json, got %v", err)
+			}
+			if !bytes.Equal(asJSON, expected.Bytes()) {
+				t.Errorf("Expected DTO %s, got %s", expected.Bytes(), asJSON)
+			}
+		})
+	}
+}
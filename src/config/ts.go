@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
 )
 
 func FormatTSEnum[T any](name string, data []T, formatter func(T) (string, string)) string {
@@ -32,6 +35,21 @@ func TSTypeOf(kind reflect.Kind) string {
 	}
 }
 
+// PANICS if the kind of the element, or of its elements, is not supported
+func TSTypeOfElement(element internal.MessageElementDescriptor) string {
+	if element.Kind != reflect.Slice {
+		return TSTypeOf(element.Kind)
+	}
+	if element.ElementKind != reflect.Struct {
+		return TSTypeOf(element.ElementKind) + "[]"
+	}
+	fields := make([]string, 0, len(element.Elements))
+	for _, nested := range element.Elements {
+		fields = append(fields, fmt.Sprintf("%s: %s", nested.FieldName, TSTypeOfElement(nested)))
+	}
+	return fmt.Sprintf("{ %s }[]", strings.Join(fields, ", "))
+}
+
 func insertRawJSDOCComment(file *os.File, comment string) {
 	file.WriteString(fmt.Sprintf("/**\n * %s\n */\n", comment))
 }
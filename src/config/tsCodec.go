@@ -0,0 +1,393 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+// Writes serializeX and deserializeX functions per event, along with the runtime they rely on,
+// message (text) encoding helpers and a dispatcher keyed on event id.
+// Expects the types and the EventType enum written by writeEventSpecsToTSFile
+func formatTSCodec(specs []internal.EventSpecification[any], nameOfEventEnum string) (string, error) {
+	var result strings.Builder
+	result.WriteString(TS_CODEC_RUNTIME)
+	result.WriteString(FormatTSEnum("MessageEncoding", []meta.MessageEncoding{meta.MESSAGE_ENCODING_BINARY, meta.MESSAGE_ENCODING_BASE16, meta.MESSAGE_ENCODING_BASE64},
+		func(encoding meta.MessageEncoding) (string, string) {
+			return formatTSConstantName(string(encoding), ""), fmt.Sprintf("\"%s\"", encoding)
+		}))
+	result.WriteString(TS_MESSAGE_ENCODING_RUNTIME)
+
+	for _, spec := range specs {
+		eventConstant := fmt.Sprintf("%s.%s", nameOfEventEnum, formatTSConstantName(spec.Name, ""))
+		serialize, err := formatTSSerializer(spec, eventConstant)
+		if err != nil {
+			return "", fmt.Errorf("generating TS serializer for %s: %s", spec.Name, err.Error())
+		}
+		deserialize, err := formatTSDeserializer(spec)
+		if err != nil {
+			return "", fmt.Errorf("generating TS deserializer for %s: %s", spec.Name, err.Error())
+		}
+		result.WriteString(serialize + "\n" + deserialize + "\n")
+	}
+
+	result.WriteString("export const EVENT_DESERIALIZERS: {[key: number]: (message: Uint8Array) => IMessage} = {\n")
+	for _, spec := range specs {
+		result.WriteString(fmt.Sprintf("\t%d: deserialize%s,\n", spec.ID, spec.Name))
+	}
+	result.WriteString("};\n\n")
+
+	result.WriteString("export type EventHandlers = Partial<{\n")
+	for _, spec := range specs {
+		result.WriteString(fmt.Sprintf("\t[%s.%s]: (message: %sMessageDTO) => void,\n", nameOfEventEnum, formatTSConstantName(spec.Name, ""), spec.Name))
+	}
+	result.WriteString("}>;\n\n")
+
+	result.WriteString("/**\n * Deserializes the message and calls the handler of its event, if any.\n")
+	result.WriteString(" * Messages of unknown events, or without a handler, are given to the fallback. Throws if the message doesn't match its event\n */\n")
+	result.WriteString("export function dispatchMessage(message: Uint8Array, handlers: EventHandlers, fallback?: (header: MessageHeader) => void): void {\n")
+	result.WriteString("\tconst header = parseMessageHeader(message);\n")
+	result.WriteString("\tswitch (header.eventID) {\n")
+	for _, spec := range specs {
+		eventConstant := fmt.Sprintf("%s.%s", nameOfEventEnum, formatTSConstantName(spec.Name, ""))
+		result.WriteString(fmt.Sprintf("\t\tcase %s: {\n", eventConstant))
+		result.WriteString(fmt.Sprintf("\t\t\tconst handler = handlers[%s];\n", eventConstant))
+		result.WriteString(fmt.Sprintf("\t\t\tif (handler) {\n\t\t\t\thandler(deserialize%s(message));\n\t\t\t} else {\n\t\t\t\tfallback?.(header);\n\t\t\t}\n", spec.Name))
+		result.WriteString("\t\t\treturn;\n\t\t}\n")
+	}
+	result.WriteString("\t\tdefault:\n\t\t\tfallback?.(header);\n\t}\n}\n")
+	return result.String(), nil
+}
+
+func formatTSSerializer(spec internal.EventSpecification[any], eventConstant string) (string, error) {
+	writes, err := formatTSWrites(spec.Structure, "message", "\t")
+	if err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("/** The event id of the message is ignored, %s is always used */\n", eventConstant)
+	result += fmt.Sprintf("export function serialize%s(message: %sMessageDTO): Uint8Array {\n", spec.Name, spec.Name)
+	result += fmt.Sprintf("\tconst w = new MessageWriter(MESSAGE_HEADER_SIZE + %d);\n", spec.ExpectedMinSize)
+	result += "\tw.u32(message.senderID);\n"
+	result += fmt.Sprintf("\tw.u32(%s);\n", eventConstant)
+	result += writes
+	result += "\treturn w.finish();\n}\n"
+	return result, nil
+}
+
+func formatTSWrites(structure internal.ComputedStructure, receiver string, indent string) (string, error) {
+	var result string
+	for _, element := range structure {
+		access := fmt.Sprintf("%s.%s", receiver, element.FieldName)
+		switch element.Kind {
+		case reflect.String:
+			result += fmt.Sprintf("%sw.string(%s, %d);\n", indent, access, element.LengthPrefix)
+		case reflect.Slice:
+			if element.ElementKind == reflect.Struct {
+				nested, err := formatTSWrites(element.Elements, "v", indent+"\t")
+				if err != nil {
+					return "", err
+				}
+				result += fmt.Sprintf("%sw.array(%s, %d, (v) => {\n%s%s});\n", indent, access, element.LengthPrefix, nested, indent)
+			} else {
+				method, err := goCodecMethodOf(element.ElementKind)
+				if err != nil {
+					return "", err
+				}
+				result += fmt.Sprintf("%sw.array(%s, %d, (v) => w.%s(v));\n", indent, access, element.LengthPrefix, method)
+			}
+		default:
+			method, err := goCodecMethodOf(element.Kind)
+			if err != nil {
+				return "", err
+			}
+			result += fmt.Sprintf("%sw.%s(%s);\n", indent, method, access)
+		}
+	}
+	return result, nil
+}
+
+// Fields at exact offsets are read straight from the DataView at those offsets, which include the header.
+// From the first variable size field on, offsets depend on the data, so the reader continues from there
+func formatTSDeserializer(spec internal.EventSpecification[any]) (string, error) {
+	result := fmt.Sprintf("/** Expects the whole message, header included. Throws if it doesn't match the structure of %s */\n", spec.Name)
+	result += fmt.Sprintf("export function deserialize%s(message: Uint8Array): %sMessageDTO {\n", spec.Name, spec.Name)
+	result += fmt.Sprintf("\tconst r = new MessageReader(message, %d, \"%s\");\n", spec.ExpectedMinSize, spec.Name)
+	result += "\treturn {\n"
+	result += "\t\tsenderID: r.view.getUint32(0, false),\n"
+	result += "\t\teventID: r.view.getUint32(4, false),\n"
+
+	var offsetIsExact = true
+	for _, element := range spec.Structure {
+		var read string
+		if offsetIsExact && !element.IsVariableSize() {
+			viewRead, err := tsDataViewReadOf(element.Kind, "r.view", fmt.Sprint(element.Offset))
+			if err != nil {
+				return "", err
+			}
+			read = viewRead
+		} else {
+			cursorRead, err := formatTSCursorRead(element)
+			if err != nil {
+				return "", err
+			}
+			read = cursorRead
+			if offsetIsExact {
+				read = fmt.Sprintf("r.from(%d).%s", element.Offset, strings.TrimPrefix(cursorRead, "r."))
+				offsetIsExact = false
+			}
+		}
+		result += fmt.Sprintf("\t\t%s: %s,\n", element.FieldName, read)
+	}
+	result += "\t};\n}\n"
+	return result, nil
+}
+
+func formatTSCursorRead(element internal.MessageElementDescriptor) (string, error) {
+	switch element.Kind {
+	case reflect.String:
+		return fmt.Sprintf("r.string(%d)", element.LengthPrefix), nil
+	case reflect.Slice:
+		if element.ElementKind == reflect.Struct {
+			fields := make([]string, 0, len(element.Elements))
+			for _, nested := range element.Elements {
+				read, err := formatTSCursorRead(nested)
+				if err != nil {
+					return "", err
+				}
+				fields = append(fields, fmt.Sprintf("%s: %s", nested.FieldName, read))
+			}
+			return fmt.Sprintf("r.array(%d, %d, () => ({ %s }))", element.LengthPrefix, internal.MinimumSizeOf(element.Elements), strings.Join(fields, ", ")), nil
+		}
+		method, err := goCodecMethodOf(element.ElementKind)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("r.array(%d, %d, () => r.%s())", element.LengthPrefix, util.SizeOfSerializedKind(element.ElementKind), method), nil
+	default:
+		method, err := goCodecMethodOf(element.Kind)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("r.%s()", method), nil
+	}
+}
+
+// Big endian. 64 bit integers are read as bigint and converted, as the TS types use number
+func tsDataViewReadOf(kind reflect.Kind, view string, offset string) (string, error) {
+	switch kind {
+	case reflect.Uint8:
+		return fmt.Sprintf("%s.getUint8(%s)", view, offset), nil
+	case reflect.Int8:
+		return fmt.Sprintf("%s.getInt8(%s)", view, offset), nil
+	case reflect.Uint16:
+		return fmt.Sprintf("%s.getUint16(%s, false)", view, offset), nil
+	case reflect.Int16:
+		return fmt.Sprintf("%s.getInt16(%s, false)", view, offset), nil
+	case reflect.Uint32:
+		return fmt.Sprintf("%s.getUint32(%s, false)", view, offset), nil
+	case reflect.Int32:
+		return fmt.Sprintf("%s.getInt32(%s, false)", view, offset), nil
+	case reflect.Uint64:
+		return fmt.Sprintf("Number(%s.getBigUint64(%s, false))", view, offset), nil
+	case reflect.Int64:
+		return fmt.Sprintf("Number(%s.getBigInt64(%s, false))", view, offset), nil
+	case reflect.Float32:
+		return fmt.Sprintf("%s.getFloat32(%s, false)", view, offset), nil
+	case reflect.Float64:
+		return fmt.Sprintf("%s.getFloat64(%s, false)", view, offset), nil
+	default:
+		return "", fmt.Errorf("kind %s has no binary codec", kind)
+	}
+}
+
+// Header parsing, writer and reader of the generated TS codec, mirroring src/internal/codecs.go
+const TS_CODEC_RUNTIME = `
+// ---- Codec ----
+
+/** Every message starts with the sender ID and the event ID, both big endian uint32's */
+export const MESSAGE_HEADER_SIZE = 8;
+
+export type MessageHeader = {
+	senderID: number,
+	eventID: number
+};
+
+/** Throws if the message is shorter than the header */
+export function parseMessageHeader(message: Uint8Array): MessageHeader {
+	if (message.byteLength < MESSAGE_HEADER_SIZE) {
+		throw new Error(` + "`expected at least ${MESSAGE_HEADER_SIZE} bytes, got ${message.byteLength}`" + `);
+	}
+	const view = new DataView(message.buffer, message.byteOffset, message.byteLength);
+	return { senderID: view.getUint32(0, false), eventID: view.getUint32(4, false) };
+}
+
+const TEXT_ENCODER = new TextEncoder();
+const TEXT_DECODER = new TextDecoder("utf-8", { fatal: true });
+
+class MessageWriter {
+	private bytes: Uint8Array;
+	private view: DataView;
+	private offset = 0;
+
+	constructor(capacity: number) {
+		this.bytes = new Uint8Array(capacity);
+		this.view = new DataView(this.bytes.buffer);
+	}
+
+	/** Returns the offset to write at. Always call before touching bytes or view, as it may replace them */
+	private reserve(size: number): number {
+		if (this.offset + size > this.bytes.byteLength) {
+			const grown = new Uint8Array(Math.max(this.bytes.byteLength * 2, this.offset + size));
+			grown.set(this.bytes);
+			this.bytes = grown;
+			this.view = new DataView(grown.buffer);
+		}
+		const at = this.offset;
+		this.offset += size;
+		return at;
+	}
+
+	u8(v: number) { const at = this.reserve(1); this.view.setUint8(at, v); }
+	u16(v: number) { const at = this.reserve(2); this.view.setUint16(at, v, false); }
+	u32(v: number) { const at = this.reserve(4); this.view.setUint32(at, v, false); }
+	u64(v: number) { const at = this.reserve(8); this.view.setBigUint64(at, BigInt(v), false); }
+	i8(v: number) { const at = this.reserve(1); this.view.setInt8(at, v); }
+	i16(v: number) { const at = this.reserve(2); this.view.setInt16(at, v, false); }
+	i32(v: number) { const at = this.reserve(4); this.view.setInt32(at, v, false); }
+	i64(v: number) { const at = this.reserve(8); this.view.setBigInt64(at, BigInt(v), false); }
+	f32(v: number) { const at = this.reserve(4); this.view.setFloat32(at, v, false); }
+	f64(v: number) { const at = this.reserve(8); this.view.setFloat64(at, v, false); }
+
+	/** Prefix is the byte size of the length prefix, 0 for none */
+	length(length: number, prefix: number) {
+		if (prefix === 2) {
+			if (length > 0xFFFF) {
+				throw new Error(` + "`length ${length} exceeds the max of a u16 prefix`" + `);
+			}
+			this.u16(length);
+		} else if (prefix === 4) {
+			this.u32(length);
+		}
+	}
+
+	string(v: string, prefix: number) {
+		const encoded = TEXT_ENCODER.encode(v);
+		this.length(encoded.byteLength, prefix);
+		const at = this.reserve(encoded.byteLength);
+		this.bytes.set(encoded, at);
+	}
+
+	array<T>(values: T[], prefix: number, writeElement: (v: T) => void) {
+		this.length(values.length, prefix);
+		values.forEach(writeElement);
+	}
+
+	finish(): Uint8Array {
+		return this.bytes.slice(0, this.offset);
+	}
+}
+
+class MessageReader {
+	readonly view: DataView;
+	private offset = MESSAGE_HEADER_SIZE;
+
+	constructor(message: Uint8Array, minBodySize: number, eventName: string) {
+		if (message.byteLength < MESSAGE_HEADER_SIZE + minBodySize) {
+			throw new Error(` + "`expected at least ${MESSAGE_HEADER_SIZE + minBodySize} bytes for ${eventName}, got ${message.byteLength}`" + `);
+		}
+		this.view = new DataView(message.buffer, message.byteOffset, message.byteLength);
+	}
+
+	/** Continues reading from the offset given */
+	from(offset: number): this {
+		this.offset = offset;
+		return this;
+	}
+
+	private take(size: number): number {
+		if (this.offset + size > this.view.byteLength) {
+			throw new Error(` + "`expected ${size} more bytes at offset ${this.offset}, got ${this.view.byteLength - this.offset}`" + `);
+		}
+		const at = this.offset;
+		this.offset += size;
+		return at;
+	}
+
+	u8(): number { return this.view.getUint8(this.take(1)); }
+	u16(): number { return this.view.getUint16(this.take(2), false); }
+	u32(): number { return this.view.getUint32(this.take(4), false); }
+	u64(): number { return Number(this.view.getBigUint64(this.take(8), false)); }
+	i8(): number { return this.view.getInt8(this.take(1)); }
+	i16(): number { return this.view.getInt16(this.take(2), false); }
+	i32(): number { return this.view.getInt32(this.take(4), false); }
+	i64(): number { return Number(this.view.getBigInt64(this.take(8), false)); }
+	f32(): number { return this.view.getFloat32(this.take(4), false); }
+	f64(): number { return this.view.getFloat64(this.take(8), false); }
+
+	/** Number of elements to follow, each of at least elementSize bytes */
+	length(prefix: number, elementSize: number): number {
+		const length = prefix === 2 ? this.u16() : prefix === 4 ? this.u32() : 0;
+		if (length * elementSize > this.view.byteLength - this.offset) {
+			throw new Error(` + "`length ${length} exceeds the ${this.view.byteLength - this.offset} bytes remaining`" + `);
+		}
+		return length;
+	}
+
+	/** An unprefixed (0) string spans the rest of the message */
+	string(prefix: number): string {
+		const length = prefix === 0 ? this.view.byteLength - this.offset : this.length(prefix, 1);
+		const at = this.take(length);
+		return TEXT_DECODER.decode(new Uint8Array(this.view.buffer, this.view.byteOffset + at, length));
+	}
+
+	array<T>(prefix: number, elementSize: number, readElement: () => T): T[] {
+		const length = this.length(prefix, elementSize);
+		const result: T[] = [];
+		for (let i = 0; i < length; i++) {
+			result.push(readElement());
+		}
+		return result;
+	}
+}
+
+`
+
+// Text encodings of messages, as per the encoding a client declares on /connect. Mirrors src/internal/messaging.go
+const TS_MESSAGE_ENCODING_RUNTIME = `/** Binary messages are to be sent as binary frames, base16 and base64 as text frames */
+export function encodeMessage(message: Uint8Array, encoding: MessageEncoding): Uint8Array | string {
+	switch (encoding) {
+		case MessageEncoding.BASE16:
+			return Array.from(message, (b) => b.toString(16).padStart(2, "0")).join("");
+		case MessageEncoding.BASE64: {
+			let binary = "";
+			message.forEach((b) => binary += String.fromCharCode(b));
+			return btoa(binary);
+		}
+		default:
+			return message;
+	}
+}
+
+/** Binary frames are taken as is. Text frames are base64 if that is the encoding, base16 otherwise, as on the server */
+export function decodeMessage(frame: ArrayBuffer | Uint8Array | string, encoding: MessageEncoding): Uint8Array {
+	if (typeof frame !== "string") {
+		return frame instanceof Uint8Array ? frame : new Uint8Array(frame);
+	}
+	if (encoding === MessageEncoding.BASE64) {
+		return Uint8Array.from(atob(frame), (c) => c.charCodeAt(0));
+	}
+	if (frame.length % 2 !== 0 || /[^0-9a-fA-F]/.test(frame)) {
+		throw new Error("invalid base16 message");
+	}
+	const result = new Uint8Array(frame.length / 2);
+	for (let i = 0; i < result.length; i++) {
+		result[i] = parseInt(frame.substring(i * 2, i * 2 + 2), 16);
+	}
+	return result;
+}
+
+`
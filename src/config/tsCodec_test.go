@@ -0,0 +1,42 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+)
+
+func TestFormatTSDeserializerReadsOffsetsOfStructure(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  *internal.EventSpecification[any]
+		wants []string
+	}{
+		{"fixed size fields at exact offsets", internal.NewSpecMap(internal.ASTEROID_SPAWN_EVENT)[internal.ASTEROID_SPAWN_EVENT.ID], []string{
+			"id: r.view.getUint32(8, false),",
+			"x: r.view.getFloat32(12, false),",
+			"health: r.view.getUint8(20),",
+			"charCode: r.from(26).string(0),",
+		}},
+		{"reader continues after a variable size field", internal.NewSpecMap(internal.PROTOCOL_MISMATCH_EVENT)[internal.PROTOCOL_MISMATCH_EVENT.ID], []string{
+			"clientVersion: r.view.getUint32(12, false),",
+			"serverFingerprint: r.from(16).string(2),",
+			"clientFingerprint: r.string(0),",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deserializer, err := formatTSDeserializer(*tt.spec)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for _, want := range tt.wants {
+				if !strings.Contains(deserializer, want) {
+					t.Errorf("Expected deserializer to contain %q, got:\n%s", want, deserializer)
+				}
+			}
+		})
+	}
+}
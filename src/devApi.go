@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
 )
 
@@ -24,7 +23,7 @@ func applyDevAPI(mux *http.ServeMux, lobbyManager *internal.LobbyManager) error
 			return
 		}
 
-		res := integrations.GetMainBackendIntegration().CloseColony(uint32(colonyIDUint), uint32(ownerIDUint))
+		res := lobbyManager.MainBackend().CloseColony(r.Context(), uint32(colonyIDUint), uint32(ownerIDUint))
 		w.Header().Set("Content-Type", "application/json")
 		if res != nil {
 			http.Error(w, res.Error(), http.StatusInternalServerError)
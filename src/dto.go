@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
 )
@@ -18,7 +19,9 @@ type ClientResponseDTO struct {
 }
 
 type LobbyStateResponseDTO struct {
+	ID       uint32               `json:"id"`
 	ColonyID uint32               `json:"colonyID"`
+	OwnerID  uint32               `json:"ownerID"`
 	Closing  bool                 `json:"closing"`
 	Phase    internal.LobbyPhase  `json:"phase"`
 	Encoding meta.MessageEncoding `json:"encoding"`
@@ -26,6 +29,10 @@ type LobbyStateResponseDTO struct {
 }
 
 type HealthCheckResponseDTO struct {
-	Status     bool   `json:"status"`
-	LobbyCount uint32 `json:"lobbyCount"`
+	Status          bool   `json:"status"`
+	LobbyCount      uint32 `json:"lobbyCount"`
+	ProtocolVersion uint32 `json:"protocolVersion"`
+	SpecFingerprint string `json:"specFingerprint"`
+	// An open breaker means calls to the main backend fail fast. Doesn't affect status, as lobbies run on regardless
+	MainBackend integrations.MainBackendStatus `json:"mainBackend"`
 }
@@ -0,0 +1,95 @@
+package integrations
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+type BreakerState string
+
+const (
+	// Calls are made as usual
+	BREAKER_STATE_CLOSED BreakerState = "closed"
+	// Calls fail fast without being made
+	BREAKER_STATE_OPEN BreakerState = "open"
+	// A single call is let through to probe whether the main backend is back
+	BREAKER_STATE_HALF_OPEN BreakerState = "half-open"
+)
+
+var ErrMainBackendUnavailable = errors.New("main backend unavailable, circuit breaker open")
+
+// Threadsafe
+//
+// Opens after failureThreshold consecutive failures, failing all calls fast for openDuration.
+// Then lets a single call through: Its success closes the breaker again, its failure keeps it open for another openDuration
+type CircuitBreaker struct {
+	failureThreshold uint32
+	openDuration     time.Duration
+	clock            util.Clock
+
+	lock                sync.Mutex
+	state               BreakerState
+	consecutiveFailures uint32
+	openedAt            time.Time
+}
+
+func NewCircuitBreaker(failureThreshold uint32, openDuration time.Duration, clock util.Clock) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: max(failureThreshold, 1),
+		openDuration:     openDuration,
+		clock:            clock,
+		state:            BREAKER_STATE_CLOSED,
+	}
+}
+
+// Returns ErrMainBackendUnavailable if the call is not to be made. Every call allowed must be followed by Record
+func (b *CircuitBreaker) Allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case BREAKER_STATE_OPEN:
+		if b.clock.Now().Sub(b.openedAt) < b.openDuration {
+			return ErrMainBackendUnavailable
+		}
+		b.state = BREAKER_STATE_HALF_OPEN
+		return nil
+	case BREAKER_STATE_HALF_OPEN:
+		// The probe is still underway
+		return ErrMainBackendUnavailable
+	}
+	return nil
+}
+
+// Only failures telling the main backend is unreachable or unwell count, not fx. a 404
+func (b *CircuitBreaker) Record(success bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if success {
+		if b.state != BREAKER_STATE_CLOSED {
+			log.Printf("[main backend] Circuit breaker closed")
+		}
+		b.state = BREAKER_STATE_CLOSED
+		b.consecutiveFailures = 0
+		return
+	}
+	b.consecutiveFailures++
+	if b.state == BREAKER_STATE_HALF_OPEN || (b.state == BREAKER_STATE_CLOSED && b.consecutiveFailures >= b.failureThreshold) {
+		log.Printf("[main backend] Circuit breaker opened after %d consecutive failures, failing fast for %s", b.consecutiveFailures, b.openDuration)
+		b.state = BREAKER_STATE_OPEN
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// An open breaker is reported half open once the next call would probe
+func (b *CircuitBreaker) State() (BreakerState, uint32) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == BREAKER_STATE_OPEN && b.clock.Now().Sub(b.openedAt) >= b.openDuration {
+		return BREAKER_STATE_HALF_OPEN, b.consecutiveFailures
+	}
+	return b.state, b.consecutiveFailures
+}
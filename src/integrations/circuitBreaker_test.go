@@ -0,0 +1,61 @@
+package integrations
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+func expectBreakerState(t *testing.T, breaker *CircuitBreaker, want BreakerState) {
+	t.Helper()
+	if state, _ := breaker.State(); state != want {
+		t.Errorf("Expected breaker %s, got %s", want, state)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := util.NewManualClock(time.Unix(1_700_000_000, 0))
+	breaker := NewCircuitBreaker(2, 10*time.Second, clock)
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("Expected call %d to be allowed, got %v", i, err)
+		}
+		breaker.Record(false)
+	}
+	expectBreakerState(t, breaker, BREAKER_STATE_OPEN)
+	if err := breaker.Allow(); !errors.Is(err, ErrMainBackendUnavailable) {
+		t.Errorf("Expected open breaker to fail fast, got %v", err)
+	}
+
+	// A failed probe opens it again
+	clock.Advance(10 * time.Second)
+	expectBreakerState(t, breaker, BREAKER_STATE_HALF_OPEN)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrMainBackendUnavailable) {
+		t.Errorf("Expected only a single probe at a time, got %v", err)
+	}
+	breaker.Record(false)
+	expectBreakerState(t, breaker, BREAKER_STATE_OPEN)
+
+	// A successful probe closes it
+	clock.Advance(10 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	breaker.Record(true)
+	expectBreakerState(t, breaker, BREAKER_STATE_CLOSED)
+	if _, consecutiveFailures := breaker.State(); consecutiveFailures != 0 {
+		t.Errorf("Expected failures to be reset, got %d", consecutiveFailures)
+	}
+
+	// Failures must be consecutive
+	breaker.Record(false)
+	breaker.Record(true)
+	breaker.Record(false)
+	expectBreakerState(t, breaker, BREAKER_STATE_CLOSED)
+}
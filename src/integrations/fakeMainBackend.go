@@ -0,0 +1,103 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Settings of a single minigame, as the main backend would serve them
+type FakeMinigameFixture struct {
+	Settings json.RawMessage `json:"settings"`
+	// Overwriting settings by difficulty id. Difficulties not present have none
+	OverwritingSettings map[uint32]json.RawMessage `json:"overwritingSettings"`
+}
+
+// Keyed by minigame id, fx.:
+//
+//	{"minigames": {"1": {"settings": {...}, "overwritingSettings": {"2": {...}}}}}
+type FakeMainBackendFixtures struct {
+	Minigames map[uint32]FakeMinigameFixture `json:"minigames"`
+}
+
+// Stands in for the main backend in process. Colonies are always closed successfully,
+// and locations upgraded one level at a time starting from level 1
+type FakeMainBackend struct {
+	fixtures FakeMainBackendFixtures
+
+	lock           sync.Mutex
+	closedColonies map[uint32]uint32
+	locationLevels map[[2]uint32]uint32
+}
+
+// Nil fixtures serves no minigame settings
+func NewFakeMainBackend(fixtures *FakeMainBackendFixtures) *FakeMainBackend {
+	fake := &FakeMainBackend{
+		closedColonies: make(map[uint32]uint32),
+		locationLevels: make(map[[2]uint32]uint32),
+	}
+	if fixtures != nil {
+		fake.fixtures = *fixtures
+	}
+	return fake
+}
+
+func LoadFakeMainBackend(fixturesPath string) (*FakeMainBackend, error) {
+	content, err := os.ReadFile(fixturesPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading main backend fixtures: %s", err.Error())
+	}
+	var fixtures FakeMainBackendFixtures
+	if err := json.Unmarshal(content, &fixtures); err != nil {
+		return nil, fmt.Errorf("error parsing main backend fixtures %s: %s", fixturesPath, err.Error())
+	}
+	return NewFakeMainBackend(&fixtures), nil
+}
+
+func (f *FakeMainBackend) CloseColony(ctx context.Context, colonyID uint32, ownerID uint32) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.closedColonies[colonyID] = ownerID
+	log.Printf("[fake main backend] Closed colony %d for owner %d", colonyID, ownerID)
+	return nil
+}
+
+// The owner the colony was closed for, if it has been closed
+func (f *FakeMainBackend) ClosedBy(colonyID uint32) (uint32, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ownerID, closed := f.closedColonies[colonyID]
+	return ownerID, closed
+}
+
+func (f *FakeMainBackend) UpgradeLocation(ctx context.Context, colonyID uint32, colLocID uint32) (*UpgradeLocationResponseDTO, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := [2]uint32{colonyID, colLocID}
+	level, exists := f.locationLevels[key]
+	if !exists {
+		level = 1
+	}
+	level++
+	f.locationLevels[key] = level
+	return &UpgradeLocationResponseDTO{ColonyLocationID: colLocID, Level: level}, nil
+}
+
+func (f *FakeMainBackend) GetMinigameSettings(ctx context.Context, minigameID uint32, difficultyID uint32) (*MBMinigameSettingsDTO, error) {
+	fixture, exists := f.fixtures.Minigames[minigameID]
+	if !exists {
+		return nil, fmt.Errorf("no fixture for minigame %d", minigameID)
+	}
+	return &MBMinigameSettingsDTO{
+		Settings:            fixture.Settings,
+		OverwritingSettings: fixture.OverwritingSettings[difficultyID],
+	}, nil
+}
+
+// Never fails, so the breaker never opens
+func (f *FakeMainBackend) Status() MainBackendStatus {
+	return MainBackendStatus{Mode: MAIN_BACKEND_MODE_FAKE, Breaker: BREAKER_STATE_CLOSED}
+}
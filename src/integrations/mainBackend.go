@@ -0,0 +1,45 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+)
+
+// The calls the multiplayer backend makes to the main backend.
+// Implemented by MainBackendIntegration over HTTPS, and by FakeMainBackend in process for tests and offline development
+type MainBackend interface {
+	CloseColony(ctx context.Context, colonyID uint32, ownerID uint32) error
+	UpgradeLocation(ctx context.Context, colonyID uint32, colLocID uint32) (*UpgradeLocationResponseDTO, error)
+	GetMinigameSettings(ctx context.Context, minigameID uint32, difficultyID uint32) (*MBMinigameSettingsDTO, error)
+	Status() MainBackendStatus
+}
+
+// As exposed on /health
+type MainBackendStatus struct {
+	Mode                MainBackendMode `json:"mode"`
+	Breaker             BreakerState    `json:"breaker"`
+	ConsecutiveFailures uint32          `json:"consecutiveFailures"`
+}
+
+var _ MainBackend = (*MainBackendIntegration)(nil)
+var _ MainBackend = (*FakeMainBackend)(nil)
+
+type MainBackendMode string
+
+const (
+	// Calls the main backend at MAIN_BACKEND_HOST:MAIN_BACKEND_PORT
+	MAIN_BACKEND_MODE_HTTP MainBackendMode = "http"
+	// Serves fixtures from MAIN_BACKEND_FIXTURES_PATH in process. Never to be used in production
+	MAIN_BACKEND_MODE_FAKE MainBackendMode = "fake"
+)
+
+// Empty defaults to http
+func ParseMainBackendMode(value string) (MainBackendMode, error) {
+	switch MainBackendMode(value) {
+	case "", MAIN_BACKEND_MODE_HTTP:
+		return MAIN_BACKEND_MODE_HTTP, nil
+	case MAIN_BACKEND_MODE_FAKE:
+		return MAIN_BACKEND_MODE_FAKE, nil
+	}
+	return "", fmt.Errorf("unknown main backend mode %s, expected %s or %s", value, MAIN_BACKEND_MODE_HTTP, MAIN_BACKEND_MODE_FAKE)
+}
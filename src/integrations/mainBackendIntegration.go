@@ -2,23 +2,51 @@ package integrations
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
 	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
 )
 
+type MainBackendOptions struct {
+	// Max time of a single attempt
+	RequestTimeout time.Duration
+	// Max attempts of idempotent calls, the first included. Other calls are attempted once
+	MaxAttempts uint32
+	// The wait before retry n is random, up to InitialBackoff * 2^(n-1), capped at MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Consecutive failures before the circuit breaker opens
+	BreakerFailureThreshold uint32
+	// How long the circuit breaker stays open before letting a call through to probe
+	BreakerOpenDuration time.Duration
+}
+
+func DefaultMainBackendOptions() MainBackendOptions {
+	return MainBackendOptions{
+		RequestTimeout:          5 * time.Second,
+		MaxAttempts:             3,
+		InitialBackoff:          200 * time.Millisecond,
+		MaxBackoff:              2 * time.Second,
+		BreakerFailureThreshold: 5,
+		BreakerOpenDuration:     30 * time.Second,
+	}
+}
+
+// Threadsafe. All calls share a single http.Client, reusing connections
 type MainBackendIntegration struct {
 	host    string
 	port    int
 	baseURL string
-}
-
-var singleton *MainBackendIntegration
-
-func GetMainBackendIntegration() *MainBackendIntegration {
-	return singleton
+	options MainBackendOptions
+	client  *http.Client
+	breaker *CircuitBreaker
 }
 
 type MBMinigameSettingsDTO struct {
@@ -35,34 +63,26 @@ type UpgradeLocationResponseDTO struct {
 	Level            uint32 `json:"level"`
 }
 
-func (m *MainBackendIntegration) UpgradeLocation(colonyID uint32, colLocID uint32) (*UpgradeLocationResponseDTO, error) {
+// Not idempotent, as each call upgrades the location another level, so never retried
+func (m *MainBackendIntegration) UpgradeLocation(ctx context.Context, colonyID uint32, colLocID uint32) (_ *UpgradeLocationResponseDTO, err error) {
+	defer observeCall("UpgradeLocation", time.Now(), &err)
 	url := fmt.Sprintf(m.baseURL+"/colony/%d/location/%d/upgrade", colonyID, colLocID)
 
-	req, err := http.NewRequest(http.MethodPost, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %s", err.Error())
-	}
-
-	resp, err := getConfiguredClient().Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error sending request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, headers: %s", resp.StatusCode, resp.Header)
-	}
-
 	var res UpgradeLocationResponseDTO
-	decodeErr := json.NewDecoder(resp.Body).Decode(&res)
-	if decodeErr != nil {
-		return nil, fmt.Errorf("error decoding response: %s", decodeErr.Error())
+	err = m.do(ctx, "UpgradeLocation", false, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	}, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&res)
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return &res, nil
 }
 
-func (m *MainBackendIntegration) CloseColony(colonyID uint32, ownerID uint32) error {
+// Retried, as closing a colony twice leaves it closed all the same
+func (m *MainBackendIntegration) CloseColony(ctx context.Context, colonyID uint32, ownerID uint32) (err error) {
+	defer observeCall("CloseColony", time.Now(), &err)
 	url := fmt.Sprintf(m.baseURL+"/colony/%d/close", colonyID)
 
 	reqBody := CloseColonyRequest{
@@ -74,68 +94,123 @@ func (m *MainBackendIntegration) CloseColony(colonyID uint32, ownerID uint32) er
 		return fmt.Errorf("error marshalling request body: %s", err.Error())
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBodyBytes))
-	if err != nil {
-		return fmt.Errorf("error creating request: %s", err.Error())
-	}
+	return m.do(ctx, "CloseColony", true, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBodyBytes))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, nil)
+}
 
-	req.Header.Set("Content-Type", "application/json")
+func (m *MainBackendIntegration) GetMinigameSettings(ctx context.Context, minigameID uint32, difficultyID uint32) (_ *MBMinigameSettingsDTO, err error) {
+	defer observeCall("GetMinigameSettings", time.Now(), &err)
+	url := fmt.Sprintf(m.baseURL+"/minigame/minimized?minigame=%d&difficulty=%d", minigameID, difficultyID)
 
-	resp, err := getConfiguredClient().Do(req)
+	var res MBMinigameSettingsDTO
+	err = m.do(ctx, "GetMinigameSettings", true, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	}, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&res)
+	})
 	if err != nil {
-		return fmt.Errorf("error sending request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d, headers: %s", resp.StatusCode, resp.Header)
+		return nil, fmt.Errorf("error getting minigame settings: %s", err.Error())
 	}
+	return &res, nil
+}
 
-	return nil
+func (m *MainBackendIntegration) Status() MainBackendStatus {
+	state, consecutiveFailures := m.breaker.State()
+	return MainBackendStatus{Mode: MAIN_BACKEND_MODE_HTTP, Breaker: state, ConsecutiveFailures: consecutiveFailures}
 }
 
-func getConfiguredClient() *http.Client {
-	return &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			DisableKeepAlives:   false,
-			MaxIdleConns:        10,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     30 * time.Second,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // This skips certificate verification
-			},
-		},
+// Attempts the request until it succeeds, fails in a way retrying won't fix, the attempts of the call are spent or the context ends.
+// newRequest is called for every attempt. decode, if any, is given the body of a 200 response
+func (m *MainBackendIntegration) do(ctx context.Context, method string, idempotent bool, newRequest func(ctx context.Context) (*http.Request, error), decode func(body io.Reader) error) error {
+	maxAttempts := uint32(1)
+	if idempotent {
+		maxAttempts = max(m.options.MaxAttempts, 1)
+	}
+	for attempt := uint32(1); ; attempt++ {
+		retryable, err := m.attempt(ctx, newRequest, decode)
+		if err == nil || !retryable || attempt >= maxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s, not retried: %s", err.Error(), ctx.Err().Error())
+		case <-time.After(backoffBefore(attempt, m.options.InitialBackoff, m.options.MaxBackoff, rand.Int64N)):
+		}
+		metricCallRetries.Inc(method)
 	}
 }
 
-func (m *MainBackendIntegration) GetMinigameSettings(minigameID uint32, difficultyID uint32) (*MBMinigameSettingsDTO, error) {
-	url := fmt.Sprintf(m.baseURL+"/minigame/minimized?minigame=%d&difficulty=%d", minigameID, difficultyID)
+// Returns whether the failure, if any, might pass by retrying
+func (m *MainBackendIntegration) attempt(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error), decode func(body io.Reader) error) (bool, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, m.options.RequestTimeout)
+	defer cancel()
+	req, err := newRequest(attemptCtx)
+	if err != nil {
+		return false, fmt.Errorf("error creating request: %s", err.Error())
+	}
+	if err := m.breaker.Allow(); err != nil {
+		return false, err
+	}
 
-	resp, err := getConfiguredClient().Get(url)
+	resp, err := m.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error getting minigame settings: %s", err.Error())
+		m.breaker.Record(false)
+		return true, fmt.Errorf("error sending request: %v", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		m.breaker.Record(false)
+		return true, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	// Anything else tells the main backend is up, even if it refused the request
+	m.breaker.Record(true)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return false, fmt.Errorf("unexpected status code: %d, headers: %s", resp.StatusCode, resp.Header)
 	}
-
-	var res MBMinigameSettingsDTO
-	decodeErr := json.NewDecoder(resp.Body).Decode(&res)
-	if decodeErr != nil {
-		return nil, fmt.Errorf("error decoding response: %s", decodeErr.Error())
+	if decode != nil {
+		if err := decode(resp.Body); err != nil {
+			return false, fmt.Errorf("error decoding response: %s", err.Error())
+		}
 	}
+	return false, nil
+}
 
-	return &res, nil
+// Full jitter: Random up to InitialBackoff * 2^(retry-1), capped at maxBackoff. random is to return [0, n)
+func backoffBefore(retry uint32, initialBackoff time.Duration, maxBackoff time.Duration, random func(n int64) int64) time.Duration {
+	ceiling := maxBackoff
+	if retry <= 32 && initialBackoff < maxBackoff>>(retry-1) {
+		ceiling = initialBackoff << (retry - 1)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(random(int64(ceiling)) + 1)
 }
 
-func InitializeMainBackendIntegration(mbHost string, mbPort int) (*MainBackendIntegration, error) {
-	singleton = &MainBackendIntegration{
+func NewMainBackendIntegration(mbHost string, mbPort int, options MainBackendOptions) *MainBackendIntegration {
+	return &MainBackendIntegration{
 		host:    mbHost,
 		port:    mbPort,
 		baseURL: fmt.Sprintf("https://%s:%d/api/v1", mbHost, mbPort),
+		options: options,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DisableKeepAlives:   false,
+				MaxIdleConns:        10,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     30 * time.Second,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true, // This skips certificate verification
+				},
+			},
+		},
+		breaker: NewCircuitBreaker(options.BreakerFailureThreshold, options.BreakerOpenDuration, util.SystemClock),
 	}
-	return singleton, nil
 }
@@ -0,0 +1,146 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Answers with the statuses given in order, repeating the last one. Returns the integration and the number of requests received
+func newTestMainBackend(t *testing.T, options MainBackendOptions, statuses ...int) (*MainBackendIntegration, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"settings":{"speed":1},"overwritingSettings":{},"id":3,"level":2}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	host, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return NewMainBackendIntegration(host, port, options), &requests
+}
+
+func testMainBackendOptions() MainBackendOptions {
+	return MainBackendOptions{
+		RequestTimeout:          time.Second,
+		MaxAttempts:             3,
+		InitialBackoff:          time.Millisecond,
+		MaxBackoff:              5 * time.Millisecond,
+		BreakerFailureThreshold: 10,
+		BreakerOpenDuration:     time.Minute,
+	}
+}
+
+func TestMainBackendRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		call         func(m *MainBackendIntegration) error
+		wantRequests int32
+		wantErr      bool
+	}{
+		{"idempotent call retried until it succeeds", []int{503, 502, 200}, func(m *MainBackendIntegration) error {
+			_, err := m.GetMinigameSettings(context.Background(), 1, 1)
+			return err
+		}, 3, false},
+		{"idempotent call gives up after max attempts", []int{503}, func(m *MainBackendIntegration) error {
+			return m.CloseColony(context.Background(), 1, 1)
+		}, 3, true},
+		{"client errors not retried", []int{404}, func(m *MainBackendIntegration) error {
+			return m.CloseColony(context.Background(), 1, 1)
+		}, 1, true},
+		{"non idempotent call not retried", []int{503, 200}, func(m *MainBackendIntegration) error {
+			_, err := m.UpgradeLocation(context.Background(), 1, 3)
+			return err
+		}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, requests := newTestMainBackend(t, testMainBackendOptions(), tt.statuses...)
+			err := tt.call(m)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error: %t, got %v", tt.wantErr, err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("Expected %d requests, got %d", tt.wantRequests, got)
+			}
+		})
+	}
+}
+
+func TestMainBackendBreakerFailsFast(t *testing.T) {
+	options := testMainBackendOptions()
+	options.BreakerFailureThreshold = 3
+	m, requests := newTestMainBackend(t, options, 503)
+
+	if err := m.CloseColony(context.Background(), 1, 1); err == nil {
+		t.Fatal("Expected error")
+	}
+	if status := m.Status(); status.Breaker != BREAKER_STATE_OPEN || status.ConsecutiveFailures != 3 {
+		t.Errorf("Expected breaker open after 3 failures, got %+v", status)
+	}
+	if err := m.CloseColony(context.Background(), 1, 1); !errors.Is(err, ErrMainBackendUnavailable) {
+		t.Errorf("Expected ErrMainBackendUnavailable, got %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("Expected no requests while the breaker is open, got %d in total", got)
+	}
+}
+
+func TestMainBackendContextDeadline(t *testing.T) {
+	options := testMainBackendOptions()
+	options.InitialBackoff = time.Minute
+	options.MaxBackoff = time.Minute
+	m, requests := newTestMainBackend(t, options, 503)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.CloseColony(ctx, 1, 1); err == nil {
+		t.Fatal("Expected error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected backing off to end with the context, took %s", elapsed)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected 1 request, got %d", got)
+	}
+}
+
+func TestBackoffBefore(t *testing.T) {
+	highest := func(n int64) int64 { return n - 1 }
+	lowest := func(n int64) int64 { return 0 }
+	tests := []struct {
+		retry uint32
+		want  time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{64, time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := backoffBefore(tt.retry, 100*time.Millisecond, time.Second, highest); got != tt.want {
+			t.Errorf("Expected retry %d to back off at most %s, got %s", tt.retry, tt.want, got)
+		}
+		if got := backoffBefore(tt.retry, 100*time.Millisecond, time.Second, lowest); got <= 0 {
+			t.Errorf("Expected retry %d to back off a positive duration, got %s", tt.retry, got)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package integrations
+
+import (
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/metrics"
+)
+
+var (
+	metricCallDuration = metrics.Default.NewHistogram("multiplayer_main_backend_request_duration_seconds",
+		"Duration of calls to the main backend, by method", metrics.DEFAULT_LATENCY_BUCKETS, "method")
+	metricCallErrors = metrics.Default.NewCounter("multiplayer_main_backend_errors_total",
+		"Failed calls to the main backend, by method", "method")
+	metricCallRetries = metrics.Default.NewCounter("multiplayer_main_backend_retries_total",
+		"Retried attempts of calls to the main backend, by method", "method")
+)
+
+// To be deferred at the start of each call, with a pointer to the named error return
+func observeCall(method string, start time.Time, err *error) {
+	metricCallDuration.Observe(time.Since(start).Seconds(), method)
+	if *err != nil {
+		metricCallErrors.Inc(method)
+	}
+}
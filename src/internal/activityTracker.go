@@ -1,8 +1,8 @@
 package internal
 
 import (
-	"log"
 	"sync/atomic"
+	"time"
 
 	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
 )
@@ -32,9 +32,10 @@ const (
 // Struct for holding and updating information based on the lobby owners actions
 type ActivityTracker struct {
 	//	Same as MinigameID
-	diffConfirmed      *util.SafeValue[*DifficultyConfirmedForMinigameMessageDTO]
-	lockedIn           atomic.Bool
-	phase              atomic.Uint32
+	diffConfirmed *util.SafeValue[*DifficultyConfirmedForMinigameMessageDTO]
+	lockedIn      atomic.Bool
+	// Unix ms at which the current phase stops waiting for players. 0 if there is none
+	deadlineMS         atomic.Int64
 	participantTracker struct {
 		playersAccountedFor atomic.Uint32
 		playersToAccountFor atomic.Uint32
@@ -86,7 +87,7 @@ func (ta *ActivityTracker) SetDiffConfirmed(dto *DifficultyConfirmedForMinigameM
 
 // To be called when Difficulty Confirmed Event is recieved from lobby owner
 //
-// This will lock in the activity and set the phase to LOBBY_PHASE_AWAITING_PARTICIPANTS
+// This will lock in the activity, allowing the lobby to move on to LOBBY_PHASE_AWAITING_PARTICIPANTS
 //
 // -Also stores the number of players that are expected to participate
 //
@@ -100,29 +101,29 @@ func (ta *ActivityTracker) LockIn(numPlayersRightNow uint32) bool {
 		return false
 	}
 	ta.lockedIn.Store(true)
-	ta.phase.Store(uint32(LOBBY_PHASE_AWAITING_PARTICIPANTS))
 	ta.participantTracker.playersToAccountFor.Store(numPlayersRightNow)
 	return true
 }
 
-// Advances lobby phase if all expected participants are accounted for
-//
-// Returns true if the phase was advanced
-func (ta *ActivityTracker) AdvanceIfAllExpectedParticipantsAreAccountedFor() bool {
-	if ta.participantTracker.playersAccountedFor.Load() >= ta.participantTracker.playersToAccountFor.Load() {
-		ta.phase.Store(uint32(LOBBY_PHASE_PLAYERS_DECLARE_INTENT))
-		var participantCount uint32 = 0
-		ta.participantTracker.OptIn.Range(func(id ClientID, client *Client) bool {
-			ta.playerReadyTracker.playersToAccountFor.Store(id, false)
-			participantCount++
-			return true
-		})
-		ta.playerReadyTracker.participantSum.Store(participantCount)
-		ta.playerReadyTracker.playersAccountedFor.Store(0)
-		log.Println("Going to in players declare intent phase")
+func (ta *ActivityTracker) IsLockedIn() bool {
+	return ta.lockedIn.Load()
+}
+
+// Guards LOBBY_PHASE_AWAITING_PARTICIPANTS -> LOBBY_PHASE_PLAYERS_DECLARE_INTENT
+func (ta *ActivityTracker) AllExpectedParticipantsAreAccountedFor() bool {
+	return ta.participantTracker.playersAccountedFor.Load() >= ta.participantTracker.playersToAccountFor.Load()
+}
+
+// To be called on entering LOBBY_PHASE_PLAYERS_DECLARE_INTENT. Expects every participant to declare ready
+func (ta *ActivityTracker) BeginReadyTracking() {
+	var participantCount uint32 = 0
+	ta.participantTracker.OptIn.Range(func(id ClientID, client *Client) bool {
+		ta.playerReadyTracker.playersToAccountFor.Store(id, false)
+		participantCount++
 		return true
-	}
-	return false
+	})
+	ta.playerReadyTracker.participantSum.Store(participantCount)
+	ta.playerReadyTracker.playersAccountedFor.Store(0)
 }
 
 func (ta *ActivityTracker) MarkPlayerAsReady(client *Client) {
@@ -131,29 +132,113 @@ func (ta *ActivityTracker) MarkPlayerAsReady(client *Client) {
 	}
 }
 
-// Returns true if the phase was advanced
-func (ta *ActivityTracker) AdvanceIfAllPlayersAreReady() bool {
-	if ta.playerReadyTracker.playersAccountedFor.Load() >= ta.playerReadyTracker.participantSum.Load() {
-		ta.phase.Store(uint32(LOBBY_PHASE_LOADING_MINIGAME))
-		log.Println("Going to in loading minigame phase")
+// Guards LOBBY_PHASE_PLAYERS_DECLARE_INTENT -> LOBBY_PHASE_LOADING_MINIGAME
+func (ta *ActivityTracker) AllPlayersAreReady() bool {
+	return ta.playerReadyTracker.playersAccountedFor.Load() >= ta.playerReadyTracker.participantSum.Load()
+}
+
+// To be called on entering LOBBY_PHASE_LOADING_MINIGAME. Expects every participant to report load complete
+func (ta *ActivityTracker) BeginLoadTracking() {
+	var participantCount uint32 = 0
+	ta.participantTracker.OptIn.Range(func(id ClientID, client *Client) bool {
+		ta.playerLoadCompleteTracker.playersToAccountFor.Store(id, false)
+		participantCount++
 		return true
-	}
-	return false
+	})
+	ta.playerLoadCompleteTracker.participantSum.Store(participantCount)
+	ta.playerLoadCompleteTracker.playersAccountedFor.Store(0)
 }
 
 func (ta *ActivityTracker) MarkPlayerAsLoadComplete(client *Client) {
-	if prevVal, exists := ta.playerLoadCompleteTracker.playersToAccountFor.Swap(client.ID, true); exists && prevVal {
+	if prevVal, exists := ta.playerLoadCompleteTracker.playersToAccountFor.Swap(client.ID, true); exists && !prevVal {
 		ta.playerLoadCompleteTracker.playersAccountedFor.Add(1)
 	}
 }
 
-func (ta *ActivityTracker) AdvanceIfAllPlayersHaveLoadedIn() bool {
-	if ta.playerLoadCompleteTracker.playersAccountedFor.Load() >= ta.playerLoadCompleteTracker.participantSum.Load() {
-		ta.phase.Store(uint32(LOBBY_PHASE_IN_MINIGAME))
-		log.Println("Going to in minigame phase")
+// Guards LOBBY_PHASE_LOADING_MINIGAME -> LOBBY_PHASE_IN_MINIGAME
+func (ta *ActivityTracker) AllPlayersHaveLoadedIn() bool {
+	return ta.playerLoadCompleteTracker.playersAccountedFor.Load() >= ta.playerLoadCompleteTracker.participantSum.Load()
+}
+
+// A zero time clears the deadline
+func (ta *ActivityTracker) SetDeadline(deadline time.Time) {
+	if deadline.IsZero() {
+		ta.deadlineMS.Store(0)
+		return
+	}
+	ta.deadlineMS.Store(deadline.UnixMilli())
+}
+
+// Returns false if the current phase has no deadline
+func (ta *ActivityTracker) IsPastDeadline(now time.Time) bool {
+	deadline := ta.deadlineMS.Load()
+	return deadline != 0 && now.UnixMilli() >= deadline
+}
+
+func (ta *ActivityTracker) ParticipantCount() int {
+	count := 0
+	ta.participantTracker.OptIn.Range(func(ClientID, *Client) bool {
+		count++
 		return true
+	})
+	return count
+}
+
+// To be called when the deadline of LOBBY_PHASE_AWAITING_PARTICIPANTS has passed.
+// Every client that hasn't joined or aborted the activity is opted out, so that all expected participants are accounted for.
+//
+// Returns the clients opted out
+func (ta *ActivityTracker) OptOutNonResponders(clients []*Client) []*Client {
+	var optedOut []*Client
+	for _, client := range clients {
+		if _, joined := ta.participantTracker.OptIn.Load(client.ID); joined {
+			continue
+		}
+		if _, aborted := ta.participantTracker.OptOut.LoadOrStore(client.ID, client); aborted {
+			continue
+		}
+		ta.participantTracker.playersAccountedFor.Add(1)
+		optedOut = append(optedOut, client)
+	}
+	return optedOut
+}
+
+// Participants that have yet to declare ready
+func (ta *ActivityTracker) ReadyLaggards() []ClientID {
+	return laggardsOf(&ta.playerReadyTracker.playersToAccountFor)
+}
+
+// Participants that have yet to finish loading
+func (ta *ActivityTracker) LoadLaggards() []ClientID {
+	return laggardsOf(&ta.playerLoadCompleteTracker.playersToAccountFor)
+}
+
+func laggardsOf(playersToAccountFor *util.ConcurrentTypedMap[ClientID, bool]) []ClientID {
+	var laggards []ClientID
+	playersToAccountFor.Range(func(id ClientID, accountedFor bool) bool {
+		if !accountedFor {
+			laggards = append(laggards, id)
+		}
+		return true
+	})
+	return laggards
+}
+
+// Removes a participant from the activity, such that the remaining participants need not wait for it
+func (ta *ActivityTracker) DropParticipant(id ClientID) {
+	ta.participantTracker.OptIn.Delete(id)
+	if ready, exists := ta.playerReadyTracker.playersToAccountFor.LoadAndDelete(id); exists {
+		ta.playerReadyTracker.participantSum.Add(^uint32(0))
+		if ready {
+			ta.playerReadyTracker.playersAccountedFor.Add(^uint32(0))
+		}
+	}
+	if loaded, exists := ta.playerLoadCompleteTracker.playersToAccountFor.LoadAndDelete(id); exists {
+		ta.playerLoadCompleteTracker.participantSum.Add(^uint32(0))
+		if loaded {
+			ta.playerLoadCompleteTracker.playersAccountedFor.Add(^uint32(0))
+		}
 	}
-	return false
 }
 
 // To be called when any Game End Event is about to be send to the lobby owner
@@ -170,11 +255,11 @@ func (ta *ActivityTracker) ReleaseLock() error {
 // Reset all tracked fields
 func (ta *ActivityTracker) Reset() error {
 	ta.diffConfirmed.Set(nil)
+	ta.deadlineMS.Store(0)
 	ta.participantTracker.OptIn.Clear()
 	ta.participantTracker.OptOut.Clear()
 	ta.participantTracker.playersAccountedFor.Store(0)
 	ta.participantTracker.playersToAccountFor.Store(0)
-	ta.phase.Store(uint32(LOBBY_PHASE_ROAMING_COLONY))
 	ta.playerReadyTracker.playersAccountedFor.Store(0)
 	ta.playerReadyTracker.participantSum.Store(0)
 	ta.playerReadyTracker.playersToAccountFor.Clear()
@@ -188,7 +273,6 @@ func NewActivityTracker() *ActivityTracker {
 	tracker := &ActivityTracker{
 		diffConfirmed: &util.SafeValue[*DifficultyConfirmedForMinigameMessageDTO]{},
 		lockedIn:      atomic.Bool{},
-		phase:         atomic.Uint32{},
 		participantTracker: struct { // Used during AWAITING_PARTICIPANTS phase
 			playersAccountedFor atomic.Uint32
 			playersToAccountFor atomic.Uint32
@@ -219,7 +303,6 @@ func NewActivityTracker() *ActivityTracker {
 			playersToAccountFor: util.ConcurrentTypedMap[ClientID, bool]{},
 		},
 	}
-	tracker.phase.Store(uint32(LOBBY_PHASE_ROAMING_COLONY))
 	tracker.lockedIn.Store(false)
 	return tracker
 }
@@ -1,15 +1,14 @@
 package internal
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"math"
 	"math/rand/v2"
+	"sort"
 	"sync/atomic"
 	"time"
 
-	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
 )
 
@@ -35,11 +34,40 @@ type Asteroid struct {
 	SpawnTimeStamp time.Time
 }
 
+// Time between two steps of the simulation
+const ASTEROIDS_TICK_INTERVAL = 100 * time.Millisecond
+
+// Max number of player inputs waiting for the next tick
+const ASTEROIDS_INPUT_QUEUE_SIZE = 256
+
+// A player input, stamped with the index of the tick it was applied on (the first tick being 0)
+type AsteroidsInput struct {
+	Tick uint32
+	Shot PlayerShootAtCodeMessageDTO
+}
+
 type AsteroidsMinigameControls struct {
 	settings   *AsteroidSettingsDTO
 	lobby      *Lobby
 	onDismount func()
 	// Initialized on controls creation
+	// Readonly. Source of all time of the simulation
+	clock util.Clock
+	// Initialized on controls creation
+	// Source of all randomness of the simulation. Must only be used by the update loop routine, or before it starts
+	rng *rand.Rand
+	// Player inputs, applied in order of arrival at the start of the next tick
+	inputs chan *PlayerShootAtCodeMessageDTO
+	// Index of the next tick to run
+	// Must only be modified by update loop routine
+	tickIndex uint32
+	// Every input applied so far, in order. Together with the seed, the game can be run again exactly
+	// Must only be modified by update loop routine
+	inputLog []AsteroidsInput
+	// If set, inputs are taken from here instead of from the players
+	// Must only be modified by update loop routine, or before it starts
+	replay []AsteroidsInput
+	// Initialized on controls creation
 	// Must only be modified after rising edge by update loop routine
 	colonyHPLeft uint32
 	// Initialized on controls creation
@@ -63,7 +91,8 @@ type AsteroidsMinigameControls struct {
 	nextAsteroidID uint32
 	// Initialized on controls creation
 	// Must only be modified by update loop routine
-	asteroids util.ConcurrentTypedMap[uint32, *Asteroid]
+	// Ordered by id, such that every run of the same seed evaluates them in the same order
+	asteroids []*Asteroid
 	// Initialized on controls creation
 	// Must only be modified by update loop routine
 	asteroidSpawnCount uint32
@@ -72,50 +101,106 @@ type AsteroidsMinigameControls struct {
 
 func (amc *AsteroidsMinigameControls) beginUpdateLoop() {
 	log.Println("Asteroids begin update loop for lobby id: ", amc.lobby.ID)
-	amc.timeStart = time.Now()
+	amc.timeStart = amc.clock.Now()
 	go amc.update()
 }
 
 func (amc *AsteroidsMinigameControls) update() {
-	for amc.checkGameEndConditions() {
-		gameTimePassedMS := time.Since(amc.timeStart).Milliseconds()
-		gameAdvancementPercent := float32(gameTimePassedMS) / float32(amc.settings.SurvivalTimeS*1000)
-		var currentAsteroidSpawnRate = amc.settings.AsteroidsPerSecondAtStart + (amc.settings.AsteroidsPerSecondAt80Percent-amc.settings.AsteroidsPerSecondAtStart)*gameAdvancementPercent
-		currentAsteroidSpawnRate *= 1 + (amc.settings.SpawnRateCoopModifier * float32(len(amc.players))) //Percentile increase per player
-
-		// This math is wrong, it does take into accound that asteroidsPerSecond rising slowly during the game
-		expectedSpawnCountRightNow := int((float32(gameTimePassedMS) / 10000) * currentAsteroidSpawnRate)
-		if expectedSpawnCountRightNow > int(amc.asteroidSpawnCount) {
-			amc.spawnAsteroid()
+	ticker := amc.clock.NewTicker(ASTEROIDS_TICK_INTERVAL)
+	defer ticker.Stop()
+	for range ticker.C() {
+		if !amc.tick() {
+			break
 		}
+	}
+	amc.onDismount()
+}
 
-		amc.evaluateAsteroids()
+// One step of the simulation. Once the loop has started, all state of the game is mutated here and only here.
+//
+// Returns false if the game has ended
+func (amc *AsteroidsMinigameControls) tick() bool {
+	tickIndex := amc.tickIndex
+	amc.tickIndex++
+	amc.applyInputs(tickIndex)
+	if !amc.checkGameEndConditions() {
+		return false
+	}
 
-		time.Sleep(100 * time.Millisecond)
+	gameTimePassedMS := amc.clock.Now().Sub(amc.timeStart).Milliseconds()
+	gameAdvancementPercent := float32(gameTimePassedMS) / float32(amc.settings.SurvivalTimeS*1000)
+	var currentAsteroidSpawnRate = amc.settings.AsteroidsPerSecondAtStart + (amc.settings.AsteroidsPerSecondAt80Percent-amc.settings.AsteroidsPerSecondAtStart)*gameAdvancementPercent
+	currentAsteroidSpawnRate *= 1 + (amc.settings.SpawnRateCoopModifier * float32(len(amc.players))) //Percentile increase per player
+
+	// This math is wrong, it does take into accound that asteroidsPerSecond rising slowly during the game
+	expectedSpawnCountRightNow := int((float32(gameTimePassedMS) / 10000) * currentAsteroidSpawnRate)
+	if expectedSpawnCountRightNow > int(amc.asteroidSpawnCount) {
+		amc.spawnAsteroid()
 	}
-	amc.onDismount()
+
+	amc.evaluateAsteroids()
+	return true
+}
+
+// Applies all inputs received since the last tick, or, when replaying, those recorded for the tick
+func (amc *AsteroidsMinigameControls) applyInputs(tickIndex uint32) {
+	if amc.replay != nil {
+		for len(amc.replay) > 0 && amc.replay[0].Tick <= tickIndex {
+			amc.applyInput(tickIndex, amc.replay[0].Shot)
+			amc.replay = amc.replay[1:]
+		}
+		return
+	}
+	for {
+		select {
+		case shot := <-amc.inputs:
+			amc.applyInput(tickIndex, *shot)
+		default:
+			return
+		}
+	}
+}
+
+func (amc *AsteroidsMinigameControls) applyInput(tickIndex uint32, shot PlayerShootAtCodeMessageDTO) {
+	amc.inputLog = append(amc.inputLog, AsteroidsInput{Tick: tickIndex, Shot: shot})
+	amc.onPlayerShot(&shot)
+}
+
+// The inputs applied so far, stamped with their tick. Only to be read once the update loop has ended
+func (amc *AsteroidsMinigameControls) InputLog() []AsteroidsInput {
+	return append([]AsteroidsInput{}, amc.inputLog...)
+}
+
+// Applies the inputs given on their tick, instead of those of the players. Run with the seed of the recording,
+// the game plays out exactly as recorded. Only to be called before the update loop starts
+func (amc *AsteroidsMinigameControls) Replay(inputs []AsteroidsInput) {
+	amc.replay = append([]AsteroidsInput{}, inputs...)
 }
 
 func (amc *AsteroidsMinigameControls) evaluateAsteroids() {
+	now := amc.clock.Now()
 	// Run through all asteroids and see if they've hit the colony
-	amc.asteroids.Range(func(key uint32, asteroid *Asteroid) bool {
-		if time.Since(asteroid.SpawnTimeStamp).Milliseconds() >= int64(asteroid.TimeUntilImpact) {
-			amc.asteroids.Delete(key)
-			amc.colonyHPLeft -= uint32(asteroid.Health)
-			data := AsteroidImpactOnColonyMessageDTO{
-				ID:           key,
-				ColonyHPLeft: amc.colonyHPLeft,
-			}
-			serialized, err := Serialize(ASTEROID_IMPACT_EVENT, data)
-			if err != nil {
-				log.Printf("Error serializing asteroid impact event: %s\n", err.Error())
-				OnUntimelyMinigameAbort("Error serializing asteroid impact event", SERVER_ID, amc.lobby, amc.state)
-				return false
-			}
-			amc.lobby.BroadcastMessage(SERVER_ID, serialized)
+	remaining := amc.asteroids[:0]
+	for _, asteroid := range amc.asteroids {
+		if now.Sub(asteroid.SpawnTimeStamp).Milliseconds() < int64(asteroid.TimeUntilImpact) {
+			remaining = append(remaining, asteroid)
+			continue
 		}
-		return true
-	})
+		// Saturating, as the hp left would otherwise wrap around and the colony never die
+		amc.colonyHPLeft -= min(amc.colonyHPLeft, uint32(asteroid.Health))
+		data := AsteroidImpactOnColonyMessageDTO{
+			ID:           asteroid.ID,
+			ColonyHPLeft: amc.colonyHPLeft,
+		}
+		serialized, err := Serialize(ASTEROID_IMPACT_EVENT, data)
+		if err != nil {
+			log.Printf("Error serializing asteroid impact event: %s\n", err.Error())
+			OnUntimelyMinigameAbort("Error serializing asteroid impact event", SERVER_ID, amc.lobby, amc.state)
+			continue
+		}
+		amc.lobby.BroadcastMessage(SERVER_ID, serialized)
+	}
+	amc.asteroids = remaining
 }
 
 // Returns false if the game has ended
@@ -139,7 +224,7 @@ func (amc *AsteroidsMinigameControls) checkGameEndConditions() bool {
 		return false
 	}
 	// Check if the players have survived the survival time
-	if time.Since(amc.timeStart).Seconds() >= float64(amc.settings.SurvivalTimeS) {
+	if amc.clock.Now().Sub(amc.timeStart).Seconds() >= float64(amc.settings.SurvivalTimeS) {
 		//Send game victory event
 		amc.state.Store(uint32(MINIGAME_STATE_VICTORY))
 		data := MinigameWonMessageDTO{
@@ -179,6 +264,10 @@ func (amc *AsteroidsMinigameControls) onRisingEdge() error {
 		penaltyCountMap[value.ID] = 0
 		return true
 	})
+	// Stable order, such that every run of the same seed assigns the same data to the same players
+	sort.Slice(asSlice, func(i, j int) bool {
+		return asSlice[i].ID < asSlice[j].ID
+	})
 	amc.friendlyFirePenaltyCountMap = penaltyCountMap
 
 	var playerPositionsXY [][]float32
@@ -224,12 +313,12 @@ func (amc *AsteroidsMinigameControls) onRisingEdge() error {
 }
 
 func (amc *AsteroidsMinigameControls) spawnAsteroid() {
-	startY := rand.Float32()*0.5 + 0.05
+	startY := amc.rng.Float32()*0.5 + 0.05
 	id := amc.nextAsteroidID
 	amc.nextAsteroidID++
 	charCode := string(amc.generator.GetNext().Value)
-	timeTillImpactMS := (rand.Float32()*(amc.settings.MaxTimeTillImpactS-amc.settings.MinTimeTillImpactS) + amc.settings.MinTimeTillImpactS) * 1000
-	health := math.Ceil(float64(amc.settings.AsteroidMaxHealth) * rand.Float64())
+	timeTillImpactMS := (amc.rng.Float32()*(amc.settings.MaxTimeTillImpactS-amc.settings.MinTimeTillImpactS) + amc.settings.MinTimeTillImpactS) * 1000
+	health := math.Ceil(float64(amc.settings.AsteroidMaxHealth) * amc.rng.Float64())
 
 	asteroid := &Asteroid{
 		AsteroidSpawnMessageDTO: AsteroidSpawnMessageDTO{
@@ -241,7 +330,7 @@ func (amc *AsteroidsMinigameControls) spawnAsteroid() {
 			Type:            0,
 			CharCode:        charCode,
 		},
-		SpawnTimeStamp: time.Now(),
+		SpawnTimeStamp: amc.clock.Now(),
 	}
 
 	serialized, err := Serialize(ASTEROID_SPAWN_EVENT, asteroid.AsteroidSpawnMessageDTO)
@@ -251,23 +340,24 @@ func (amc *AsteroidsMinigameControls) spawnAsteroid() {
 		return
 	}
 
-	amc.asteroids.Store(id, asteroid)
+	amc.asteroids = append(amc.asteroids, asteroid)
 	amc.asteroidSpawnCount++
 	amc.lobby.BroadcastMessage(SERVER_ID, serialized)
 }
 
 func (amc *AsteroidsMinigameControls) onPlayerShot(msg *PlayerShootAtCodeMessageDTO) {
 	var somethingWasHit bool = false
-	amc.asteroids.Range(func(key uint32, asteroid *Asteroid) bool {
+	remaining := amc.asteroids[:0]
+	for _, asteroid := range amc.asteroids {
 		if asteroid.CharCode == msg.CharCode {
 			asteroid.Health--
-			if asteroid.Health == 0 {
-				amc.asteroids.Delete(key)
-			}
 			somethingWasHit = true
 		}
-		return true
-	})
+		if asteroid.Health > 0 {
+			remaining = append(remaining, asteroid)
+		}
+	}
+	amc.asteroids = remaining
 
 	for _, player := range amc.players {
 		if player.CharCode == msg.CharCode {
@@ -312,7 +402,9 @@ func (amc *AsteroidsMinigameControls) onFallingEdge() error {
 	log.Println("Asteroids on falling edge for lobby id: ", amc.lobby.ID)
 	if (*amc.state).Load() == uint32(MINIGAME_STATE_VICTORY) {
 		//Ask main backend to upgrade location
-		resp, err := integrations.GetMainBackendIntegration().UpgradeLocation(amc.lobby.ColonyID, amc.difficultyInfo.ColonyLocationID)
+		ctx, cancel := amc.lobby.mainBackendContext()
+		defer cancel()
+		resp, err := amc.lobby.mainBackend.UpgradeLocation(ctx, amc.lobby.ColonyID, amc.difficultyInfo.ColonyLocationID)
 		if err != nil {
 			return fmt.Errorf("error upgrading location: %s", err.Error())
 		}
@@ -339,35 +431,49 @@ func (amc *AsteroidsMinigameControls) onMessage(msg *MessageEntry) error {
 			SendDebugInfoToClient(msg.Client, 400, "error deserializing player shoot event: "+err.Error())
 			return fmt.Errorf("error deserializing player shoot event: %s", err.Error())
 		}
-		amc.onPlayerShot(deserialized)
+		// Applied on the next tick, as all state is owned by the update loop routine
+		select {
+		case amc.inputs <- deserialized:
+		default:
+			return fmt.Errorf("input queue full, dropped shot of player %d", deserialized.PlayerID)
+		}
 	}
 	return nil
 }
 
-func GetAsteroidMinigameControls(diff *DifficultyConfirmedForMinigameMessageDTO, lobby *Lobby, onDismount func()) (*GenericMinigameControls, error) {
-	rawSettings, err := integrations.GetMainBackendIntegration().GetMinigameSettings(1, diff.DifficultyID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get minigame settings: %s", err.Error())
-	}
+const ASTEROIDS_MINIGAME_ID uint32 = 1
 
-	// Parse base settings
-	var baseSettings AsteroidSettingsDTO
-	if err := json.Unmarshal(rawSettings.Settings, &baseSettings); err != nil {
-		return nil, fmt.Errorf("error unmarshaling base settings: %s", err.Error())
-	}
-
-	// If there are overwriting settings, apply them
-	if len(rawSettings.OverwritingSettings) > 0 {
-		var overwriteSettings AsteroidSettingsDTO
-		if err := json.Unmarshal(rawSettings.OverwritingSettings, &overwriteSettings); err != nil {
-			return nil, fmt.Errorf("error unmarshaling overwriting settings: %s", err.Error())
-		}
+func init() {
+	RegisterMinigame(MinigameDefinition[AsteroidSettingsDTO]{
+		ID:           ASTEROIDS_MINIGAME_ID,
+		Name:         "Asteroids",
+		FirstEventID: 3000,
+		LastEventID:  3999,
+		Events:       ALL_ASTEROIDS_EVENTS,
+		Factory:      GetAsteroidMinigameControls,
+	})
+}
 
-		mergeSettings(&baseSettings, &overwriteSettings)
+func GetAsteroidMinigameControls(diff *DifficultyConfirmedForMinigameMessageDTO, settings *AsteroidSettingsDTO, env MinigameEnvironment, lobby *Lobby, onDismount func()) (*GenericMinigameControls, error) {
+	minigame, err := newAsteroidsMinigame(diff, settings, env, lobby, onDismount)
+	if err != nil {
+		return nil, err
 	}
 
+	return &GenericMinigameControls{
+		MinigameID:      ASTEROIDS_MINIGAME_ID,
+		ExecRisingEdge:  minigame.onRisingEdge,
+		StartLoop:       minigame.beginUpdateLoop,
+		ExecFallingEdge: minigame.onFallingEdge,
+		OnMessage:       minigame.onMessage,
+		State:           minigame.state,
+	}, nil
+}
+
+func newAsteroidsMinigame(diff *DifficultyConfirmedForMinigameMessageDTO, settings *AsteroidSettingsDTO, env MinigameEnvironment, lobby *Lobby, onDismount func()) (*AsteroidsMinigameControls, error) {
+	rng := env.NewRand()
 	// Todo update char set based on language from diff (diff also needs new field languageReferenceID)
-	generator, err := util.NewCharCodePool(100, baseSettings.CharCodeLength, util.SymbolSets.English.Lowercase)
+	generator, err := util.NewCharCodePoolFrom(100, settings.CharCodeLength, util.SymbolSets.English.Lowercase, rng)
 	if err != nil {
 		return nil, fmt.Errorf("error creating char code pool: %s", err.Error())
 	}
@@ -375,67 +481,19 @@ func GetAsteroidMinigameControls(diff *DifficultyConfirmedForMinigameMessageDTO,
 	state := atomic.Uint32{}
 	state.Store(uint32(MINIGAME_STATE_UNDETERMINED))
 
-	minigame := &AsteroidsMinigameControls{
-		settings:           &baseSettings,
+	return &AsteroidsMinigameControls{
+		settings:           settings,
 		lobby:              lobby,
 		onDismount:         onDismount,
+		clock:              env.Clock,
+		rng:                rng,
+		inputs:             make(chan *PlayerShootAtCodeMessageDTO, ASTEROIDS_INPUT_QUEUE_SIZE),
 		generator:          generator,
-		colonyHPLeft:       baseSettings.ColonyHealth,
+		colonyHPLeft:       settings.ColonyHealth,
 		nextAsteroidID:     0,
-		asteroids:          util.ConcurrentTypedMap[uint32, *Asteroid]{},
+		asteroids:          []*Asteroid{},
 		asteroidSpawnCount: 0,
 		difficultyInfo:     diff,
 		state:              &state,
-	}
-
-	return &GenericMinigameControls{
-		ExecRisingEdge:  minigame.onRisingEdge,
-		StartLoop:       minigame.beginUpdateLoop,
-		ExecFallingEdge: minigame.onFallingEdge,
-		OnMessage:       minigame.onMessage,
-		State:           &state,
 	}, nil
 }
-
-// mergeSettings applies non-zero values from src to dst
-func mergeSettings(dst *AsteroidSettingsDTO, src *AsteroidSettingsDTO) {
-	if src.MinTimeTillImpactS != 0 {
-		dst.MinTimeTillImpactS = src.MinTimeTillImpactS
-	}
-	if src.MaxTimeTillImpactS != 0 {
-		dst.MaxTimeTillImpactS = src.MaxTimeTillImpactS
-	}
-	if src.CharCodeLength != 0 {
-		dst.CharCodeLength = src.CharCodeLength
-	}
-	if src.AsteroidsPerSecondAtStart != 0 {
-		dst.AsteroidsPerSecondAtStart = src.AsteroidsPerSecondAtStart
-	}
-	if src.AsteroidsPerSecondAt80Percent != 0 {
-		dst.AsteroidsPerSecondAt80Percent = src.AsteroidsPerSecondAt80Percent
-	}
-	if src.ColonyHealth != 0 {
-		dst.ColonyHealth = src.ColonyHealth
-	}
-	if src.AsteroidMaxHealth != 0 {
-		dst.AsteroidMaxHealth = src.AsteroidMaxHealth
-	}
-	if src.StunDurationS != 0 {
-		dst.StunDurationS = src.StunDurationS
-	}
-	if src.FriendlyFirePenaltyS != 0 {
-		dst.FriendlyFirePenaltyS = src.FriendlyFirePenaltyS
-	}
-	if src.FriendlyFirePenaltyMultiplier != 0 {
-		dst.FriendlyFirePenaltyMultiplier = src.FriendlyFirePenaltyMultiplier
-	}
-	if src.TimeBetweenShotsS != 0 {
-		dst.TimeBetweenShotsS = src.TimeBetweenShotsS
-	}
-	if src.SurvivalTimeS != 0 {
-		dst.SurvivalTimeS = src.SurvivalTimeS
-	}
-	if src.SpawnRateCoopModifier != 0 {
-		dst.SpawnRateCoopModifier = src.SpawnRateCoopModifier
-	}
-}
@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+func testAsteroidSettings() *AsteroidSettingsDTO {
+	return &AsteroidSettingsDTO{
+		MinTimeTillImpactS:            1,
+		MaxTimeTillImpactS:            3,
+		CharCodeLength:                3,
+		AsteroidsPerSecondAtStart:     20,
+		AsteroidsPerSecondAt80Percent: 40,
+		ColonyHealth:                  1000,
+		AsteroidMaxHealth:             3,
+		FriendlyFirePenaltyS:          1,
+		FriendlyFirePenaltyMultiplier: 2,
+		TimeBetweenShotsS:             1,
+		SurvivalTimeS:                 5,
+	}
+}
+
+// Runs the simulation on virtual time until it ends, shooting at the oldest asteroid every 5th tick.
+// Returns the asteroids present after each tick, and the number of ticks run
+func runAsteroidsOnVirtualTime(t *testing.T, settings *AsteroidSettingsDTO, seed uint64) ([][]AsteroidSpawnMessageDTO, int) {
+	t.Helper()
+	lobby := NewLobby(1, 10, 3, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+	clock := util.NewManualClock(time.Unix(1000, 0))
+	amc, err := newAsteroidsMinigame(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: ASTEROIDS_MINIGAME_ID},
+		settings, MinigameEnvironment{Clock: clock, Seed: seed}, lobby, func() {})
+	if err != nil {
+		t.Fatalf("Expected no error creating asteroids, got %v", err)
+	}
+	if err := amc.onRisingEdge(); err != nil {
+		t.Fatalf("Expected no error on rising edge, got %v", err)
+	}
+	amc.timeStart = clock.Now()
+
+	var trace [][]AsteroidSpawnMessageDTO
+	for ticks := 1; ; ticks++ {
+		if ticks%5 == 0 && len(amc.asteroids) > 0 {
+			amc.inputs <- &PlayerShootAtCodeMessageDTO{PlayerID: 10, CharCode: amc.asteroids[0].CharCode}
+		}
+		clock.Advance(ASTEROIDS_TICK_INTERVAL)
+		if !amc.tick() {
+			return trace, ticks
+		}
+		present := make([]AsteroidSpawnMessageDTO, len(amc.asteroids))
+		for i, asteroid := range amc.asteroids {
+			present[i] = asteroid.AsteroidSpawnMessageDTO
+		}
+		trace = append(trace, present)
+	}
+}
+
+func TestAsteroidsIsDeterministic(t *testing.T) {
+	first, _ := runAsteroidsOnVirtualTime(t, testAsteroidSettings(), 42)
+	second, _ := runAsteroidsOnVirtualTime(t, testAsteroidSettings(), 42)
+	if !reflect.DeepEqual(first, second) {
+		t.Error("Expected two runs of the same seed and input to be identical")
+	}
+
+	spawned := false
+	for _, present := range first {
+		spawned = spawned || len(present) > 0
+	}
+	if !spawned {
+		t.Fatal("Expected asteroids to spawn")
+	}
+
+	other, _ := runAsteroidsOnVirtualTime(t, testAsteroidSettings(), 43)
+	if reflect.DeepEqual(first, other) {
+		t.Error("Expected runs of different seeds to differ")
+	}
+}
+
+func TestAsteroidsEndsOnVirtualTime(t *testing.T) {
+	tests := []struct {
+		name      string
+		health    uint32
+		wantState MinigameState
+		wantTicks int
+	}{
+		{"survived", 1000, MINIGAME_STATE_VICTORY, 50},
+		// Impacts exceeding the hp left must not wrap around
+		{"colony destroyed", 1, MINIGAME_STATE_DEFEAT, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := testAsteroidSettings()
+			settings.ColonyHealth = tt.health
+			settings.MinTimeTillImpactS = 0.1
+			settings.MaxTimeTillImpactS = 0.1
+			lobby := NewLobby(1, 10, 3, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+			clock := util.NewManualClock(time.Unix(1000, 0))
+			amc, err := newAsteroidsMinigame(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: ASTEROIDS_MINIGAME_ID},
+				settings, MinigameEnvironment{Clock: clock, Seed: 7}, lobby, func() {})
+			if err != nil {
+				t.Fatalf("Expected no error creating asteroids, got %v", err)
+			}
+			amc.timeStart = clock.Now()
+
+			ticks := 1
+			for ; ticks <= 100; ticks++ {
+				clock.Advance(ASTEROIDS_TICK_INTERVAL)
+				if !amc.tick() {
+					break
+				}
+			}
+			if state := MinigameState(amc.state.Load()); state != tt.wantState {
+				t.Errorf("Expected state %d, got %d", tt.wantState, state)
+			}
+			if tt.wantTicks != 0 && ticks != tt.wantTicks {
+				t.Errorf("Expected the game to end after %d ticks, got %d", tt.wantTicks, ticks)
+			}
+		})
+	}
+}
+
+// Runs the simulation on virtual time until it ends, returning every event broadcast and the inputs applied.
+// Unless replaying, shoots at the oldest asteroid every 3rd tick and misses every 7th
+func runAsteroidsRecorded(t *testing.T, seed uint64, replay []AsteroidsInput) ([][]byte, []AsteroidsInput) {
+	t.Helper()
+	lobby := NewLobby(1, 10, 3, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+	var events [][]byte
+	lobby.BroadcastMessage = func(senderID ClientID, message []byte) []*Client {
+		events = append(events, append([]byte{}, message...))
+		return nil
+	}
+	clock := util.NewManualClock(time.Unix(1000, 0))
+	amc, err := newAsteroidsMinigame(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: ASTEROIDS_MINIGAME_ID},
+		testAsteroidSettings(), MinigameEnvironment{Clock: clock, Seed: seed}, lobby, func() {})
+	if err != nil {
+		t.Fatalf("Expected no error creating asteroids, got %v", err)
+	}
+	if replay != nil {
+		amc.Replay(replay)
+	}
+	if err := amc.onRisingEdge(); err != nil {
+		t.Fatalf("Expected no error on rising edge, got %v", err)
+	}
+	amc.timeStart = clock.Now()
+
+	for ticks := 1; ; ticks++ {
+		if replay == nil && ticks%3 == 0 && len(amc.asteroids) > 0 {
+			amc.inputs <- &PlayerShootAtCodeMessageDTO{PlayerID: 10, CharCode: amc.asteroids[0].CharCode}
+		}
+		if replay == nil && ticks%7 == 0 {
+			amc.inputs <- &PlayerShootAtCodeMessageDTO{PlayerID: 20, CharCode: "???"}
+		}
+		clock.Advance(ASTEROIDS_TICK_INTERVAL)
+		if !amc.tick() {
+			return events, amc.InputLog()
+		}
+	}
+}
+
+func TestAsteroidsReplaysInputLog(t *testing.T) {
+	recorded, inputs := runAsteroidsRecorded(t, 42, nil)
+	if len(inputs) == 0 {
+		t.Fatal("Expected inputs to be recorded")
+	}
+
+	replayed, replayedInputs := runAsteroidsRecorded(t, 42, inputs)
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("Expected the replay to broadcast the %d events recorded, got %d, differing", len(recorded), len(replayed))
+	}
+	if !reflect.DeepEqual(inputs, replayedInputs) {
+		t.Error("Expected the replay to apply the inputs on the ticks recorded")
+	}
+
+	withoutInputs, _ := runAsteroidsRecorded(t, 42, []AsteroidsInput{})
+	if reflect.DeepEqual(recorded, withoutInputs) {
+		t.Error("Expected the inputs to affect the events")
+	}
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"encoding/binary"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -34,7 +35,8 @@ func (dcs *GeneralDisclosedClientState) UpdateAny(messageID MessageID, remainder
 	case PLAYER_MOVE_EVENT.ID:
 		{
 			locationIDElement := PLAYER_MOVE_EVENT.Structure[1]
-			offset := locationIDElement.Offset
+			// Offsets of the structure include the header, which the remainder does not
+			offset := locationIDElement.Offset - MESSAGE_HEADER_SIZE
 			byteSize := locationIDElement.ByteSize
 			subSlice := remainder[offset : offset+byteSize]
 			dcs.LastKnownPosition.Store(binary.BigEndian.Uint32(subSlice))
@@ -51,32 +53,69 @@ type Client struct {
 	ID      ClientID
 	IDBytes []byte
 	IGN     string
-	Type    OriginType
+	// Threadsafe, as the type changes if the client is promoted to owner. Use Type()
+	originType atomic.Pointer[OriginType]
+	JoinedAt   time.Time
 	//Updated in sync with processing of this clients messages
 	State    *GeneralDisclosedClientState
 	Encoding meta.MessageEncoding
-	Conn     *websocket.Conn
+	// Current connection. Replaced when the client resumes its session. Guarded by connLock
+	Conn *websocket.Conn
+	// Secret handed to the client on join, with which it may resume its session after a dropped connection
+	ResumeToken string
+	connLock    sync.Mutex
+	session     clientSession
+	// Outbound queue drained by the write pump of the client
+	send         chan outboundMessage
+	done         chan struct{}
+	closeOnce    sync.Once
+	slowConsumer atomic.Bool
+	// Set once the slow consumer policy has scheduled the client for removal
+	evictionScheduled atomic.Bool
+	writeTimeout      time.Duration
+	// Milliseconds since epoch of the last pong received, or the time the current connection was attached
+	lastPongMS atomic.Int64
 }
 
 func (c *Client) String() string {
-	return fmt.Sprintf("%d (%s) %s encoding: %s", c.ID, c.IGN, c.Type, c.Encoding)
+	return fmt.Sprintf("%d (%s) %s encoding: %s", c.ID, c.IGN, c.Type(), c.Encoding)
 }
 
+func (c *Client) Type() OriginType {
+	return *c.originType.Load()
+}
+
+func (c *Client) setType(originType OriginType) {
+	c.originType.Store(&originType)
+}
+
+// The time of last message is initialized to now, so that new clients aren't concidered idle
 func NewDisclosedClientState() *GeneralDisclosedClientState {
-	return &GeneralDisclosedClientState{
+	state := &GeneralDisclosedClientState{
 		LastKnownPosition: atomic.Uint32{},
 		MSOfLastMessage:   atomic.Uint64{},
 	}
+	state.MSOfLastMessage.Store(uint64(time.Now().UnixMilli()))
+	return state
 }
 
-func NewClient(id ClientID, IGN string, clientType OriginType, conn *websocket.Conn, encoding meta.MessageEncoding) *Client {
-	return &Client{
-		ID:       id,
-		IDBytes:  util.BytesOfUint32(id),
-		IGN:      IGN,
-		Type:     clientType,
-		Conn:     conn,
-		Encoding: encoding,
-		State:    NewDisclosedClientState(),
+// Also starts the write pump of the client, which runs until the client is closed
+func NewClient(id ClientID, IGN string, clientType OriginType, conn *websocket.Conn, encoding meta.MessageEncoding, configuration *meta.RuntimeConfiguration) *Client {
+	client := &Client{
+		ID:           id,
+		IDBytes:      util.BytesOfUint32(id),
+		IGN:          IGN,
+		JoinedAt:     time.Now(),
+		Conn:         conn,
+		Encoding:     encoding,
+		State:        NewDisclosedClientState(),
+		ResumeToken:  newResumeToken(),
+		send:         make(chan outboundMessage, configuration.ClientSendQueueSize),
+		done:         make(chan struct{}),
+		writeTimeout: configuration.ClientWriteTimeout,
 	}
+	client.setType(clientType)
+	client.markPong()
+	go client.writePump()
+	return client
 }
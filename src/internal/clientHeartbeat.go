@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func (c *Client) markPong() {
+	c.lastPongMS.Store(time.Now().UnixMilli())
+}
+
+// Whether the client has neither had a message processed nor answered a ping within the limits given
+func (c *Client) isIdle(now time.Time, pongTimeout time.Duration, idleTimeout time.Duration) bool {
+	pongAge := now.Sub(time.UnixMilli(c.lastPongMS.Load()))
+	messageAge := now.Sub(time.UnixMilli(int64(c.State.MSOfLastMessage.Load())))
+	return pongAge > pongTimeout && messageAge > idleTimeout
+}
+
+// Pings the client on the connection given until stop is closed or the client is closed.
+//
+// Runs once per connection, alongside handleConnection
+func (lobby *Lobby) runHeartbeat(client *Client, conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(lobby.configuration.ClientPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-client.done:
+			return
+		case <-ticker.C:
+			// Answered by the pong handler set in handleConnection, which extends the read deadline
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(lobby.configuration.ClientWriteTimeout)); err != nil {
+				// The read deadline takes care of the rest
+				log.Printf("[lobby] Error pinging user %d: %v", client.ID, err)
+				return
+			}
+		}
+	}
+}
+
+// Periodically evicts any idle clients. Exits when the lobby is closing
+func (lobby *Lobby) runIdleEviction() {
+	ticker := time.NewTicker(lobby.configuration.ClientPingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if lobby.Closing.Load() {
+			return
+		}
+		lobby.evictIdleClients(time.Now())
+	}
+}
+
+// Suspended clients are left to the expiry of their session, as their pong is bound to be overdue
+func (lobby *Lobby) evictIdleClients(now time.Time) {
+	lobby.Clients.Range(func(key ClientID, client *Client) bool {
+		if client.isIdle(now, lobby.configuration.ClientPongTimeout, lobby.configuration.ClientIdleTimeout) &&
+			!client.IsSuspended() &&
+			client.evictionScheduled.CompareAndSwap(false, true) {
+			log.Printf("[lobby] User %d in lobby %d is idle, evicting", client.ID, lobby.ID)
+			// Disconnecting broadcasts PLAYER_LEFT and may close the lobby, which mustn't hold up the sweep
+			go lobby.handleDisconnect(client)
+		}
+		return true
+	})
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+func TestClientIsIdle(t *testing.T) {
+	now := time.Now()
+	pongTimeout := 30 * time.Second
+	idleTimeout := 60 * time.Second
+
+	tests := []struct {
+		name        string
+		lastPong    time.Time
+		lastMessage time.Time
+		want        bool
+	}{
+		{"fresh", now, now, false},
+		{"silent but answering pings", now, now.Add(-2 * idleTimeout), false},
+		{"chatty but not answering pings", now.Add(-2 * pongTimeout), now, false},
+		{"neither", now.Add(-2 * pongTimeout), now.Add(-2 * idleTimeout), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{State: NewDisclosedClientState()}
+			client.lastPongMS.Store(tt.lastPong.UnixMilli())
+			client.State.MSOfLastMessage.Store(uint64(tt.lastMessage.UnixMilli()))
+			if got := client.isIdle(now, pongTimeout, idleTimeout); got != tt.want {
+				t.Errorf("Expected isIdle to be %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHeartbeatPingsClient(t *testing.T) {
+	serverSide, clientSide := newTestConnPair(t)
+	configuration := *testConfiguration
+	configuration.ClientPingInterval = 10 * time.Millisecond
+	lobby := &Lobby{configuration: &configuration}
+	client := NewClient(1, "Hello", ORIGIN_TYPE_GUEST, serverSide, meta.MESSAGE_ENCODING_BINARY, &configuration)
+	defer client.Close()
+
+	pinged := make(chan struct{}, 1)
+	clientSide.SetPingHandler(func(appData string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	// Control frames are only processed while reading
+	go clientSide.ReadMessage()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go lobby.runHeartbeat(client, serverSide, stop)
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the client to be pinged")
+	}
+}
+
+func TestIdleEvictionSkipsSuspendedClients(t *testing.T) {
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+	longAgo := time.Now().Add(-time.Hour)
+	suspended, _ := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, longAgo)
+	connected, _ := addTestClient(t, lobby, 30, ORIGIN_TYPE_GUEST, longAgo)
+	for _, client := range []*Client{suspended, connected} {
+		client.lastPongMS.Store(longAgo.UnixMilli())
+		client.State.MSOfLastMessage.Store(uint64(longAgo.UnixMilli()))
+	}
+	if !suspended.suspend(suspended.Conn, time.Minute, 10, func(c *Client) {}) {
+		t.Fatal("Expected suspend to succeed")
+	}
+
+	lobby.evictIdleClients(time.Now())
+
+	if suspended.evictionScheduled.Load() {
+		t.Error("Expected the suspended client to be left to its session expiry")
+	}
+	if !connected.evictionScheduled.Load() {
+		t.Error("Expected the idle connected client to be evicted")
+	}
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrSessionEnded          = errors.New("session has ended")
+	ErrReplayBufferOverflown = errors.New("replay buffer of suspended client overflown")
+)
+
+// Tracks whether or not the connection of a client has dropped, and what has been sent to the client since.
+//
+// A client is suspended when its connection drops unexpectedly. While suspended, any messages to the client
+// are buffered, and replayed if the client resumes its session within the grace period.
+type clientSession struct {
+	suspended bool
+	// Set once the session is over for good, after which it can't be resumed
+	ended        bool
+	replayBuffer []outboundMessage
+	bufferLimit  uint32
+	expiry       *time.Timer
+}
+
+func newResumeToken() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// Constant time comparison of the resume token
+func (c *Client) ResumeTokenMatches(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(c.ResumeToken), []byte(token)) == 1
+}
+
+// Writes directly to the current connection, or buffers the message if the client is suspended
+//
+// Only to be called by the write pump of the client, or while resuming.
+func (c *Client) write(messageType int, data []byte) error {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if c.session.ended {
+		return ErrSessionEnded
+	}
+	if c.session.suspended {
+		if uint32(len(c.session.replayBuffer)) >= c.session.bufferLimit {
+			// No way of replaying faithfully anymore, so expire the session right away
+			c.session.expiry.Reset(0)
+			return ErrReplayBufferOverflown
+		}
+		c.session.replayBuffer = append(c.session.replayBuffer, outboundMessage{messageType: messageType, data: data})
+		return nil
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// Marks the client as suspended. onExpiry is called if the client hasn't resumed before the grace period runs out.
+//
+// Returns false if the connection given is no longer the clients current connection, or the session has already ended.
+func (c *Client) suspend(conn *websocket.Conn, gracePeriod time.Duration, bufferLimit uint32, onExpiry func(*Client)) bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if c.session.ended || c.session.suspended || c.Conn != conn {
+		return false
+	}
+	c.session.suspended = true
+	c.session.bufferLimit = bufferLimit
+	c.session.replayBuffer = nil
+	c.session.expiry = time.AfterFunc(gracePeriod, func() {
+		if c.endSession() {
+			onExpiry(c)
+		}
+	})
+	return true
+}
+
+// Attaches the new connection to the client and replays anything buffered while the client was suspended.
+//
+// A client may also resume while not suspended, in which case it is assumed that the
+// old connection is half-open and it is closed.
+//
+// Unless ErrSessionEnded is returned, the new connection is attached even if replaying fails.
+// The session is then to be ended, as the client has missed messages.
+func (c *Client) resume(conn *websocket.Conn) (int, error) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if c.session.ended {
+		return 0, ErrSessionEnded
+	}
+
+	previousConn := c.Conn
+	c.Conn = conn
+	wasSuspended := c.session.suspended
+	if wasSuspended {
+		c.session.expiry.Stop()
+		c.session.suspended = false
+	} else if previousConn != nil {
+		previousConn.Close()
+	}
+
+	// Replaying while holding the lock assures nothing new is written in between
+	replayed := 0
+	for _, buffered := range c.session.replayBuffer {
+		conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+		if err := conn.WriteMessage(buffered.messageType, buffered.data); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	c.session.replayBuffer = nil
+	return replayed, nil
+}
+
+// Returns false if the session was already ended
+func (c *Client) endSession() bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if c.session.ended {
+		return false
+	}
+	c.session.ended = true
+	c.session.suspended = false
+	c.session.replayBuffer = nil
+	if c.session.expiry != nil {
+		c.session.expiry.Stop()
+	}
+	return true
+}
+
+func (c *Client) IsSuspended() bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.session.suspended
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/gorilla/websocket"
+)
+
+var testConfiguration = meta.NewRuntimeConfiguration(meta.RUNTIME_MODE_DEV, meta.MESSAGE_ENCODING_BINARY)
+
+var testMainBackend = integrations.NewFakeMainBackend(nil)
+
+// Returns the server side and the client side of a fresh websocket connection
+func newTestConnPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	serverConns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Unexpected error upgrading: %v", err)
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	clientConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing: %v", err)
+	}
+	serverConn := <-serverConns
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	return serverConn, clientConn
+}
+
+func TestClientSessionReplaysBufferedMessagesOnResume(t *testing.T) {
+	oldServerSide, _ := newTestConnPair(t)
+	client := NewClient(1, "Hello", ORIGIN_TYPE_GUEST, oldServerSide, meta.MESSAGE_ENCODING_BINARY, testConfiguration)
+
+	expired := make(chan *Client, 1)
+	if !client.suspend(oldServerSide, time.Minute, 10, func(c *Client) { expired <- c }) {
+		t.Fatal("Expected suspend to succeed")
+	}
+	if !client.IsSuspended() {
+		t.Error("Expected client to be suspended")
+	}
+
+	for _, msg := range []string{"first", "second"} {
+		if err := client.write(websocket.BinaryMessage, []byte(msg)); err != nil {
+			t.Fatalf("Unexpected error buffering message: %v", err)
+		}
+	}
+
+	newServerSide, newClientSide := newTestConnPair(t)
+	replayed, err := client.resume(newServerSide)
+	if err != nil {
+		t.Fatalf("Unexpected error resuming: %v", err)
+	}
+	if replayed != 2 {
+		t.Errorf("Expected 2 replayed messages, got %d", replayed)
+	}
+	if client.IsSuspended() {
+		t.Error("Expected client to no longer be suspended")
+	}
+
+	newClientSide.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []string{"first", "second"} {
+		_, data, err := newClientSide.ReadMessage()
+		if err != nil {
+			t.Fatalf("Unexpected error reading replayed message: %v", err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected replayed message %s, got %s", expected, string(data))
+		}
+	}
+
+	select {
+	case <-expired:
+		t.Error("Expected expiry not to fire after resume")
+	default:
+	}
+}
+
+func TestClientSessionExpiresOnBufferOverflow(t *testing.T) {
+	serverSide, _ := newTestConnPair(t)
+	client := NewClient(1, "Hello", ORIGIN_TYPE_GUEST, serverSide, meta.MESSAGE_ENCODING_BINARY, testConfiguration)
+
+	expired := make(chan *Client, 1)
+	client.suspend(serverSide, time.Minute, 1, func(c *Client) { expired <- c })
+
+	if err := client.write(websocket.BinaryMessage, []byte("fits")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := client.write(websocket.BinaryMessage, []byte("overflows")); err != ErrReplayBufferOverflown {
+		t.Errorf("Expected ErrReplayBufferOverflown, got %v", err)
+	}
+
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatal("Expected session to expire after overflowing the replay buffer")
+	}
+
+	newServerSide, _ := newTestConnPair(t)
+	if _, err := client.resume(newServerSide); err != ErrSessionEnded {
+		t.Errorf("Expected ErrSessionEnded when resuming an expired session, got %v", err)
+	}
+}
+
+func TestClientSessionIgnoresStaleConnection(t *testing.T) {
+	oldServerSide, _ := newTestConnPair(t)
+	client := NewClient(1, "Hello", ORIGIN_TYPE_GUEST, oldServerSide, meta.MESSAGE_ENCODING_BINARY, testConfiguration)
+
+	// Resuming while not suspended takes over from the (presumably half-open) old connection
+	newServerSide, _ := newTestConnPair(t)
+	if _, err := client.resume(newServerSide); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// When the read loop of the old connection then ends, it must not suspend the client
+	if client.suspend(oldServerSide, time.Minute, 10, func(c *Client) {}) {
+		t.Error("Expected suspend on a stale connection to be ignored")
+	}
+}
+
+func TestResumeSessionEndsSessionIfReplayFails(t *testing.T) {
+	lm := CreateLobbyManager(testConfiguration, testMainBackend)
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, lm.CloseQueue, testConfiguration, testMainBackend)
+	lm.Lobbies.Store(lobby.ID, lobby)
+	_, ownerSide := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+	guest, _ := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, time.Now())
+
+	if !guest.suspend(guest.Conn, time.Minute, 10, func(c *Client) {}) {
+		t.Fatal("Expected suspend to succeed")
+	}
+	if err := guest.write(websocket.BinaryMessage, []byte("buffered")); err != nil {
+		t.Fatalf("Unexpected error buffering message: %v", err)
+	}
+
+	// Writing to a connection closed locally fails
+	brokenServerSide, _ := newTestConnPair(t)
+	brokenServerSide.Close()
+	if joinErr := lm.ResumeSession(lobby.ID, guest.ID, guest.ResumeToken, brokenServerSide); joinErr == nil {
+		t.Fatal("Expected resuming to fail")
+	}
+
+	if _, stillThere := lobby.Clients.Load(guest.ID); stillThere {
+		t.Error("Expected the client to be removed once replaying failed")
+	}
+	if _, err := guest.resume(brokenServerSide); err != ErrSessionEnded {
+		t.Errorf("Expected the session to have ended, got %v", err)
+	}
+	awaitEvent(t, ownerSide, PLAYER_LEFT_EVENT.ID)
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrSlowConsumer = errors.New("outbound queue of client is full")
+
+type outboundMessage struct {
+	messageType int
+	data        []byte
+}
+
+// Queues a message for the write pump of the client. Never blocks.
+//
+// Returns ErrSlowConsumer if the queue is full, in which case the message is dropped and the client flagged as a slow consumer.
+// Returns ErrSessionEnded if the client has been closed.
+//
+// Threadsafe
+func (c *Client) Enqueue(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrSessionEnded
+	default:
+	}
+
+	select {
+	case c.send <- outboundMessage{messageType: messageType, data: data}:
+		return nil
+	default:
+		c.slowConsumer.Store(true)
+		return ErrSlowConsumer
+	}
+}
+
+// Whether or not the outbound queue of this client has overflown at any point
+func (c *Client) IsSlowConsumer() bool {
+	return c.slowConsumer.Load()
+}
+
+// The only routine writing data messages to the connection(s) of the client, as gorilla/websocket doesn't allow concurrent writers.
+// Control frames (pings, pongs and close) are written with WriteControl instead, which gorilla/websocket permits alongside this writer.
+//
+// Runs until the client is closed.
+func (c *Client) writePump() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			if err := c.write(msg.messageType, msg.data); err != nil {
+				if errors.Is(err, ErrSessionEnded) {
+					return
+				}
+				if errors.Is(err, ErrReplayBufferOverflown) {
+					continue
+				}
+				log.Printf("[client] Error writing to client %d: %v", c.ID, err)
+				// Once a write has failed, the connection is no good. Closing it makes the read loop notice right away.
+				c.closeCurrentConn()
+				continue
+			}
+			metricBytesSent.Add(uint64(len(msg.data)), string(c.Encoding))
+		}
+	}
+}
+
+func (c *Client) closeCurrentConn() {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	c.Conn.Close()
+}
+
+// Ends the session for good, stops the write pump and closes the current connection
+func (c *Client) Close() error {
+	return c.closeWith(websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func (c *Client) closeWith(closeMessage []byte) error {
+	c.endSession()
+	c.closeOnce.Do(func() { close(c.done) })
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	c.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(c.writeTimeout))
+	return c.Conn.Close()
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/gorilla/websocket"
+)
+
+func TestWritePumpDeliversInOrder(t *testing.T) {
+	serverSide, clientSide := newTestConnPair(t)
+	client := NewClient(1, "Hello", ORIGIN_TYPE_GUEST, serverSide, meta.MESSAGE_ENCODING_BINARY, testConfiguration)
+	defer client.Close()
+
+	expected := []string{"first", "second", "third"}
+	for _, msg := range expected {
+		if err := client.Enqueue(websocket.BinaryMessage, []byte(msg)); err != nil {
+			t.Fatalf("Unexpected error enqueueing: %v", err)
+		}
+	}
+
+	clientSide.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range expected {
+		_, data, err := clientSide.ReadMessage()
+		if err != nil {
+			t.Fatalf("Unexpected error reading: %v", err)
+		}
+		if string(data) != want {
+			t.Errorf("Expected %s, got %s", want, string(data))
+		}
+	}
+}
+
+func TestEnqueueFlagsSlowConsumer(t *testing.T) {
+	serverSide, _ := newTestConnPair(t)
+	// Not using NewClient, as no write pump should be draining the queue
+	client := &Client{
+		ID:   1,
+		Conn: serverSide,
+		send: make(chan outboundMessage, 2),
+		done: make(chan struct{}),
+	}
+
+	for range 2 {
+		if err := client.Enqueue(websocket.BinaryMessage, []byte("fits")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if client.IsSlowConsumer() {
+		t.Error("Expected client not to be flagged before the queue overflows")
+	}
+	if err := client.Enqueue(websocket.BinaryMessage, []byte("overflows")); err != ErrSlowConsumer {
+		t.Errorf("Expected ErrSlowConsumer, got %v", err)
+	}
+	if !client.IsSlowConsumer() {
+		t.Error("Expected client to be flagged as a slow consumer")
+	}
+
+	client.Close()
+	if err := client.Enqueue(websocket.BinaryMessage, []byte("closed")); err != ErrSessionEnded {
+		t.Errorf("Expected ErrSessionEnded after close, got %v", err)
+	}
+}
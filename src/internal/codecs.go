@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Building blocks of the codecs generated by --generate-go-codecs (see codecs_generated.go).
+// Both writer and reader hold on to the first error, such that the generated code needs not check after every field.
+
+type codecWriter struct {
+	message []byte
+	err     error
+}
+
+func newCodecWriter(capacity uint32) *codecWriter {
+	return &codecWriter{message: make([]byte, 0, capacity)}
+}
+
+func (w *codecWriter) bytes() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.message, nil
+}
+
+func (w *codecWriter) u8(v uint8)   { w.message = append(w.message, v) }
+func (w *codecWriter) u16(v uint16) { w.message = binary.BigEndian.AppendUint16(w.message, v) }
+func (w *codecWriter) u32(v uint32) { w.message = binary.BigEndian.AppendUint32(w.message, v) }
+func (w *codecWriter) u64(v uint64) { w.message = binary.BigEndian.AppendUint64(w.message, v) }
+func (w *codecWriter) i8(v int8)    { w.u8(uint8(v)) }
+func (w *codecWriter) i16(v int16)  { w.u16(uint16(v)) }
+func (w *codecWriter) i32(v int32)  { w.u32(uint32(v)) }
+func (w *codecWriter) i64(v int64)  { w.u64(uint64(v)) }
+func (w *codecWriter) f32(v float32) {
+	w.u32(math.Float32bits(v))
+}
+func (w *codecWriter) f64(v float64) {
+	w.u64(math.Float64bits(v))
+}
+
+func (w *codecWriter) length(length int, prefix LengthPrefix) {
+	if w.err != nil {
+		return
+	}
+	w.message, w.err = appendLengthPrefix(w.message, make([]byte, 4), prefix, length)
+}
+
+func (w *codecWriter) string(v string, prefix LengthPrefix) {
+	w.length(len(v), prefix)
+	w.message = append(w.message, v...)
+}
+
+type codecReader struct {
+	cursor messageCursor
+	err    error
+}
+
+func newCodecReader(data []byte) *codecReader {
+	return &codecReader{cursor: messageCursor{data: data}}
+}
+
+// Zeroes on failure, so that the generated code can go on reading
+func (r *codecReader) take(n uint32) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	taken, err := r.cursor.take(n)
+	if err != nil {
+		r.err = err
+		return make([]byte, n)
+	}
+	return taken
+}
+
+func (r *codecReader) u8() uint8   { return r.take(1)[0] }
+func (r *codecReader) u16() uint16 { return binary.BigEndian.Uint16(r.take(2)) }
+func (r *codecReader) u32() uint32 { return binary.BigEndian.Uint32(r.take(4)) }
+func (r *codecReader) u64() uint64 { return binary.BigEndian.Uint64(r.take(8)) }
+func (r *codecReader) i8() int8    { return int8(r.u8()) }
+func (r *codecReader) i16() int16  { return int16(r.u16()) }
+func (r *codecReader) i32() int32  { return int32(r.u32()) }
+func (r *codecReader) i64() int64  { return int64(r.u64()) }
+func (r *codecReader) f32() float32 {
+	return math.Float32frombits(r.u32())
+}
+func (r *codecReader) f64() float64 {
+	return math.Float64frombits(r.u64())
+}
+
+// Number of elements to follow, each of at least elementSize bytes
+func (r *codecReader) length(prefix LengthPrefix, elementSize uint32) int {
+	if r.err != nil {
+		return 0
+	}
+	length, err := readLengthPrefix(&r.cursor, prefix)
+	if err != nil {
+		r.err = err
+		return 0
+	}
+	// Checked before allocating, so a bogus length can't make us allocate more than the message could hold
+	if uint64(length)*uint64(elementSize) > uint64(r.cursor.remaining()) {
+		r.err = fmt.Errorf("length %d exceeds the %d bytes remaining", length, r.cursor.remaining())
+		return 0
+	}
+	return int(length)
+}
+
+func (r *codecReader) string(prefix LengthPrefix) string {
+	if r.err != nil {
+		return ""
+	}
+	length := r.cursor.remaining()
+	if prefix != LENGTH_PREFIX_NONE {
+		length = uint32(r.length(prefix, 1))
+	}
+	bytes := r.take(length)
+	if r.err != nil {
+		return ""
+	}
+	if !utf8.Valid(bytes) {
+		r.err = fmt.Errorf("invalid UTF-8 string")
+		return ""
+	}
+	return string(bytes)
+}
@@ -0,0 +1,439 @@
+// Code generated by the multiplayer backend tool (--tools --generate-go-codecs). DO NOT EDIT.
+
+package internal
+
+func (dto AssignPlayerDataMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(13)
+	w.u32(dto.ID)
+	w.f32(dto.X)
+	w.f32(dto.Y)
+	w.u8(dto.TankType)
+	w.string(dto.CharCode, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *AssignPlayerDataMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ID = r.u32()
+	dto.X = r.f32()
+	dto.Y = r.f32()
+	dto.TankType = r.u8()
+	dto.CharCode = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto AsteroidImpactOnColonyMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(8)
+	w.u32(dto.ID)
+	w.u32(dto.ColonyHPLeft)
+	return w.bytes()
+}
+
+func (dto *AsteroidImpactOnColonyMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ID = r.u32()
+	dto.ColonyHPLeft = r.u32()
+	return r.err
+}
+
+func (dto AsteroidSpawnMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(18)
+	w.u32(dto.ID)
+	w.f32(dto.X)
+	w.f32(dto.Y)
+	w.u8(dto.Health)
+	w.u32(dto.TimeUntilImpact)
+	w.u8(dto.Type)
+	w.string(dto.CharCode, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *AsteroidSpawnMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ID = r.u32()
+	dto.X = r.f32()
+	dto.Y = r.f32()
+	dto.Health = r.u8()
+	dto.TimeUntilImpact = r.u32()
+	dto.Type = r.u8()
+	dto.CharCode = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto AsteroidsPlayerPenaltyMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(8)
+	w.u32(dto.PlayerID)
+	w.f32(dto.TimeoutDurationS)
+	w.string(dto.Type, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *AsteroidsPlayerPenaltyMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.TimeoutDurationS = r.f32()
+	dto.Type = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto DebugEventMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.Code)
+	w.string(dto.Message, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *DebugEventMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.Code = r.u32()
+	dto.Message = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto DifficultyConfirmedForMinigameMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(12)
+	w.u32(dto.ColonyLocationID)
+	w.u32(dto.MinigameID)
+	w.u32(dto.DifficultyID)
+	w.string(dto.DifficultyName, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *DifficultyConfirmedForMinigameMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ColonyLocationID = r.u32()
+	dto.MinigameID = r.u32()
+	dto.DifficultyID = r.u32()
+	dto.DifficultyName = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto DifficultySelectForMinigameMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(12)
+	w.u32(dto.ColonyLocationID)
+	w.u32(dto.MinigameID)
+	w.u32(dto.DifficultyID)
+	w.string(dto.DifficultyName, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *DifficultySelectForMinigameMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ColonyLocationID = r.u32()
+	dto.MinigameID = r.u32()
+	dto.DifficultyID = r.u32()
+	dto.DifficultyName = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto EmptyDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(0)
+	return w.bytes()
+}
+
+func (dto *EmptyDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	return r.err
+}
+
+func (dto EnterLocationMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.ID)
+	return w.bytes()
+}
+
+func (dto *EnterLocationMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ID = r.u32()
+	return r.err
+}
+
+func (dto GenericUntimelyAbortMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.SourceID)
+	w.string(dto.Reason, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *GenericUntimelyAbortMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.SourceID = r.u32()
+	dto.Reason = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto LobbyStateSnapshotMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(32)
+	w.u32(dto.LobbyID)
+	w.u32(dto.OwnerID)
+	w.u32(dto.ColonyID)
+	w.u32(dto.Phase)
+	w.u32(dto.PlayerCount)
+	w.u32(dto.ColonyLocationID)
+	w.u32(dto.MinigameID)
+	w.u32(dto.DifficultyID)
+	w.string(dto.DifficultyName, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *LobbyStateSnapshotMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.LobbyID = r.u32()
+	dto.OwnerID = r.u32()
+	dto.ColonyID = r.u32()
+	dto.Phase = r.u32()
+	dto.PlayerCount = r.u32()
+	dto.ColonyLocationID = r.u32()
+	dto.MinigameID = r.u32()
+	dto.DifficultyID = r.u32()
+	dto.DifficultyName = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto LobbyStateSnapshotPlayerMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(8)
+	w.u32(dto.PlayerID)
+	w.u32(dto.LastKnownPosition)
+	w.string(dto.IGN, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *LobbyStateSnapshotPlayerMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.LastKnownPosition = r.u32()
+	dto.IGN = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto LocationUpgradeMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(8)
+	w.u32(dto.ColonyLocationID)
+	w.u32(dto.Level)
+	return w.bytes()
+}
+
+func (dto *LocationUpgradeMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ColonyLocationID = r.u32()
+	dto.Level = r.u32()
+	return r.err
+}
+
+func (dto MinigameLostMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(12)
+	w.u32(dto.ColonyLocationID)
+	w.u32(dto.MinigameID)
+	w.u32(dto.DifficultyID)
+	w.string(dto.DifficultyName, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *MinigameLostMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ColonyLocationID = r.u32()
+	dto.MinigameID = r.u32()
+	dto.DifficultyID = r.u32()
+	dto.DifficultyName = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto MinigameWonMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(12)
+	w.u32(dto.ColonyLocationID)
+	w.u32(dto.MinigameID)
+	w.u32(dto.DifficultyID)
+	w.string(dto.DifficultyName, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *MinigameWonMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ColonyLocationID = r.u32()
+	dto.MinigameID = r.u32()
+	dto.DifficultyID = r.u32()
+	dto.DifficultyName = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto OwnerChangedMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(8)
+	w.u32(dto.PlayerID)
+	w.u32(dto.PreviousOwnerID)
+	w.string(dto.IGN, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *OwnerChangedMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.PreviousOwnerID = r.u32()
+	dto.IGN = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto PhaseDeadlineMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(8)
+	w.u32(dto.Phase)
+	w.u32(dto.RemainingMS)
+	return w.bytes()
+}
+
+func (dto *PhaseDeadlineMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.Phase = r.u32()
+	dto.RemainingMS = r.u32()
+	return r.err
+}
+
+func (dto PlayerAbortingMinigameMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.PlayerID)
+	w.string(dto.IGN, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *PlayerAbortingMinigameMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.IGN = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto PlayerJoinActivityMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.PlayerID)
+	w.string(dto.IGN, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *PlayerJoinActivityMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.IGN = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto PlayerJoinedMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.PlayerID)
+	w.string(dto.IGN, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *PlayerJoinedMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.IGN = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto PlayerLeftMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.PlayerID)
+	w.string(dto.IGN, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *PlayerLeftMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.IGN = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto PlayerLoadFailureMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(0)
+	w.string(dto.Reason, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *PlayerLoadFailureMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.Reason = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto PlayerMoveMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(8)
+	w.u32(dto.PlayerID)
+	w.u32(dto.ColonyLocationID)
+	return w.bytes()
+}
+
+func (dto *PlayerMoveMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.ColonyLocationID = r.u32()
+	return r.err
+}
+
+func (dto PlayerReadyMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.PlayerID)
+	w.string(dto.IGN, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *PlayerReadyMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.IGN = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto PlayerShootAtCodeMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(4)
+	w.u32(dto.PlayerID)
+	w.string(dto.CharCode, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *PlayerShootAtCodeMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.PlayerID = r.u32()
+	dto.CharCode = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto ProtocolMismatchMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(10)
+	w.u32(dto.ServerVersion)
+	w.u32(dto.ClientVersion)
+	w.string(dto.ServerFingerprint, LENGTH_PREFIX_U16)
+	w.string(dto.ClientFingerprint, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *ProtocolMismatchMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.ServerVersion = r.u32()
+	dto.ClientVersion = r.u32()
+	dto.ServerFingerprint = r.string(LENGTH_PREFIX_U16)
+	dto.ClientFingerprint = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto ServerAnnouncementMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(0)
+	w.string(dto.Message, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *ServerAnnouncementMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.Message = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
+
+func (dto SessionResumeTokenMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(0)
+	w.string(dto.Token, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *SessionResumeTokenMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.Token = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
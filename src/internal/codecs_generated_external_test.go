@@ -0,0 +1,30 @@
+package internal_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/config"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
+)
+
+// The codec of the test DTO is generated like those of the registered DTOs, but for a spec only the tests have.
+// Lives in an external test package, as the generator is in src/config, which imports this one
+func TestGeneratedTestCodecsAreUpToDate(t *testing.T) {
+	spec := internal.NewSpecMap(internal.TEST_SCOREBOARD_EVENT)[internal.TEST_SCOREBOARD_EVENT.ID]
+	var generated bytes.Buffer
+	if err := config.WriteGoCodecs(&generated, []internal.EventSpecification[any]{*spec}); err != nil {
+		t.Fatalf("Expected no error generating codecs, got %v", err)
+	}
+	onDisk, err := os.ReadFile("codecs_generated_test.go")
+	if err != nil || !bytes.Equal(generated.Bytes(), onDisk) {
+		if os.Getenv("WRITE_TEST_CODECS") != "" {
+			if err := os.WriteFile("codecs_generated_test.go", generated.Bytes(), 0644); err != nil {
+				t.Fatalf("Expected to write the generated codecs, got %v", err)
+			}
+			return
+		}
+		t.Error("codecs_generated_test.go is out of date, rerun this test with WRITE_TEST_CODECS=1")
+	}
+}
@@ -0,0 +1,45 @@
+// Code generated by the multiplayer backend tool (--tools --generate-go-codecs). DO NOT EDIT.
+
+package internal
+
+func (dto testScoreboardMessageDTO) MarshalBinary() ([]byte, error) {
+	w := newCodecWriter(10)
+	w.u16(dto.Round)
+	w.length(len(dto.Hits), LENGTH_PREFIX_U16)
+	for _, v := range dto.Hits {
+		w.u16(v)
+	}
+	w.length(len(dto.Deltas), LENGTH_PREFIX_U32)
+	for _, v := range dto.Deltas {
+		w.i64(v)
+	}
+	w.length(len(dto.Entries), LENGTH_PREFIX_U16)
+	for _, v := range dto.Entries {
+		w.u32(v.PlayerID)
+		w.string(v.IGN, LENGTH_PREFIX_U16)
+		w.f32(v.Accuracy)
+	}
+	w.string(dto.Note, LENGTH_PREFIX_NONE)
+	return w.bytes()
+}
+
+func (dto *testScoreboardMessageDTO) UnmarshalBinary(data []byte) error {
+	r := newCodecReader(data)
+	dto.Round = r.u16()
+	dto.Hits = make([]uint16, r.length(LENGTH_PREFIX_U16, 2))
+	for i := range dto.Hits {
+		dto.Hits[i] = r.u16()
+	}
+	dto.Deltas = make([]int64, r.length(LENGTH_PREFIX_U32, 8))
+	for i := range dto.Deltas {
+		dto.Deltas[i] = r.i64()
+	}
+	dto.Entries = make([]testScoreboardEntryDTO, r.length(LENGTH_PREFIX_U16, 10))
+	for i := range dto.Entries {
+		dto.Entries[i].PlayerID = r.u32()
+		dto.Entries[i].IGN = r.string(LENGTH_PREFIX_U16)
+		dto.Entries[i].Accuracy = r.f32()
+	}
+	dto.Note = r.string(LENGTH_PREFIX_NONE)
+	return r.err
+}
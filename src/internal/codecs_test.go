@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"encoding"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+type testScoreboardEntryDTO struct {
+	PlayerID uint32  `json:"playerID" comment:"Player ID"`
+	IGN      string  `json:"ign" comment:"In game name" prefix:"u16"`
+	Accuracy float32 `json:"accuracy" comment:"Share of shots hit"`
+}
+
+// Covers the slices of the generated codecs, which no registered DTO has (see codecs_generated_test.go)
+type testScoreboardMessageDTO struct {
+	Round   uint16                   `json:"round" comment:"Round"`
+	Hits    []uint16                 `json:"hits" comment:"Hits per wave"`
+	Deltas  []int64                  `json:"deltas" comment:"Score deltas" prefix:"u32"`
+	Entries []testScoreboardEntryDTO `json:"entries" comment:"Entries"`
+	Note    string                   `json:"note" comment:"Note"`
+}
+
+var TEST_SCOREBOARD_EVENT = NewSpecification[testScoreboardMessageDTO](1_000_000_003, "TestScoreboard", "Only used in tests",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
+func registeredSpecs() []*EventSpecification[any] {
+	var specs []*EventSpecification[any]
+	maps := []map[MessageID]*EventSpecification[any]{LOBBY_MANAGEMENT_EVENTS, COLONY_EVENTS, MINIGAME_INITIATION_EVENTS}
+	for _, minigame := range RegisteredMinigames() {
+		maps = append(maps, minigame.Events)
+	}
+	for _, events := range maps {
+		for _, spec := range events {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// Fills every field with something random, but deterministic for the rng given
+func fillTestValue(v reflect.Value, rng *rand.Rand) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fillTestValue(v.Field(i), rng)
+		}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(rng.Uint64())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(rng.Int64())
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(rng.Float32()))
+	case reflect.String:
+		runes := make([]rune, rng.IntN(8))
+		for i := range runes {
+			runes[i] = []rune("abcæøå🚀")[rng.IntN(7)]
+		}
+		v.SetString(string(runes))
+	case reflect.Slice:
+		length := rng.IntN(4)
+		v.Set(reflect.MakeSlice(v.Type(), length, length))
+		for i := 0; i < length; i++ {
+			fillTestValue(v.Index(i), rng)
+		}
+	}
+}
+
+func TestGeneratedCodecsMatchReflection(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	specs := append(registeredSpecs(), NewSpecMap(TEST_SCOREBOARD_EVENT)[TEST_SCOREBOARD_EVENT.ID])
+	for _, spec := range specs {
+		t.Run(spec.Name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				value := reflect.New(spec.DTOType).Elem()
+				fillTestValue(value, rng)
+
+				marshaler, ok := value.Interface().(encoding.BinaryMarshaler)
+				if !ok {
+					t.Fatalf("%s has no generated codec, run --tools --generate-go-codecs", spec.DTOType.Name())
+				}
+				generated, err := marshaler.MarshalBinary()
+				if err != nil {
+					t.Fatalf("Expected no error from the generated codec, got %v", err)
+				}
+				reflective, err := serializeReflective(spec, value.Interface())
+				if err != nil {
+					t.Fatalf("Expected no error from reflection, got %v", err)
+				}
+				// Serialize prepends the event id
+				if !reflect.DeepEqual(generated, reflective[4:]) {
+					t.Fatalf("Expected identical bytes for %+v\ngenerated:  %v\nreflection: %v", value.Interface(), generated, reflective[4:])
+				}
+
+				fromGenerated := reflect.New(spec.DTOType)
+				if err := fromGenerated.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(generated); err != nil {
+					t.Fatalf("Expected no error from the generated codec, got %v", err)
+				}
+				fromReflection := reflect.New(spec.DTOType)
+				if err := readStruct(&messageCursor{data: generated}, spec.Structure, fromReflection.Elem()); err != nil {
+					t.Fatalf("Expected no error from reflection, got %v", err)
+				}
+				if !reflect.DeepEqual(fromGenerated.Elem().Interface(), value.Interface()) {
+					t.Errorf("Expected the generated codec to read back %+v, got %+v", value.Interface(), fromGenerated.Elem().Interface())
+				}
+				if !reflect.DeepEqual(fromReflection.Elem().Interface(), value.Interface()) {
+					t.Errorf("Expected reflection to read back %+v, got %+v", value.Interface(), fromReflection.Elem().Interface())
+				}
+			}
+		})
+	}
+}
+
+func TestGeneratedCodecsRejectTruncatedMessages(t *testing.T) {
+	serialized, err := Serialize(ASTEROID_SPAWN_EVENT, AsteroidSpawnMessageDTO{ID: 1, CharCode: "abc"})
+	if err != nil {
+		t.Fatalf("Expected no error serializing, got %v", err)
+	}
+	// Cut off within the fixed size fields
+	if _, err := Deserialize(ASTEROID_SPAWN_EVENT, serialized[4:10], true); err == nil {
+		t.Error("Expected an error deserializing a truncated message")
+	}
+}
+
+func TestGeneratedCodecsRejectMissingHeader(t *testing.T) {
+	// Fewer bytes than the header, though as many as the body needs
+	if _, err := Deserialize(ENTER_LOCATION_EVENT, make([]byte, MESSAGE_HEADER_SIZE-1), false); err == nil {
+		t.Error("Expected an error deserializing a message without a full header")
+	}
+}
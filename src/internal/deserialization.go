@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"math"
@@ -14,18 +15,52 @@ import (
 //
 // Based on remainderOnly, it will either expect the entire message (headers and all)
 // or only the remainder (body) of the message.
+//
+// Uses the generated codec of T if there is one (see codecs_generated.go), and reflection otherwise
 func Deserialize[T any](spec *EventSpecification[T], data []byte, remainderOnly bool) (*T, error) {
+	var dest T // Allocation of new nil-value instantiated copy of T
+	if err := deserializeInto(spec.Structure, spec.ExpectedMinSize, data, remainderOnly, &dest); err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+// Deserializes into a new instance of the DTO type of the spec, for when the type isn't known statically,
+// as for the specs of ALL_EVENTS. Returns the DTO by value
+func DeserializeDTO(spec *EventSpecification[any], data []byte, remainderOnly bool) (any, error) {
+	if spec.DTOType == nil {
+		return nil, fmt.Errorf("spec %s has no DTO type", spec.Name)
+	}
+	dest := reflect.New(spec.DTOType)
+	if err := deserializeInto(spec.Structure, spec.ExpectedMinSize, data, remainderOnly, dest.Interface()); err != nil {
+		return nil, err
+	}
+	return dest.Elem().Interface(), nil
+}
+
+// dest must be a pointer to the value to deserialize into
+func deserializeInto(structure ComputedStructure, expectedMinSize uint32, data []byte, remainderOnly bool, dest any) error {
 	// A specs offset is including the header although it does not itself describe it,
 	// so if remainderOnly == true, we need subtract the header size to get the correct offset
 	offsetAdjustment := util.Ternary(remainderOnly, MESSAGE_HEADER_SIZE, 0)
 
-	if len(data) < int(spec.ExpectedMinSize)-int(offsetAdjustment) {
-		return nil, fmt.Errorf("expected at least %d bytes, got %d", spec.ExpectedMinSize, len(data))
+	if len(data) < int(expectedMinSize)-int(offsetAdjustment) {
+		return fmt.Errorf("expected at least %d bytes, got %d", expectedMinSize, len(data))
 	}
 
-	var dest T // Allocation of new nil-value instantiated copy of T
+	// Generated codecs only ever read the body
+	if unmarshaler, ok := dest.(encoding.BinaryUnmarshaler); ok {
+		body := data
+		if !remainderOnly {
+			if len(data) < int(MESSAGE_HEADER_SIZE) {
+				return fmt.Errorf("expected at least %d bytes of header, got %d", MESSAGE_HEADER_SIZE, len(data))
+			}
+			body = data[MESSAGE_HEADER_SIZE:]
+		}
+		return unmarshaler.UnmarshalBinary(body)
+	}
 
-	t := reflect.TypeOf(dest)
+	t := reflect.TypeOf(dest).Elem()
 
 	// If it's a pointer, get the underlying element
 	if t.Kind() == reflect.Ptr {
@@ -33,60 +68,150 @@ func Deserialize[T any](spec *EventSpecification[T], data []byte, remainderOnly
 	}
 
 	if t.Kind() != reflect.Struct {
-		return nil, fmt.Errorf("expected a struct, got %s", t.Kind())
+		return fmt.Errorf("expected a struct, got %s", t.Kind())
 	}
 
-	if t.NumField() != len(spec.Structure) {
-		return nil, fmt.Errorf("expected %d fields, got %d", len(spec.Structure), t.NumField())
+	if t.NumField() != len(structure) {
+		return fmt.Errorf("expected %d fields, got %d", len(structure), t.NumField())
 	}
 
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		element := spec.Structure[i]
+		element := structure[i]
 		if field.Type.Kind() != element.Kind {
-			return nil, fmt.Errorf("expected field %d to be of kind %s, got %s", i, element.Kind, field.Type.Kind())
+			return fmt.Errorf("expected field %d to be of kind %s, got %s", i, element.Kind, field.Type.Kind())
 		}
+	}
 
-		value, err := parseGoTypeFromBytes(data, element.Offset-offsetAdjustment, element.Kind)
-		if err != nil {
-			return nil, err
-		}
+	// Elements following a variable size element have no fixed offset, so the message is read front to back
+	cursor := &messageCursor{data: data, offset: MESSAGE_HEADER_SIZE - offsetAdjustment}
+	return readStruct(cursor, structure, reflect.ValueOf(dest).Elem())
+}
 
-		if err := setStructField(&dest, field.Name, value); err != nil {
-			return nil, err
-		}
-	}
+// Position in a message being deserialized
+type messageCursor struct {
+	data   []byte
+	offset uint32
+}
 
-	return &dest, nil
+func (cursor *messageCursor) remaining() uint32 {
+	if cursor.offset >= uint32(len(cursor.data)) {
+		return 0
+	}
+	return uint32(len(cursor.data)) - cursor.offset
 }
 
-// Extremely unsafe. Use with caution
-func setStructField(strukt interface{}, fieldName string, value interface{}) error {
-	structValue := reflect.ValueOf(strukt)
-	if structValue.Kind() != reflect.Ptr || structValue.Elem().Kind() != reflect.Struct {
-		return fmt.Errorf("strukt must be a pointer to a struct")
+func (cursor *messageCursor) take(n uint32) ([]byte, error) {
+	if n > cursor.remaining() {
+		return nil, fmt.Errorf("expected %d more bytes at offset %d, got %d", n, cursor.offset, cursor.remaining())
 	}
-	structValue = structValue.Elem()
+	taken := cursor.data[cursor.offset : cursor.offset+n]
+	cursor.offset += n
+	return taken, nil
+}
 
-	fieldValue := structValue.FieldByName(fieldName)
-	if !fieldValue.IsValid() {
-		return fmt.Errorf("no such field: %s in struct %v", fieldName, structValue.Type())
+// Reads each element of the structure into the fields of the struct value
+func readStruct(cursor *messageCursor, structure ComputedStructure, v reflect.Value) error {
+	for _, element := range structure {
+		field, found := util.FindFieldByJSONTagValue(v, element.FieldName)
+		if !found {
+			return fmt.Errorf("no such field: %s in struct %v", element.FieldName, v.Type())
+		}
+		if !field.CanSet() {
+			return fmt.Errorf("cannot set field %s in struct %v", element.FieldName, v.Type())
+		}
+		if err := readElement(cursor, element, field); err != nil {
+			return fmt.Errorf("field '%s': %s", element.FieldName, err.Error())
+		}
 	}
+	return nil
+}
 
-	if !fieldValue.CanSet() {
-		return fmt.Errorf("cannot set field %s in struct %v", fieldName, structValue.Type())
+func readElement(cursor *messageCursor, element MessageElementDescriptor, field reflect.Value) error {
+	switch element.Kind {
+	case reflect.String:
+		length := cursor.remaining()
+		if element.LengthPrefix != LENGTH_PREFIX_NONE {
+			var err error
+			if length, err = readLengthPrefix(cursor, element.LengthPrefix); err != nil {
+				return err
+			}
+		}
+		bytes, err := cursor.take(length)
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(bytes) {
+			return fmt.Errorf("invalid UTF-8 string")
+		}
+		field.SetString(string(bytes))
+		return nil
+
+	case reflect.Slice:
+		length, err := readLengthPrefix(cursor, element.LengthPrefix)
+		if err != nil {
+			return err
+		}
+		elementSize := util.SizeOfSerializedKind(element.ElementKind)
+		if element.ElementKind == reflect.Struct {
+			elementSize = MinimumSizeOf(element.Elements)
+		}
+		// Checked before allocating, so a bogus length can't make us allocate more than the message could hold
+		if uint64(length)*uint64(elementSize) > uint64(cursor.remaining()) {
+			return fmt.Errorf("length %d exceeds the %d bytes remaining", length, cursor.remaining())
+		}
+		slice := reflect.MakeSlice(field.Type(), int(length), int(length))
+		for i := 0; i < int(length); i++ {
+			if element.ElementKind == reflect.Struct {
+				err = readStruct(cursor, element.Elements, slice.Index(i))
+			} else {
+				err = readPrimitive(cursor, element.ElementKind, slice.Index(i))
+			}
+			if err != nil {
+				return fmt.Errorf("element %d: %s", i, err.Error())
+			}
+		}
+		field.Set(slice)
+		return nil
+
+	default:
+		return readPrimitive(cursor, element.Kind, field)
 	}
+}
 
-	fieldType := fieldValue.Type()
+func readPrimitive(cursor *messageCursor, kind reflect.Kind, field reflect.Value) error {
+	size := util.SizeOfSerializedKind(kind)
+	if size > cursor.remaining() {
+		return fmt.Errorf("not enough data to parse %s", kind)
+	}
+	value, err := parseGoTypeFromBytes(cursor.data, cursor.offset, kind)
+	if err != nil {
+		return err
+	}
 	val := reflect.ValueOf(value)
-	if fieldType != val.Type() {
+	if field.Type() != val.Type() {
 		return fmt.Errorf("provided value type didn't match obj field type")
 	}
-
-	fieldValue.Set(val)
+	field.Set(val)
+	cursor.offset += size
 	return nil
 }
 
+func readLengthPrefix(cursor *messageCursor, prefix LengthPrefix) (uint32, error) {
+	bytes, err := cursor.take(uint32(prefix))
+	if err != nil {
+		return 0, fmt.Errorf("length prefix: %s", err.Error())
+	}
+	switch prefix {
+	case LENGTH_PREFIX_U16:
+		return uint32(binary.BigEndian.Uint16(bytes)), nil
+	case LENGTH_PREFIX_U32:
+		return binary.BigEndian.Uint32(bytes), nil
+	default:
+		return 0, fmt.Errorf("unsupported length prefix: %d", prefix)
+	}
+}
+
 // Extremely unsafe. Use with caution
 func parseGoTypeFromBytes(data []byte, offset uint32, kind reflect.Kind) (interface{}, error) {
 	if util.SizeOfSerializedKind(kind) > uint32(len(data))-offset {
@@ -5,6 +5,7 @@ import (
 	"log"
 	"reflect"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
@@ -44,6 +45,8 @@ type EventSpecification[T any] struct {
 	// 3. The message is of at least the expected size
 	Handler   AbstractEventHandler[T]
 	Structure ComputedStructure
+	// The type of T, as T is erased once in a spec map
+	DTOType reflect.Type
 }
 
 func (eSpec *EventSpecification[T]) CopyIDBytes() []byte {
@@ -58,9 +61,9 @@ func NewSpecification[T any](id MessageID, name string, comment string, whoMaySe
 	handler AbstractEventHandler[T]) *EventSpecification[T] {
 
 	var idAsBytes = util.BytesOfUint32(id)
+	var tNull T
 	derived, computeErr := DeriveReferenceDescriptionFromT[T]()
 	if computeErr != nil {
-		var tNull T
 		panic(fmt.Sprintf("Specification error: Error deriving reference description for %s: %s", reflect.TypeOf(tNull).String(), computeErr.Error()))
 	}
 	minContentSize, computed := ComputeStructure(name, derived)
@@ -77,11 +80,15 @@ func NewSpecification[T any](id MessageID, name string, comment string, whoMaySe
 		ExpectedMinSize: minContentSize,
 		Structure:       computed,
 		Comment:         comment,
+		DTOType:         reflect.TypeOf(tNull),
 	}
 }
 
 // Derive a reference structure description from a generic type param.
 // Will error if the type is not a struct or general field name isn't provided with the JSON tag.
+//
+// Strings and slices may carry a prefix tag selecting the size of their length prefix: `prefix:"u16"` or `prefix:"u32"`.
+// Slices are u16 prefixed by default.
 func DeriveReferenceDescriptionFromT[T any]() (ReferenceStructure, error) {
 	var tNull T
 	tVal := reflect.ValueOf(tNull)
@@ -89,21 +96,47 @@ func DeriveReferenceDescriptionFromT[T any]() (ReferenceStructure, error) {
 	if tVal.Type().Kind() != reflect.Struct {
 		return nil, fmt.Errorf("t is not a struct")
 	}
+	return deriveReferenceDescription(tVal.Type())
+}
 
+func deriveReferenceDescription(t reflect.Type) (ReferenceStructure, error) {
 	var result ReferenceStructure
-	for i := 0; i < tVal.Type().NumField(); i++ {
-		field := tVal.Type().Field(i)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
 		fieldName, err := util.GetFieldNameFromTag(field)
 		if err != nil {
-			return nil, fmt.Errorf("unable to derive reference structure for %s: %s", tVal.Type().String(), err)
+			return nil, fmt.Errorf("unable to derive reference structure for %s: %s", t.String(), err)
 		}
-		kind := field.Type.Kind()
 		comment, err := util.GetCommentValue(field)
 		if err != nil {
-			log.Printf("Warning: Deriving reference structure for %s: %s", tVal.Type().String(), err)
+			log.Printf("Warning: Deriving reference structure for %s: %s", t.String(), err)
 			comment = "no comment provided"
 		}
-		result = append(result, NewElementDescriptor(comment, fieldName, kind))
+		prefix, err := ParseLengthPrefix(field.Tag.Get("prefix"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to derive reference structure for %s: field %s: %s", t.String(), field.Name, err)
+		}
+
+		if field.Type.Kind() != reflect.Slice {
+			element := NewElementDescriptor(comment, fieldName, field.Type.Kind())
+			element.LengthPrefix = prefix
+			result = append(result, element)
+			continue
+		}
+
+		if prefix == LENGTH_PREFIX_NONE {
+			prefix = DEFAULT_SLICE_LENGTH_PREFIX
+		}
+		elementType := field.Type.Elem()
+		if elementType.Kind() != reflect.Struct {
+			result = append(result, NewSliceDescriptor(comment, fieldName, elementType.Kind(), prefix))
+			continue
+		}
+		elements, err := deriveReferenceDescription(elementType)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, NewStructSliceDescriptor(comment, fieldName, elements, prefix))
 	}
 	return result, nil
 }
@@ -131,6 +164,9 @@ var DEBUG_EVENT = NewSpecification[DebugEventMessageDTO](1, "DebugInfo", "For de
 var SERVER_CLOSING_EVENT = NewSpecification[EmptyDTO](2, "ServerClosing", "Sent when the server shuts down, followed by LOBBY CLOSING",
 	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
 
+var SERVER_ANNOUNCEMENT_EVENT = NewSpecification[ServerAnnouncementMessageDTO](3, "ServerAnnouncement", "Operational message from the server administrators, to be shown to the player",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
 // Full range: 0 to 4,294,967,295
 //
 // 1-10: System events, 0 is the nil value for uint32, so it's not used
@@ -141,8 +177,10 @@ var SERVER_CLOSING_EVENT = NewSpecification[EmptyDTO](2, "ServerClosing", "Sent
 //
 // 2000-2999: Minigame Initiation Events
 //
+// 3000+: Minigame Events, registered by each minigame. See minigameRegistry.go
+//
 // 1_000_000_000+: Game Events
-var ALL_EVENTS = NewSpecMap(DEBUG_EVENT, SERVER_CLOSING_EVENT)
+var ALL_EVENTS = NewSpecMap(DEBUG_EVENT, SERVER_CLOSING_EVENT, SERVER_ANNOUNCEMENT_EVENT)
 
 // Use only with instances of EventSpecification[T extends any]
 //
@@ -178,8 +216,24 @@ var PLAYER_LEFT_EVENT = NewSpecification[PlayerLeftMessageDTO](12, "PlayerLeft",
 var LOBBY_CLOSING_EVENT = NewSpecification[EmptyDTO](13, "LobbyClosing", "Sent when the lobby closes", SERVER_ONLY,
 	Handlers_IntentionalIgnoreHandler)
 
+var SESSION_RESUME_TOKEN_EVENT = NewSpecification[SessionResumeTokenMessageDTO](14, "SessionResumeToken", "Sent only to a client that has just joined, containing the token with which it may resume its session if the connection drops",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
+var OWNER_CHANGED_EVENT = NewSpecification[OwnerChangedMessageDTO](15, "OwnerChanged", "Sent when the owner has left and a guest has been promoted to owner in its place",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
+var LOBBY_STATE_SNAPSHOT_EVENT = NewSpecification[LobbyStateSnapshotMessageDTO](16, "LobbyStateSnapshot", "Sent only to a client that has just joined, describing the lobby as it is. Followed by one LobbyStateSnapshotPlayer per player in the lobby",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
+var LOBBY_STATE_SNAPSHOT_PLAYER_EVENT = NewSpecification[LobbyStateSnapshotPlayerMessageDTO](17, "LobbyStateSnapshotPlayer", "Sent only to a client that has just joined, following LobbyStateSnapshot, once per player in the lobby including the client itself",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
+var PROTOCOL_MISMATCH_EVENT = NewSpecification[ProtocolMismatchMessageDTO](18, "ProtocolMismatch", "Sent only to a client that has just joined in compatibility mode, as its protocol version or spec fingerprint differs from that of the server",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
 // 10-999: Lobby Management
-var LOBBY_MANAGEMENT_EVENTS = NewSpecMap(PLAYER_JOINED_EVENT, PLAYER_LEFT_EVENT, LOBBY_CLOSING_EVENT)
+var LOBBY_MANAGEMENT_EVENTS = NewSpecMap(PLAYER_JOINED_EVENT, PLAYER_LEFT_EVENT, LOBBY_CLOSING_EVENT, SESSION_RESUME_TOKEN_EVENT, OWNER_CHANGED_EVENT,
+	LOBBY_STATE_SNAPSHOT_EVENT, LOBBY_STATE_SNAPSHOT_PLAYER_EVENT, PROTOCOL_MISMATCH_EVENT)
 
 var ENTER_LOCATION_EVENT = NewSpecification[EnterLocationMessageDTO](1001, "EnterLocation", "Send when the owner enters a location",
 	OWNER_ONLY, Handlers_NoCheckReplicate)
@@ -236,14 +290,25 @@ var MINIGAME_WON_EVENT = NewSpecification[MinigameWonMessageDTO](2012, "Minigame
 var MINIGAME_LOST_EVENT = NewSpecification[MinigameLostMessageDTO](2013, "MinigameLost", "Sent when the server has determined that the currently ongoing minigame is lost",
 	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
 
+var PHASE_DEADLINE_EVENT = NewSpecification[PhaseDeadlineMessageDTO](2014, "PhaseDeadline", "Sent when a waiting phase of the minigame initiation begins, with the time left before the server stops waiting for players. Also queued internally once the deadline has passed",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
 var MINIGAME_INITIATION_EVENTS = NewSpecMap(DIFFICULTY_SELECT_FOR_MINIGAME_EVENT, DIFFICULTY_CONFIRMED_FOR_MINIGAME_EVENT, PLAYERS_DECLARE_INTENT_EVENT,
 	PLAYER_READY_EVENT, PLAYER_ABORTING_MINIGAME_EVENT, MINIGAME_BEGINS_EVENT, PLAYER_JOIN_ACTIVITY_EVENT, PLAYER_LOAD_FAILURE_EVENT,
 	GENERIC_MINIGAME_UNTIMELY_ABORT, PLAYER_LOAD_COMPLETE_EVENT, LOAD_MINIGAME_EVENT, GENERIC_MINIGAME_SEQUENCE_RESET,
-	MINIGAME_WON_EVENT, MINIGAME_LOST_EVENT)
+	MINIGAME_WON_EVENT, MINIGAME_LOST_EVENT, PHASE_DEADLINE_EVENT)
 
 // Loads and organises event specification for later use
 // Also checks if there's errors.
+//
+// Only the first call loads anything, so packages using the specs (fx. the client package) may call it as well
 func InitEventSpecifications() error {
+	return initEventSpecificationsOnce()
+}
+
+var initEventSpecificationsOnce = sync.OnceValue(loadEventSpecifications)
+
+func loadEventSpecifications() error {
 	if err := loadEventsIntoAllEvents(LOBBY_MANAGEMENT_EVENTS); err != nil {
 		return err
 	}
@@ -253,9 +318,12 @@ func InitEventSpecifications() error {
 	if err := loadEventsIntoAllEvents(MINIGAME_INITIATION_EVENTS); err != nil {
 		return err
 	}
-	if err := loadEventsIntoAllEvents(ALL_ASTEROIDS_EVENTS); err != nil {
-		return err
+	for _, minigame := range RegisteredMinigames() {
+		if err := loadEventsIntoAllEvents(minigame.Events); err != nil {
+			return fmt.Errorf("loading events of minigame %s: %w", minigame.Name, err)
+		}
 	}
+	protocolFingerprint = ComputeProtocolFingerprint(ALL_EVENTS)
 
 	return nil
 }
@@ -9,6 +9,10 @@ type DebugEventMessageDTO struct {
 	Message string `json:"message" comment:"Debug message"`
 }
 
+type ServerAnnouncementMessageDTO struct {
+	Message string `json:"message" comment:"Announcement"`
+}
+
 type PlayerJoinedMessageDTO struct {
 	PlayerID uint32 `json:"id" comment:"Player ID"`
 	IGN      string `json:"ign" comment:"Player IGN"`
@@ -19,6 +23,42 @@ type PlayerLeftMessageDTO struct {
 	IGN      string `json:"ign" comment:"Player IGN"`
 }
 
+type SessionResumeTokenMessageDTO struct {
+	Token string `json:"token" comment:"Secret to provide as resumeToken on /connect to resume the session after a dropped connection"`
+}
+
+type OwnerChangedMessageDTO struct {
+	PlayerID        uint32 `json:"id" comment:"Player ID of the new owner"`
+	PreviousOwnerID uint32 `json:"previousOwnerID" comment:"Player ID of the previous owner"`
+	IGN             string `json:"ign" comment:"IGN of the new owner"`
+}
+
+type LobbyStateSnapshotMessageDTO struct {
+	LobbyID     uint32 `json:"lobbyID" comment:"Lobby ID"`
+	OwnerID     uint32 `json:"ownerID" comment:"Player ID of the current owner"`
+	ColonyID    uint32 `json:"colonyID" comment:"Colony ID"`
+	Phase       uint32 `json:"phase" comment:"Current lobby phase"`
+	PlayerCount uint32 `json:"playerCount" comment:"Number of LobbyStateSnapshotPlayer events to follow"`
+	// Zero values if no minigame difficulty is locked in
+	ColonyLocationID uint32 `json:"colonyLocationID" comment:"Colony Location ID of the locked in minigame, if any"`
+	MinigameID       uint32 `json:"minigameID" comment:"Minigame ID of the locked in minigame, if any"`
+	DifficultyID     uint32 `json:"difficultyID" comment:"Difficulty ID of the locked in minigame, if any"`
+	DifficultyName   string `json:"difficultyName" comment:"Difficulty Name of the locked in minigame, if any"`
+}
+
+type ProtocolMismatchMessageDTO struct {
+	ServerVersion     uint32 `json:"serverVersion" comment:"Protocol version of the server"`
+	ClientVersion     uint32 `json:"clientVersion" comment:"Protocol version declared by the client, 0 if none"`
+	ServerFingerprint string `json:"serverFingerprint" comment:"Spec fingerprint of the server" prefix:"u16"`
+	ClientFingerprint string `json:"clientFingerprint" comment:"Spec fingerprint declared by the client, empty if none"`
+}
+
+type LobbyStateSnapshotPlayerMessageDTO struct {
+	PlayerID          uint32 `json:"id" comment:"Player ID"`
+	LastKnownPosition uint32 `json:"lastKnownPosition" comment:"Colony Location ID the player was last known to be at"`
+	IGN               string `json:"ign" comment:"Player IGN"`
+}
+
 type EnterLocationMessageDTO struct {
 	ID uint32 `json:"id" comment:"Colony Location ID"`
 }
@@ -71,6 +111,11 @@ type GenericUntimelyAbortMessageDTO struct {
 	Reason   string `json:"reason" comment:"Reason"`
 }
 
+type PhaseDeadlineMessageDTO struct {
+	Phase       uint32 `json:"phase" comment:"Lobby phase the deadline applies to"`
+	RemainingMS uint32 `json:"remainingMS" comment:"Milliseconds left until the deadline"`
+}
+
 type MinigameLostMessageDTO struct {
 	ColonyLocationID uint32 `json:"colonyLocationID" comment:"Colony Location ID"`
 	MinigameID       uint32 `json:"minigameID" comment:"Minigame ID"`
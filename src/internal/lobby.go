@@ -1,12 +1,14 @@
 package internal
 
 import (
-	"encoding/hex"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
@@ -32,54 +34,72 @@ func NewMessageEntry(client *Client, remainder []byte, spec *EventSpecification[
 
 // Lobby represents a lobby with a set of users
 type Lobby struct {
-	ID       LobbyID
-	OwnerID  ClientID
-	ColonyID uint32
-	Clients  util.ConcurrentTypedMap[ClientID, *Client] // UserID to User mapping
-	Sync     sync.Mutex                                 // Protects access to the Users map
-	Closing  atomic.Bool                                // Indicates if the lobby is in the process of closing
-	//Prepends senderID
+	ID LobbyID
+	// Threadsafe, current owner, which changes if ownership is migrated. Use GetOwnerID()
+	ownerID atomic.Uint32
+	// The owner of the colony according to the main backend. Never changes, even if ownership of the lobby is migrated
+	ColonyOwnerID    ClientID
+	ColonyID         uint32
+	ownerLeavePolicy meta.OwnerLeavePolicy
+	Clients          util.ConcurrentTypedMap[ClientID, *Client] // UserID to User mapping
+	Sync             sync.Mutex                                 // Protects access to the Users map
+	Closing          atomic.Bool                                // Indicates if the lobby is in the process of closing
+	//Prepends senderID. Encodes the message as per the encoding of each client
 	BroadcastMessage func(senderID ClientID, message []byte) []*Client
-	Encoding         meta.MessageEncoding
-	activityTracker  *ActivityTracker
-	currentActivity  *GenericMinigameControls
-	CloseQueue       chan<- *Lobby // Queue on which to register self for closing
+	// Encoding of clients that don't declare their own on connect
+	Encoding        meta.MessageEncoding
+	activityTracker *ActivityTracker
+	// Only to be changed by the hooks of phases
+	currentActivity atomic.Pointer[GenericMinigameControls]
+	// Loaded ahead of entering LOBBY_PHASE_IN_MINIGAME, and taken by its enter hook
+	loadedActivity atomic.Pointer[GenericMinigameControls]
+	phases         *LobbyStateMachine
+	CloseQueue     chan<- *Lobby // Queue on which to register self for closing
 	// Queue of all messages to be further tracked
 	// All messages must have been through all pre-flight checks and handler before being added here
 	PostProcessQueue chan *MessageEntry
+	configuration    *meta.RuntimeConfiguration
+	mainBackend      integrations.MainBackend
+	// Closed once the colony has been closed with the main backend, successfully or not
+	colonyClosed chan struct{}
+	// Cancelled once the lobby closes, ending any call to the main backend made on behalf of it
+	ctx    context.Context
+	cancel context.CancelFunc
 	//Maybe introduce message channel for messages to be sent to the lobby
 }
 
-func NewLobby(id LobbyID, ownerID ClientID, colonyID uint32, encoding meta.MessageEncoding, closeQueue chan<- *Lobby) *Lobby {
+func NewLobby(id LobbyID, ownerID ClientID, colonyID uint32, encoding meta.MessageEncoding, ownerLeavePolicy meta.OwnerLeavePolicy, closeQueue chan<- *Lobby, configuration *meta.RuntimeConfiguration, mainBackend integrations.MainBackend) *Lobby {
 	lobby := &Lobby{
 		ID:               id,
-		OwnerID:          ownerID,
+		ColonyOwnerID:    ownerID,
 		ColonyID:         colonyID,
+		ownerLeavePolicy: ownerLeavePolicy,
 		Clients:          util.ConcurrentTypedMap[ClientID, *Client]{},
 		Closing:          atomic.Bool{},
 		Encoding:         encoding,
 		activityTracker:  NewActivityTracker(),
-		currentActivity:  nil,
 		CloseQueue:       closeQueue,
 		PostProcessQueue: make(chan *MessageEntry, 1000),
+		configuration:    configuration,
+		mainBackend:      mainBackend,
+		colonyClosed:     make(chan struct{}),
 	}
-
-	switch encoding {
-	case meta.MESSAGE_ENCODING_BINARY:
-		lobby.BroadcastMessage = func(senderID ClientID, message []byte) []*Client {
-			return BroadcastMessageBinary(lobby, senderID, message)
-		}
-	case meta.MESSAGE_ENCODING_BASE16:
-		lobby.BroadcastMessage = func(senderID ClientID, message []byte) []*Client {
-			return BroadcastMessageBase16(lobby, senderID, message)
-		}
-	case meta.MESSAGE_ENCODING_BASE64:
-		lobby.BroadcastMessage = func(senderID ClientID, message []byte) []*Client {
-			return BroadcastMessageBase64(lobby, senderID, message)
+	lobby.ctx, lobby.cancel = context.WithCancel(context.Background())
+	lobby.ownerID.Store(ownerID)
+
+	lobby.BroadcastMessage = func(senderID ClientID, message []byte) []*Client {
+		eventName := eventNameOf(message)
+		metricMessagesBroadcast.Inc(eventName)
+		unreachable := broadcast(lobby, senderID, message)
+		if len(unreachable) > 0 {
+			metricBroadcastFailures.Add(uint64(len(unreachable)), eventName)
 		}
+		return lobby.handleUnresponsiveClients(unreachable)
 	}
+	lobby.phases = newLobbyPhases(lobby)
 
 	go lobby.runPostProcess()
+	go lobby.runIdleEviction()
 
 	return lobby
 }
@@ -92,6 +112,9 @@ const (
 	JoinErrorAlreadyInLobby       JoinError = 2
 	JoinErrorUnknown              JoinError = 3
 	JoinErrorSerializationFailure JoinError = 4
+	JoinErrorColonyMismatch       JoinError = 5
+	JoinErrorSessionNotResumable  JoinError = 6
+	JoinErrorProtocolMismatch     JoinError = 7
 )
 
 type LobbyJoinError struct {
@@ -105,64 +128,54 @@ func (e *LobbyJoinError) Error() string {
 }
 
 // Handle user connection and disconnection events
-func (lobby *Lobby) handleConnection(client *Client) {
+//
+// Runs once per connection, so again if the client resumes its session on a new connection
+func (lobby *Lobby) handleConnection(client *Client, conn *websocket.Conn) {
 
 	// Set Ping handler
-	client.Conn.SetPingHandler(func(appData string) error {
+	conn.SetPingHandler(func(appData string) error {
 		log.Printf("[lobby] Received ping from user %d", client.ID)
 		// Respond with Pong automatically
-		return client.Conn.WriteMessage(websocket.PongMessage, []byte(appData))
+		return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(lobby.configuration.ClientWriteTimeout))
 	})
 
 	// Set Pong handler
-	client.Conn.SetPongHandler(func(appData string) error {
-		log.Printf("[lobby] Received pong from user %d", client.ID)
-		return nil
+	conn.SetPongHandler(func(appData string) error {
+		client.markPong()
+		return conn.SetReadDeadline(time.Now().Add(lobby.configuration.ClientPongTimeout))
 	})
 
-	var onDisconnect func(*Client)
-	if client.Type == ORIGIN_TYPE_OWNER {
-		onDisconnect = lobby.handleOwnerDisconnect
-	} else {
-		onDisconnect = lobby.handleGuestDisconnect
-	}
+	// Half-open connections are detected by the read deadline running out
+	client.markPong()
+	conn.SetReadDeadline(time.Now().Add(lobby.configuration.ClientPongTimeout))
+	stopHeartbeat := make(chan struct{})
+	go lobby.runHeartbeat(client, conn, stopHeartbeat)
 
 	// Set Close handler
-	client.Conn.SetCloseHandler(func(code int, text string) error {
+	conn.SetCloseHandler(func(code int, text string) error {
 		log.Printf("[lobby] User %d disconnected with close message: %d - %s", client.ID, code, text)
-		onDisconnect(client)
 		return nil
 	})
 
+	var readErr error
 	for {
 		// Read the message from the WebSocket
 		// Blocks until TextMessage or BinaryMessage is received.
-		dataType, msg, err := client.Conn.ReadMessage()
+		dataType, msg, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("User %d disconnected: %v", client.ID, err)
+			readErr = err
 			break
 		}
+		metricBytesReceived.Add(uint64(len(msg)), string(client.Encoding))
 
-		if dataType == websocket.TextMessage {
-			//Base16, hex, decode the message
-			log.Printf("[lobby] Received text message from user %d", client.ID)
-			var decodeErr error
-			msg, decodeErr = hex.DecodeString(string(msg))
-
-			if decodeErr != nil {
-				log.Printf("[lobby] Error decoding message from user %d: %v", client.ID, decodeErr)
-				if cantSendDebugInfo := SendDebugInfoToClient(client, 400, "Error decoding message"); cantSendDebugInfo != nil {
-					log.Printf("[lobby] Error sending debug info to user %d: %v", client.ID, cantSendDebugInfo)
-					break
-				}
-			}
-		} else if dataType != websocket.BinaryMessage {
-			log.Printf("[lobby] Invalid message type from user %d", client.ID)
-			if cantSendDebugInfo := SendDebugInfoToClient(client, 404, "Invalid message type: "+fmt.Sprint(dataType)); cantSendDebugInfo != nil {
+		msg, err = DecodeInbound(client.Encoding, dataType, msg)
+		if err != nil {
+			log.Printf("[lobby] Error decoding message from user %d: %v", client.ID, err)
+			if cantSendDebugInfo := SendDebugInfoToClient(client, 400, "Error decoding message: "+err.Error()); cantSendDebugInfo != nil {
 				log.Printf("[lobby] Error sending debug info to user %d: %v", client.ID, cantSendDebugInfo)
 				break
 			}
-
 			continue
 		}
 
@@ -175,6 +188,7 @@ func (lobby *Lobby) handleConnection(client *Client) {
 			}
 			continue
 		}
+		metricMessagesReceived.Inc(spec.Name)
 		// Although the client object as returned here, should be the same as the one in the input to this method,
 		// just for safety, we fetch the client object from the lobby's client map anyway
 		_, clientExists := lobby.Clients.Load(clientID)
@@ -183,7 +197,8 @@ func (lobby *Lobby) handleConnection(client *Client) {
 			continue
 		}
 
-		if !spec.SendPermissions[client.Type] {
+		// Checked per message, as the type changes if the client is promoted to owner
+		if !spec.SendPermissions[client.Type()] {
 			log.Printf("[lobby] User %d not allowed to send message ID %d", client.ID, spec.ID)
 			if err := SendDebugInfoToClient(client, 401, fmt.Sprintf("Unauthorized: client %d is not allowed to send messages of id %d", client.ID, spec.ID)); err != nil {
 				break
@@ -201,21 +216,41 @@ func (lobby *Lobby) handleConnection(client *Client) {
 			}
 		}
 	}
-	// Some disconnect issues here.
-	onDisconnect(client)
+	close(stopHeartbeat)
+	lobby.onConnectionLost(client, conn, readErr)
+}
+
+// Decides whether a lost connection ends the clients session right away, or whether the client is suspended
+// to allow it to resume its session within the grace period.
+func (lobby *Lobby) onConnectionLost(client *Client, conn *websocket.Conn, readErr error) {
+	if current, exists := lobby.Clients.Load(client.ID); !exists || current != client {
+		// Already removed, fx. by RemoveClient
+		return
+	}
+	// The client said goodbye, so no reason to wait around
+	intentional := websocket.IsCloseError(readErr, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+	if intentional || lobby.Closing.Load() || lobby.configuration.SessionResumeGracePeriod <= 0 {
+		lobby.handleDisconnect(client)
+		return
+	}
+
+	if client.suspend(conn, lobby.configuration.SessionResumeGracePeriod, lobby.configuration.SessionResumeBufferSize, lobby.handleDisconnect) {
+		log.Printf("[lobby] User %d suspended in lobby %d, awaiting resume for %s", client.ID, lobby.ID, lobby.configuration.SessionResumeGracePeriod)
+	}
 }
 
 // Assumes all pre-flight checks have been done
 func (lobby *Lobby) processClientMessage(client *Client, spec *EventSpecification[any], remainder []byte) error {
 	// Handle message based on messageID
 	if handlingErr := spec.Handler(lobby, client, spec, remainder); handlingErr != nil {
-		if !errors.Is(handlingErr, &UnresponsiveClientsError{}) {
+		var unresponsiveErr *UnresponsiveClientsError
+		if !errors.As(handlingErr, &unresponsiveErr) {
 			SendDebugInfoToClient(client, 500, "Error handling message: "+handlingErr.Error())
 			log.Printf("[lobby] Error handling message ID %d from clientID %d: %v", spec.ID, client.ID, handlingErr)
 			return fmt.Errorf("Error handling message ID %d from clientID %d: %v", spec.ID, client.ID, handlingErr)
-		} else {
-			//TODO: Track unresponsive clients
 		}
+		// The slow consumer policy has already been applied by the broadcast, the message itself is fine
+		log.Printf("[lobby] Message ID %d from clientID %d did not reach %d client(s)", spec.ID, client.ID, len(unresponsiveErr.UnresponsiveClients))
 	}
 
 	client.State.UpdateAny(spec.ID, remainder)
@@ -225,8 +260,53 @@ func (lobby *Lobby) processClientMessage(client *Client, spec *EventSpecificatio
 	return nil
 }
 
+func (lobby *Lobby) GetOwnerID() ClientID {
+	return lobby.ownerID.Load()
+}
+
 func (lobby *Lobby) GetPhase() uint32 {
-	return lobby.activityTracker.phase.Load()
+	return uint32(lobby.phases.Current())
+}
+
+// Declares the minigame sequence of a lobby:
+//
+// ROAMING_COLONY -> AWAITING_PARTICIPANTS -> PLAYERS_DECLARE_INTENT -> LOADING_MINIGAME -> IN_MINIGAME -> ROAMING_COLONY
+//
+// Any phase up until the minigame has started may fall back to ROAMING_COLONY
+func newLobbyPhases(l *Lobby) *LobbyStateMachine {
+	tracker := l.activityTracker
+	return NewLobbyStateMachine().
+		Allow(LOBBY_PHASE_ROAMING_COLONY, LOBBY_PHASE_AWAITING_PARTICIPANTS, tracker.IsLockedIn).
+		Allow(LOBBY_PHASE_AWAITING_PARTICIPANTS, LOBBY_PHASE_PLAYERS_DECLARE_INTENT, tracker.AllExpectedParticipantsAreAccountedFor).
+		Allow(LOBBY_PHASE_PLAYERS_DECLARE_INTENT, LOBBY_PHASE_LOADING_MINIGAME, tracker.AllPlayersAreReady).
+		Allow(LOBBY_PHASE_LOADING_MINIGAME, LOBBY_PHASE_IN_MINIGAME, tracker.AllPlayersHaveLoadedIn).
+		Allow(LOBBY_PHASE_AWAITING_PARTICIPANTS, LOBBY_PHASE_ROAMING_COLONY, nil).
+		Allow(LOBBY_PHASE_PLAYERS_DECLARE_INTENT, LOBBY_PHASE_ROAMING_COLONY, nil).
+		Allow(LOBBY_PHASE_LOADING_MINIGAME, LOBBY_PHASE_ROAMING_COLONY, nil).
+		Allow(LOBBY_PHASE_IN_MINIGAME, LOBBY_PHASE_ROAMING_COLONY, nil).
+		OnEnter(LOBBY_PHASE_ROAMING_COLONY, func(PhaseTransition) error {
+			return tracker.ReleaseLock()
+		}).
+		OnEnter(LOBBY_PHASE_AWAITING_PARTICIPANTS, l.armPhaseDeadline).
+		OnEnter(LOBBY_PHASE_PLAYERS_DECLARE_INTENT, func(transition PhaseTransition) error {
+			tracker.BeginReadyTracking()
+			l.BroadcastMessage(SERVER_ID, PLAYERS_DECLARE_INTENT_EVENT.CopyIDBytes())
+			return l.armPhaseDeadline(transition)
+		}).
+		OnEnter(LOBBY_PHASE_LOADING_MINIGAME, func(transition PhaseTransition) error {
+			tracker.BeginLoadTracking()
+			l.BroadcastMessage(SERVER_ID, LOAD_MINIGAME_EVENT.CopyIDBytes())
+			return l.armPhaseDeadline(transition)
+		}).
+		OnEnter(LOBBY_PHASE_IN_MINIGAME, l.mountActivity).
+		OnExit(LOBBY_PHASE_IN_MINIGAME, l.unmountActivity).
+		OnHookError(func(transition PhaseTransition) {
+			if err := OnUntimelyMinigameAbort(transition.Err.Error(), SERVER_ID, l, nil); err != nil {
+				log.Printf("[lobby] Error sending untimely abort message: %v", err)
+			}
+		}).
+		Observe(logPhaseTransitions(l.ID)).
+		Observe(countPhaseTransitions)
 }
 
 func (l *Lobby) runPostProcess() {
@@ -234,93 +314,39 @@ func (l *Lobby) runPostProcess() {
 	for !l.Closing.Load() {
 		// Blocks until a messageInfo is received
 		messageInfo := <-l.PostProcessQueue
-		currentPhase := l.activityTracker.phase.Load()
 
+		// Only ever queued by the server itself, fx. when the owner leaves mid-sequence
 		if messageInfo.Spec.ID == GENERIC_MINIGAME_SEQUENCE_RESET.ID {
-			if currentPhase == uint32(LOBBY_PHASE_IN_MINIGAME) {
-				SendDebugInfoToClient(messageInfo.Client, 400, "Cannot reset minigame sequence while in minigame")
-				return
-			} else {
-				if err := l.activityTracker.ReleaseLock(); err != nil {
-					log.Printf("[lobby] Error releasing lock: %v", err)
-					SendDebugInfoToClient(messageInfo.Client, 400, "Error releasing lock: "+err.Error())
-					return
-				}
+			if l.phases.Current() == LOBBY_PHASE_IN_MINIGAME {
+				log.Printf("[lobby] Ignoring minigame sequence reset in lobby %d, as a minigame is ongoing", l.ID)
+				continue
 			}
+			l.resetSequence("sequence reset")
+			continue
+		}
+		// Only ever queued by the server itself, once the deadline of a waiting phase has passed
+		if messageInfo.Spec.ID == PHASE_DEADLINE_EVENT.ID {
+			l.onPhaseDeadline(LobbyPhase(binary.BigEndian.Uint32(messageInfo.Remainder)))
+			continue
 		}
 
-		switch currentPhase {
-		case uint32(LOBBY_PHASE_ROAMING_COLONY):
+		switch l.phases.Current() {
+		case LOBBY_PHASE_ROAMING_COLONY:
 			l.trackPhaseRoamningColony(messageInfo.Client, messageInfo.Spec, messageInfo.Remainder)
-
-		case uint32(LOBBY_PHASE_AWAITING_PARTICIPANTS):
+			l.advancePhase(LOBBY_PHASE_ROAMING_COLONY, LOBBY_PHASE_AWAITING_PARTICIPANTS, "activity locked in")
+		case LOBBY_PHASE_AWAITING_PARTICIPANTS:
 			l.trackPhaseAwaitingParticipants(messageInfo.Client, messageInfo.Spec, messageInfo.Remainder)
-			// If all players have been accounted for, begin the next phase
-			if l.activityTracker.AdvanceIfAllExpectedParticipantsAreAccountedFor() {
-				// Send players declare intent event
-				l.BroadcastMessage(SERVER_ID, PLAYERS_DECLARE_INTENT_EVENT.CopyIDBytes())
-			}
-		case uint32(LOBBY_PHASE_PLAYERS_DECLARE_INTENT):
+			l.advancePhase(LOBBY_PHASE_AWAITING_PARTICIPANTS, LOBBY_PHASE_PLAYERS_DECLARE_INTENT, "all participants accounted for")
+		case LOBBY_PHASE_PLAYERS_DECLARE_INTENT:
 			l.trackPhasePlayersDeclareIntent(messageInfo.Client, messageInfo.Spec, messageInfo.Remainder)
-			// If all players are ready, begin the next phase
-			if l.activityTracker.AdvanceIfAllPlayersAreReady() {
-				// Send Load Minigame event
-				l.BroadcastMessage(SERVER_ID, LOAD_MINIGAME_EVENT.CopyIDBytes())
-			}
-		case uint32(LOBBY_PHASE_LOADING_MINIGAME):
-			if messageInfo.Spec.ID == PLAYER_LOAD_FAILURE_EVENT.ID {
-				deserialized, err := Deserialize(PLAYER_LOAD_FAILURE_EVENT, messageInfo.Remainder, true)
-				if err != nil {
-					log.Printf("[lobby] While updating tracked activity: Error deserializing message from clientID %d: %v", messageInfo.Client.ID, err)
-					SendDebugInfoToClient(messageInfo.Client, 400, "Error deserializing message: "+err.Error())
-					return
-				}
-				serErr := OnUntimelyMinigameAbort(deserialized.Reason, messageInfo.Client.ID, l, nil)
-				if serErr != nil {
-					log.Printf("[lobby] Error sending untimely abort message: %v", err)
-				}
-				l.activityTracker.ReleaseLock()
-			}
-
-			if messageInfo.Spec.ID == PLAYER_LOAD_COMPLETE_EVENT.ID {
-				l.activityTracker.MarkPlayerAsLoadComplete(messageInfo.Client)
-			}
-
-			if l.activityTracker.AdvanceIfAllPlayersHaveLoadedIn() {
-				// Find game loop.
-				var diff *DifficultyConfirmedForMinigameMessageDTO
-				l.activityTracker.diffConfirmed.Do(func(v **DifficultyConfirmedForMinigameMessageDTO) {
-					diff = *v // Super unsafe, may cause nil pointer derefence on several levels
-					// Either right here, or later
-					// However, as of current control flow, this shouldn't be able to happen
-					// So if it fails, let it fail, as the error wouldn't be here, but earlier.
-				})
-				controls, err := LoadMinigameControls(diff, l, l.dismountCurrentActivity)
-				if err != nil {
-					err := OnUntimelyMinigameAbort(err.Error(), SERVER_ID, l, nil)
-					if err != nil {
-						log.Printf("[lobby] Error sending untimely abort message: %v", err)
-					}
-					l.activityTracker.ReleaseLock()
-					return
-				}
-
-				if err := controls.ExecRisingEdge(); err != nil {
-					err := OnUntimelyMinigameAbort(err.Error(), SERVER_ID, l, nil)
-					if err != nil {
-						log.Printf("[lobby] Error sending untimely abort message: %v", err)
-					}
-					l.activityTracker.ReleaseLock()
-					return
-				}
-
-				controls.StartLoop()
-				l.currentActivity = controls
-			}
-		case uint32(LOBBY_PHASE_IN_MINIGAME):
+			l.advancePhase(LOBBY_PHASE_PLAYERS_DECLARE_INTENT, LOBBY_PHASE_LOADING_MINIGAME, "all players ready")
+		case LOBBY_PHASE_LOADING_MINIGAME:
+			l.trackPhaseLoadingMinigame(messageInfo.Client, messageInfo.Spec, messageInfo.Remainder)
+			l.enterMinigame("all players loaded")
+		case LOBBY_PHASE_IN_MINIGAME:
 			_, isInGame := l.activityTracker.participantTracker.OptIn.Load(messageInfo.Client.ID)
-			if isInGame {
-				if err := l.currentActivity.OnMessage(messageInfo); err != nil {
+			if activity := l.currentActivity.Load(); isInGame && activity != nil {
+				if err := activity.OnMessage(messageInfo); err != nil {
 					log.Printf("[lobby] Error processing message in minigame: %v", err)
 					SendDebugInfoToClient(messageInfo.Client, 500, "Error processing message in minigame: "+err.Error())
 				}
@@ -329,14 +355,114 @@ func (l *Lobby) runPostProcess() {
 	}
 }
 
-// Dismounts the current activity
-// Releases the lock on activity tracker
+// Attempts the transition, if the lobby is still in the phase expected.
+// Tracking may already have moved the lobby elsewhere, fx. back to roaming
+func (l *Lobby) advancePhase(from LobbyPhase, to LobbyPhase, reason string) {
+	if l.phases.Current() != from {
+		return
+	}
+	if _, err := l.phases.Transition(to, reason); err != nil {
+		log.Printf("[lobby] Lobby %d could not advance from %s to %s: %v", l.ID, from, to, err)
+	}
+}
+
+// Abandons the minigame sequence in progress, if any, and lets everyone know
+func (l *Lobby) resetSequence(reason string) {
+	if l.phases.Current() != LOBBY_PHASE_ROAMING_COLONY {
+		if _, err := l.phases.Transition(LOBBY_PHASE_ROAMING_COLONY, reason); err != nil {
+			log.Printf("[lobby] Error resetting minigame sequence in lobby %d: %v", l.ID, err)
+		}
+	}
+	l.BroadcastMessage(SERVER_ID, GENERIC_MINIGAME_SEQUENCE_RESET.CopyIDBytes())
+}
+
+// Loads the minigame locked in, then moves on to LOBBY_PHASE_IN_MINIGAME, if all players have loaded.
+//
+// Loading fetches the settings from the main backend, so it is done before transitioning, as other transitions
+// (fx. an admin releasing the lobby) would otherwise wait on the main backend. Should the lobby have moved on meanwhile,
+// the minigame loaded is discarded
+func (l *Lobby) enterMinigame(reason string) {
+	if l.phases.Current() != LOBBY_PHASE_LOADING_MINIGAME || !l.activityTracker.AllPlayersHaveLoadedIn() {
+		return
+	}
+	var diff *DifficultyConfirmedForMinigameMessageDTO
+	l.activityTracker.diffConfirmed.Do(func(v **DifficultyConfirmedForMinigameMessageDTO) {
+		if v != nil {
+			diff = *v
+		}
+	})
+	controls, err := LoadMinigameControls(diff, l, l.dismountCurrentActivity)
+	if err != nil {
+		log.Printf("[lobby] Error loading minigame in lobby %d: %v", l.ID, err)
+		if err := OnUntimelyMinigameAbort(err.Error(), SERVER_ID, l, nil); err != nil {
+			log.Printf("[lobby] Error sending untimely abort message: %v", err)
+		}
+		l.advancePhase(LOBBY_PHASE_LOADING_MINIGAME, LOBBY_PHASE_ROAMING_COLONY, "failed to load minigame")
+		return
+	}
+	l.loadedActivity.Store(controls)
+	l.advancePhase(LOBBY_PHASE_LOADING_MINIGAME, LOBBY_PHASE_IN_MINIGAME, reason)
+	l.loadedActivity.Store(nil)
+}
+
+// Enter hook of LOBBY_PHASE_IN_MINIGAME. Starts the minigame loaded by enterMinigame
+func (l *Lobby) mountActivity(PhaseTransition) error {
+	controls := l.loadedActivity.Swap(nil)
+	if controls == nil {
+		return fmt.Errorf("no minigame loaded")
+	}
+	if err := controls.ExecRisingEdge(); err != nil {
+		return err
+	}
+	// Only set once the rising edge succeeded, as the falling edge is not to be executed otherwise
+	l.currentActivity.Store(controls)
+	controls.StartLoop()
+	metricMinigameStarts.Inc(fmt.Sprint(controls.MinigameID))
+	return nil
+}
+
+// Exit hook of LOBBY_PHASE_IN_MINIGAME.
+// The falling edge runs in the background, as it may call the main backend, fx. to upgrade the location won
+func (l *Lobby) unmountActivity(PhaseTransition) error {
+	activity := l.currentActivity.Swap(nil)
+	if activity == nil {
+		return nil
+	}
+	metricMinigameOutcomes.Inc(fmt.Sprint(activity.MinigameID), MinigameStateFrom(activity.State.Load()).String())
+	go func() {
+		// The minigame is over either way, so a failing falling edge doesn't warrant an abort
+		if err := activity.ExecFallingEdge(); err != nil {
+			log.Printf("[lobby] Error executing falling edge of minigame %d in lobby %d: %v", activity.MinigameID, l.ID, err)
+		}
+	}()
+	return nil
+}
+
+// Called by the minigame once its loop has ended
 func (l *Lobby) dismountCurrentActivity() {
-	if l.currentActivity != nil {
-		l.currentActivity.ExecFallingEdge()
-		l.currentActivity = nil
+	if _, err := l.phases.Transition(LOBBY_PHASE_ROAMING_COLONY, "minigame ended"); err != nil {
+		log.Printf("[lobby] Error dismounting minigame in lobby %d: %v", l.ID, err)
+	}
+}
+
+func (l *Lobby) trackPhaseLoadingMinigame(client *Client, spec *EventSpecification[any], remainder []byte) {
+	switch spec.ID {
+	case PLAYER_LOAD_FAILURE_EVENT.ID:
+		deserialized, err := Deserialize(PLAYER_LOAD_FAILURE_EVENT, remainder, true)
+		if err != nil {
+			log.Printf("[lobby] While updating tracked activity: Error deserializing message from clientID %d: %v", client.ID, err)
+			SendDebugInfoToClient(client, 400, "Error deserializing message: "+err.Error())
+			return
+		}
+		if err := OnUntimelyMinigameAbort(deserialized.Reason, client.ID, l, nil); err != nil {
+			log.Printf("[lobby] Error sending untimely abort message: %v", err)
+		}
+		if _, err := l.phases.Transition(LOBBY_PHASE_ROAMING_COLONY, "player failed to load"); err != nil {
+			log.Printf("[lobby] Error resetting minigame sequence in lobby %d: %v", l.ID, err)
+		}
+	case PLAYER_LOAD_COMPLETE_EVENT.ID:
+		l.activityTracker.MarkPlayerAsLoadComplete(client)
 	}
-	l.activityTracker.ReleaseLock()
 }
 
 func (l *Lobby) trackPhasePlayersDeclareIntent(client *Client, spec *EventSpecification[any], remainder []byte) {
@@ -376,9 +502,9 @@ func (l *Lobby) trackPhaseAwaitingParticipants(client *Client, spec *EventSpecif
 		if !l.activityTracker.RemoveParticipant(client) {
 			log.Printf("[lobby] Error removing participant from activity because it is not yet locked in. Message from %d", client.ID)
 			SendDebugInfoToClient(client, 400, "Cannot remove participant from activity because the Activity is not yet locked in")
-		} else if client.ID == l.OwnerID {
-			//Emit generic sequence reset
-			l.BroadcastMessage(SERVER_ID, GENERIC_MINIGAME_SEQUENCE_RESET.CopyIDBytes())
+		} else if client.ID == l.GetOwnerID() {
+			// The owner drives the sequence, so it can't continue without them
+			l.resetSequence("owner left the activity")
 		}
 	}
 
@@ -389,23 +515,122 @@ func (lobby *Lobby) handleGuestDisconnect(user *Client) {
 	lobby.RemoveClient(user)
 }
 func (lobby *Lobby) handleOwnerDisconnect(user *Client) {
+	if lobby.ownerLeavePolicy == meta.OWNER_LEAVE_POLICY_MIGRATE && !lobby.Closing.Load() && lobby.migrateOwnership(user) {
+		return
+	}
 	log.Println("Lobby owner disconnected, closing lobby: ", lobby.ID)
 	// If the lobby owner disconnects, close the lobby and notify everyone
 	lobby.close()
 }
 
+// Removes the previous owner and promotes the longest connected guest to owner.
+// If the owner leaves in the middle of a minigame sequence, the sequence is reset, while an ongoing minigame continues.
+//
+// Returns false if there is no guest to promote
+func (lobby *Lobby) migrateOwnership(previousOwner *Client) bool {
+	lobby.Sync.Lock()
+	defer lobby.Sync.Unlock()
+
+	successor := lobby.longestConnectedGuest(previousOwner.ID)
+	if successor == nil {
+		return false
+	}
+	lobby.RemoveClient(previousOwner)
+
+	successor.setType(ORIGIN_TYPE_OWNER)
+	lobby.ownerID.Store(successor.ID)
+	log.Printf("[lobby] Ownership of lobby %d migrated from %d to %d", lobby.ID, previousOwner.ID, successor.ID)
+
+	serialized, err := Serialize(OWNER_CHANGED_EVENT, OwnerChangedMessageDTO{
+		PlayerID:        successor.ID,
+		IGN:             successor.IGN,
+		PreviousOwnerID: previousOwner.ID,
+	})
+	if err != nil {
+		log.Printf("[lobby] Error serializing owner changed event: %v", err)
+	} else {
+		lobby.BroadcastMessage(SERVER_ID, serialized)
+	}
+
+	// The owner drives the minigame sequence, so any sequence in progress can't complete.
+	// Resetting through the post process queue avoids racing the tracking of the phase.
+	// Never waits for room in the queue, as the lobby is locked and the disconnect may come from the post processing itself
+	if phase := LobbyPhase(lobby.GetPhase()); phase != LOBBY_PHASE_ROAMING_COLONY && phase != LOBBY_PHASE_IN_MINIGAME {
+		select {
+		case lobby.PostProcessQueue <- NewMessageEntry(successor, EMPTY_BYTE_ARR, MINIGAME_INITIATION_EVENTS[GENERIC_MINIGAME_SEQUENCE_RESET.ID]):
+		default:
+			log.Printf("[lobby] Post process queue of lobby %d is full, dropping reset of the sequence in phase %s", lobby.ID, phase)
+		}
+	}
+	return true
+}
+
+// Prefers clients that are connected over suspended ones. Ties are broken by lowest ID.
+//
+// Returns nil if there are no guests
+func (lobby *Lobby) longestConnectedGuest(excluding ClientID) *Client {
+	var best *Client
+	isBetter := func(candidate *Client) bool {
+		if best == nil {
+			return true
+		}
+		if candidate.IsSuspended() != best.IsSuspended() {
+			return !candidate.IsSuspended()
+		}
+		if !candidate.JoinedAt.Equal(best.JoinedAt) {
+			return candidate.JoinedAt.Before(best.JoinedAt)
+		}
+		return candidate.ID < best.ID
+	}
+	lobby.Clients.Range(func(id ClientID, client *Client) bool {
+		if id != excluding && client.Type() == ORIGIN_TYPE_GUEST && isBetter(client) {
+			best = client
+		}
+		return true
+	})
+	return best
+}
+
+// Applies the slow consumer policy to any slow consumers among the clients given
+//
+// Returns the clients given
+func (lobby *Lobby) handleUnresponsiveClients(clients []*Client) []*Client {
+	if lobby.configuration.SlowConsumerPolicy != meta.SLOW_CONSUMER_POLICY_DISCONNECT {
+		return clients
+	}
+	for _, client := range clients {
+		// Only the first overflow triggers the eviction
+		if client.IsSlowConsumer() && client.evictionScheduled.CompareAndSwap(false, true) {
+			log.Printf("[lobby] Client %d in lobby %d is a slow consumer, disconnecting", client.ID, lobby.ID)
+			// Not inline, as removing the client broadcasts in turn
+			go lobby.handleDisconnect(client)
+		}
+	}
+	return clients
+}
+
+// Removes the client from the lobby as it disconnects (or is made to).
+//
+// Depends on the type of the client at the time of calling, as the type changes if the client is promoted to owner
+func (lobby *Lobby) handleDisconnect(client *Client) {
+	if client.Type() == ORIGIN_TYPE_OWNER {
+		lobby.handleOwnerDisconnect(client)
+	} else {
+		lobby.handleGuestDisconnect(client)
+	}
+}
+
 // Remove a client from the lobby and notify all other clients
 //
 // Also closes the clients web socket connection
 func (lobby *Lobby) RemoveClient(client *Client) {
-	client, exists := lobby.Clients.Load(client.ID)
+	client, exists := lobby.Clients.LoadAndDelete(client.ID)
 	if !exists {
 		log.Printf("[lobby] User %v not found in lobby %d", client, lobby.ID)
 		return
 	}
 
-	lobby.Clients.Delete(client.ID)
-	client.Conn.Close()
+	client.Close()
 
 	lobby.activityTracker.RemoveParticipant(client)
 
@@ -423,15 +648,34 @@ func (lobby *Lobby) RemoveClient(client *Client) {
 
 // Notify all clients in the lobby that the lobby is closing
 //
-// Adds lobby to lobby manager closing channel
+// Only the first time, the lobby is added to the lobby manager closing channel and the colony is closed with the main backend in the background.
+// Closing again must not touch the channel, as the lobby manager closes it on shutdown while colonies may still be closing
 func (lobby *Lobby) close() {
-	lobby.Closing.Store(true)
+	first := !lobby.Closing.Swap(true)
+	if first {
+		lobby.cancel()
+		go lobby.closeColony()
+	}
 	lobby.BroadcastMessage(SERVER_ID, LOBBY_CLOSING_EVENT.CopyIDBytes())
-	err := integrations.GetMainBackendIntegration().CloseColony(lobby.ColonyID, lobby.OwnerID)
+	if first {
+		lobby.CloseQueue <- lobby
+	}
+}
+
+// Not bound to the context of the lobby, as that is cancelled by closing it
+func (lobby *Lobby) closeColony() {
+	defer close(lobby.colonyClosed)
+	ctx, cancel := context.WithTimeout(context.Background(), lobby.configuration.MainBackendCallTimeout)
+	defer cancel()
+	err := lobby.mainBackend.CloseColony(ctx, lobby.ColonyID, lobby.ColonyOwnerID)
 	if err != nil {
 		log.Printf("[lobby] Error closing colony %d: %v", lobby.ColonyID, err)
 	}
-	lobby.CloseQueue <- lobby
+}
+
+// For calls to the main backend made on behalf of the lobby. Ends after MainBackendCallTimeout, or once the lobby closes
+func (lobby *Lobby) mainBackendContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(lobby.ctx, lobby.configuration.MainBackendCallTimeout)
 }
 
 // Only called indirectly by the lobby manager while it is processing the close queue
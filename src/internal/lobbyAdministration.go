@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gorilla/websocket"
+)
+
+// Operational levers used by the admin API
+
+var (
+	ErrLobbyNotFound  = errors.New("lobby not found")
+	ErrClientNotFound = errors.New("client not found")
+	ErrShuttingDown   = errors.New("shutting down")
+)
+
+// Custom close code telling the client it was kicked by an administrator (4000-4999 are reserved for applications)
+const CLOSE_CODE_KICKED = 4001
+
+func (lm *LobbyManager) AcceptsNewLobbies() bool {
+	return lm.acceptsNewLobbies.Load()
+}
+
+// Refuses to accept new lobbies again once shutting down has begun
+func (lm *LobbyManager) SetAcceptsNewLobbies(accepts bool) error {
+	lm.acceptsLock.Lock()
+	defer lm.acceptsLock.Unlock()
+	if accepts && lm.shuttingDown {
+		return ErrShuttingDown
+	}
+	lm.acceptsNewLobbies.Store(accepts)
+	log.Printf("[lob man] Accepts new lobbies set to %v", accepts)
+	return nil
+}
+
+// Closes the lobby as if the owner had disconnected. The reason is announced to all clients first
+func (lm *LobbyManager) ForceCloseLobby(lobbyID LobbyID, reason string) error {
+	lobby, exists := lm.Lobbies.Load(lobbyID)
+	if !exists {
+		return ErrLobbyNotFound
+	}
+	if lobby.Closing.Load() {
+		return fmt.Errorf("lobby %d is already closing", lobbyID)
+	}
+	if err := lobby.Announce("Lobby closed by an administrator: " + reason); err != nil {
+		return err
+	}
+	lobby.close()
+	return nil
+}
+
+// Removes the client from the lobby. The reason is given in the close frame sent to the client.
+// Kicking the owner is handled as the owner leaving: Under OWNER_LEAVE_POLICY_MIGRATE the longest connected guest
+// becomes owner, while under OWNER_LEAVE_POLICY_CLOSE (or without guests) the lobby closes
+func (lm *LobbyManager) KickClient(lobbyID LobbyID, clientID ClientID, reason string) error {
+	lobby, exists := lm.Lobbies.Load(lobbyID)
+	if !exists {
+		return ErrLobbyNotFound
+	}
+	client, exists := lobby.Clients.Load(clientID)
+	if !exists {
+		return ErrClientNotFound
+	}
+	client.CloseWithReason(CLOSE_CODE_KICKED, reason)
+	lobby.handleDisconnect(client)
+	return nil
+}
+
+// Announces the message to all clients in all lobbies. Returns the number of lobbies reached
+func (lm *LobbyManager) AnnounceToAll(message string) (int, error) {
+	var reached int
+	var err error
+	lm.Lobbies.Range(func(key LobbyID, lobby *Lobby) bool {
+		if err = lobby.Announce(message); err != nil {
+			return false
+		}
+		reached++
+		return true
+	})
+	return reached, err
+}
+
+func (lm *LobbyManager) AnnounceToLobby(lobbyID LobbyID, message string) error {
+	lobby, exists := lm.Lobbies.Load(lobbyID)
+	if !exists {
+		return ErrLobbyNotFound
+	}
+	return lobby.Announce(message)
+}
+
+// Releases the activity lock of a lobby stuck in some phase, returning it to roaming the colony
+func (lm *LobbyManager) ForceReleaseActivityLock(lobbyID LobbyID) error {
+	lobby, exists := lm.Lobbies.Load(lobbyID)
+	if !exists {
+		return ErrLobbyNotFound
+	}
+	lobby.phases.Reset("released by admin")
+	lobby.BroadcastMessage(SERVER_ID, GENERIC_MINIGAME_SEQUENCE_RESET.CopyIDBytes())
+	return nil
+}
+
+// Broadcasts a ServerAnnouncement to all clients in the lobby
+func (lobby *Lobby) Announce(message string) error {
+	serialized, err := Serialize(SERVER_ANNOUNCEMENT_EVENT, ServerAnnouncementMessageDTO{Message: message})
+	if err != nil {
+		return fmt.Errorf("error serializing announcement: %s", err.Error())
+	}
+	lobby.BroadcastMessage(SERVER_ID, serialized)
+	return nil
+}
+
+// Control frames may carry at most 125 bytes, 2 of which are the close code
+const MAX_CLOSE_REASON_LENGTH = 123
+
+// Like Close, but with the code and reason given in the close frame. Overly long reasons are truncated
+func (c *Client) CloseWithReason(code int, reason string) error {
+	if len(reason) > MAX_CLOSE_REASON_LENGTH {
+		reason = reason[:MAX_CLOSE_REASON_LENGTH]
+	}
+	return c.closeWith(websocket.FormatCloseMessage(code, reason))
+}
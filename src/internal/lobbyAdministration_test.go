@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+func TestSetAcceptsNewLobbiesAfterShutdown(t *testing.T) {
+	lm := CreateLobbyManager(testConfiguration, testMainBackend)
+	if err := lm.SetAcceptsNewLobbies(false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := lm.SetAcceptsNewLobbies(true); err != nil || !lm.AcceptsNewLobbies() {
+		t.Fatalf("Expected to accept new lobbies again, got %v", err)
+	}
+
+	lm.ShutdownLobbyManager()
+
+	if err := lm.SetAcceptsNewLobbies(true); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected ErrShuttingDown, got %v", err)
+	}
+	if lm.AcceptsNewLobbies() {
+		t.Error("Expected new lobbies to stay refused once shutting down")
+	}
+	if err := lm.SetAcceptsNewLobbies(false); err != nil {
+		t.Errorf("Expected refusing new lobbies to still be allowed, got %v", err)
+	}
+}
+
+func TestKickOwner(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      meta.OwnerLeavePolicy
+		wantClosing bool
+	}{
+		{"migrate", meta.OWNER_LEAVE_POLICY_MIGRATE, false},
+		{"close", meta.OWNER_LEAVE_POLICY_CLOSE, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lm := CreateLobbyManager(testConfiguration, testMainBackend)
+			lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, tt.policy, lm.CloseQueue, testConfiguration, testMainBackend)
+			lm.Lobbies.Store(lobby.ID, lobby)
+			addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+			guest, guestSide := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, time.Now())
+
+			if err := lm.KickClient(lobby.ID, 10, "test"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if lobby.Closing.Load() != tt.wantClosing {
+				t.Errorf("Expected closing: %t, got %t", tt.wantClosing, lobby.Closing.Load())
+			}
+			if tt.wantClosing {
+				return
+			}
+			if lobby.GetOwnerID() != guest.ID || guest.Type() != ORIGIN_TYPE_OWNER {
+				t.Errorf("Expected the guest to be promoted, owner is %d", lobby.GetOwnerID())
+			}
+			awaitEvent(t, guestSide, OWNER_CHANGED_EVENT.ID)
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
@@ -16,17 +20,22 @@ type LobbyManager struct {
 	Lobbies           util.ConcurrentTypedMap[LobbyID, *Lobby]
 	nextLobbyID       atomic.Uint32
 	acceptsNewLobbies atomic.Bool
-	CloseQueue        chan *Lobby // Queue of lobbies that need to be closed
-	configuration     *meta.RuntimeConfiguration
+	// Held while changing acceptsNewLobbies, such that it can't be turned back on once shutting down has begun
+	acceptsLock   sync.Mutex
+	shuttingDown  bool
+	CloseQueue    chan *Lobby // Queue of lobbies that need to be closed
+	configuration *meta.RuntimeConfiguration
+	mainBackend   integrations.MainBackend
 }
 
-func CreateLobbyManager(runtimeConfiguration *meta.RuntimeConfiguration) *LobbyManager {
+func CreateLobbyManager(runtimeConfiguration *meta.RuntimeConfiguration, mainBackend integrations.MainBackend) *LobbyManager {
 	lm := &LobbyManager{
 		Lobbies:           util.ConcurrentTypedMap[LobbyID, *Lobby]{},
 		acceptsNewLobbies: atomic.Bool{},
 		nextLobbyID:       atomic.Uint32{},
 		CloseQueue:        make(chan *Lobby, 10), // A queue to handle closing lobbies
 		configuration:     runtimeConfiguration,
+		mainBackend:       mainBackend,
 	}
 	lm.nextLobbyID.Store(1)
 	lm.acceptsNewLobbies.Store(true)
@@ -35,6 +44,10 @@ func CreateLobbyManager(runtimeConfiguration *meta.RuntimeConfiguration) *LobbyM
 	return lm
 }
 
+func (lm *LobbyManager) MainBackend() integrations.MainBackend {
+	return lm.mainBackend
+}
+
 func (lm *LobbyManager) GetLobbyCount() int {
 	var count = 0
 	lm.Lobbies.Range(func(key LobbyID, value *Lobby) bool {
@@ -54,19 +67,42 @@ func (lm *LobbyManager) processClosures() {
 }
 
 func (lm *LobbyManager) ShutdownLobbyManager() {
+	lm.acceptsLock.Lock()
+	lm.shuttingDown = true
 	lm.acceptsNewLobbies.Store(false)
+	lm.acceptsLock.Unlock()
 
 	log.Printf("[lob man] Shutting down %d lobbies", lm.GetLobbyCount())
 
 	// Close all lobbies
+	var closing []*Lobby
 	lm.Lobbies.Range(func(key LobbyID, value *Lobby) bool {
 		value.BroadcastMessage(SERVER_ID, SERVER_CLOSING_EVENT.CopyIDBytes())
 		value.close()
+		closing = append(closing, value)
 		return true
 	})
 
 	//Dunno if this should be done like this
 	close(lm.CloseQueue)
+
+	lm.awaitColonyClosures(closing, LOBBY_MANAGER_SHUTDOWN_COLONY_CLOSE_TIMEOUT)
+}
+
+// Max time shutting down waits for the main backend to close the colonies of the lobbies
+const LOBBY_MANAGER_SHUTDOWN_COLONY_CLOSE_TIMEOUT = 15 * time.Second
+
+// Colonies are closed in the background, so they'd be left open if the process exited right away
+func (lm *LobbyManager) awaitColonyClosures(lobbies []*Lobby, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for i, lobby := range lobbies {
+		select {
+		case <-lobby.colonyClosed:
+		case <-deadline:
+			log.Printf("[lob man] Gave up waiting for %d colonies to close after %s", len(lobbies)-i, timeout)
+			return
+		}
+	}
 }
 
 // Unregister a lobby and clean it up
@@ -80,7 +116,9 @@ func (lm *LobbyManager) UnregisterLobby(lobby *Lobby) {
 }
 
 // Create a new lobby and assign an owner
-func (lm *LobbyManager) CreateLobby(ownerID ClientID, colonyID uint32, userSetEncoding meta.MessageEncoding) (*Lobby, error) {
+//
+// An empty ownerLeavePolicy falls back to the configured default
+func (lm *LobbyManager) CreateLobby(ownerID ClientID, colonyID uint32, userSetEncoding meta.MessageEncoding, ownerLeavePolicy meta.OwnerLeavePolicy) (*Lobby, error) {
 	if !lm.acceptsNewLobbies.Load() {
 		return nil, fmt.Errorf("[lob man] Lobby manager is not accepting new lobbies at this point")
 	}
@@ -106,10 +144,14 @@ func (lm *LobbyManager) CreateLobby(ownerID ClientID, colonyID uint32, userSetEn
 		encodingToUse = lm.configuration.Encoding
 	}
 
-	lobby := NewLobby(lobbyID, ownerID, colonyID, encodingToUse, lm.CloseQueue)
+	if ownerLeavePolicy == "" {
+		ownerLeavePolicy = lm.configuration.OwnerLeavePolicy
+	}
+
+	lobby := NewLobby(lobbyID, ownerID, colonyID, encodingToUse, ownerLeavePolicy, lm.CloseQueue, lm.configuration, lm.mainBackend)
 	lm.Lobbies.Store(lobbyID, lobby)
 
-	log.Println("[lob man] Lobby created, id:", lobbyID, " chosen broadcasting encoding: ", encodingToUse)
+	log.Println("[lob man] Lobby created, id:", lobbyID, " chosen broadcasting encoding: ", encodingToUse, " owner leave policy: ", ownerLeavePolicy)
 	return lobby, nil
 }
 
@@ -119,7 +161,11 @@ func (lm *LobbyManager) IsJoinPossible(lobbyID LobbyID, clientID ClientID, colon
 		//In the case we have a de-sync issue, attempt to close the colony
 		//it will error if the colony is already closed, or doesn't exist, but in this specific case
 		//we don't mind
-		go integrations.GetMainBackendIntegration().CloseColony(colonyID, colonyOwnerID)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), lm.configuration.MainBackendCallTimeout)
+			defer cancel()
+			lm.mainBackend.CloseColony(ctx, colonyID, colonyOwnerID)
+		}()
 		return &LobbyJoinError{Reason: "Lobby does not exist", Type: JoinErrorNotFound, LobbyID: lobbyID}
 	}
 
@@ -130,6 +176,10 @@ func (lm *LobbyManager) IsJoinPossible(lobbyID LobbyID, clientID ClientID, colon
 		return &LobbyJoinError{Reason: "Lobby is closing", Type: JoinErrorClosing, LobbyID: lobbyID}
 	}
 
+	if lobby.ColonyID != colonyID {
+		return &LobbyJoinError{Reason: "Join token was issued for another colony", Type: JoinErrorColonyMismatch, LobbyID: lobbyID}
+	}
+
 	if _, exists := lobby.Clients.Load(clientID); exists {
 		//IMPOSTER!
 		return &LobbyJoinError{Reason: "User is already in lobby", Type: JoinErrorAlreadyInLobby, LobbyID: lobbyID}
@@ -138,7 +188,10 @@ func (lm *LobbyManager) IsJoinPossible(lobbyID LobbyID, clientID ClientID, colon
 }
 
 // JoinLobby allows a user to join a specific lobby
-func (lm *LobbyManager) JoinLobby(lobbyID LobbyID, clientID ClientID, clientIGN string, conn *websocket.Conn) *LobbyJoinError {
+//
+// An empty encoding falls back to the encoding of the lobby
+// The handshake is expected to have passed CheckProtocol. If incompatible, the client is told so before anything else
+func (lm *LobbyManager) JoinLobby(lobbyID LobbyID, clientID ClientID, clientIGN string, encoding meta.MessageEncoding, handshake ProtocolHandshake, conn *websocket.Conn) *LobbyJoinError {
 	lobby, exists := lm.Lobbies.Load(lobbyID)
 	if !exists {
 		return &LobbyJoinError{Reason: "Lobby does not exist", Type: JoinErrorNotFound, LobbyID: lobbyID}
@@ -153,25 +206,92 @@ func (lm *LobbyManager) JoinLobby(lobbyID LobbyID, clientID ClientID, clientIGN
 		return &LobbyJoinError{Reason: "User is already in lobby", Type: JoinErrorAlreadyInLobby, LobbyID: lobbyID}
 	}
 
-	client := NewClient(clientID, clientIGN,
-		util.Ternary(lobby.OwnerID == clientID, ORIGIN_TYPE_OWNER, ORIGIN_TYPE_GUEST),
-		conn, lobby.Encoding,
-	)
+	if encoding == "" {
+		encoding = lobby.Encoding
+	}
 
+	// Serialized before creating the client, as that starts its writer
 	msg, err := Serialize(PLAYER_JOINED_EVENT, PlayerJoinedMessageDTO{
-		PlayerID: client.ID,
-		IGN:      client.IGN,
+		PlayerID: clientID,
+		IGN:      clientIGN,
 	})
 	if err != nil {
 		return &LobbyJoinError{Reason: "Failed to serialize player joined message", Type: JoinErrorSerializationFailure, LobbyID: lobbyID}
 	}
 
+	client := NewClient(clientID, clientIGN,
+		util.Ternary(lobby.GetOwnerID() == clientID, ORIGIN_TYPE_OWNER, ORIGIN_TYPE_GUEST),
+		conn, encoding, lm.configuration,
+	)
+
+	// Queued before the client is added to the lobby, such that no broadcast can get ahead of it
+	if !handshake.IsCompatible() {
+		if err := sendProtocolMismatch(client, handshake); err != nil {
+			log.Printf("[lob man] Error sending protocol mismatch to client %d: %v", client.ID, err)
+		}
+	}
+
 	//Broadcasting before we add the client to the lobbies client map
 	lobby.BroadcastMessage(SERVER_ID, msg)
 
 	lobby.Clients.Store(client.ID, client)
+
+	tokenMsg, err := Serialize(SESSION_RESUME_TOKEN_EVENT, SessionResumeTokenMessageDTO{Token: client.ResumeToken})
+	if err != nil {
+		log.Printf("[lob man] Error serializing session resume token for client %d: %v", client.ID, err)
+	} else if err := SendMessageToClient(client, SERVER_ID, tokenMsg); err != nil {
+		log.Printf("[lob man] Error sending session resume token to client %d: %v", client.ID, err)
+	}
+
+	if err := lobby.SendStateSnapshot(client); err != nil {
+		log.Printf("[lob man] Error sending lobby state snapshot to client %d: %v", client.ID, err)
+	}
+
 	// Handle the user's connection
-	go lobby.handleConnection(client)
+	go lobby.handleConnection(client, conn)
+
+	return nil
+}
+
+func (lm *LobbyManager) IsResumePossible(lobbyID LobbyID, clientID ClientID, resumeToken string) *LobbyJoinError {
+	_, joinErr := lm.findResumableClient(lobbyID, clientID, resumeToken)
+	return joinErr
+}
+
+// Reattaches the new connection to the existing client of an ongoing session,
+// replays any events buffered while it was away, and continues handling the client on the new connection.
+func (lm *LobbyManager) ResumeSession(lobbyID LobbyID, clientID ClientID, resumeToken string, conn *websocket.Conn) *LobbyJoinError {
+	client, joinErr := lm.findResumableClient(lobbyID, clientID, resumeToken)
+	if joinErr != nil {
+		return joinErr
+	}
+	lobby, _ := lm.Lobbies.Load(lobbyID)
+
+	replayed, err := client.resume(conn)
+	if err != nil {
+		// The connection is the clients by now, yet missed some of what was buffered, so the session can't go on
+		if !errors.Is(err, ErrSessionEnded) {
+			lobby.handleDisconnect(client)
+		}
+		return &LobbyJoinError{Reason: "Unable to resume session: " + err.Error(), Type: JoinErrorSessionNotResumable, LobbyID: lobbyID}
+	}
+	log.Printf("[lob man] Client %d resumed session in lobby %d, replayed %d messages", clientID, lobbyID, replayed)
 
+	go lobby.handleConnection(client, conn)
 	return nil
 }
+
+func (lm *LobbyManager) findResumableClient(lobbyID LobbyID, clientID ClientID, resumeToken string) (*Client, *LobbyJoinError) {
+	lobby, exists := lm.Lobbies.Load(lobbyID)
+	if !exists {
+		return nil, &LobbyJoinError{Reason: "Lobby does not exist", Type: JoinErrorNotFound, LobbyID: lobbyID}
+	}
+	if lobby.Closing.Load() {
+		return nil, &LobbyJoinError{Reason: "Lobby is closing", Type: JoinErrorClosing, LobbyID: lobbyID}
+	}
+	client, exists := lobby.Clients.Load(clientID)
+	if !exists || !client.ResumeTokenMatches(resumeToken) {
+		return nil, &LobbyJoinError{Reason: "No resumable session found", Type: JoinErrorSessionNotResumable, LobbyID: lobbyID}
+	}
+	return client, nil
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+// Max time the lobby waits for players in the given phase. 0 if it waits forever
+func (l *Lobby) phaseTimeout(phase LobbyPhase) time.Duration {
+	switch phase {
+	case LOBBY_PHASE_AWAITING_PARTICIPANTS:
+		return l.configuration.AwaitingParticipantsTimeout
+	case LOBBY_PHASE_PLAYERS_DECLARE_INTENT:
+		return l.configuration.PlayersDeclareIntentTimeout
+	case LOBBY_PHASE_LOADING_MINIGAME:
+		return l.configuration.LoadingMinigameTimeout
+	default:
+		return 0
+	}
+}
+
+// Enter hook of the waiting phases. Starts the countdown of the phase and lets clients know how long they have.
+//
+// Once passed, the deadline is handled by the post process routine, like any other message
+func (l *Lobby) armPhaseDeadline(transition PhaseTransition) error {
+	timeout := l.phaseTimeout(transition.To)
+	if timeout <= 0 {
+		l.activityTracker.SetDeadline(time.Time{})
+		return nil
+	}
+	l.activityTracker.SetDeadline(time.Now().Add(timeout))
+
+	serialized, err := Serialize(PHASE_DEADLINE_EVENT, PhaseDeadlineMessageDTO{
+		Phase:       uint32(transition.To),
+		RemainingMS: uint32(timeout.Milliseconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("error serializing phase deadline event: %s", err.Error())
+	}
+	l.BroadcastMessage(SERVER_ID, serialized)
+
+	phase := binary.BigEndian.AppendUint32(nil, uint32(transition.To))
+	time.AfterFunc(timeout, func() {
+		select {
+		case l.PostProcessQueue <- NewMessageEntry(nil, phase, MINIGAME_INITIATION_EVENTS[PHASE_DEADLINE_EVENT.ID]):
+		default:
+			log.Printf("[lobby] Post process queue of lobby %d is full, dropping deadline of phase %s", l.ID, transition.To)
+		}
+	})
+	return nil
+}
+
+// Stops waiting for the players that haven't responded in time and moves on, if the lobby is still in the phase the deadline was set for.
+// Deadlines of earlier phases may still fire, and are ignored
+func (l *Lobby) onPhaseDeadline(phase LobbyPhase) {
+	if l.phases.Current() != phase || !l.activityTracker.IsPastDeadline(time.Now()) {
+		return
+	}
+
+	switch phase {
+	case LOBBY_PHASE_AWAITING_PARTICIPANTS:
+		optedOut := l.activityTracker.OptOutNonResponders(l.clientList())
+		log.Printf("[lobby] Deadline passed in lobby %d, %d player(s) that did not respond have been opted out", l.ID, len(optedOut))
+		if l.activityTracker.ParticipantCount() == 0 {
+			l.resetSequence("no participants")
+			return
+		}
+		l.advancePhase(LOBBY_PHASE_AWAITING_PARTICIPANTS, LOBBY_PHASE_PLAYERS_DECLARE_INTENT, "deadline passed")
+	case LOBBY_PHASE_PLAYERS_DECLARE_INTENT:
+		if l.handleLaggards(l.activityTracker.ReadyLaggards(), "did not declare ready in time") {
+			l.advancePhase(LOBBY_PHASE_PLAYERS_DECLARE_INTENT, LOBBY_PHASE_LOADING_MINIGAME, "deadline passed")
+		}
+	case LOBBY_PHASE_LOADING_MINIGAME:
+		if l.handleLaggards(l.activityTracker.LoadLaggards(), "did not finish loading in time") {
+			l.enterMinigame("deadline passed")
+		}
+	}
+}
+
+// Applies the laggard policy of the lobby.
+//
+// Returns false if the minigame sequence has been abandoned
+func (l *Lobby) handleLaggards(laggards []ClientID, reason string) bool {
+	if len(laggards) == 0 {
+		return true
+	}
+	log.Printf("[lobby] Deadline passed in lobby %d, %d player(s) %s", l.ID, len(laggards), reason)
+
+	switch l.configuration.LaggardPolicy {
+	case meta.LAGGARD_POLICY_ABORT:
+		if err := OnUntimelyMinigameAbort(fmt.Sprintf("%d player(s) %s", len(laggards), reason), SERVER_ID, l, nil); err != nil {
+			log.Printf("[lobby] Error sending untimely abort message: %v", err)
+		}
+		if _, err := l.phases.Transition(LOBBY_PHASE_ROAMING_COLONY, "laggards"); err != nil {
+			log.Printf("[lobby] Error resetting minigame sequence in lobby %d: %v", l.ID, err)
+		}
+		return false
+	default:
+		for _, id := range laggards {
+			l.activityTracker.DropParticipant(id)
+			if client, exists := l.Clients.Load(id); exists {
+				SendDebugInfoToClient(client, 408, "Dropped from minigame: "+reason)
+			}
+		}
+		if l.activityTracker.ParticipantCount() == 0 {
+			l.resetSequence("all participants dropped")
+			return false
+		}
+		return true
+	}
+}
+
+func (lobby *Lobby) clientList() []*Client {
+	var clients []*Client
+	lobby.Clients.Range(func(_ ClientID, client *Client) bool {
+		clients = append(clients, client)
+		return true
+	})
+	return clients
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+// Copy of the test configuration with the timeouts given, and no deadline for loading
+func deadlineConfiguration(awaiting time.Duration, declareIntent time.Duration, policy meta.LaggardPolicy) *meta.RuntimeConfiguration {
+	configuration := *testConfiguration
+	configuration.AwaitingParticipantsTimeout = awaiting
+	configuration.PlayersDeclareIntentTimeout = declareIntent
+	configuration.LoadingMinigameTimeout = 0
+	configuration.LaggardPolicy = policy
+	return &configuration
+}
+
+func TestPhaseDeadlineOptsOutNonResponders(t *testing.T) {
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1),
+		deadlineConfiguration(50*time.Millisecond, 0, meta.LAGGARD_POLICY_DROP), testMainBackend)
+	owner, _ := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+	_, guestSide := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, time.Now())
+
+	lobby.activityTracker.SetDiffConfirmed(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: 1, DifficultyID: 1})
+	lobby.activityTracker.LockIn(2)
+	lobby.activityTracker.AddParticipant(owner)
+	if _, err := lobby.phases.Transition(LOBBY_PHASE_AWAITING_PARTICIPANTS, "test"); err != nil {
+		t.Fatalf("Expected transition to awaiting participants, got %v", err)
+	}
+
+	deadline, err := Deserialize(PHASE_DEADLINE_EVENT, awaitEvent(t, guestSide, PHASE_DEADLINE_EVENT.ID), true)
+	if err != nil {
+		t.Fatalf("Expected phase deadline event, got %v", err)
+	}
+	if LobbyPhase(deadline.Phase) != LOBBY_PHASE_AWAITING_PARTICIPANTS || deadline.RemainingMS != 50 {
+		t.Errorf("Expected 50ms left of AwaitingParticipants, got %dms left of %s", deadline.RemainingMS, LobbyPhase(deadline.Phase))
+	}
+
+	awaitEvent(t, guestSide, PLAYERS_DECLARE_INTENT_EVENT.ID)
+	if _, optedOut := lobby.activityTracker.participantTracker.OptOut.Load(20); !optedOut {
+		t.Error("Expected guest that didn't respond to be opted out")
+	}
+	if count := lobby.activityTracker.ParticipantCount(); count != 1 {
+		t.Errorf("Expected 1 participant, got %d", count)
+	}
+}
+
+func TestPhaseDeadlineLaggardPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    meta.LaggardPolicy
+		wantEvent MessageID
+		wantPhase LobbyPhase
+	}{
+		{"drop continues without laggards", meta.LAGGARD_POLICY_DROP, LOAD_MINIGAME_EVENT.ID, LOBBY_PHASE_LOADING_MINIGAME},
+		{"abort resets sequence", meta.LAGGARD_POLICY_ABORT, GENERIC_MINIGAME_UNTIMELY_ABORT.ID, LOBBY_PHASE_ROAMING_COLONY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1),
+				deadlineConfiguration(0, 50*time.Millisecond, tt.policy), testMainBackend)
+			owner, ownerSide := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+			guest, _ := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, time.Now())
+
+			lobby.activityTracker.SetDiffConfirmed(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: 1, DifficultyID: 1})
+			lobby.activityTracker.LockIn(2)
+			lobby.activityTracker.AddParticipant(owner)
+			lobby.activityTracker.AddParticipant(guest)
+			for _, phase := range []LobbyPhase{LOBBY_PHASE_AWAITING_PARTICIPANTS, LOBBY_PHASE_PLAYERS_DECLARE_INTENT} {
+				if ok, err := lobby.phases.Transition(phase, "test"); !ok || err != nil {
+					t.Fatalf("Expected transition to %s, got %v, %v", phase, ok, err)
+				}
+			}
+			lobby.activityTracker.MarkPlayerAsReady(owner)
+
+			awaitEvent(t, ownerSide, tt.wantEvent)
+			if phase := lobby.phases.Current(); phase != tt.wantPhase {
+				t.Errorf("Expected phase %s, got %s", tt.wantPhase, phase)
+			}
+		})
+	}
+}
+
+func TestActivityTrackerDropParticipant(t *testing.T) {
+	tracker := NewActivityTracker()
+	tracker.SetDiffConfirmed(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: 1, DifficultyID: 1})
+	tracker.LockIn(2)
+	ready := &Client{ID: 1}
+	laggard := &Client{ID: 2}
+	tracker.AddParticipant(ready)
+	tracker.AddParticipant(laggard)
+	tracker.BeginReadyTracking()
+	tracker.MarkPlayerAsReady(ready)
+
+	if tracker.AllPlayersAreReady() {
+		t.Fatal("Expected not all players to be ready")
+	}
+	laggards := tracker.ReadyLaggards()
+	if len(laggards) != 1 || laggards[0] != laggard.ID {
+		t.Fatalf("Expected laggards [%d], got %v", laggard.ID, laggards)
+	}
+
+	tracker.DropParticipant(laggard.ID)
+	if !tracker.AllPlayersAreReady() {
+		t.Error("Expected remaining players to be ready once the laggard is dropped")
+	}
+	if count := tracker.ParticipantCount(); count != 1 {
+		t.Errorf("Expected 1 participant, got %d", count)
+	}
+}
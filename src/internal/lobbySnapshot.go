@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Sends the current state of the lobby to a single client: One LobbyStateSnapshot followed by one LobbyStateSnapshotPlayer per player.
+//
+// The snapshot is not atomic. Anything changing while it is taken reaches the client as a regular event afterwards
+func (lobby *Lobby) SendStateSnapshot(client *Client) error {
+	players := lobby.clientList()
+	// Stable order, such that the roster reads the same for every client
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].ID < players[j].ID
+	})
+
+	snapshot := LobbyStateSnapshotMessageDTO{
+		LobbyID:     lobby.ID,
+		OwnerID:     lobby.GetOwnerID(),
+		ColonyID:    lobby.ColonyID,
+		Phase:       lobby.GetPhase(),
+		PlayerCount: uint32(len(players)),
+	}
+	if lobby.activityTracker.IsLockedIn() {
+		lobby.activityTracker.diffConfirmed.Do(func(v **DifficultyConfirmedForMinigameMessageDTO) {
+			if v == nil || *v == nil {
+				return
+			}
+			snapshot.ColonyLocationID = (*v).ColonyLocationID
+			snapshot.MinigameID = (*v).MinigameID
+			snapshot.DifficultyID = (*v).DifficultyID
+			snapshot.DifficultyName = (*v).DifficultyName
+		})
+	}
+
+	serialized, err := Serialize(LOBBY_STATE_SNAPSHOT_EVENT, snapshot)
+	if err != nil {
+		return fmt.Errorf("error serializing lobby state snapshot: %s", err.Error())
+	}
+	if err := SendMessageToClient(client, SERVER_ID, serialized); err != nil {
+		return err
+	}
+
+	for _, player := range players {
+		serialized, err := Serialize(LOBBY_STATE_SNAPSHOT_PLAYER_EVENT, LobbyStateSnapshotPlayerMessageDTO{
+			PlayerID:          player.ID,
+			LastKnownPosition: player.State.LastKnownPosition.Load(),
+			IGN:               player.IGN,
+		})
+		if err != nil {
+			return fmt.Errorf("error serializing lobby state snapshot of player %d: %s", player.ID, err.Error())
+		}
+		if err := SendMessageToClient(client, SERVER_ID, serialized); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+func TestUpdateAnyTracksPlayerPosition(t *testing.T) {
+	serialized, err := Serialize(PLAYER_MOVE_EVENT, PlayerMoveMessageDTO{PlayerID: 20, ColonyLocationID: 7})
+	if err != nil {
+		t.Fatalf("Expected no error serializing, got %v", err)
+	}
+	state := NewDisclosedClientState()
+	// Serialize only prepends the message id, not the sender id
+	state.UpdateAny(PLAYER_MOVE_EVENT.ID, serialized[4:])
+
+	if position := state.LastKnownPosition.Load(); position != 7 {
+		t.Errorf("Expected last known position 7, got %d", position)
+	}
+}
+
+func TestSendStateSnapshot(t *testing.T) {
+	lobby := NewLobby(1, 10, 3, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+	guest, _ := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, time.Now())
+	owner, _ := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+	joiner, joinerSide := addTestClient(t, lobby, 30, ORIGIN_TYPE_GUEST, time.Now())
+	owner.State.LastKnownPosition.Store(5)
+	guest.State.LastKnownPosition.Store(6)
+
+	diff := &DifficultyConfirmedForMinigameMessageDTO{ColonyLocationID: 5, MinigameID: 1, DifficultyID: 2, DifficultyName: "Hard"}
+	lobby.activityTracker.SetDiffConfirmed(diff)
+	lobby.activityTracker.LockIn(3)
+	if _, err := lobby.phases.Transition(LOBBY_PHASE_AWAITING_PARTICIPANTS, "test"); err != nil {
+		t.Fatalf("Expected transition to awaiting participants, got %v", err)
+	}
+
+	if err := lobby.SendStateSnapshot(joiner); err != nil {
+		t.Fatalf("Expected no error sending snapshot, got %v", err)
+	}
+
+	snapshot, err := Deserialize(LOBBY_STATE_SNAPSHOT_EVENT, awaitEvent(t, joinerSide, LOBBY_STATE_SNAPSHOT_EVENT.ID), true)
+	if err != nil {
+		t.Fatalf("Expected lobby state snapshot, got %v", err)
+	}
+	want := LobbyStateSnapshotMessageDTO{
+		LobbyID:          1,
+		OwnerID:          10,
+		ColonyID:         3,
+		Phase:            uint32(LOBBY_PHASE_AWAITING_PARTICIPANTS),
+		PlayerCount:      3,
+		ColonyLocationID: 5,
+		MinigameID:       1,
+		DifficultyID:     2,
+		DifficultyName:   "Hard",
+	}
+	if *snapshot != want {
+		t.Errorf("Expected snapshot %+v, got %+v", want, *snapshot)
+	}
+
+	wantPlayers := []LobbyStateSnapshotPlayerMessageDTO{
+		{PlayerID: 10, LastKnownPosition: 5, IGN: "Player"},
+		{PlayerID: 20, LastKnownPosition: 6, IGN: "Player"},
+		{PlayerID: 30, LastKnownPosition: 0, IGN: "Player"},
+	}
+	for _, wantPlayer := range wantPlayers {
+		player, err := Deserialize(LOBBY_STATE_SNAPSHOT_PLAYER_EVENT, awaitEvent(t, joinerSide, LOBBY_STATE_SNAPSHOT_PLAYER_EVENT.ID), true)
+		if err != nil {
+			t.Fatalf("Expected lobby state snapshot player, got %v", err)
+		}
+		if *player != wantPlayer {
+			t.Errorf("Expected player %+v, got %+v", wantPlayer, *player)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+func (p LobbyPhase) String() string {
+	switch p {
+	case LOBBY_PHASE_ROAMING_COLONY:
+		return "RoamingColony"
+	case LOBBY_PHASE_AWAITING_PARTICIPANTS:
+		return "AwaitingParticipants"
+	case LOBBY_PHASE_PLAYERS_DECLARE_INTENT:
+		return "PlayersDeclareIntent"
+	case LOBBY_PHASE_LOADING_MINIGAME:
+		return "LoadingMinigame"
+	case LOBBY_PHASE_IN_MINIGAME:
+		return "InMinigame"
+	default:
+		return "Unknown"
+	}
+}
+
+var ErrTransitionNotAllowed = errors.New("phase transition not allowed")
+
+// A completed (or failed) change of phase, as reported to observers
+type PhaseTransition struct {
+	From   LobbyPhase
+	To     LobbyPhase
+	Reason string
+	// Set if a hook failed, in which case the machine has been reset to LOBBY_PHASE_ROAMING_COLONY
+	Err error
+}
+
+// Checked before a transition. Returning false cancels the transition, without it being concidered an error
+type PhaseGuard func() bool
+
+// Runs on entering or exiting a phase. Any error resets the machine to LOBBY_PHASE_ROAMING_COLONY
+type PhaseHook func(transition PhaseTransition) error
+
+type phaseHooks struct {
+	onEnter PhaseHook
+	onExit  PhaseHook
+}
+
+// Tracks the phase of a lobby and allows only the declared transitions.
+//
+// Transitions are serialized, so hooks may safely broadcast and update the activity tracker.
+// Hooks must not themselves transition the machine.
+type LobbyStateMachine struct {
+	lock  sync.Mutex
+	phase atomic.Uint32
+	// From -> To -> Guard. A transition without a guard is declared with a nil guard
+	transitions map[LobbyPhase]map[LobbyPhase]PhaseGuard
+	hooks       map[LobbyPhase]*phaseHooks
+	observers   []func(PhaseTransition)
+	// Invoked after the machine has been reset due to a failing hook
+	onHookError func(transition PhaseTransition)
+}
+
+func NewLobbyStateMachine() *LobbyStateMachine {
+	machine := &LobbyStateMachine{
+		transitions: make(map[LobbyPhase]map[LobbyPhase]PhaseGuard),
+		hooks:       make(map[LobbyPhase]*phaseHooks),
+	}
+	machine.phase.Store(uint32(LOBBY_PHASE_ROAMING_COLONY))
+	return machine
+}
+
+func (m *LobbyStateMachine) Current() LobbyPhase {
+	return LobbyPhase(m.phase.Load())
+}
+
+// Declares an allowed transition. The guard may be nil
+func (m *LobbyStateMachine) Allow(from LobbyPhase, to LobbyPhase, guard PhaseGuard) *LobbyStateMachine {
+	if m.transitions[from] == nil {
+		m.transitions[from] = make(map[LobbyPhase]PhaseGuard)
+	}
+	m.transitions[from][to] = guard
+	return m
+}
+
+func (m *LobbyStateMachine) OnEnter(phase LobbyPhase, hook PhaseHook) *LobbyStateMachine {
+	m.hooksOf(phase).onEnter = hook
+	return m
+}
+
+func (m *LobbyStateMachine) OnExit(phase LobbyPhase, hook PhaseHook) *LobbyStateMachine {
+	m.hooksOf(phase).onExit = hook
+	return m
+}
+
+// Observers are notified of every transition, including resets. Not to be added once the machine is in use
+func (m *LobbyStateMachine) Observe(observer func(PhaseTransition)) *LobbyStateMachine {
+	m.observers = append(m.observers, observer)
+	return m
+}
+
+func (m *LobbyStateMachine) OnHookError(handler func(transition PhaseTransition)) *LobbyStateMachine {
+	m.onHookError = handler
+	return m
+}
+
+func (m *LobbyStateMachine) hooksOf(phase LobbyPhase) *phaseHooks {
+	if m.hooks[phase] == nil {
+		m.hooks[phase] = &phaseHooks{}
+	}
+	return m.hooks[phase]
+}
+
+// Attempts to move from the current phase to the phase given.
+//
+// Returns true if the transition happened. Returns false and no error if the guard of the transition rejected it.
+// Returns ErrTransitionNotAllowed if no such transition is declared from the current phase.
+// If a hook fails, the machine is reset to LOBBY_PHASE_ROAMING_COLONY and the error of the hook is returned
+func (m *LobbyStateMachine) Transition(to LobbyPhase, reason string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	from := m.Current()
+	guard, allowed := m.transitions[from][to]
+	if !allowed {
+		return false, fmt.Errorf("%w: %s -> %s", ErrTransitionNotAllowed, from, to)
+	}
+	if guard != nil && !guard() {
+		return false, nil
+	}
+
+	transition := PhaseTransition{From: from, To: to, Reason: reason}
+	if err := m.runHooks(transition); err != nil {
+		m.resetAfterHookError(transition, err)
+		return false, err
+	}
+	m.notify(transition)
+	return true, nil
+}
+
+// Moves to LOBBY_PHASE_ROAMING_COLONY from any phase, bypassing the transition table and guards.
+// Errors of hooks are reported to observers, but otherwise ignored
+func (m *LobbyStateMachine) Reset(reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.reset(PhaseTransition{From: m.Current(), To: LOBBY_PHASE_ROAMING_COLONY, Reason: reason})
+}
+
+// Exit hook of the old phase, then enter hook of the new. The phase is updated in between
+func (m *LobbyStateMachine) runHooks(transition PhaseTransition) error {
+	if hooks := m.hooks[transition.From]; hooks != nil && hooks.onExit != nil {
+		if err := hooks.onExit(transition); err != nil {
+			return fmt.Errorf("exiting %s: %w", transition.From, err)
+		}
+	}
+	m.phase.Store(uint32(transition.To))
+	if hooks := m.hooks[transition.To]; hooks != nil && hooks.onEnter != nil {
+		if err := hooks.onEnter(transition); err != nil {
+			return fmt.Errorf("entering %s: %w", transition.To, err)
+		}
+	}
+	return nil
+}
+
+// Error policy: Never leave the lobby stuck in a half-entered phase, fall back to roaming
+func (m *LobbyStateMachine) resetAfterHookError(failed PhaseTransition, err error) {
+	failed.Err = err
+	m.notify(failed)
+	m.reset(PhaseTransition{From: m.Current(), To: LOBBY_PHASE_ROAMING_COLONY, Reason: "hook failed: " + err.Error()})
+	if m.onHookError != nil {
+		m.onHookError(failed)
+	}
+}
+
+func (m *LobbyStateMachine) reset(transition PhaseTransition) {
+	if transition.From != transition.To {
+		if hooks := m.hooks[transition.From]; hooks != nil && hooks.onExit != nil {
+			if err := hooks.onExit(transition); err != nil {
+				transition.Err = err
+			}
+		}
+	}
+	m.phase.Store(uint32(LOBBY_PHASE_ROAMING_COLONY))
+	if hooks := m.hooks[LOBBY_PHASE_ROAMING_COLONY]; hooks != nil && hooks.onEnter != nil {
+		if err := hooks.onEnter(transition); err != nil {
+			transition.Err = errors.Join(transition.Err, err)
+		}
+	}
+	m.notify(transition)
+}
+
+func (m *LobbyStateMachine) notify(transition PhaseTransition) {
+	for _, observer := range m.observers {
+		observer(transition)
+	}
+}
+
+// Logs every transition
+func logPhaseTransitions(lobbyID LobbyID) func(PhaseTransition) {
+	return func(transition PhaseTransition) {
+		if transition.Err != nil {
+			log.Printf("[lobby] Lobby %d failed transition %s -> %s (%s): %v", lobbyID, transition.From, transition.To, transition.Reason, transition.Err)
+			return
+		}
+		log.Printf("[lobby] Lobby %d transitioned %s -> %s (%s)", lobbyID, transition.From, transition.To, transition.Reason)
+	}
+}
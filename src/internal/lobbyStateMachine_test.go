@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLobbyStateMachineTransition(t *testing.T) {
+	tests := []struct {
+		name      string
+		to        LobbyPhase
+		guard     PhaseGuard
+		wantOK    bool
+		wantErr   error
+		wantPhase LobbyPhase
+	}{
+		{"allowed without guard", LOBBY_PHASE_AWAITING_PARTICIPANTS, nil, true, nil, LOBBY_PHASE_AWAITING_PARTICIPANTS},
+		{"allowed by guard", LOBBY_PHASE_AWAITING_PARTICIPANTS, func() bool { return true }, true, nil, LOBBY_PHASE_AWAITING_PARTICIPANTS},
+		{"rejected by guard", LOBBY_PHASE_AWAITING_PARTICIPANTS, func() bool { return false }, false, nil, LOBBY_PHASE_ROAMING_COLONY},
+		{"not declared", LOBBY_PHASE_IN_MINIGAME, nil, false, ErrTransitionNotAllowed, LOBBY_PHASE_ROAMING_COLONY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := NewLobbyStateMachine().
+				Allow(LOBBY_PHASE_ROAMING_COLONY, LOBBY_PHASE_AWAITING_PARTICIPANTS, tt.guard)
+
+			ok, err := machine.Transition(tt.to, "test")
+			if ok != tt.wantOK {
+				t.Errorf("Expected transition to return %v, got %v", tt.wantOK, ok)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if machine.Current() != tt.wantPhase {
+				t.Errorf("Expected phase %s, got %s", tt.wantPhase, machine.Current())
+			}
+		})
+	}
+}
+
+func TestLobbyStateMachineRunsHooksInOrder(t *testing.T) {
+	var calls []string
+	var observed []PhaseTransition
+	machine := NewLobbyStateMachine().
+		Allow(LOBBY_PHASE_ROAMING_COLONY, LOBBY_PHASE_AWAITING_PARTICIPANTS, nil).
+		OnExit(LOBBY_PHASE_ROAMING_COLONY, func(PhaseTransition) error {
+			calls = append(calls, "exit roaming")
+			return nil
+		}).
+		OnEnter(LOBBY_PHASE_AWAITING_PARTICIPANTS, func(transition PhaseTransition) error {
+			calls = append(calls, "enter awaiting")
+			return nil
+		}).
+		Observe(func(transition PhaseTransition) {
+			observed = append(observed, transition)
+		})
+
+	if _, err := machine.Transition(LOBBY_PHASE_AWAITING_PARTICIPANTS, "test"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "exit roaming" || calls[1] != "enter awaiting" {
+		t.Errorf("Expected exit hook before enter hook, got %v", calls)
+	}
+	if len(observed) != 1 {
+		t.Fatalf("Expected 1 observed transition, got %d", len(observed))
+	}
+	if observed[0].From != LOBBY_PHASE_ROAMING_COLONY || observed[0].To != LOBBY_PHASE_AWAITING_PARTICIPANTS || observed[0].Reason != "test" {
+		t.Errorf("Expected observed transition RoamingColony -> AwaitingParticipants (test), got %+v", observed[0])
+	}
+}
+
+func TestLobbyStateMachineResetsOnHookError(t *testing.T) {
+	hookErr := errors.New("failed to load")
+	var reportedErr error
+	var reenteredRoaming bool
+	machine := NewLobbyStateMachine().
+		Allow(LOBBY_PHASE_ROAMING_COLONY, LOBBY_PHASE_AWAITING_PARTICIPANTS, nil).
+		OnEnter(LOBBY_PHASE_AWAITING_PARTICIPANTS, func(PhaseTransition) error {
+			return hookErr
+		}).
+		OnEnter(LOBBY_PHASE_ROAMING_COLONY, func(PhaseTransition) error {
+			reenteredRoaming = true
+			return nil
+		}).
+		OnHookError(func(transition PhaseTransition) {
+			reportedErr = transition.Err
+		})
+
+	ok, err := machine.Transition(LOBBY_PHASE_AWAITING_PARTICIPANTS, "test")
+	if ok || !errors.Is(err, hookErr) {
+		t.Errorf("Expected transition to fail with %v, got %v, %v", hookErr, ok, err)
+	}
+	if machine.Current() != LOBBY_PHASE_ROAMING_COLONY {
+		t.Errorf("Expected machine to be reset to roaming, got %s", machine.Current())
+	}
+	if !reenteredRoaming {
+		t.Error("Expected enter hook of roaming to run on reset")
+	}
+	if !errors.Is(reportedErr, hookErr) {
+		t.Errorf("Expected hook error handler to receive %v, got %v", hookErr, reportedErr)
+	}
+
+	// The machine must still be usable afterwards
+	if _, err := machine.Transition(LOBBY_PHASE_AWAITING_PARTICIPANTS, "retry"); !errors.Is(err, hookErr) {
+		t.Errorf("Expected retry to reach the failing hook again, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/gorilla/websocket"
+)
+
+// Adds a client to the lobby, returning it along with the other end of its connection
+func addTestClient(t *testing.T, lobby *Lobby, id ClientID, originType OriginType, joinedAt time.Time) (*Client, *websocket.Conn) {
+	serverSide, clientSide := newTestConnPair(t)
+	client := NewClient(id, "Player", originType, serverSide, meta.MESSAGE_ENCODING_BINARY, testConfiguration)
+	client.JoinedAt = joinedAt
+	lobby.Clients.Store(id, client)
+	return client, clientSide
+}
+
+// Reads messages until one with the given event id arrives
+func awaitEvent(t *testing.T, conn *websocket.Conn, eventID MessageID) []byte {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected event %d, got error: %v", eventID, err)
+		}
+		if uint32(len(data)) >= MESSAGE_HEADER_SIZE && binary.BigEndian.Uint32(data[4:8]) == eventID {
+			return data[MESSAGE_HEADER_SIZE:]
+		}
+	}
+}
+
+func TestOwnerMigrationPromotesLongestConnectedGuest(t *testing.T) {
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_MIGRATE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+	now := time.Now()
+	owner, _ := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, now.Add(-time.Hour))
+	oldestGuest, oldestGuestSide := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, now.Add(-time.Minute))
+	newestGuest, newestGuestSide := addTestClient(t, lobby, 30, ORIGIN_TYPE_GUEST, now)
+
+	lobby.handleDisconnect(owner)
+
+	if lobby.Closing.Load() {
+		t.Fatal("Expected lobby not to close")
+	}
+	if lobby.GetOwnerID() != oldestGuest.ID {
+		t.Errorf("Expected owner to be %d, got %d", oldestGuest.ID, lobby.GetOwnerID())
+	}
+	if oldestGuest.Type() != ORIGIN_TYPE_OWNER || newestGuest.Type() != ORIGIN_TYPE_GUEST {
+		t.Errorf("Expected only the oldest guest to be promoted, got %s and %s", oldestGuest.Type(), newestGuest.Type())
+	}
+	if _, stillThere := lobby.Clients.Load(owner.ID); stillThere {
+		t.Error("Expected previous owner to be removed")
+	}
+	if lobby.ColonyOwnerID != owner.ID {
+		t.Error("Expected colony owner to remain unchanged")
+	}
+
+	for _, conn := range []*websocket.Conn{oldestGuestSide, newestGuestSide} {
+		remainder := awaitEvent(t, conn, OWNER_CHANGED_EVENT.ID)
+		deserialized, err := Deserialize(OWNER_CHANGED_EVENT, remainder, true)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if deserialized.PlayerID != oldestGuest.ID || deserialized.PreviousOwnerID != owner.ID {
+			t.Errorf("Unexpected owner changed event: %+v", deserialized)
+		}
+	}
+
+	// Owner only events follow the new owner
+	if !ENTER_LOCATION_EVENT.SendPermissions[oldestGuest.Type()] || ENTER_LOCATION_EVENT.SendPermissions[newestGuest.Type()] {
+		t.Error("Expected owner only events to be allowed for the new owner only")
+	}
+}
+
+func TestOwnerMigrationResetsSequenceInProgress(t *testing.T) {
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_MIGRATE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+	owner, _ := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+	_, guestSide := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, time.Now())
+
+	lobby.activityTracker.SetDiffConfirmed(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: 1, DifficultyID: 1})
+	lobby.activityTracker.LockIn(2)
+	if _, err := lobby.phases.Transition(LOBBY_PHASE_AWAITING_PARTICIPANTS, "test"); err != nil {
+		t.Fatalf("Expected transition to awaiting participants, got %v", err)
+	}
+
+	lobby.handleDisconnect(owner)
+
+	awaitEvent(t, guestSide, GENERIC_MINIGAME_SEQUENCE_RESET.ID)
+	if LobbyPhase(lobby.GetPhase()) != LOBBY_PHASE_ROAMING_COLONY {
+		t.Errorf("Expected lobby to be back to roaming, got phase %d", lobby.GetPhase())
+	}
+}
+
+func TestOwnerLeavingClosesColony(t *testing.T) {
+	mainBackend := integrations.NewFakeMainBackend(nil)
+	closeQueue := make(chan *Lobby, 1)
+	lobby := NewLobby(1, 10, 3, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, closeQueue, testConfiguration, mainBackend)
+	owner, _ := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+	_, guestSide := addTestClient(t, lobby, 20, ORIGIN_TYPE_GUEST, time.Now())
+
+	lobby.handleDisconnect(owner)
+
+	awaitEvent(t, guestSide, LOBBY_CLOSING_EVENT.ID)
+	// In the background
+	select {
+	case <-lobby.colonyClosed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the colony to be closed")
+	}
+	if ownerID, closed := mainBackend.ClosedBy(3); !closed || ownerID != 10 {
+		t.Errorf("Expected colony 3 to be closed for owner 10, got %d (closed: %t)", ownerID, closed)
+	}
+	select {
+	case queued := <-closeQueue:
+		if queued != lobby {
+			t.Error("Expected the lobby to be queued for closure")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the lobby to be queued for closure")
+	}
+}
+
+// Blocks fetching minigame settings until released
+type blockingMainBackend struct {
+	integrations.MainBackend
+	fetching chan struct{}
+	release  chan struct{}
+}
+
+func (b *blockingMainBackend) GetMinigameSettings(ctx context.Context, minigameID uint32, difficultyID uint32) (*integrations.MBMinigameSettingsDTO, error) {
+	b.fetching <- struct{}{}
+	<-b.release
+	return b.MainBackend.GetMinigameSettings(ctx, minigameID, difficultyID)
+}
+
+// A lobby with a single player, who has loaded the asteroids minigame
+func newLoadedTestLobby(t *testing.T, mainBackend integrations.MainBackend) *Lobby {
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1),
+		deadlineConfiguration(0, 0, meta.LAGGARD_POLICY_DROP), mainBackend)
+	owner, _ := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+	lobby.activityTracker.SetDiffConfirmed(&DifficultyConfirmedForMinigameMessageDTO{MinigameID: ASTEROIDS_MINIGAME_ID, DifficultyID: 1})
+	lobby.activityTracker.LockIn(1)
+	lobby.activityTracker.AddParticipant(owner)
+	for _, phase := range []LobbyPhase{LOBBY_PHASE_AWAITING_PARTICIPANTS, LOBBY_PHASE_PLAYERS_DECLARE_INTENT, LOBBY_PHASE_LOADING_MINIGAME} {
+		if phase == LOBBY_PHASE_LOADING_MINIGAME {
+			lobby.activityTracker.MarkPlayerAsReady(owner)
+		}
+		if ok, err := lobby.phases.Transition(phase, "test"); !ok || err != nil {
+			t.Fatalf("Expected transition to %s, got %v, %v", phase, ok, err)
+		}
+	}
+	lobby.activityTracker.MarkPlayerAsLoadComplete(owner)
+	return lobby
+}
+
+func newAsteroidsFixtureBackend(t *testing.T) *integrations.FakeMainBackend {
+	settings, err := json.Marshal(testAsteroidSettings())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return integrations.NewFakeMainBackend(&integrations.FakeMainBackendFixtures{
+		Minigames: map[uint32]integrations.FakeMinigameFixture{ASTEROIDS_MINIGAME_ID: {Settings: settings}},
+	})
+}
+
+func TestEnterMinigameMountsLoadedMinigame(t *testing.T) {
+	lobby := newLoadedTestLobby(t, newAsteroidsFixtureBackend(t))
+	defer lobby.phases.Reset("test over")
+
+	lobby.enterMinigame("test")
+
+	if phase := lobby.phases.Current(); phase != LOBBY_PHASE_IN_MINIGAME {
+		t.Fatalf("Expected phase %s, got %s", LOBBY_PHASE_IN_MINIGAME, phase)
+	}
+	if activity := lobby.currentActivity.Load(); activity == nil || activity.MinigameID != ASTEROIDS_MINIGAME_ID {
+		t.Errorf("Expected asteroids to be mounted, got %+v", activity)
+	}
+}
+
+func TestLoadingMinigameDoesNotHoldPhases(t *testing.T) {
+	mainBackend := &blockingMainBackend{
+		MainBackend: newAsteroidsFixtureBackend(t),
+		fetching:    make(chan struct{}, 1),
+		release:     make(chan struct{}),
+	}
+	lobby := newLoadedTestLobby(t, mainBackend)
+
+	entered := make(chan struct{})
+	go func() {
+		lobby.enterMinigame("test")
+		close(entered)
+	}()
+	<-mainBackend.fetching
+
+	released := make(chan struct{})
+	go func() {
+		lobby.phases.Reset("released by admin")
+		close(released)
+	}()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("Expected releasing the lobby not to wait for the minigame settings")
+	}
+
+	close(mainBackend.release)
+	<-entered
+	if phase := lobby.phases.Current(); phase != LOBBY_PHASE_ROAMING_COLONY {
+		t.Errorf("Expected the lobby to stay released, got phase %s", phase)
+	}
+	if lobby.currentActivity.Load() != nil || lobby.loadedActivity.Load() != nil {
+		t.Error("Expected the minigame loaded meanwhile to be discarded")
+	}
+}
+
+// Answers no call until its context ends
+type unresponsiveMainBackend struct {
+	integrations.MainBackend
+}
+
+func (b *unresponsiveMainBackend) GetMinigameSettings(ctx context.Context, minigameID uint32, difficultyID uint32) (*integrations.MBMinigameSettingsDTO, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestLoadingMinigameEndsWithLobbyContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		callTimeout time.Duration
+		act         func(lobby *Lobby)
+	}{
+		{"deadline passes", 50 * time.Millisecond, func(lobby *Lobby) {}},
+		{"lobby closes", time.Minute, func(lobby *Lobby) { lobby.close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lobby := newLoadedTestLobby(t, &unresponsiveMainBackend{MainBackend: testMainBackend})
+			lobby.configuration.MainBackendCallTimeout = tt.callTimeout
+
+			entered := make(chan struct{})
+			go func() {
+				lobby.enterMinigame("test")
+				close(entered)
+			}()
+			tt.act(lobby)
+			select {
+			case <-entered:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected loading the minigame to give up")
+			}
+			if phase := lobby.phases.Current(); phase != LOBBY_PHASE_ROAMING_COLONY {
+				t.Errorf("Expected phase %s, got %s", LOBBY_PHASE_ROAMING_COLONY, phase)
+			}
+		})
+	}
+}
+
+func TestClosingAgainAfterShutdown(t *testing.T) {
+	lm := CreateLobbyManager(testConfiguration, testMainBackend)
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, lm.CloseQueue, testConfiguration, testMainBackend)
+	lm.Lobbies.Store(lobby.ID, lobby)
+	owner, _ := addTestClient(t, lobby, 10, ORIGIN_TYPE_OWNER, time.Now())
+
+	lm.ShutdownLobbyManager()
+
+	// Fx. the owner being evicted while the colonies are closing. Must not send on the closed queue
+	lobby.handleDisconnect(owner)
+}
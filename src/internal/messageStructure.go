@@ -2,24 +2,93 @@ package internal
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 
 	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
 )
 
+// Byte size of the length prefix preceding a string or slice.
+// Selected through the prefix tag of a field, fx. `prefix:"u16"`
+type LengthPrefix uint32
+
+const (
+	// Only allowed for a string, which is then the last element of the message and spans all remaining bytes
+	LENGTH_PREFIX_NONE LengthPrefix = 0
+	LENGTH_PREFIX_U16  LengthPrefix = 2
+	LENGTH_PREFIX_U32  LengthPrefix = 4
+)
+
+// The prefix of slices without a prefix tag
+const DEFAULT_SLICE_LENGTH_PREFIX = LENGTH_PREFIX_U16
+
+func ParseLengthPrefix(s string) (LengthPrefix, error) {
+	switch s {
+	case "":
+		return LENGTH_PREFIX_NONE, nil
+	case "u16":
+		return LENGTH_PREFIX_U16, nil
+	case "u32":
+		return LENGTH_PREFIX_U32, nil
+	default:
+		return LENGTH_PREFIX_NONE, fmt.Errorf("invalid length prefix: %s, expected u16 or u32", s)
+	}
+}
+
+// Max length a prefix of this size can express
+func (prefix LengthPrefix) MaxLength() uint64 {
+	switch prefix {
+	case LENGTH_PREFIX_U16:
+		return math.MaxUint16
+	case LENGTH_PREFIX_U32:
+		return math.MaxUint32
+	default:
+		return 0
+	}
+}
+
+func (prefix LengthPrefix) String() string {
+	switch prefix {
+	case LENGTH_PREFIX_U16:
+		return "u16"
+	case LENGTH_PREFIX_U32:
+		return "u32"
+	default:
+		return "none"
+	}
+}
+
 // For use in statically computing elements at the very start of the application
 type MessageElementDescriptor struct {
 	ByteSize uint32 //Byte size of 0 means variable size
 	// accounting for message header
+	//
+	// For any element following a variable size element, this is the offset when all variable size elements before it are empty
 	Offset      uint32
 	FieldName   string
 	Description string
-	Kind        reflect.Kind //We do not intend to encode structs, so this is fine
+	Kind        reflect.Kind
+	// Strings: Number of bytes. Slices: Number of elements.
+	LengthPrefix LengthPrefix
+	// Slices only
+	ElementKind reflect.Kind
+	// Slices of structs only. Offsets are relative to the start of each element
+	Elements ComputedStructure
 }
+
+func (element MessageElementDescriptor) IsVariableSize() bool {
+	return element.ByteSize == 0
+}
+
 type ShortElementDescriptor struct {
-	Description string
-	FieldName   string
-	Kind        reflect.Kind //We do not intend to encode structs, so this is fine
+	Description  string
+	FieldName    string
+	Kind         reflect.Kind
+	LengthPrefix LengthPrefix
+	// Slices only
+	ElementKind reflect.Kind
+	// Slices of structs only
+	Elements ReferenceStructure
 }
 
 // description is a human readable description of the element, appears as a comment in generated code
@@ -33,6 +102,39 @@ func NewElementDescriptor(description string, fieldName string, kind reflect.Kin
 	}
 }
 
+// A string preceded by its length in bytes. May appear anywhere in a message
+func NewPrefixedStringDescriptor(description string, fieldName string, prefix LengthPrefix) ShortElementDescriptor {
+	return ShortElementDescriptor{
+		Description:  description,
+		FieldName:    fieldName,
+		Kind:         reflect.String,
+		LengthPrefix: prefix,
+	}
+}
+
+// A slice of fixed size primitives preceded by its number of elements. May appear anywhere in a message
+func NewSliceDescriptor(description string, fieldName string, elementKind reflect.Kind, prefix LengthPrefix) ShortElementDescriptor {
+	return ShortElementDescriptor{
+		Description:  description,
+		FieldName:    fieldName,
+		Kind:         reflect.Slice,
+		LengthPrefix: prefix,
+		ElementKind:  elementKind,
+	}
+}
+
+// A slice of flat structs preceded by its number of elements. May appear anywhere in a message
+func NewStructSliceDescriptor(description string, fieldName string, elements ReferenceStructure, prefix LengthPrefix) ShortElementDescriptor {
+	return ShortElementDescriptor{
+		Description:  description,
+		FieldName:    fieldName,
+		Kind:         reflect.Slice,
+		LengthPrefix: prefix,
+		ElementKind:  reflect.Struct,
+		Elements:     elements,
+	}
+}
+
 // In order slice of elements
 type ReferenceStructure []ShortElementDescriptor
 
@@ -49,40 +151,80 @@ const MESSAGE_HEADER_SIZE uint32 = 8
 // Returns the minimum total size of any message of this description as well as the full computed structure
 // the min size does not include the message header
 func ComputeStructure(messageName string, shortDescription ReferenceStructure) (uint32, ComputedStructure) {
+	minimumTotalSize, computedStructure, err := computeElements(shortDescription, MESSAGE_HEADER_SIZE, false)
+	if err != nil {
+		panic(fmt.Errorf("message %s: %s", messageName, err.Error()))
+	}
+	return minimumTotalSize, computedStructure
+}
+
+// Offsets start at the offset given. Elements of a slice of structs are nested, and must be flat
+func computeElements(shortDescription ReferenceStructure, offset uint32, nested bool) (uint32, ComputedStructure, error) {
 	var computedStructure ComputedStructure
-	var offset uint32 = MESSAGE_HEADER_SIZE
-	var hasVariableSizeElement bool = false
 	var minimumTotalSize uint32 = 0
 
 	for index, element := range shortDescription {
 		if err := isValidKind(element.Kind); err != nil {
-			panic(err)
+			return 0, nil, err
 		}
 
-		var isVariable bool = IsKindOfVariableSize(element.Kind)
-		if isVariable && hasVariableSizeElement {
-			panic(fmt.Errorf("message %s has multiple variable size elements", messageName))
+		computed := MessageElementDescriptor{
+			ByteSize:     util.SizeOfSerializedKind(element.Kind),
+			Offset:       offset,
+			FieldName:    element.FieldName,
+			Description:  element.Description,
+			Kind:         element.Kind,
+			LengthPrefix: element.LengthPrefix,
 		}
 
-		// Any variable elements should be on the end of the message
-		if isVariable && index != len(shortDescription)-1 {
-			panic(fmt.Errorf("message %s has a variable size element that is not the last element", messageName))
+		switch element.Kind {
+		case reflect.String:
+			// Any unprefixed string spans the remainder of the message, so it must be on the end
+			if element.LengthPrefix == LENGTH_PREFIX_NONE && (nested || index != len(shortDescription)-1) {
+				return 0, nil, fmt.Errorf("string %s is neither length prefixed nor the last element", element.FieldName)
+			}
+		case reflect.Slice:
+			if nested {
+				return 0, nil, fmt.Errorf("slice %s is nested in a slice, only flat structs are allowed as slice elements", element.FieldName)
+			}
+			if element.LengthPrefix == LENGTH_PREFIX_NONE {
+				return 0, nil, fmt.Errorf("slice %s has no length prefix", element.FieldName)
+			}
+			computed.ElementKind = element.ElementKind
+			if element.ElementKind == reflect.Struct {
+				if len(element.Elements) == 0 {
+					return 0, nil, fmt.Errorf("slice %s has elements of an empty struct", element.FieldName)
+				}
+				_, elements, err := computeElements(element.Elements, 0, true)
+				if err != nil {
+					return 0, nil, fmt.Errorf("elements of slice %s: %s", element.FieldName, err.Error())
+				}
+				computed.Elements = elements
+			} else if util.SizeOfSerializedKind(element.ElementKind) == 0 || isValidKind(element.ElementKind) != nil {
+				return 0, nil, fmt.Errorf("slice %s has elements of kind %s, expected a fixed size primitive or a struct", element.FieldName, element.ElementKind)
+			}
+		default:
+			if element.LengthPrefix != LENGTH_PREFIX_NONE {
+				return 0, nil, fmt.Errorf("element %s of kind %s has a length prefix, only strings and slices may have one", element.FieldName, element.Kind)
+			}
 		}
 
-		// Extract the actual value from the interface and use unsafe.Sizeof
-		sizeOfElement := util.SizeOfSerializedKind(element.Kind)
-
-		computedStructure = append(computedStructure, MessageElementDescriptor{
-			ByteSize:    sizeOfElement,
-			Offset:      offset,
-			FieldName:   element.FieldName,
-			Description: element.Description,
-			Kind:        element.Kind,
-		})
-		offset += sizeOfElement
-		minimumTotalSize += sizeOfElement
+		computedStructure = append(computedStructure, computed)
+		// An empty variable size element occupies only its prefix
+		size := computed.ByteSize + uint32(computed.LengthPrefix)
+		offset += size
+		minimumTotalSize += size
 	}
-	return minimumTotalSize, computedStructure
+	return minimumTotalSize, computedStructure, nil
+}
+
+// Minimum number of bytes an instance of the structure occupies
+func MinimumSizeOf(structure ComputedStructure) uint32 {
+	var size uint32 = 0
+	for _, element := range structure {
+		size += element.ByteSize + uint32(element.LengthPrefix)
+	}
+	return size
 }
 
 func VerifyStructureTCompliance[T any](structure ComputedStructure) error {
@@ -103,6 +245,9 @@ func VerifyStructureTCompliance[T any](structure ComputedStructure) error {
 		if field.Kind() != element.Kind {
 			return fmt.Errorf("field %s has kind %s, expected %s", element.FieldName, field.Kind(), element.Kind)
 		}
+		if element.Kind == reflect.Slice && field.Type().Elem().Kind() != element.ElementKind {
+			return fmt.Errorf("field %s has elements of kind %s, expected %s", element.FieldName, field.Type().Elem().Kind(), element.ElementKind)
+		}
 	}
 
 	return nil
@@ -111,7 +256,7 @@ func VerifyStructureTCompliance[T any](structure ComputedStructure) error {
 // In terms of expected message contents
 func isValidKind(kind reflect.Kind) error {
 	switch kind {
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String, reflect.Slice:
 		return nil
 	default:
 		return fmt.Errorf("kind %s is not supported", kind)
@@ -119,7 +264,7 @@ func isValidKind(kind reflect.Kind) error {
 }
 
 var TypesAllowed = []reflect.Kind{
-	reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String,
+	reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String, reflect.Slice, reflect.Struct,
 }
 
 func IsKindOfVariableSize(kind reflect.Kind) bool {
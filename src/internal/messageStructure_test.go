@@ -1 +1,186 @@
 package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testParticipantDTO struct {
+	ID    uint32 `json:"id" comment:"Player ID"`
+	IGN   string `json:"ign" comment:"In game name" prefix:"u16"`
+	Ready uint8  `json:"ready" comment:"1 if ready"`
+}
+
+type testRosterMessageDTO struct {
+	LobbyID      uint32               `json:"lobbyID" comment:"Lobby ID"`
+	Title        string               `json:"title" comment:"Title" prefix:"u16"`
+	Scores       []uint32             `json:"scores" comment:"Scores"`
+	Participants []testParticipantDTO `json:"participants" comment:"Participants" prefix:"u32"`
+	Note         string               `json:"note" comment:"Note"`
+}
+
+var TEST_ROSTER_EVENT = NewSpecification[testRosterMessageDTO](1_000_000_002, "TestRoster", "Only used in tests",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
+func TestComputeStructureLengthPrefixed(t *testing.T) {
+	tests := []struct {
+		name        string
+		structure   ReferenceStructure
+		wantMinSize uint32
+		wantPanic   string
+	}{
+		{"trailing string", ReferenceStructure{
+			NewElementDescriptor("", "id", reflect.Uint32),
+			NewElementDescriptor("", "name", reflect.String),
+		}, 4, ""},
+		{"prefixed strings anywhere", ReferenceStructure{
+			NewPrefixedStringDescriptor("", "first", LENGTH_PREFIX_U16),
+			NewPrefixedStringDescriptor("", "second", LENGTH_PREFIX_U32),
+			NewElementDescriptor("", "id", reflect.Uint32),
+		}, 10, ""},
+		{"slices anywhere", ReferenceStructure{
+			NewSliceDescriptor("", "scores", reflect.Float32, LENGTH_PREFIX_U16),
+			NewStructSliceDescriptor("", "players", ReferenceStructure{
+				NewElementDescriptor("", "id", reflect.Uint32),
+				NewPrefixedStringDescriptor("", "ign", LENGTH_PREFIX_U16),
+			}, LENGTH_PREFIX_U32),
+			NewElementDescriptor("", "id", reflect.Uint32),
+		}, 10, ""},
+		{"unprefixed string not last", ReferenceStructure{
+			NewElementDescriptor("", "name", reflect.String),
+			NewElementDescriptor("", "id", reflect.Uint32),
+		}, 0, "neither length prefixed nor the last element"},
+		{"unprefixed slice", ReferenceStructure{
+			NewSliceDescriptor("", "scores", reflect.Uint32, LENGTH_PREFIX_NONE),
+		}, 0, "no length prefix"},
+		{"slice of strings", ReferenceStructure{
+			NewSliceDescriptor("", "names", reflect.String, LENGTH_PREFIX_U16),
+		}, 0, "expected a fixed size primitive or a struct"},
+		{"unprefixed string in struct element", ReferenceStructure{
+			NewStructSliceDescriptor("", "players", ReferenceStructure{
+				NewElementDescriptor("", "ign", reflect.String),
+			}, LENGTH_PREFIX_U16),
+		}, 0, "neither length prefixed nor the last element"},
+		{"slice in struct element", ReferenceStructure{
+			NewStructSliceDescriptor("", "players", ReferenceStructure{
+				NewSliceDescriptor("", "scores", reflect.Uint32, LENGTH_PREFIX_U16),
+			}, LENGTH_PREFIX_U16),
+		}, 0, "only flat structs"},
+		{"prefixed number", ReferenceStructure{
+			{FieldName: "id", Kind: reflect.Uint32, LengthPrefix: LENGTH_PREFIX_U16},
+		}, 0, "only strings and slices"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if tt.wantPanic == "" {
+					if r != nil {
+						t.Errorf("Expected no panic, got %v", r)
+					}
+					return
+				}
+				if r == nil || !strings.Contains(r.(error).Error(), tt.wantPanic) {
+					t.Errorf("Expected panic containing %q, got %v", tt.wantPanic, r)
+				}
+			}()
+			minSize, _ := ComputeStructure("TestMessage", tt.structure)
+			if minSize != tt.wantMinSize {
+				t.Errorf("Expected min size %d, got %d", tt.wantMinSize, minSize)
+			}
+		})
+	}
+}
+
+func TestDeriveLengthPrefixedStructure(t *testing.T) {
+	structure := TEST_ROSTER_EVENT.Structure
+	if structure[1].LengthPrefix != LENGTH_PREFIX_U16 {
+		t.Errorf("Expected title to be u16 prefixed, got %s", structure[1].LengthPrefix)
+	}
+	if structure[2].LengthPrefix != DEFAULT_SLICE_LENGTH_PREFIX || structure[2].ElementKind != reflect.Uint32 {
+		t.Errorf("Expected scores to be a default prefixed slice of uint32, got %+v", structure[2])
+	}
+	if structure[3].LengthPrefix != LENGTH_PREFIX_U32 || len(structure[3].Elements) != 3 {
+		t.Errorf("Expected participants to be a u32 prefixed slice of 3 element structs, got %+v", structure[3])
+	}
+	// lobbyID + title prefix + scores prefix + participants prefix
+	if TEST_ROSTER_EVENT.ExpectedMinSize != 4+2+2+4 {
+		t.Errorf("Expected min size %d, got %d", 4+2+2+4, TEST_ROSTER_EVENT.ExpectedMinSize)
+	}
+}
+
+func TestLengthPrefixedRoundTrip(t *testing.T) {
+	message := testRosterMessageDTO{
+		LobbyID: 7,
+		Title:   "Hi",
+		Scores:  []uint32{1, 258},
+		Participants: []testParticipantDTO{
+			{ID: 1, IGN: "A", Ready: 1},
+			{ID: 2, IGN: "", Ready: 0},
+		},
+		Note: "end",
+	}
+	want := []byte{
+		0x3B, 0x9A, 0xCA, 0x02, // event id
+		0, 0, 0, 7, // lobbyID
+		0, 2, 'H', 'i', // title
+		0, 2, 0, 0, 0, 1, 0, 0, 1, 2, // scores
+		0, 0, 0, 2, // participants
+		0, 0, 0, 1, 0, 1, 'A', 1,
+		0, 0, 0, 2, 0, 0, 0,
+		'e', 'n', 'd', // note
+	}
+
+	size, err := ComputeMessageSize(TEST_ROSTER_EVENT, message)
+	if err != nil {
+		t.Fatalf("Expected no error computing size, got %v", err)
+	}
+	if int(size) != len(want)-4 {
+		t.Errorf("Expected size %d, got %d", len(want)-4, size)
+	}
+
+	serialized, err := Serialize(TEST_ROSTER_EVENT, message)
+	if err != nil {
+		t.Fatalf("Expected no error serializing, got %v", err)
+	}
+	if !reflect.DeepEqual(serialized, want) {
+		t.Errorf("Expected bytes %v, got %v", want, serialized)
+	}
+
+	deserialized, err := Deserialize(TEST_ROSTER_EVENT, serialized[4:], true)
+	if err != nil {
+		t.Fatalf("Expected no error deserializing, got %v", err)
+	}
+	if !reflect.DeepEqual(*deserialized, message) {
+		t.Errorf("Expected %+v, got %+v", message, *deserialized)
+	}
+}
+
+func TestDeserializeLengthPrefixedRejectsBadLengths(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"string longer than message", []byte{0, 0, 0, 7, 0, 9, 'H', 'i', 0, 0, 0, 0, 0, 0}},
+		{"slice longer than message", []byte{0, 0, 0, 7, 0, 0, 0xFF, 0xFF, 0, 0, 0, 0}},
+		{"struct slice longer than message", []byte{0, 0, 0, 7, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"truncated struct element", []byte{0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 5, 'A'}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Deserialize(TEST_ROSTER_EVENT, tt.body, true); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestSerializeRejectsOverlongPrefixedString(t *testing.T) {
+	message := testRosterMessageDTO{Title: strings.Repeat("a", int(LENGTH_PREFIX_U16.MaxLength())+1)}
+	if _, err := Serialize(TEST_ROSTER_EVENT, message); err == nil || !strings.Contains(err.Error(), "exceeds the max") {
+		t.Errorf("Expected error about the max length, got %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"log"
 
@@ -19,22 +21,56 @@ func SetServerID(id uint32, idBytes []byte) {
 }
 
 // When the server writes to the client, it sends a string and uses own id and debug message id 00...00
+//
+// Queued for the write pump of the client, so never blocks
 func SendDebugInfoToClient(client *Client, code uint32, message string) error {
 	var messageBody = DEBUG_EVENT.CopyIDBytes()
 	var withCode = append(messageBody, util.BytesOfUint32(code)...)
 	var withMessage = append(withCode, []byte(message)...)
-	var isBinary = true
 	log.Println("Sending debug info, client encoding is: ", client.String())
-	switch client.Encoding {
+	return SendMessageToClient(client, SERVER_ID, withMessage)
+}
+
+// Queues a message for a single client, encoded according to the encoding of that client
+//
+// # Expects the message to be binary and pre-pended with the required messageID
+//
+// Prepends senderID
+func SendMessageToClient(client *Client, senderID ClientID, message []byte) error {
+	withSender := append(util.BytesOfUint32(uint32(senderID)), message...)
+	messageType, encoded := EncodeOutbound(client.Encoding, withSender)
+	return client.Enqueue(messageType, encoded)
+}
+
+// Returns the websocket message type and the message encoded as per the encoding given
+//
+// Clients encode what they send the same way (see the client package)
+func EncodeOutbound(encoding meta.MessageEncoding, message []byte) (int, []byte) {
+	switch encoding {
 	case meta.MESSAGE_ENCODING_BASE16:
-		isBinary = false
-		withMessage = util.EncodeBase16(withMessage)
+		return websocket.TextMessage, util.EncodeBase16(message)
 	case meta.MESSAGE_ENCODING_BASE64:
-		isBinary = false
-		withMessage = util.EncodeBase64(withMessage)
+		return websocket.TextMessage, util.EncodeBase64(message)
+	default:
+		return websocket.BinaryMessage, message
 	}
+}
 
-	return client.Conn.WriteMessage(util.Ternary(isBinary, websocket.BinaryMessage, websocket.TextMessage), withMessage)
+// Decodes an incoming frame as per the encoding of the client that sent it.
+//
+// Binary frames are always taken as is. Text frames from binary clients are assumed to be base16
+func DecodeInbound(encoding meta.MessageEncoding, messageType int, message []byte) ([]byte, error) {
+	switch messageType {
+	case websocket.BinaryMessage:
+		return message, nil
+	case websocket.TextMessage:
+		if encoding == meta.MESSAGE_ENCODING_BASE64 {
+			return base64.StdEncoding.DecodeString(string(message))
+		}
+		return hex.DecodeString(string(message))
+	default:
+		return nil, fmt.Errorf("invalid message type: %d", messageType)
+	}
 }
 
 var EMPTY_BYTE_ARR = []byte{}
@@ -43,12 +79,10 @@ var EMPTY_BYTE_ARR = []byte{}
 // Expects the msg to be raw binary data.
 // # Returns client id, spec, rest of the message
 func ExtractMessageHeader(msg []byte) (ClientID, *EventSpecification[any], []byte, error) {
-	if len(msg) < 8 {
-		return 0, nil, EMPTY_BYTE_ARR, fmt.Errorf("message size too small. Must at least include userID (big endian uint32) and messageID (big endian uint32) in that order")
+	userID, messageID, remainder, err := SplitMessageHeader(msg)
+	if err != nil {
+		return 0, nil, EMPTY_BYTE_ARR, err
 	}
-	// Extract userID and messageID (uint32)
-	userID := binary.BigEndian.Uint32(msg[:4])
-	messageID := binary.BigEndian.Uint32(msg[4:8])
 
 	var spec *EventSpecification[any]
 	var specExists bool
@@ -58,61 +92,50 @@ func ExtractMessageHeader(msg []byte) (ClientID, *EventSpecification[any], []byt
 		return 0, nil, EMPTY_BYTE_ARR, fmt.Errorf("message size too small. Expected at least %d bytes for message type %s, got %d", spec.ExpectedMinSize, spec.Name, len(msg))
 	}
 
-	return ClientID(userID), spec, msg[MESSAGE_HEADER_SIZE:], nil
+	return userID, spec, remainder, nil
 }
 
-// BroadcastMessage sends a message to all users in the lobby except the sender
-//
-// # Expects the message to be binary and pre-pended with the required clientID and messageID
-//
-// # DOES NOT Check whether or not the sender is allowed to broadcast that message
-//
-// Returns the clients that could not be reached (if any)
-func BroadcastMessageBinary(lobby *Lobby, senderID ClientID, message []byte) []*Client {
-	return broadcast(lobby, senderID, message, websocket.BinaryMessage)
+// Splits the header off a message without looking up the spec of it
+// # Returns sender id, message id, rest of the message
+func SplitMessageHeader(msg []byte) (ClientID, MessageID, []byte, error) {
+	if len(msg) < int(MESSAGE_HEADER_SIZE) {
+		return 0, 0, EMPTY_BYTE_ARR, fmt.Errorf("message size too small. Must at least include userID (big endian uint32) and messageID (big endian uint32) in that order")
+	}
+	// Extract userID and messageID (uint32)
+	userID := binary.BigEndian.Uint32(msg[:4])
+	messageID := binary.BigEndian.Uint32(msg[4:8])
+	return ClientID(userID), messageID, msg[MESSAGE_HEADER_SIZE:], nil
 }
 
-// BroadcastMessage sends a message to all users in the lobby except the sender
-//
-// # Expects the message to be binary and pre-pended with the required clientID and messageID
+// Sends a message to all users in the lobby except the sender.
+// Only queues the message for the write pump of each client, so a slow client doesn't stall the broadcast for everyone.
 //
-// # DOES NOT Check whether or not the sender is allowed to broadcast that message
-//
-// Returns the clients that could not be reached (if any)
-func BroadcastMessageBase16(lobby *Lobby, senderID ClientID, message []byte) []*Client {
-	message = util.EncodeBase16(message)
-	return broadcast(lobby, senderID, message, websocket.TextMessage)
-}
-
-// BroadcastMessage sends a message to all users in the lobby except the sender
+// The message is encoded once per encoding in use among the clients of the lobby.
 //
-// # Expects the message to be binary and pre-pended with the required clientID and messageID
+// # Expects the message to be binary and pre-pended with the required messageID
 //
 // # DOES NOT Check whether or not the sender is allowed to broadcast that message
 //
-// Returns the clients that could not be reached (if any)
-func BroadcastMessageBase64(lobby *Lobby, senderID ClientID, message []byte) []*Client {
-	message = util.EncodeBase64(message)
-	return broadcast(lobby, senderID, message, websocket.TextMessage)
-}
-
-// Returns the clients that could not be reached (if any)
+// Returns the clients that could not be reached (if any), i.e. slow consumers and clients already closed.
 //
 // Prepends senderID
-func broadcast(lobby *Lobby, senderID ClientID, message []byte, messageType int) []*Client {
+func broadcast(lobby *Lobby, senderID ClientID, message []byte) []*Client {
 	var unreachableClients []*Client
-	var replicationCount = 0
 
-	wSenderID := util.BytesOfUint32(uint32(senderID))
-	message = append(wSenderID, message...)
+	withSender := append(util.BytesOfUint32(uint32(senderID)), message...)
+	encodedPerEncoding := make(map[meta.MessageEncoding]outboundMessage, 3)
 	lobby.Clients.Range(func(userID ClientID, user *Client) bool {
-		if userID != senderID {
-			err := user.Conn.WriteMessage(messageType, message)
-			replicationCount++
-			if err != nil {
-				log.Println("[messaging] Error sending message to user:", userID, err)
-				unreachableClients = append(unreachableClients, user)
-			}
+		if userID == senderID {
+			return true
+		}
+		encoded, alreadyEncoded := encodedPerEncoding[user.Encoding]
+		if !alreadyEncoded {
+			encoded.messageType, encoded.data = EncodeOutbound(user.Encoding, withSender)
+			encodedPerEncoding[user.Encoding] = encoded
+		}
+		if err := user.Enqueue(encoded.messageType, encoded.data); err != nil {
+			log.Println("[messaging] Error queueing message for user:", userID, err)
+			unreachableClients = append(unreachableClients, user)
 		}
 		return true
 	})
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+	"github.com/gorilla/websocket"
+)
+
+func TestDecodeInbound(t *testing.T) {
+	raw := []byte{0, 0, 0, 1, 0, 0, 0, 2}
+	tests := []struct {
+		name        string
+		encoding    meta.MessageEncoding
+		messageType int
+		message     []byte
+		wantErr     bool
+	}{
+		{"binary frame", meta.MESSAGE_ENCODING_BINARY, websocket.BinaryMessage, raw, false},
+		{"binary frame from base64 client", meta.MESSAGE_ENCODING_BASE64, websocket.BinaryMessage, raw, false},
+		{"base16 text", meta.MESSAGE_ENCODING_BASE16, websocket.TextMessage, []byte("0000000100000002"), false},
+		{"base64 text", meta.MESSAGE_ENCODING_BASE64, websocket.TextMessage, []byte("AAAAAQAAAAI="), false},
+		{"text from binary client is base16", meta.MESSAGE_ENCODING_BINARY, websocket.TextMessage, []byte("0000000100000002"), false},
+		{"base64 text from base16 client", meta.MESSAGE_ENCODING_BASE16, websocket.TextMessage, []byte("AAAAAQAAAAI="), true},
+		{"ping frame", meta.MESSAGE_ENCODING_BINARY, websocket.PingMessage, raw, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeInbound(tt.encoding, tt.messageType, tt.message)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", decoded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(decoded, raw) {
+				t.Errorf("Expected %v, got %v", raw, decoded)
+			}
+		})
+	}
+}
+
+func TestBroadcastEncodesPerClient(t *testing.T) {
+	lobby := NewLobby(1, 10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE, make(chan *Lobby, 1), testConfiguration, testMainBackend)
+
+	receivers := map[meta.MessageEncoding]*websocket.Conn{}
+	for i, encoding := range []meta.MessageEncoding{meta.MESSAGE_ENCODING_BINARY, meta.MESSAGE_ENCODING_BASE16, meta.MESSAGE_ENCODING_BASE64} {
+		serverSide, clientSide := newTestConnPair(t)
+		client := NewClient(ClientID(20+i), "Player", ORIGIN_TYPE_GUEST, serverSide, encoding, testConfiguration)
+		lobby.Clients.Store(client.ID, client)
+		receivers[encoding] = clientSide
+	}
+
+	message := LOBBY_CLOSING_EVENT.CopyIDBytes()
+	if unreachable := lobby.BroadcastMessage(SERVER_ID, message); len(unreachable) != 0 {
+		t.Fatalf("Expected all clients to be reachable, got %d unreachable", len(unreachable))
+	}
+
+	expected := append(append([]byte{}, SERVER_ID_BYTES...), message...)
+	for encoding, conn := range receivers {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Unexpected error reading as %s: %v", encoding, err)
+		}
+		decoded, err := DecodeInbound(encoding, messageType, data)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding as %s: %v", encoding, err)
+		}
+		if !bytes.Equal(decoded, expected) {
+			t.Errorf("Expected %v for %s, got %v", expected, encoding, decoded)
+		}
+	}
+}
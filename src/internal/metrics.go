@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/metrics"
+)
+
+var (
+	metricLobbiesActive = metrics.Default.NewGauge("multiplayer_lobbies_active",
+		"Number of open lobbies")
+	metricClientsActive = metrics.Default.NewGauge("multiplayer_clients_active",
+		"Number of clients in any lobby, by origin type", "origin_type")
+	metricMessagesReceived = metrics.Default.NewCounter("multiplayer_messages_received_total",
+		"Messages received from clients with a valid header, by event", "event")
+	metricMessagesBroadcast = metrics.Default.NewCounter("multiplayer_messages_broadcast_total",
+		"Messages broadcast to lobbies, by event", "event")
+	metricBytesReceived = metrics.Default.NewCounter("multiplayer_bytes_received_total",
+		"Bytes received from clients, by encoding", "encoding")
+	metricBytesSent = metrics.Default.NewCounter("multiplayer_bytes_sent_total",
+		"Bytes written to clients, by encoding", "encoding")
+	metricBroadcastFailures = metrics.Default.NewCounter("multiplayer_broadcast_failures_total",
+		"Number of times a broadcast could not reach a client, by event", "event")
+	metricPostProcessQueueDepth = metrics.Default.NewGauge("multiplayer_post_process_queue_depth",
+		"Messages waiting in the post process queue, by lobby", "lobby")
+	metricMinigameStarts = metrics.Default.NewCounter("multiplayer_minigame_starts_total",
+		"Minigames started, by minigame id", "minigame")
+	metricMinigameOutcomes = metrics.Default.NewCounter("multiplayer_minigame_outcomes_total",
+		"Minigames ended, by minigame id and final state", "minigame", "state")
+	metricPhaseTransitions = metrics.Default.NewCounter("multiplayer_lobby_phase_transitions_total",
+		"Lobby phase transitions, by phase left and phase entered", "from", "to")
+)
+
+// Name of the event of a message, which is expected to start with the message id
+func eventNameOf(message []byte) string {
+	if len(message) < 4 {
+		return "Unknown"
+	}
+	if spec, exists := ALL_EVENTS[binary.BigEndian.Uint32(message[:4])]; exists {
+		return spec.Name
+	}
+	return "Unknown"
+}
+
+// Updates the metrics which are only computed on demand, i.e. when scraped
+func (lm *LobbyManager) UpdateMetrics() {
+	var lobbyCount int
+	clientsByType := map[OriginType]int{ORIGIN_TYPE_OWNER: 0, ORIGIN_TYPE_GUEST: 0}
+	// Lobbies come and go, so old series must be cleared. Replaced at once, as scrapes may run concurrently
+	var queueDepths []metrics.GaugeSeries
+	lm.Lobbies.Range(func(id LobbyID, lobby *Lobby) bool {
+		lobbyCount++
+		queueDepths = append(queueDepths, metrics.GaugeSeries{Value: float64(len(lobby.PostProcessQueue)), LabelValues: []string{fmt.Sprint(id)}})
+		lobby.Clients.Range(func(_ ClientID, client *Client) bool {
+			clientsByType[client.Type()]++
+			return true
+		})
+		return true
+	})
+	metricPostProcessQueueDepth.Replace(queueDepths)
+	metricLobbiesActive.Set(float64(lobbyCount))
+	for originType, count := range clientsByType {
+		metricClientsActive.Set(float64(count), originType)
+	}
+}
+
+// Counts every lobby phase transition
+func countPhaseTransitions(transition PhaseTransition) {
+	if transition.Err != nil {
+		return
+	}
+	metricPhaseTransitions.Inc(transition.From.String(), transition.To.String())
+}
@@ -48,12 +48,11 @@ func LoadMinigameControls(diffDTO *DifficultyConfirmedForMinigameMessageDTO, lob
 		return nil, fmt.Errorf("diffDTO is nil")
 	}
 
-	switch diffDTO.MinigameID {
-	case 1:
-		return GetAsteroidMinigameControls(diffDTO, lobby, onDismount)
-	default:
+	minigame, exists := GetMinigame(diffDTO.MinigameID)
+	if !exists {
 		return nil, fmt.Errorf("minigame with id %d not found", diffDTO.MinigameID)
 	}
+	return minigame.load(diffDTO, lobby, onDismount)
 }
 
 func OnUntimelyMinigameAbort(reason string, sourceID uint32, lobby *Lobby, state *atomic.Uint32) error {
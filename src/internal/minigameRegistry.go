@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
+)
+
+const (
+	// Events of minigames live above all lobby events. Fx. 3000-3999 for asteroids
+	MINIGAME_EVENT_RANGE_START MessageID = 3000
+	// Game events. A minigame either reserves a range below this, or a range at or above it, never across
+	GAME_EVENT_RANGE_START MessageID = 1_000_000_000
+)
+
+// Creates the controls of a minigame, given the settings fetched from the main backend
+type MinigameFactory[S any] func(diff *DifficultyConfirmedForMinigameMessageDTO, settings *S, env MinigameEnvironment, lobby *Lobby, onDismount func()) (*GenericMinigameControls, error)
+
+// Everything a minigame provides when registering itself. S is the settings DTO of the minigame
+type MinigameDefinition[S any] struct {
+	ID   uint32
+	Name string
+	// Inclusive range of event ids reserved by the minigame
+	FirstEventID MessageID
+	LastEventID  MessageID
+	Events       map[MessageID]*EventSpecification[any]
+	Factory      MinigameFactory[S]
+}
+
+// A registered minigame, with the type of its settings erased
+type MinigameRegistration struct {
+	ID           uint32
+	Name         string
+	FirstEventID MessageID
+	LastEventID  MessageID
+	Events       map[MessageID]*EventSpecification[any]
+	SettingsType reflect.Type
+	load         func(diff *DifficultyConfirmedForMinigameMessageDTO, lobby *Lobby, onDismount func()) (*GenericMinigameControls, error)
+}
+
+type minigameRegistry struct {
+	lock      sync.RWMutex
+	minigames map[uint32]*MinigameRegistration
+}
+
+func newMinigameRegistry() *minigameRegistry {
+	return &minigameRegistry{minigames: make(map[uint32]*MinigameRegistration)}
+}
+
+var registry = newMinigameRegistry()
+
+// To be called from the init() function of the file declaring the minigame.
+//
+// PANICS if the definition is invalid, or clashes with a minigame already registered
+func RegisterMinigame[S any](definition MinigameDefinition[S]) {
+	if err := registry.add(newMinigameRegistration(definition)); err != nil {
+		panic(fmt.Sprintf("Minigame registration error: %s", err.Error()))
+	}
+}
+
+func newMinigameRegistration[S any](definition MinigameDefinition[S]) *MinigameRegistration {
+	var settings S
+	return &MinigameRegistration{
+		ID:           definition.ID,
+		Name:         definition.Name,
+		FirstEventID: definition.FirstEventID,
+		LastEventID:  definition.LastEventID,
+		Events:       definition.Events,
+		SettingsType: reflect.TypeOf(settings),
+		load: func(diff *DifficultyConfirmedForMinigameMessageDTO, lobby *Lobby, onDismount func()) (*GenericMinigameControls, error) {
+			if definition.Factory == nil {
+				return nil, fmt.Errorf("minigame %d has no factory", definition.ID)
+			}
+			ctx, cancel := lobby.mainBackendContext()
+			defer cancel()
+			settings, err := loadMinigameSettings[S](ctx, lobby.mainBackend, definition.ID, diff.DifficultyID)
+			if err != nil {
+				return nil, err
+			}
+			env := NewMinigameEnvironment()
+			log.Printf("[minigame] Loading %s for lobby %d with seed %d", definition.Name, lobby.ID, env.Seed)
+			controls, err := definition.Factory(diff, settings, env, lobby, onDismount)
+			if err != nil {
+				return nil, err
+			}
+			controls.MinigameID = definition.ID
+			return controls, nil
+		},
+	}
+}
+
+func (r *minigameRegistry) add(minigame *MinigameRegistration) error {
+	if err := minigame.validate(); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, other := range r.minigames {
+		if other.ID == minigame.ID {
+			return fmt.Errorf("minigame id %d of %s is already used by %s", minigame.ID, minigame.Name, other.Name)
+		}
+		if minigame.FirstEventID <= other.LastEventID && other.FirstEventID <= minigame.LastEventID {
+			return fmt.Errorf("event range %d-%d of %s overlaps %d-%d of %s",
+				minigame.FirstEventID, minigame.LastEventID, minigame.Name, other.FirstEventID, other.LastEventID, other.Name)
+		}
+	}
+	r.minigames[minigame.ID] = minigame
+	return nil
+}
+
+func (minigame *MinigameRegistration) validate() error {
+	if minigame.ID == 0 {
+		return fmt.Errorf("minigame %s has id 0, which is the nil value", minigame.Name)
+	}
+	if minigame.FirstEventID < MINIGAME_EVENT_RANGE_START {
+		return fmt.Errorf("event range of %s starts at %d, below the minigame event range starting at %d", minigame.Name, minigame.FirstEventID, MINIGAME_EVENT_RANGE_START)
+	}
+	if minigame.LastEventID < minigame.FirstEventID {
+		return fmt.Errorf("event range of %s ends at %d, before it starts at %d", minigame.Name, minigame.LastEventID, minigame.FirstEventID)
+	}
+	if minigame.FirstEventID < GAME_EVENT_RANGE_START && minigame.LastEventID >= GAME_EVENT_RANGE_START {
+		return fmt.Errorf("event range %d-%d of %s crosses the start of the game event range at %d", minigame.FirstEventID, minigame.LastEventID, minigame.Name, GAME_EVENT_RANGE_START)
+	}
+	for id, spec := range minigame.Events {
+		if id < minigame.FirstEventID || id > minigame.LastEventID {
+			return fmt.Errorf("event %s of %s has id %d, outside its range %d-%d", spec.Name, minigame.Name, id, minigame.FirstEventID, minigame.LastEventID)
+		}
+	}
+	return nil
+}
+
+func (r *minigameRegistry) get(id uint32) (*MinigameRegistration, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	minigame, exists := r.minigames[id]
+	return minigame, exists
+}
+
+// Ordered by id
+func (r *minigameRegistry) all() []*MinigameRegistration {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	minigames := make([]*MinigameRegistration, 0, len(r.minigames))
+	for _, minigame := range r.minigames {
+		minigames = append(minigames, minigame)
+	}
+	sort.Slice(minigames, func(i, j int) bool {
+		return minigames[i].ID < minigames[j].ID
+	})
+	return minigames
+}
+
+func GetMinigame(id uint32) (*MinigameRegistration, bool) {
+	return registry.get(id)
+}
+
+// Ordered by id
+func RegisteredMinigames() []*MinigameRegistration {
+	return registry.all()
+}
+
+// Fetches the settings of the minigame for the difficulty given from the main backend, and applies any overwriting settings
+func loadMinigameSettings[S any](ctx context.Context, mainBackend integrations.MainBackend, minigameID uint32, difficultyID uint32) (*S, error) {
+	rawSettings, err := mainBackend.GetMinigameSettings(ctx, minigameID, difficultyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get minigame settings: %s", err.Error())
+	}
+
+	var baseSettings S
+	if err := json.Unmarshal(rawSettings.Settings, &baseSettings); err != nil {
+		return nil, fmt.Errorf("error unmarshaling base settings: %s", err.Error())
+	}
+
+	if len(rawSettings.OverwritingSettings) > 0 {
+		var overwriteSettings S
+		if err := json.Unmarshal(rawSettings.OverwritingSettings, &overwriteSettings); err != nil {
+			return nil, fmt.Errorf("error unmarshaling overwriting settings: %s", err.Error())
+		}
+		mergeSettings(&baseSettings, &overwriteSettings)
+	}
+	return &baseSettings, nil
+}
+
+// Applies the non-zero fields of src to dst
+func mergeSettings[S any](dst *S, src *S) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src).Elem()
+	if dstValue.Kind() != reflect.Struct {
+		if !srcValue.IsZero() {
+			dstValue.Set(srcValue)
+		}
+		return
+	}
+	for i := 0; i < srcValue.NumField(); i++ {
+		field := srcValue.Field(i)
+		if dstValue.Field(i).CanSet() && !field.IsZero() {
+			dstValue.Field(i).Set(field)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
+)
+
+type testMinigameSettingsDTO struct {
+	Speed  float32 `json:"speed"`
+	Health uint32  `json:"health"`
+	Name   string  `json:"name"`
+}
+
+var TEST_MINIGAME_EVENT = NewSpecification[EmptyDTO](1_000_000_001, "TestMinigameEvent", "Only used in tests",
+	SERVER_ONLY, Handlers_IntentionalIgnoreHandler)
+
+func testMinigameDefinition(id uint32, first MessageID, last MessageID) MinigameDefinition[testMinigameSettingsDTO] {
+	return MinigameDefinition[testMinigameSettingsDTO]{
+		ID:           id,
+		Name:         "Test",
+		FirstEventID: first,
+		LastEventID:  last,
+		Events:       NewSpecMap(TEST_MINIGAME_EVENT),
+	}
+}
+
+func withoutEvents(definition MinigameDefinition[testMinigameSettingsDTO]) MinigameDefinition[testMinigameSettingsDTO] {
+	definition.Events = nil
+	return definition
+}
+
+func TestMinigameRegistryValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition MinigameDefinition[testMinigameSettingsDTO]
+		wantErr    string
+	}{
+		{"valid", testMinigameDefinition(2, 1_000_000_000, 1_000_000_999), ""},
+		{"nil id", testMinigameDefinition(0, 1_000_000_000, 1_000_000_999), "nil value"},
+		{"clashing id", testMinigameDefinition(ASTEROIDS_MINIGAME_ID, 1_000_000_000, 1_000_000_999), "already used"},
+		{"below minigame range", testMinigameDefinition(2, 2000, 2999), "below the minigame event range"},
+		{"inverted range", testMinigameDefinition(2, 1_000_000_999, 1_000_000_000), "before it starts"},
+		{"across game event range", testMinigameDefinition(2, 999_999_000, 1_000_000_999), "crosses the start"},
+		{"overlapping asteroids", withoutEvents(testMinigameDefinition(2, 3500, 4499)), "overlaps"},
+		{"event outside range", testMinigameDefinition(2, 4000, 4999), "outside its range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMinigameRegistry()
+			asteroids, _ := GetMinigame(ASTEROIDS_MINIGAME_ID)
+			if err := r.add(asteroids); err != nil {
+				t.Fatalf("Expected asteroids to register, got %v", err)
+			}
+
+			err := r.add(newMinigameRegistration(tt.definition))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAsteroidsIsRegistered(t *testing.T) {
+	asteroids, exists := GetMinigame(ASTEROIDS_MINIGAME_ID)
+	if !exists {
+		t.Fatal("Expected asteroids to be registered")
+	}
+	if asteroids.SettingsType != reflect.TypeOf(AsteroidSettingsDTO{}) {
+		t.Errorf("Expected settings type AsteroidSettingsDTO, got %s", asteroids.SettingsType)
+	}
+	if _, exists := asteroids.Events[ASTEROID_SPAWN_EVENT.ID]; !exists {
+		t.Error("Expected asteroid events to be registered along with the minigame")
+	}
+}
+
+func TestMergeSettings(t *testing.T) {
+	base := testMinigameSettingsDTO{Speed: 1, Health: 100, Name: "base"}
+	overwrite := testMinigameSettingsDTO{Health: 50}
+
+	mergeSettings(&base, &overwrite)
+
+	want := testMinigameSettingsDTO{Speed: 1, Health: 50, Name: "base"}
+	if base != want {
+		t.Errorf("Expected %+v, got %+v", want, base)
+	}
+}
+
+func TestLoadMinigameSettingsFromFakeMainBackend(t *testing.T) {
+	mainBackend := integrations.NewFakeMainBackend(&integrations.FakeMainBackendFixtures{
+		Minigames: map[uint32]integrations.FakeMinigameFixture{
+			2: {
+				Settings:            json.RawMessage(`{"speed":1,"health":100,"name":"base"}`),
+				OverwritingSettings: map[uint32]json.RawMessage{3: json.RawMessage(`{"health":50}`)},
+			},
+		},
+	})
+	tests := []struct {
+		name         string
+		minigameID   uint32
+		difficultyID uint32
+		want         testMinigameSettingsDTO
+		wantErr      bool
+	}{
+		{"no overwriting settings", 2, 1, testMinigameSettingsDTO{Speed: 1, Health: 100, Name: "base"}, false},
+		{"overwritten", 2, 3, testMinigameSettingsDTO{Speed: 1, Health: 50, Name: "base"}, false},
+		{"no fixture", 4, 1, testMinigameSettingsDTO{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := loadMinigameSettings[testMinigameSettingsDTO](context.Background(), mainBackend, tt.minigameID, tt.difficultyID)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", settings)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if *settings != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, *settings)
+			}
+		})
+	}
+}
+
+// The fixtures bundled for MAIN_BACKEND_MODE=fake must keep up with the settings of the asteroids minigame
+func TestBundledFixturesParseAsAsteroidSettings(t *testing.T) {
+	mainBackend, err := integrations.LoadFakeMainBackend("../../fixtures/mainBackend.json")
+	if err != nil {
+		t.Fatalf("Unexpected error loading fixtures: %v", err)
+	}
+	for _, difficultyID := range []uint32{1, 2, 3} {
+		raw, err := mainBackend.GetMinigameSettings(context.Background(), ASTEROIDS_MINIGAME_ID, difficultyID)
+		if err != nil {
+			t.Fatalf("Expected asteroids fixture, got %v", err)
+		}
+		for _, settings := range []json.RawMessage{raw.Settings, raw.OverwritingSettings} {
+			if len(settings) == 0 {
+				continue
+			}
+			decoder := json.NewDecoder(strings.NewReader(string(settings)))
+			decoder.DisallowUnknownFields()
+			var dto AsteroidSettingsDTO
+			if err := decoder.Decode(&dto); err != nil {
+				t.Errorf("Expected settings of difficulty %d to be asteroid settings, got %v", difficultyID, err)
+			}
+		}
+	}
+}
@@ -1,6 +1,28 @@
 package internal
 
-import "sync/atomic"
+import (
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/util"
+)
+
+// Sources of time and randomness of a minigame.
+// A minigame is to draw on nothing else, such that the same seed and the same input reproduces a match exactly
+type MinigameEnvironment struct {
+	Clock util.Clock
+	Seed  uint64
+}
+
+// Wall clock and a random seed
+func NewMinigameEnvironment() MinigameEnvironment {
+	return MinigameEnvironment{Clock: util.SystemClock, Seed: rand.Uint64()}
+}
+
+// Deterministic for any given seed
+func (env MinigameEnvironment) NewRand() *rand.Rand {
+	return rand.New(rand.NewPCG(env.Seed, env.Seed))
+}
 
 // Must be blocking.
 // Here is to be executed any final logic or broadcasts before the game loop actually starts.
@@ -17,6 +39,7 @@ type MinigameLoopStartFunction func()
 type MinigameFallingEdgeFunction func() error
 
 type GenericMinigameControls struct {
+	MinigameID uint32
 	// Blocking. Executes pre-game start logic. If any
 	// Such as assigning players to teams, player data, etc, specific for the game loop
 	ExecRisingEdge MinigameRisingEdgeFunction
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+// To be bumped on any deliberate breaking change of the protocol not covered by the spec fingerprint
+const PROTOCOL_VERSION uint32 = 1
+
+// Set by InitEventSpecifications
+var protocolFingerprint string
+
+// Fingerprint of ALL_EVENTS, as computed by InitEventSpecifications
+func ProtocolFingerprint() string {
+	return protocolFingerprint
+}
+
+// Stable hash over the ids, names and structure (field names, kinds, sizes, offsets and length prefixes) of the events given.
+// Comments and send permissions are not included, as a client needs not agree on those to understand the server
+func ComputeProtocolFingerprint(events map[MessageID]*EventSpecification[any]) string {
+	ids := make([]MessageID, 0, len(events))
+	for id := range events {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	var description strings.Builder
+	for _, id := range ids {
+		spec := events[id]
+		description.WriteString(fmt.Sprintf("%d:%s{", spec.ID, spec.Name))
+		describeStructure(&description, spec.Structure)
+		description.WriteString("}\n")
+	}
+	hash := sha256.Sum256([]byte(description.String()))
+	return hex.EncodeToString(hash[:8])
+}
+
+func describeStructure(description *strings.Builder, structure ComputedStructure) {
+	for _, element := range structure {
+		description.WriteString(fmt.Sprintf("%s:%s:%d:%d:%d", element.FieldName, element.Kind, element.ByteSize, element.Offset, element.LengthPrefix))
+		if element.Kind == reflect.Slice {
+			description.WriteString(fmt.Sprintf(":%s[", element.ElementKind))
+			describeStructure(description, element.Elements)
+			description.WriteString("]")
+		}
+		description.WriteString(";")
+	}
+}
+
+// Protocol version and spec fingerprint as declared by a client when connecting.
+// Either may be left out (zero value), in which case it isn't checked
+type ProtocolHandshake struct {
+	Version     uint32
+	Fingerprint string
+}
+
+func (handshake ProtocolHandshake) IsCompatible() bool {
+	versionMatches := handshake.Version == 0 || handshake.Version == PROTOCOL_VERSION
+	fingerprintMatches := handshake.Fingerprint == "" || handshake.Fingerprint == ProtocolFingerprint()
+	return versionMatches && fingerprintMatches
+}
+
+func (handshake ProtocolHandshake) describeMismatch() string {
+	return fmt.Sprintf("server has protocol version %d and spec fingerprint %s, client declared version %d and fingerprint \"%s\"",
+		PROTOCOL_VERSION, ProtocolFingerprint(), handshake.Version, handshake.Fingerprint)
+}
+
+// Preflight for any connection. Returns nil if the client is compatible, or if it may connect anyway as per the protocol mismatch policy
+func (lm *LobbyManager) CheckProtocol(lobbyID LobbyID, handshake ProtocolHandshake) *LobbyJoinError {
+	if handshake.IsCompatible() {
+		return nil
+	}
+	if lm.configuration.ProtocolMismatchPolicy == meta.PROTOCOL_MISMATCH_POLICY_COMPAT {
+		log.Printf("[protocol] Accepting incompatible client in compatibility mode: %s", handshake.describeMismatch())
+		return nil
+	}
+	return &LobbyJoinError{Reason: "Protocol mismatch: " + handshake.describeMismatch(), Type: JoinErrorProtocolMismatch, LobbyID: lobbyID}
+}
+
+// Tells a client accepted in compatibility mode what differs
+func sendProtocolMismatch(client *Client, handshake ProtocolHandshake) error {
+	serialized, err := Serialize(PROTOCOL_MISMATCH_EVENT, ProtocolMismatchMessageDTO{
+		ServerVersion:     PROTOCOL_VERSION,
+		ClientVersion:     handshake.Version,
+		ServerFingerprint: ProtocolFingerprint(),
+		ClientFingerprint: handshake.Fingerprint,
+	})
+	if err != nil {
+		return fmt.Errorf("error serializing protocol mismatch: %s", err.Error())
+	}
+	return SendMessageToClient(client, SERVER_ID, serialized)
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GustavBW/bsc-multiplayer-backend/src/meta"
+)
+
+func TestComputeProtocolFingerprint(t *testing.T) {
+	renamed := *PLAYER_JOINED_EVENT
+	renamed.Name = "PlayerArrived"
+	moved := *PLAYER_JOINED_EVENT
+	moved.Structure = append(ComputedStructure{}, moved.Structure...)
+	moved.Structure[0].Offset++
+	recommented := *PLAYER_JOINED_EVENT
+	recommented.Comment = "Something else entirely"
+
+	base := ComputeProtocolFingerprint(NewSpecMap(PLAYER_JOINED_EVENT, PLAYER_LEFT_EVENT))
+	if len(base) != 16 {
+		t.Errorf("Expected a fingerprint of 16 hex characters, got %q", base)
+	}
+
+	tests := []struct {
+		name     string
+		events   map[MessageID]*EventSpecification[any]
+		wantSame bool
+	}{
+		{"same events", NewSpecMap(PLAYER_JOINED_EVENT, PLAYER_LEFT_EVENT), true},
+		{"different comment", NewSpecMap(&recommented, PLAYER_LEFT_EVENT), true},
+		{"missing event", NewSpecMap(PLAYER_JOINED_EVENT), false},
+		{"additional event", NewSpecMap(PLAYER_JOINED_EVENT, PLAYER_LEFT_EVENT, LOBBY_CLOSING_EVENT), false},
+		{"different name", NewSpecMap(&renamed, PLAYER_LEFT_EVENT), false},
+		{"different offset", NewSpecMap(&moved, PLAYER_LEFT_EVENT), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Run a few times, as map iteration order differs between runs
+			for i := 0; i < 10; i++ {
+				if got := ComputeProtocolFingerprint(tt.events); (got == base) != tt.wantSame {
+					t.Fatalf("Expected same fingerprint: %v, got %s vs base %s", tt.wantSame, got, base)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckProtocol(t *testing.T) {
+	previous := protocolFingerprint
+	protocolFingerprint = "0123456789abcdef"
+	defer func() { protocolFingerprint = previous }()
+
+	tests := []struct {
+		name      string
+		policy    meta.ProtocolMismatchPolicy
+		handshake ProtocolHandshake
+		wantErr   bool
+	}{
+		{"undeclared", meta.PROTOCOL_MISMATCH_POLICY_REJECT, ProtocolHandshake{}, false},
+		{"matching", meta.PROTOCOL_MISMATCH_POLICY_REJECT, ProtocolHandshake{Version: PROTOCOL_VERSION, Fingerprint: "0123456789abcdef"}, false},
+		{"version only", meta.PROTOCOL_MISMATCH_POLICY_REJECT, ProtocolHandshake{Version: PROTOCOL_VERSION}, false},
+		{"other version", meta.PROTOCOL_MISMATCH_POLICY_REJECT, ProtocolHandshake{Version: PROTOCOL_VERSION + 1}, true},
+		{"other fingerprint", meta.PROTOCOL_MISMATCH_POLICY_REJECT, ProtocolHandshake{Fingerprint: "fedcba9876543210"}, true},
+		{"other fingerprint in compat mode", meta.PROTOCOL_MISMATCH_POLICY_COMPAT, ProtocolHandshake{Fingerprint: "fedcba9876543210"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *testConfiguration
+			config.ProtocolMismatchPolicy = tt.policy
+			lm := &LobbyManager{configuration: &config}
+
+			err := lm.CheckProtocol(1, tt.handshake)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && err.Type != JoinErrorProtocolMismatch {
+				t.Errorf("Expected protocol mismatch error, got %v", err.Type)
+			}
+		})
+	}
+}
+
+func TestJoinLobbySendsProtocolMismatchInCompatMode(t *testing.T) {
+	previous := protocolFingerprint
+	protocolFingerprint = "0123456789abcdef"
+	defer func() { protocolFingerprint = previous }()
+
+	config := *testConfiguration
+	config.ProtocolMismatchPolicy = meta.PROTOCOL_MISMATCH_POLICY_COMPAT
+	lm := CreateLobbyManager(&config, testMainBackend)
+	lobby, err := lm.CreateLobby(10, 1, meta.MESSAGE_ENCODING_BINARY, meta.OWNER_LEAVE_POLICY_CLOSE)
+	if err != nil {
+		t.Fatalf("Expected no error creating lobby, got %v", err)
+	}
+
+	handshake := ProtocolHandshake{Version: PROTOCOL_VERSION, Fingerprint: "fedcba9876543210"}
+	serverSide, clientSide := newTestConnPair(t)
+	// As a guest, as the lobby would otherwise close when the test closes the connection
+	if joinErr := lm.JoinLobby(lobby.ID, 20, "Guest", "", handshake, serverSide); joinErr != nil {
+		t.Fatalf("Expected to join, got %v", joinErr)
+	}
+
+	// Before anything else
+	clientSide.SetReadDeadline(time.Now().Add(time.Second))
+	_, first, err := clientSide.ReadMessage()
+	if err != nil {
+		t.Fatalf("Expected protocol mismatch, got %v", err)
+	}
+	_, eventID, remainder, err := SplitMessageHeader(first)
+	if err != nil || eventID != PROTOCOL_MISMATCH_EVENT.ID {
+		t.Fatalf("Expected the first message to be a protocol mismatch, got event %d (%v)", eventID, err)
+	}
+	mismatch, err := Deserialize(PROTOCOL_MISMATCH_EVENT, remainder, true)
+	if err != nil {
+		t.Fatalf("Expected protocol mismatch, got %v", err)
+	}
+	want := ProtocolMismatchMessageDTO{
+		ServerVersion:     PROTOCOL_VERSION,
+		ClientVersion:     PROTOCOL_VERSION,
+		ServerFingerprint: "0123456789abcdef",
+		ClientFingerprint: "fedcba9876543210",
+	}
+	if *mismatch != want {
+		t.Errorf("Expected %+v, got %+v", want, *mismatch)
+	}
+}
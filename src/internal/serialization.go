@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"math"
@@ -11,7 +12,22 @@ import (
 
 // Serializes the provided data according to the specification
 // Includes the event id part of the header prefixed (i.e. only needs the sender id to be appended before sending)
+//
+// Uses the generated codec of T if there is one (see codecs_generated.go), and reflection otherwise
 func Serialize[T any](spec *EventSpecification[T], data T) ([]byte, error) {
+	if marshaler, ok := any(data).(encoding.BinaryMarshaler); ok {
+		body, err := marshaler.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		message := make([]byte, 0, len(spec.IDBytes)+len(body))
+		message = append(message, spec.IDBytes...)
+		return append(message, body...), nil
+	}
+	return serializeReflective(spec, data)
+}
+
+func serializeReflective[T any](spec *EventSpecification[T], data T) ([]byte, error) {
 	// Calculate the exact size needed
 	messageSize, err := ComputeMessageSize(spec, data)
 	if err != nil {
@@ -40,14 +56,10 @@ func Serialize[T any](spec *EventSpecification[T], data T) ([]byte, error) {
 	buffer := make([]byte, 8)
 
 	// Serialize fields according to spec
-	for _, element := range spec.Structure {
-		field, _ := util.FindFieldByJSONTagValue(v, element.FieldName)
-		// We don't need to check found because we already validated in ComputeMessageSize
-
-		message, err = appendValue(message, buffer, field)
-		if err != nil {
-			return nil, fmt.Errorf("field '%s': %s", element.FieldName, err.Error())
-		}
+	// We don't need to check that the fields are found because we already validated in ComputeMessageSize
+	message, err = appendStruct(message, buffer, spec.Structure, v)
+	if err != nil {
+		return nil, err
 	}
 
 	return message, nil
@@ -64,9 +76,13 @@ func ComputeMessageSize[T any](spec *EventSpecification[T], data T) (uint32, err
 	if v.Kind() != reflect.Struct {
 		return 0, fmt.Errorf("expected a struct, got %s", v.Kind())
 	}
+	return sizeOfStruct(spec.Structure, v)
+}
+
+func sizeOfStruct(structure ComputedStructure, v reflect.Value) (uint32, error) {
 	var size uint32 = 0
 	// Go through spec structure to calculate size
-	for i, element := range spec.Structure {
+	for i, element := range structure {
 		// Find field by JSON tag name
 		field, found := util.FindFieldByJSONTagValue(v, element.FieldName)
 		if !found {
@@ -78,27 +94,103 @@ func ComputeMessageSize[T any](spec *EventSpecification[T], data T) (uint32, err
 				element.FieldName, element.Kind, field.Kind())
 		}
 
-		if element.ByteSize == 0 {
-			// Variable size field (currently only strings)
-			if element.Kind != reflect.String {
-				return 0, fmt.Errorf("unsupported variable size field type: %s", element.Kind)
-			}
-			// Variable size fields must be at the end
-			if i != len(spec.Structure)-1 {
+		if !element.IsVariableSize() {
+			// Fixed size field
+			size += element.ByteSize
+			continue
+		}
+
+		switch element.Kind {
+		case reflect.String:
+			// Unprefixed strings must be at the end
+			if element.LengthPrefix == LENGTH_PREFIX_NONE && i != len(structure)-1 {
 				return 0, fmt.Errorf("variable size field '%s' must be the last field",
 					element.FieldName)
 			}
-			// Add string length
-			size += uint32(len(field.String()))
-		} else {
-			// Fixed size field
-			size += element.ByteSize
+			size += uint32(element.LengthPrefix) + uint32(len(field.String()))
+		case reflect.Slice:
+			size += uint32(element.LengthPrefix)
+			if element.ElementKind != reflect.Struct {
+				size += uint32(field.Len()) * util.SizeOfSerializedKind(element.ElementKind)
+				continue
+			}
+			for j := 0; j < field.Len(); j++ {
+				elementSize, err := sizeOfStruct(element.Elements, field.Index(j))
+				if err != nil {
+					return 0, fmt.Errorf("field '%s' element %d: %s", element.FieldName, j, err.Error())
+				}
+				size += elementSize
+			}
+		default:
+			return 0, fmt.Errorf("unsupported variable size field type: %s", element.Kind)
 		}
 	}
 
 	return size, nil
 }
 
+// Appends each element of the structure in order
+func appendStruct(message []byte, buffer []byte, structure ComputedStructure, v reflect.Value) ([]byte, error) {
+	for _, element := range structure {
+		field, _ := util.FindFieldByJSONTagValue(v, element.FieldName)
+
+		var err error
+		message, err = appendElement(message, buffer, element, field)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %s", element.FieldName, err.Error())
+		}
+	}
+	return message, nil
+}
+
+func appendElement(message []byte, buffer []byte, element MessageElementDescriptor, value reflect.Value) ([]byte, error) {
+	switch element.Kind {
+	case reflect.String:
+		message, err := appendLengthPrefix(message, buffer, element.LengthPrefix, len(value.String()))
+		if err != nil {
+			return nil, err
+		}
+		return append(message, []byte(value.String())...), nil
+
+	case reflect.Slice:
+		message, err := appendLengthPrefix(message, buffer, element.LengthPrefix, value.Len())
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < value.Len(); i++ {
+			if element.ElementKind == reflect.Struct {
+				message, err = appendStruct(message, buffer, element.Elements, value.Index(i))
+			} else {
+				message, err = appendValue(message, buffer, value.Index(i))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %s", i, err.Error())
+			}
+		}
+		return message, nil
+
+	default:
+		return appendValue(message, buffer, value)
+	}
+}
+
+func appendLengthPrefix(message []byte, buffer []byte, prefix LengthPrefix, length int) ([]byte, error) {
+	if prefix == LENGTH_PREFIX_NONE {
+		return message, nil
+	}
+	if uint64(length) > prefix.MaxLength() {
+		return nil, fmt.Errorf("length %d exceeds the max %d of a %s length prefix", length, prefix.MaxLength(), prefix)
+	}
+	switch prefix {
+	case LENGTH_PREFIX_U16:
+		binary.BigEndian.PutUint16(buffer, uint16(length))
+		return append(message, buffer[:2]...), nil
+	default:
+		binary.BigEndian.PutUint32(buffer, uint32(length))
+		return append(message, buffer[:4]...), nil
+	}
+}
+
 func appendValue(message []byte, buffer []byte, value reflect.Value) ([]byte, error) {
 	switch value.Kind() {
 	case reflect.Uint8:
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"syscall"
 
+	"github.com/GustavBW/bsc-multiplayer-backend/src/auth"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/config"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/integrations"
 	"github.com/GustavBW/bsc-multiplayer-backend/src/internal"
@@ -30,30 +31,28 @@ func main() {
 		panic(envErr)
 	}
 	log.Println("[main] Configuration loaded: ", runtimeConfiguration.ToString())
-	port, portErr := config.GetInt("MAIN_BACKEND_PORT")
-	if portErr != nil {
-		panic("Error getting MAIN_BACKEND_PORT" + portErr.Error())
-	}
-	host, hostErr := config.LoudGet("MAIN_BACKEND_HOST")
-	if hostErr != nil {
-		panic("Error getting MAIN_BACKEND_HOST" + hostErr.Error())
+	mainBackend := setupMainBackend(runtimeConfiguration)
+	internal.SetServerID(SERVER_ID, SERVER_ID_BYTES)
+
+	joinTokenSecret, secretErr := config.LoudGet("JOIN_TOKEN_SECRET")
+	if secretErr != nil {
+		panic("Error getting JOIN_TOKEN_SECRET" + secretErr.Error())
 	}
-	// Initializing the singleton
-	_, mbErr := integrations.InitializeMainBackendIntegration(host, port)
-	if mbErr != nil {
-		panic(mbErr)
+	tokenSigner, signerErr := auth.NewJoinTokenSigner([]byte(joinTokenSecret))
+	if signerErr != nil {
+		panic(signerErr)
 	}
-	internal.SetServerID(SERVER_ID, SERVER_ID_BYTES)
 
-	lobbyManager := internal.CreateLobbyManager(runtimeConfiguration)
+	lobbyManager := internal.CreateLobbyManager(runtimeConfiguration, mainBackend)
 
 	// Create a new ServeMux
 	mux := http.NewServeMux()
 
-	applyPublicApi(mux, lobbyManager)
+	applyPublicApi(mux, lobbyManager, tokenSigner)
 	if runtimeConfiguration.Mode == meta.RUNTIME_MODE_DEV {
 		applyDevAPI(mux, lobbyManager)
 	}
+	setupAdminAPI(mux, lobbyManager)
 
 	go startServer(mux)
 
@@ -87,6 +86,71 @@ func startServer(mux *http.ServeMux) {
 
 }
 
+// MAIN_BACKEND_MODE=fake serves fixtures in process instead of calling the main backend, and is refused in prod
+func setupMainBackend(runtimeConfiguration *meta.RuntimeConfiguration) integrations.MainBackend {
+	mode, modeErr := integrations.ParseMainBackendMode(config.GetOr("MAIN_BACKEND_MODE", ""))
+	if modeErr != nil {
+		panic("Error parsing MAIN_BACKEND_MODE: " + modeErr.Error())
+	}
+	if mode == integrations.MAIN_BACKEND_MODE_FAKE {
+		if runtimeConfiguration.Mode == meta.RUNTIME_MODE_PROD {
+			panic("MAIN_BACKEND_MODE=fake is not allowed in prod")
+		}
+		fixturesPath := config.GetOr("MAIN_BACKEND_FIXTURES_PATH", "fixtures/mainBackend.json")
+		fake, fakeErr := integrations.LoadFakeMainBackend(fixturesPath)
+		if fakeErr != nil {
+			panic(fakeErr)
+		}
+		log.Println("[main] Using fake main backend with fixtures from " + fixturesPath)
+		return fake
+	}
+
+	port, portErr := config.GetInt("MAIN_BACKEND_PORT")
+	if portErr != nil {
+		panic("Error getting MAIN_BACKEND_PORT" + portErr.Error())
+	}
+	host, hostErr := config.LoudGet("MAIN_BACKEND_HOST")
+	if hostErr != nil {
+		panic("Error getting MAIN_BACKEND_HOST" + hostErr.Error())
+	}
+	options, optionsErr := config.GetMainBackendOptions()
+	if optionsErr != nil {
+		panic(optionsErr)
+	}
+	return integrations.NewMainBackendIntegration(host, port, options)
+}
+
+// The admin API is only enabled if ADMIN_TOKEN is set. If ADMIN_PORT is set, it is served on that port only
+func setupAdminAPI(publicMux *http.ServeMux, lobbyManager *internal.LobbyManager) {
+	adminToken := config.GetOr("ADMIN_TOKEN", "")
+	if adminToken == "" {
+		log.Println("[main] ADMIN_TOKEN not set, admin API disabled")
+		return
+	}
+	auditLog, auditErr := openAuditLog(config.GetOr("ADMIN_AUDIT_LOG_PATH", "admin-audit.log"))
+	if auditErr != nil {
+		panic("Error opening admin audit log: " + auditErr.Error())
+	}
+
+	adminPortStr := config.GetOr("ADMIN_PORT", "")
+	if adminPortStr == "" {
+		applyAdminAPI(publicMux, lobbyManager, adminToken, auditLog)
+		return
+	}
+	adminPort, portErr := strconv.Atoi(adminPortStr)
+	if portErr != nil {
+		panic("Error parsing ADMIN_PORT: " + portErr.Error())
+	}
+	adminMux := http.NewServeMux()
+	applyAdminAPI(adminMux, lobbyManager, adminToken, auditLog)
+	go func() {
+		log.Println("[server] Admin server starting on :" + strconv.Itoa(adminPort))
+		if serverErr := http.ListenAndServe(":"+strconv.Itoa(adminPort), adminMux); serverErr != nil {
+			log.Printf("[server] Admin server error: %v", serverErr)
+		}
+	}()
+}
+
 // Blocks
 func awaitSysShutdown() {
 	// Create a channel to listen for OS signals
@@ -1,5 +1,10 @@
 package meta
 
+import (
+	"fmt"
+	"time"
+)
+
 type RuntimeMode string
 
 const (
@@ -16,18 +21,147 @@ const (
 	MESSAGE_ENCODING_BINARY MessageEncoding = "binary"
 )
 
+// What to do with a client whose outbound queue overflows
+type SlowConsumerPolicy string
+
+const (
+	// Remove the client from the lobby
+	SLOW_CONSUMER_POLICY_DISCONNECT SlowConsumerPolicy = "disconnect"
+	// Drop the messages that don't fit, but keep the client
+	SLOW_CONSUMER_POLICY_DROP SlowConsumerPolicy = "drop"
+)
+
+func ParseMessageEncoding(s string) (MessageEncoding, error) {
+	switch encoding := MessageEncoding(s); encoding {
+	case MESSAGE_ENCODING_BINARY, MESSAGE_ENCODING_BASE16, MESSAGE_ENCODING_BASE64:
+		return encoding, nil
+	default:
+		return "", fmt.Errorf("invalid encoding \"%s\", expected \"binary|base16|base64\"", s)
+	}
+}
+
+// What happens to a lobby when its owner leaves
+type OwnerLeavePolicy string
+
+const (
+	// Close the lobby and the colony
+	OWNER_LEAVE_POLICY_CLOSE OwnerLeavePolicy = "close"
+	// Promote the longest connected guest to owner, closing only if there are no guests left
+	OWNER_LEAVE_POLICY_MIGRATE OwnerLeavePolicy = "migrate"
+)
+
+func ParseOwnerLeavePolicy(s string) (OwnerLeavePolicy, error) {
+	switch policy := OwnerLeavePolicy(s); policy {
+	case OWNER_LEAVE_POLICY_CLOSE, OWNER_LEAVE_POLICY_MIGRATE:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid owner leave policy \"%s\", expected \"close|migrate\"", s)
+	}
+}
+
+// What happens to participants that don't declare ready or finish loading before the deadline of the phase
+type LaggardPolicy string
+
+const (
+	// Continue the minigame sequence without the laggards
+	LAGGARD_POLICY_DROP LaggardPolicy = "drop"
+	// Abort the minigame sequence for everyone
+	LAGGARD_POLICY_ABORT LaggardPolicy = "abort"
+)
+
+func ParseLaggardPolicy(s string) (LaggardPolicy, error) {
+	switch policy := LaggardPolicy(s); policy {
+	case LAGGARD_POLICY_DROP, LAGGARD_POLICY_ABORT:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid laggard policy \"%s\", expected \"drop|abort\"", s)
+	}
+}
+
+// What happens to clients connecting with a protocol version or spec fingerprint other than that of the server
+type ProtocolMismatchPolicy string
+
+const (
+	// Refuse the connection
+	PROTOCOL_MISMATCH_POLICY_REJECT ProtocolMismatchPolicy = "reject"
+	// Accept the connection, and tell the client what differs through a ProtocolMismatch event
+	PROTOCOL_MISMATCH_POLICY_COMPAT ProtocolMismatchPolicy = "compat"
+)
+
+func ParseProtocolMismatchPolicy(s string) (ProtocolMismatchPolicy, error) {
+	switch policy := ProtocolMismatchPolicy(s); policy {
+	case PROTOCOL_MISMATCH_POLICY_REJECT, PROTOCOL_MISMATCH_POLICY_COMPAT:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid protocol mismatch policy \"%s\", expected \"reject|compat\"", s)
+	}
+}
+
 type RuntimeConfiguration struct {
 	Mode     RuntimeMode
 	Encoding MessageEncoding
+	// How long a client with a dropped connection is kept around, waiting for it to resume its session.
+	// 0 disables session resumption
+	SessionResumeGracePeriod time.Duration
+	// Max number of server events buffered for a suspended client. Overflowing ends the session early
+	SessionResumeBufferSize uint32
+	// Max number of messages queued for any one client before it is concidered a slow consumer
+	ClientSendQueueSize uint32
+	// Max time a single write to a client may take
+	ClientWriteTimeout time.Duration
+	SlowConsumerPolicy SlowConsumerPolicy
+	// How often the server pings each client
+	ClientPingInterval time.Duration
+	// Max time without a pong (or any other message) before the connection is concidered dead
+	ClientPongTimeout time.Duration
+	// Max time without any message processed from a client before it is evicted, given it also stopped answering pings
+	ClientIdleTimeout time.Duration
+	// Default for lobbies that don't specify their own
+	OwnerLeavePolicy OwnerLeavePolicy
+	// Max time to wait for players to join or abort the activity. Non-responders are treated as opted out. 0 waits forever
+	AwaitingParticipantsTimeout time.Duration
+	// Max time to wait for participants to declare ready. 0 waits forever
+	PlayersDeclareIntentTimeout time.Duration
+	// Max time to wait for participants to finish loading the minigame. 0 waits forever
+	LoadingMinigameTimeout time.Duration
+	// Applies to participants that haven't declared ready or finished loading in time
+	LaggardPolicy LaggardPolicy
+	// Applies to clients connecting with another protocol version or spec fingerprint than the server
+	ProtocolMismatchPolicy ProtocolMismatchPolicy
+	// Max time a call to the main backend made on behalf of a lobby may take, retries included
+	MainBackendCallTimeout time.Duration
 }
 
 func (rc *RuntimeConfiguration) ToString() string {
-	return "mode: " + string(rc.Mode) + " encoding: " + string(rc.Encoding)
+	return "mode: " + string(rc.Mode) + " encoding: " + string(rc.Encoding) +
+		fmt.Sprintf(" session resume grace period: %s (buffer size %d)", rc.SessionResumeGracePeriod, rc.SessionResumeBufferSize) +
+		fmt.Sprintf(" client send queue size: %d write timeout: %s slow consumer policy: %s", rc.ClientSendQueueSize, rc.ClientWriteTimeout, rc.SlowConsumerPolicy) +
+		fmt.Sprintf(" client ping interval: %s pong timeout: %s idle timeout: %s", rc.ClientPingInterval, rc.ClientPongTimeout, rc.ClientIdleTimeout) +
+		" owner leave policy: " + string(rc.OwnerLeavePolicy) +
+		fmt.Sprintf(" phase timeouts: awaiting participants %s declare intent %s loading minigame %s", rc.AwaitingParticipantsTimeout, rc.PlayersDeclareIntentTimeout, rc.LoadingMinigameTimeout) +
+		" laggard policy: " + string(rc.LaggardPolicy) +
+		" protocol mismatch policy: " + string(rc.ProtocolMismatchPolicy) +
+		fmt.Sprintf(" main backend call timeout: %s", rc.MainBackendCallTimeout)
 }
 
 func NewRuntimeConfiguration(mode RuntimeMode, encoding MessageEncoding) *RuntimeConfiguration {
 	return &RuntimeConfiguration{
-		Mode:     mode,
-		Encoding: encoding,
+		Mode:                        mode,
+		Encoding:                    encoding,
+		SessionResumeGracePeriod:    15 * time.Second,
+		SessionResumeBufferSize:     256,
+		ClientSendQueueSize:         256,
+		ClientWriteTimeout:          5 * time.Second,
+		SlowConsumerPolicy:          SLOW_CONSUMER_POLICY_DISCONNECT,
+		ClientPingInterval:          10 * time.Second,
+		ClientPongTimeout:           30 * time.Second,
+		ClientIdleTimeout:           60 * time.Second,
+		OwnerLeavePolicy:            OWNER_LEAVE_POLICY_CLOSE,
+		AwaitingParticipantsTimeout: 30 * time.Second,
+		PlayersDeclareIntentTimeout: 30 * time.Second,
+		LoadingMinigameTimeout:      60 * time.Second,
+		LaggardPolicy:               LAGGARD_POLICY_DROP,
+		ProtocolMismatchPolicy:      PROTOCOL_MISMATCH_POLICY_REJECT,
+		MainBackendCallTimeout:      10 * time.Second,
 	}
 }
@@ -0,0 +1,338 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Minimal, dependency free, metrics registry writing the Prometheus text exposition format (version 0.0.4).
+//
+// Metrics are registered once, typically as package level vars, and are threadsafe to update from anywhere.
+type Registry struct {
+	lock    sync.Mutex
+	metrics []metric
+}
+
+// The registry exposed on /metrics
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type metric interface {
+	describe() (name string, help string, kind string)
+	writeSeries(w io.Writer) error
+}
+
+func (r *Registry) register(m metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Writes all metrics in the Prometheus text format, sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.Lock()
+	metrics := make([]metric, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.lock.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		nameI, _, _ := metrics[i].describe()
+		nameJ, _, _ := metrics[j].describe()
+		return nameI < nameJ
+	})
+	for _, m := range metrics {
+		name, help, kind := m.describe()
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind); err != nil {
+			return err
+		}
+		if err := m.writeSeries(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Serves the registry. Any onScrape functions are run first, to update metrics which are only computed on demand
+func (r *Registry) Handler(onScrape ...func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, f := range onScrape {
+			f()
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		r.WriteText(w)
+	})
+}
+
+// Common to all metric types. Holds one series per distinct combination of label values
+type family[S any] struct {
+	name       string
+	help       string
+	labelNames []string
+	lock       sync.RWMutex
+	series     map[string]*labelledSeries[S]
+	newSeries  func() *S
+}
+
+type labelledSeries[S any] struct {
+	labelValues []string
+	value       *S
+}
+
+func newFamily[S any](name string, help string, labelNames []string, newSeries func() *S) family[S] {
+	return family[S]{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]*labelledSeries[S]),
+		newSeries:  newSeries,
+	}
+}
+
+func (f *family[S]) keyOf(labelValues []string) string {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (f *family[S]) with(labelValues []string) *S {
+	key := f.keyOf(labelValues)
+	f.lock.RLock()
+	existing, exists := f.series[key]
+	f.lock.RUnlock()
+	if exists {
+		return existing.value
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if existing, exists := f.series[key]; exists {
+		return existing.value
+	}
+	created := &labelledSeries[S]{labelValues: append([]string{}, labelValues...), value: f.newSeries()}
+	f.series[key] = created
+	return created.value
+}
+
+// Sorted by label values, for stable output
+func (f *family[S]) sortedSeries() []*labelledSeries[S] {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*labelledSeries[S], 0, len(keys))
+	for _, key := range keys {
+		result = append(result, f.series[key])
+	}
+	return result
+}
+
+// Removes all series, for metrics where label values may disappear, fx. per lobby
+func (f *family[S]) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.series = make(map[string]*labelledSeries[S])
+}
+
+// Monotonically increasing count
+type Counter struct {
+	family[atomic.Uint64]
+}
+
+func (r *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+	counter := &Counter{newFamily(name, help, labelNames, func() *atomic.Uint64 { return &atomic.Uint64{} })}
+	r.register(counter)
+	return counter
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta uint64, labelValues ...string) {
+	c.with(labelValues).Add(delta)
+}
+
+func (c *Counter) describe() (string, string, string) {
+	return c.name, c.help, "counter"
+}
+
+func (c *Counter) writeSeries(w io.Writer) error {
+	for _, s := range c.sortedSeries() {
+		if _, err := fmt.Fprintf(w, "%s%s %d\n", c.name, formatLabels(c.labelNames, s.labelValues), s.value.Load()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Value that may go up and down
+type Gauge struct {
+	family[atomic.Uint64] // float64 bits
+}
+
+func (r *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{newFamily(name, help, labelNames, func() *atomic.Uint64 { return &atomic.Uint64{} })}
+	r.register(gauge)
+	return gauge
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.with(labelValues).Store(math.Float64bits(value))
+}
+
+// A value of a gauge, by the label values of its series
+type GaugeSeries struct {
+	Value       float64
+	LabelValues []string
+}
+
+// Replaces all series with those given at once, for metrics where label values may disappear, fx. per lobby.
+// Unlike Reset followed by Set, a concurrent scrape never sees the gauge partially filled
+func (g *Gauge) Replace(series []GaugeSeries) {
+	replacement := make(map[string]*labelledSeries[atomic.Uint64], len(series))
+	for _, s := range series {
+		value := &atomic.Uint64{}
+		value.Store(math.Float64bits(s.Value))
+		replacement[g.keyOf(s.LabelValues)] = &labelledSeries[atomic.Uint64]{labelValues: append([]string{}, s.LabelValues...), value: value}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.series = replacement
+}
+
+func (g *Gauge) describe() (string, string, string) {
+	return g.name, g.help, "gauge"
+}
+
+func (g *Gauge) writeSeries(w io.Writer) error {
+	for _, s := range g.sortedSeries() {
+		value := math.Float64frombits(s.value.Load())
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labelNames, s.labelValues), formatFloat(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Latency buckets in seconds, from 5ms to 10s
+var DEFAULT_LATENCY_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogramSeries struct {
+	lock sync.Mutex
+	// Non-cumulative count per bucket. The last entry is the +Inf bucket
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Distribution of observed values over a fixed set of buckets
+type Histogram struct {
+	family[histogramSeries]
+	buckets []float64
+}
+
+// The buckets must be sorted ascending
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	histogram := &Histogram{buckets: buckets}
+	histogram.family = newFamily(name, help, labelNames, func() *histogramSeries {
+		return &histogramSeries{counts: make([]uint64, len(buckets)+1)}
+	})
+	r.register(histogram)
+	return histogram
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	series := h.with(labelValues)
+	index := sort.SearchFloat64s(h.buckets, value)
+	series.lock.Lock()
+	defer series.lock.Unlock()
+	series.counts[index]++
+	series.sum += value
+	series.count++
+}
+
+func (h *Histogram) describe() (string, string, string) {
+	return h.name, h.help, "histogram"
+}
+
+func (h *Histogram) writeSeries(w io.Writer) error {
+	bucketLabelNames := append(append([]string{}, h.labelNames...), "le")
+	for _, s := range h.sortedSeries() {
+		s.value.lock.Lock()
+		counts := append([]uint64{}, s.value.counts...)
+		sum, count := s.value.sum, s.value.count
+		s.value.lock.Unlock()
+
+		var cumulative uint64
+		for i, upperBound := range append(append([]float64{}, h.buckets...), math.Inf(1)) {
+			cumulative += counts[i]
+			labels := formatLabels(bucketLabelNames, append(append([]string{}, s.labelValues...), formatFloat(upperBound)))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, cumulative); err != nil {
+				return err
+			}
+		}
+		labels := formatLabels(h.labelNames, s.labelValues)
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", h.name, labels, formatFloat(sum), h.name, labels, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(name)
+		builder.WriteString("=\"")
+		builder.WriteString(escapeLabelValue(values[i]))
+		builder.WriteByte('"')
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
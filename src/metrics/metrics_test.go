@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_messages_total", "Messages received", "event")
+	gauge := registry.NewGauge("test_lobbies_active", "Active lobbies")
+	histogram := registry.NewHistogram("test_latency_seconds", "Call latency", []float64{0.1, 1}, "method")
+
+	counter.Inc("PlayerMove")
+	counter.Add(2, "PlayerMove")
+	counter.Inc(`Quote"And\Backslash`)
+	gauge.Set(3)
+	histogram.Observe(0.05, "CloseColony")
+	histogram.Observe(0.5, "CloseColony")
+	histogram.Observe(5, "CloseColony")
+
+	var builder strings.Builder
+	if err := registry.WriteText(&builder); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `# HELP test_latency_seconds Call latency
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{method="CloseColony",le="0.1"} 1
+test_latency_seconds_bucket{method="CloseColony",le="1"} 2
+test_latency_seconds_bucket{method="CloseColony",le="+Inf"} 3
+test_latency_seconds_sum{method="CloseColony"} 5.55
+test_latency_seconds_count{method="CloseColony"} 3
+# HELP test_lobbies_active Active lobbies
+# TYPE test_lobbies_active gauge
+test_lobbies_active 3
+# HELP test_messages_total Messages received
+# TYPE test_messages_total counter
+test_messages_total{event="PlayerMove"} 3
+test_messages_total{event="Quote\"And\\Backslash"} 1
+`
+	if builder.String() != expected {
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", expected, builder.String())
+	}
+}
+
+func TestGaugeReset(t *testing.T) {
+	registry := NewRegistry()
+	gauge := registry.NewGauge("test_queue_depth", "Queue depth", "lobby")
+	gauge.Set(1, "1")
+	gauge.Reset()
+	gauge.Set(2, "2")
+
+	var builder strings.Builder
+	registry.WriteText(&builder)
+	if strings.Contains(builder.String(), `lobby="1"`) {
+		t.Errorf("Expected reset series to be gone, got:\n%s", builder.String())
+	}
+	if !strings.Contains(builder.String(), `test_queue_depth{lobby="2"} 2`) {
+		t.Errorf("Expected new series to be present, got:\n%s", builder.String())
+	}
+}
+
+func TestGaugeReplace(t *testing.T) {
+	registry := NewRegistry()
+	gauge := registry.NewGauge("test_queue_depth", "Queue depth", "lobby")
+	gauge.Set(1, "1")
+	gauge.Set(1, "2")
+	gauge.Replace([]GaugeSeries{{Value: 3, LabelValues: []string{"2"}}, {Value: 4, LabelValues: []string{"3"}}})
+
+	var builder strings.Builder
+	registry.WriteText(&builder)
+	if strings.Contains(builder.String(), `lobby="1"`) {
+		t.Errorf("Expected replaced series to be gone, got:\n%s", builder.String())
+	}
+	for _, want := range []string{`test_queue_depth{lobby="2"} 3`, `test_queue_depth{lobby="3"} 4`} {
+		if !strings.Contains(builder.String(), want) {
+			t.Errorf("Expected %s, got:\n%s", want, builder.String())
+		}
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_total", "Test", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic on wrong label count")
+		}
+	}()
+	counter.Inc("only one")
+}
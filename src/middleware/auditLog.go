@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// A single administrative action, written as one line of JSON
+type AuditEntry struct {
+	Time       time.Time         `json:"time"`
+	RemoteAddr string            `json:"remoteAddr"`
+	Action     string            `json:"action"`
+	Params     map[string]string `json:"params,omitempty"`
+	Status     int               `json:"status"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Append-only log of administrative actions. Threadsafe
+type AuditLog struct {
+	lock   sync.Mutex
+	output io.Writer
+}
+
+func NewAuditLog(output io.Writer) *AuditLog {
+	return &AuditLog{output: output}
+}
+
+// Writes the entry as a JSON line. Failing to write is logged, but never stops the action itself
+func (a *AuditLog) Record(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[audit] Error marshalling audit entry for action %s: %v", entry.Action, err)
+		return
+	}
+	log.Printf("[audit] %s", bytes)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if _, err := a.output.Write(append(bytes, '\n')); err != nil {
+		log.Printf("[audit] Error writing audit entry for action %s: %v", entry.Action, err)
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAuditLogWritesJSONLines(t *testing.T) {
+	var output bytes.Buffer
+	auditLog := NewAuditLog(&output)
+
+	auditLog.Record(AuditEntry{Action: "KickClient", Params: map[string]string{"lobbyID": "2"}, Status: 200})
+	auditLog.Record(AuditEntry{Action: "ForceCloseLobby", Status: 404, Error: "lobby not found"})
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), output.String())
+	}
+
+	var first AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Unexpected error unmarshalling line: %v", err)
+	}
+	if first.Action != "KickClient" || first.Params["lobbyID"] != "2" || first.Status != 200 {
+		t.Errorf("Entry does not match. Got: %+v", first)
+	}
+	if first.Time.IsZero() {
+		t.Error("Expected time to be set")
+	}
+
+	var second AuditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("Unexpected error unmarshalling line: %v", err)
+	}
+	if second.Error != "lobby not found" {
+		t.Errorf("Expected error to be recorded, got %+v", second)
+	}
+}
@@ -27,13 +27,29 @@ var SymbolSets = symbols{
 	},
 }
 
+// Source of randomness of char pools. Satisfied by *rand.Rand of both math/rand and math/rand/v2
+type Shuffler interface {
+	Shuffle(n int, swap func(i, j int))
+}
+
+type globalShuffler struct{}
+
+func (globalShuffler) Shuffle(n int, swap func(i, j int)) {
+	rand.Shuffle(n, swap)
+}
+
 func NewCharCodePool(initialSize uint32, charCodeLength uint32, runes []rune) (*CharCodePool, error) {
+	return NewCharCodePoolFrom(initialSize, charCodeLength, runes, globalShuffler{})
+}
+
+// Same as NewCharCodePool, drawing randomness from the shuffler given. The same seeded shuffler gives the same codes
+func NewCharCodePoolFrom(initialSize uint32, charCodeLength uint32, runes []rune, shuffler Shuffler) (*CharCodePool, error) {
 	var possiblePermutations = math.Pow(float64(len(runes)), float64(charCodeLength))
 	if possiblePermutations < float64(initialSize) {
 		return nil, fmt.Errorf("initialSize %d is larger than the number of possible permutations %f", initialSize, possiblePermutations)
 	}
 
-	charPool := NewCharPool(runes)
+	charPool := NewCharPoolFrom(runes, shuffler)
 	codePool := &CharCodePool{
 		codeLength: charCodeLength,
 		charPool:   charPool,
@@ -102,18 +118,23 @@ func (ccp *CharCodePool) Reintroduce(pe *PoolEntry[[]rune]) {
 }
 
 func NewCharPool(runes []rune) *CharPool {
+	return NewCharPoolFrom(runes, globalShuffler{})
+}
+
+func NewCharPoolFrom(runes []rune, shuffler Shuffler) *CharPool {
 	//Allocate shared symbols array
 	var symbols = make([]rune, len(runes))
 	copy(symbols, runes)
 
 	//Shuffle symbols
-	rand.Shuffle(len(symbols), func(i, j int) {
+	shuffler.Shuffle(len(symbols), func(i, j int) {
 		symbols[i], symbols[j] = symbols[j], symbols[i]
 	})
 
 	return &CharPool{
 		indexPointer: 0,
 		symbols:      symbols,
+		shuffler:     shuffler,
 	}
 }
 
@@ -126,13 +147,14 @@ type CharPool struct {
 	sync.Mutex
 	indexPointer uint32
 	symbols      []rune
+	shuffler     Shuffler
 }
 
 func (cp *CharPool) GetNextChar() rune {
 	cp.Lock()
 	defer cp.Unlock()
 	if cp.indexPointer >= uint32(len(cp.symbols)) {
-		rand.Shuffle(len(cp.symbols), func(i, j int) {
+		cp.shuffler.Shuffle(len(cp.symbols), func(i, j int) {
 			cp.symbols[i], cp.symbols[j] = cp.symbols[j], cp.symbols[i]
 		})
 		cp.indexPointer = 0
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// Source of time, such that anything timed may also run on virtual time
+type Clock interface {
+	Now() time.Time
+	NewTicker(interval time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// The wall clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(interval time.Duration) Ticker {
+	return &systemTicker{ticker: time.NewTicker(interval)}
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// Threadsafe
+//
+// Clock which only moves when told to. Tickers fire as time is advanced past their next tick,
+// and like those of the time package, drop ticks that aren't received in time
+type ManualClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) NewTicker(interval time.Duration) Ticker {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ticker := &manualTicker{
+		clock:    c,
+		interval: interval,
+		next:     c.now.Add(interval),
+		c:        make(chan time.Time, 1),
+	}
+	c.tickers = append(c.tickers, ticker)
+	return ticker
+}
+
+// Moves time forward, firing any tickers due in the meantime
+func (c *ManualClock) Advance(duration time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(duration)
+	for _, ticker := range c.tickers {
+		for !ticker.next.After(c.now) {
+			select {
+			case ticker.c <- ticker.next:
+			default:
+			}
+			ticker.next = ticker.next.Add(ticker.interval)
+		}
+	}
+}
+
+type manualTicker struct {
+	clock    *ManualClock
+	interval time.Duration
+	next     time.Time
+	c        chan time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
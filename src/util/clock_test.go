@@ -0,0 +1,50 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockAdvance(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewManualClock(start)
+	ticker := clock.NewTicker(100 * time.Millisecond)
+
+	clock.Advance(50 * time.Millisecond)
+	select {
+	case <-ticker.C():
+		t.Fatal("Expected no tick before the interval has passed")
+	default:
+	}
+
+	clock.Advance(50 * time.Millisecond)
+	select {
+	case tick := <-ticker.C():
+		if want := start.Add(100 * time.Millisecond); !tick.Equal(want) {
+			t.Errorf("Expected tick at %v, got %v", want, tick)
+		}
+	default:
+		t.Fatal("Expected a tick once the interval has passed")
+	}
+
+	// Ticks not received in time are dropped, like those of time.Ticker
+	clock.Advance(time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Error("Expected missed ticks to be dropped")
+	default:
+	}
+
+	ticker.Stop()
+	clock.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Error("Expected no tick after stopping the ticker")
+	default:
+	}
+
+	if now := clock.Now(); !now.Equal(start.Add(2100 * time.Millisecond)) {
+		t.Errorf("Expected clock at %v, got %v", start.Add(2100*time.Millisecond), now)
+	}
+}